@@ -0,0 +1,352 @@
+package goauth
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// PasswordResetEndpoint is the endpoint at which users request and complete password resets.
+	PasswordResetEndpoint = "/password_reset"
+	// EmailVerificationEndpoint is the endpoint at which users verify their email address.
+	EmailVerificationEndpoint = "/verify_email"
+
+	// ParamToken is the parameter containing verification codes in the links sent to users and the token
+	// sent to the introspection endpoint.
+	ParamToken = "token"
+)
+
+var (
+	// DefaultPasswordResetExpiry is the default expiry of password reset codes.
+	DefaultPasswordResetExpiry = time.Hour
+	// DefaultEmailVerificationExpiry is the default expiry of email verification codes.
+	DefaultEmailVerificationExpiry = 24 * time.Hour
+	// DefaultMinPasswordLength is the default minimum length of passwords set using the password reset
+	// flow.
+	DefaultMinPasswordLength = 8
+
+	DefaultPasswordResetTemplate = template.Must(template.New("password_reset").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Reset your password</title>
+	<link rel="stylesheet" href="{{.AssetsPath}}style.css">
+	<link rel="stylesheet" href="{{.AssetsPath}}theme.css">
+</head>
+<body>
+<main class="card">
+	<h1>Reset your password</h1>
+	{{if .Error}}
+	<p class="alert alert-error" role="alert">{{.Error}}</p>
+	{{end}}
+	{{if .Reset}}
+	<p>Your password has been reset, you may now sign in with your new password.</p>
+	{{if .SessionsEnded}}
+	<p>Anyone who signed in using your old password has been signed out.</p>
+	{{end}}
+	{{else if .Sent}}
+	<p>If an account matches the details you entered, you will receive a link to reset your password shortly.</p>
+	{{else if .Token}}
+	<form method="POST">
+		<input type="hidden" name="token" value="{{.Token}}">
+		<label for="password">New password</label>
+		<input type="password" id="password" name="password" autocomplete="new-password" autofocus>
+		<label for="password_confirm">Confirm new password</label>
+		<input type="password" id="password_confirm" name="password_confirm" autocomplete="new-password">
+		<div class="actions">
+			<button type="submit" class="primary">Reset password</button>
+		</div>
+	</form>
+	{{else}}
+	<p>Enter your username or email address and we will send you a link to reset your password.</p>
+	<form method="POST">
+		<label for="username">Username or email address</label>
+		<input type="text" id="username" name="username" autocomplete="username" autofocus>
+		<div class="actions">
+			<button type="submit" class="primary">Send link</button>
+		</div>
+	</form>
+	{{end}}
+</main>
+<script src="{{.AssetsPath}}app.js"></script>
+</body>
+</html>
+`))
+
+	DefaultEmailVerificationTemplate = template.Must(template.New("verify_email").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Verify your email address</title>
+	<link rel="stylesheet" href="{{.AssetsPath}}style.css">
+	<link rel="stylesheet" href="{{.AssetsPath}}theme.css">
+</head>
+<body>
+<main class="card">
+	<h1>Verify your email address</h1>
+	{{if .Error}}
+	<p class="alert alert-error" role="alert">{{.Error}}</p>
+	{{end}}
+	{{if .Verified}}
+	<p>Your email address has been verified.</p>
+	{{else if .Token}}
+	<form method="POST">
+		<input type="hidden" name="token" value="{{.Token}}">
+		<div class="actions">
+			<button type="submit" class="primary">Verify email address</button>
+		</div>
+	</form>
+	{{end}}
+</main>
+</body>
+</html>
+`))
+
+	// DefaultPasswordResetHandler renders ViewPasswordReset using DefaultRenderer.
+	DefaultPasswordResetHandler = NewPasswordResetHandler(RendererFunc(renderWithDefaultRenderer))
+	// DefaultEmailVerificationHandler renders ViewEmailVerification using DefaultRenderer.
+	DefaultEmailVerificationHandler = NewEmailVerificationHandler(RendererFunc(renderWithDefaultRenderer))
+)
+
+// VerificationSender delivers verification links to users, typically by email.
+type VerificationSender interface {
+	// SendVerification sends the link containing the VerificationCode to the email address it was issued
+	// for.
+	SendVerification(v VerificationCode, link string) error
+}
+
+// VerificationPurpose is the action a VerificationCode allows.
+type VerificationPurpose string
+
+const (
+	VerificationPasswordReset VerificationPurpose = "password_reset"
+	VerificationEmail         VerificationPurpose = "email_verification"
+)
+
+// VerificationCode is a short-lived, single use code sent to a user in order to verify that they control
+// their email address.
+type VerificationCode struct {
+	Code      Secret
+	Purpose   VerificationPurpose
+	Username  string
+	Email     string
+	CreatedAt time.Time
+	ExpiresIn time.Duration
+}
+
+// IsExpired returns true if the code has expired.
+func (v *VerificationCode) IsExpired() bool {
+	return !v.CreatedAt.Add(v.ExpiresIn).After(timeNow())
+}
+
+// NewPasswordResetHandler returns a PasswordResetHandler rendering ViewPasswordReset with the given
+// Renderer.
+func NewPasswordResetHandler(renderer Renderer) func(token string, sent, reset bool, authErr error) http.Handler {
+	return func(token string, sent, reset bool, authErr error) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			render(w, renderer, ViewPasswordReset, authErr, map[string]interface{}{
+				"Token":         token,
+				"Sent":          sent,
+				"Reset":         reset,
+				"SessionsEnded": GetSessionsEnded(r),
+				"Error":         authErr,
+				"AssetsPath":    assetsPath(r),
+			})
+		})
+	}
+}
+
+// NewEmailVerificationHandler returns an EmailVerificationHandler rendering ViewEmailVerification with the
+// given Renderer.
+func NewEmailVerificationHandler(renderer Renderer) func(token string, verified bool, authErr error) http.Handler {
+	return func(token string, verified bool, authErr error) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			render(w, renderer, ViewEmailVerification, authErr, map[string]interface{}{
+				"Token":      token,
+				"Verified":   verified,
+				"Error":      authErr,
+				"AssetsPath": assetsPath(r),
+			})
+		})
+	}
+}
+
+type sessionsEndedKey struct{}
+
+// GetSessionsEnded returns true if the PasswordResetHandler is rendering a reset password whose grants
+// issued beforehand have been revoked. It is false if the SessionStoreBackend cannot find them, in which
+// case the PasswordResetHandler must not tell the resource owner that their sessions were ended.
+func GetSessionsEnded(r *http.Request) bool {
+	ended, _ := r.Context().Value(sessionsEndedKey{}).(bool)
+	return ended
+}
+
+// withSessionsEnded records that the grants of the resource owner have been revoked in the context of the
+// request.
+func withSessionsEnded(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionsEndedKey{}, true))
+}
+
+// accountBaseURL returns the AccountBaseURL, or the Issuer if it is not set. The links sent to users are
+// never derived from the request, as its Host header is chosen by whoever makes it, so account flows are
+// disabled if both are empty.
+func (s *Server) accountBaseURL() string {
+	if s.AccountBaseURL != "" {
+		return s.AccountBaseURL
+	}
+	return s.issuerURL("")
+}
+
+// minPasswordLength returns the Server's MinPasswordLength, or DefaultMinPasswordLength if it is not set.
+func (s *Server) minPasswordLength() int {
+	if s.MinPasswordLength > 0 {
+		return s.MinPasswordLength
+	}
+	return DefaultMinPasswordLength
+}
+
+// accountURL returns the absolute URL of the endpoint including the verification code.
+func (s *Server) accountURL(endpoint string, code Secret) string {
+	return s.accountBaseURL() + endpoint + "?" + url.Values{ParamToken: {code.RawString()}}.Encode()
+}
+
+// supportsVerificationCodes returns false if the SessionStoreBackend cannot store verification codes, in
+// which case the account flows are disabled.
+func (s *Server) supportsVerificationCodes() bool {
+	_, err := s.SessionStore.GetVerificationCode("")
+	return err != ErrVerificationCodesUnsupported
+}
+
+// sendVerification issues a VerificationCode for the account and sends a link to the endpoint containing it.
+func (s *Server) sendVerification(r *http.Request, purpose VerificationPurpose, username, email, endpoint string, expiresIn time.Duration) error {
+	if s.accountBaseURL() == "" {
+		return ErrorServerError
+	}
+	v, err := s.sessionStore(r).NewVerificationCode(VerificationCode{
+		Purpose:   purpose,
+		Username:  username,
+		Email:     email,
+		ExpiresIn: expiresIn,
+	})
+	if err != nil {
+		return err
+	}
+	return s.VerificationSender.SendVerification(v, s.accountURL(endpoint, v.Code))
+}
+
+// SendEmailVerification sends an email verification link to the current email address of the account, for
+// example after the account has been created. The link is built from the AccountBaseURL, or the Issuer if
+// it is not set, and ErrorServerError is returned if neither is set.
+func (s *Server) SendEmailVerification(r *http.Request, username string) error {
+	if s.UserStore == nil || s.VerificationSender == nil {
+		return ErrorServerError
+	}
+	username, email, err := s.UserStore.FindUser(username)
+	if err != nil {
+		return err
+	}
+	return s.sendVerification(r, VerificationEmail, username, email, EmailVerificationEndpoint, DefaultEmailVerificationExpiry)
+}
+
+func (s *Server) handlePasswordReset(w http.ResponseWriter, r *http.Request) {
+	if s.UserStore == nil || s.VerificationSender == nil || s.accountBaseURL() == "" || !s.supportsVerificationCodes() {
+		// Password resets are not configured for this server
+		http.NotFound(w, r)
+		return
+	}
+	token := r.FormValue(ParamToken)
+	if token == "" {
+		if r.Method != "POST" {
+			s.PasswordResetHandler("", false, false, nil).ServeHTTP(w, r)
+			return
+		}
+		// The outcome is not disclosed in order to avoid revealing which accounts exist
+		username, email, err := s.UserStore.FindUser(r.PostFormValue("username"))
+		if err == nil && email != "" {
+			s.sendVerification(r, VerificationPasswordReset, username, email, PasswordResetEndpoint, DefaultPasswordResetExpiry)
+		}
+		s.PasswordResetHandler("", true, false, nil).ServeHTTP(w, r)
+		return
+	}
+	v, err := s.sessionStore(r).CheckVerificationCode(Secret(token), VerificationPasswordReset)
+	if err != nil {
+		s.PasswordResetHandler("", false, false, fmt.Errorf("the link is invalid or has expired")).ServeHTTP(w, r)
+		return
+	}
+	if r.Method != "POST" {
+		s.PasswordResetHandler(token, false, false, nil).ServeHTTP(w, r)
+		return
+	}
+	password := r.PostFormValue("password")
+	if minLength := s.minPasswordLength(); len(password) < minLength {
+		s.PasswordResetHandler(token, false, false, fmt.Errorf("the password must be at least %d characters", minLength)).ServeHTTP(w, r)
+		return
+	}
+	if password != r.PostFormValue("password_confirm") {
+		s.PasswordResetHandler(token, false, false, fmt.Errorf("the passwords do not match")).ServeHTTP(w, r)
+		return
+	}
+	// Delete the code first so that it can only be used once
+	err = s.sessionStore(r).DeleteVerificationCode(v.Code)
+	if err != nil {
+		s.PasswordResetHandler("", false, false, fmt.Errorf("the link is invalid or has expired")).ServeHTTP(w, r)
+		return
+	}
+	err = s.UserStore.SetPassword(v.Username, Secret(password))
+	if err != nil {
+		s.PasswordResetHandler("", false, false, fmt.Errorf("an internal server error occurred, please try again")).ServeHTTP(w, r)
+		return
+	}
+	// End the sessions established using the old password. If the backend cannot find them the password is
+	// still reset, but the failure is reported as tokens obtained using the old password remain valid.
+	err = s.PasswordChanged(r.Context(), v.Username)
+	switch err {
+	case nil:
+		r = withSessionsEnded(r)
+	case ErrRevokeSubjectUnsupported:
+		if s.OnInternalError != nil {
+			s.OnInternalError(r, err)
+		}
+		s.reportError(r, err)
+	default:
+		s.PasswordResetHandler("", false, false, fmt.Errorf("an internal server error occurred, please try again")).ServeHTTP(w, r)
+		return
+	}
+	s.PasswordResetHandler("", false, true, nil).ServeHTTP(w, r)
+}
+
+func (s *Server) handleEmailVerification(w http.ResponseWriter, r *http.Request) {
+	if s.UserStore == nil || !s.supportsVerificationCodes() {
+		// Email verification is not configured for this server
+		http.NotFound(w, r)
+		return
+	}
+	token := r.FormValue(ParamToken)
+	v, err := s.sessionStore(r).CheckVerificationCode(Secret(token), VerificationEmail)
+	if err != nil {
+		s.EmailVerificationHandler("", false, fmt.Errorf("the link is invalid or has expired")).ServeHTTP(w, r)
+		return
+	}
+	// Links are often fetched by email scanners, so the code is only used once the user confirms
+	if r.Method != "POST" {
+		s.EmailVerificationHandler(token, false, nil).ServeHTTP(w, r)
+		return
+	}
+	err = s.sessionStore(r).DeleteVerificationCode(v.Code)
+	if err != nil {
+		s.EmailVerificationHandler("", false, fmt.Errorf("the link is invalid or has expired")).ServeHTTP(w, r)
+		return
+	}
+	err = s.UserStore.SetEmailVerified(v.Username, v.Email)
+	if err != nil {
+		s.EmailVerificationHandler("", false, fmt.Errorf("the email address could not be verified")).ServeHTTP(w, r)
+		return
+	}
+	s.EmailVerificationHandler("", true, nil).ServeHTTP(w, r)
+}
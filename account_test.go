@@ -0,0 +1,241 @@
+package goauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testUserStore implements the UserStore interface and is intended for use only in testing.
+type testUserStore struct {
+	username string
+	email    string
+	password Secret
+	verified string
+}
+
+func (t *testUserStore) CreateUser(user User, password Secret) error {
+	return ErrUserExists
+}
+
+func (t *testUserStore) VerifyPassword(username string, password Secret) (bool, error) {
+	return username == t.username && password == t.password, nil
+}
+
+func (t *testUserStore) ListUsers(offset, limit int) ([]User, error) {
+	return []User{{Username: t.username, Email: t.email}}, nil
+}
+
+func (t *testUserStore) FindUser(identifier string) (string, string, error) {
+	if identifier != t.username && identifier != t.email {
+		return "", "", errors.New("not found")
+	}
+	return t.username, t.email, nil
+}
+
+func (t *testUserStore) SetPassword(username string, password Secret) error {
+	t.password = password
+	return nil
+}
+
+func (t *testUserStore) SetEmailVerified(username, email string) error {
+	t.verified = email
+	return nil
+}
+
+// testVerificationSender implements the VerificationSender interface and is intended for use only in testing.
+type testVerificationSender struct {
+	links []string
+}
+
+func (t *testVerificationSender) SendVerification(v VerificationCode, link string) error {
+	t.links = append(t.links, link)
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	users := &testUserStore{username: "testusername", email: "test@example.com"}
+	sender := &testVerificationSender{}
+	server.UserStore = users
+	server.VerificationSender = sender
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// Password resets are disabled unless the links can be built without the Host of the request
+	if w := post(PasswordResetEndpoint, "username=testusername"); w.Code != http.StatusNotFound || len(sender.links) != 0 {
+		t.Fatalf("Test failed, expected password resets to be disabled, status %d", w.Code)
+	}
+	server.AccountBaseURL = "https://auth.example.com"
+
+	// Unknown accounts are not disclosed and no link is sent
+	w := post(PasswordResetEndpoint, "username=unknown")
+	if w.Code != 200 || len(sender.links) != 0 {
+		t.Fatalf("Test failed, expected no link to be sent, status %d", w.Code)
+	}
+	w = post(PasswordResetEndpoint, "username=test@example.com")
+	if w.Code != 200 || len(sender.links) != 1 {
+		t.Fatalf("Test failed, expected a link to be sent, status %d", w.Code)
+	}
+	link, err := url.Parse(sender.links[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Host != "auth.example.com" || link.Path != PasswordResetEndpoint {
+		t.Errorf("Test failed, unexpected link %s", link)
+	}
+	token := link.Query().Get(ParamToken)
+	err = server.SessionStore.PutGrant(Grant{AccessToken: "oldtoken", Username: "testusername", CreatedAt: time.Now().Add(-time.Minute), ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The password must be at least MinPasswordLength characters
+	server.MinPasswordLength = 12
+	w = post(PasswordResetEndpoint, url.Values{"token": {token}, "password": {"newpassword"}, "password_confirm": {"newpassword"}}.Encode())
+	if w.Code != 401 || users.password != "" || !strings.Contains(w.Body.String(), "at least 12 characters") {
+		t.Errorf("Test failed, expected the password to be too short, status %d", w.Code)
+	}
+	server.MinPasswordLength = 0
+
+	// The passwords must match
+	w = post(PasswordResetEndpoint, url.Values{"token": {token}, "password": {"newpassword"}, "password_confirm": {"other"}}.Encode())
+	if w.Code != 401 || users.password != "" {
+		t.Errorf("Test failed, expected the password not to be reset, status %d", w.Code)
+	}
+	w = post(PasswordResetEndpoint, url.Values{"token": {token}, "password": {"newpassword"}, "password_confirm": {"newpassword"}}.Encode())
+	if w.Code != 200 || users.password != "newpassword" || !strings.Contains(w.Body.String(), "signed out") {
+		t.Errorf("Test failed, expected the password to be reset, status %d", w.Code)
+	}
+	// Grants issued before the password was reset are revoked
+	if _, err := server.SessionStore.GetGrant("oldtoken"); err == nil {
+		t.Errorf("Test failed, expected the grant issued before the reset to be revoked")
+	}
+
+	// The code can only be used once
+	users.password = ""
+	w = post(PasswordResetEndpoint, url.Values{"token": {token}, "password": {"newpassword"}, "password_confirm": {"newpassword"}}.Encode())
+	if w.Code != 401 || users.password != "" {
+		t.Errorf("Test failed, expected the code to be rejected, status %d", w.Code)
+	}
+
+	// Password reset codes cannot be used to verify email addresses
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", EmailVerificationEndpoint+"?token="+url.QueryEscape(token), nil))
+	if w.Code != 401 || users.verified != "" {
+		t.Errorf("Test failed, expected the code to be rejected, status %d", w.Code)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	users := &testUserStore{username: "testusername", email: "test@example.com"}
+	sender := &testVerificationSender{}
+	server.UserStore = users
+	server.VerificationSender = sender
+
+	// Links are never built from the Host of the request
+	err := server.SendEmailVerification(httptest.NewRequest("GET", "http://auth.example.com/signup", nil), "testusername")
+	if err != ErrorServerError || len(sender.links) != 0 {
+		t.Fatalf("Test failed, expected no link without a base URL got %v %v", err, sender.links)
+	}
+	server.Issuer = "http://auth.example.com"
+	err = server.SendEmailVerification(httptest.NewRequest("GET", "http://evil.example.com/signup", nil), "testusername")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sender.links) != 1 || !strings.HasPrefix(sender.links[0], "http://auth.example.com"+EmailVerificationEndpoint) {
+		t.Fatalf("Test failed, unexpected links %v", sender.links)
+	}
+	// Following the link renders a confirmation form without using the code
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", sender.links[0], nil))
+	if w.Code != 200 || users.verified != "" || !strings.Contains(w.Body.String(), `<form method="POST">`) {
+		t.Errorf("Test failed, expected a confirmation form, status %d", w.Code)
+	}
+	link, _ := url.Parse(sender.links[0])
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", EmailVerificationEndpoint, strings.NewReader(link.RawQuery))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		server.ServeHTTP(w, r)
+		return w
+	}
+	if w = post(); w.Code != 200 || users.verified != "test@example.com" {
+		t.Errorf("Test failed, expected the email address to be verified, status %d", w.Code)
+	}
+	// The code can only be used once
+	users.verified = ""
+	if w = post(); w.Code != 401 || users.verified != "" {
+		t.Errorf("Test failed, expected the code to be rejected, status %d", w.Code)
+	}
+}
+
+func TestAccountFlowsUnsupported(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(baseSessionStoreBackend{NewMemSessionStoreBackend()})
+	server.UserStore = &testUserStore{username: "testusername", email: "test@example.com"}
+	sender := &testVerificationSender{}
+	server.VerificationSender = sender
+	server.AccountBaseURL = "https://auth.example.com"
+
+	// The account flows are disabled if the backend cannot store verification codes
+	for _, path := range []string{PasswordResetEndpoint, EmailVerificationEndpoint + "?token=test"} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Test failed, expected %s to be disabled got %d", path, w.Code)
+		}
+	}
+	err := server.SendEmailVerification(httptest.NewRequest("GET", "/signup", nil), "testusername")
+	if err != ErrVerificationCodesUnsupported || len(sender.links) != 0 {
+		t.Errorf("Test failed, expected %v got %v", ErrVerificationCodesUnsupported, err)
+	}
+}
+
+// verificationOnlyBackend stores verification codes but cannot find the grants of a resource owner.
+type verificationOnlyBackend struct {
+	SessionStoreBackend
+	VerificationCodeStore
+}
+
+func TestPasswordResetWithoutRevocation(t *testing.T) {
+	server := newTestHandler()
+	backend := NewMemSessionStoreBackend()
+	server.SessionStore = NewSessionStore(verificationOnlyBackend{backend, backend})
+	server.UserStore = &testUserStore{username: "testusername", email: "test@example.com"}
+	server.VerificationSender = &testVerificationSender{}
+	server.AccountBaseURL = "https://auth.example.com"
+	var reported error
+	server.OnInternalError = func(r *http.Request, err error) {
+		reported = err
+	}
+
+	v, err := server.SessionStore.NewVerificationCode(VerificationCode{Purpose: VerificationPasswordReset, Username: "testusername", ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", PasswordResetEndpoint, strings.NewReader(url.Values{"token": {v.Code.RawString()}, "password": {"newpassword"}, "password_confirm": {"newpassword"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	// The password is reset, but the resource owner is not told that their sessions were ended
+	if w.Code != 200 || strings.Contains(w.Body.String(), "signed out") {
+		t.Errorf("Test failed, unexpected response %d %s", w.Code, w.Body)
+	}
+	if reported != ErrRevokeSubjectUnsupported {
+		t.Errorf("Test failed, expected %v to be reported got %v", ErrRevokeSubjectUnsupported, reported)
+	}
+}
@@ -0,0 +1,337 @@
+package goauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultGrantArchiveRetention is the period for which a MemGrantArchive that does not set Retention
+	// keeps archived grants.
+	DefaultGrantArchiveRetention = 90 * 24 * time.Hour
+)
+
+// Reasons for which grants are archived.
+const (
+	ArchiveReasonDeleted = "deleted"
+	ArchiveReasonExpired = "expired"
+)
+
+// HashToken returns the hex encoded SHA-256 hash of a token, under which it is archived.
+func HashToken(token Secret) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token.RawString()))
+	return hex.EncodeToString(sum[:])
+}
+
+// ArchivedGrant is the record of a deleted or expired Grant kept for incident investigation. The tokens
+// are only stored as hashes so that an archived grant cannot be used.
+type ArchivedGrant struct {
+	AccessTokenHash  string
+	RefreshTokenHash string
+	ClientID         string
+	Username         string
+	Scope            []string
+	CreatedAt        time.Time
+	ExpiresIn        time.Duration
+	IssuedAt         time.Time
+	ArchivedAt       time.Time
+	// Reason is the reason the grant was archived, such as ArchiveReasonDeleted.
+	Reason string
+}
+
+// NewArchivedGrant returns the ArchivedGrant of a grant.
+func NewArchivedGrant(grant Grant, reason string) ArchivedGrant {
+	return ArchivedGrant{
+		AccessTokenHash:  HashToken(grant.AccessToken),
+		RefreshTokenHash: HashToken(grant.RefreshToken),
+		ClientID:         grant.ClientID,
+		Username:         grant.Username,
+		Scope:            grant.Scope,
+		CreatedAt:        grant.CreatedAt,
+		ExpiresIn:        grant.ExpiresIn,
+		IssuedAt:         grant.IssuedAt,
+		ArchivedAt:       timeNow(),
+		Reason:           reason,
+	}
+}
+
+// GrantArchive stores the history of grants removed from the session store for a retention period,
+// answering questions such as which scope a token had access to before it expired.
+type GrantArchive interface {
+	// ArchiveGrant stores an archived grant.
+	ArchiveGrant(grant ArchivedGrant) error
+	// FindArchivedGrant returns the archived grant whose access or refresh token has the hash.
+	FindArchivedGrant(tokenHash string) (ArchivedGrant, error)
+}
+
+// ArchivingSessionStoreBackend wraps a SessionStoreBackend, archiving grants when they are deleted or
+// removed by SessionStore.Sweep. If archiving fails the grant is not removed.
+type ArchivingSessionStoreBackend struct {
+	SessionStoreBackend
+	Archive GrantArchive
+}
+
+// NewArchivingSessionStoreBackend returns a backend archiving the grants removed from the backend.
+func NewArchivingSessionStoreBackend(backend SessionStoreBackend, archive GrantArchive) *ArchivingSessionStoreBackend {
+	return &ArchivingSessionStoreBackend{backend, archive}
+}
+
+// DeleteGrant archives the grant and removes it from the backend.
+func (a *ArchivingSessionStoreBackend) DeleteGrant(accessToken Secret) error {
+	grant, err := a.SessionStoreBackend.GetGrant(accessToken)
+	if err != nil {
+		return err
+	}
+	err = a.Archive.ArchiveGrant(NewArchivedGrant(grant, ArchiveReasonDeleted))
+	if err != nil {
+		return err
+	}
+	return a.SessionStoreBackend.DeleteGrant(accessToken)
+}
+
+// InsertGrant stores the grant atomically if the wrapped backend implements GrantInserter.
+func (a *ArchivingSessionStoreBackend) InsertGrant(grant Grant) error {
+	return NewSessionStore(a.SessionStoreBackend).insertGrant(grant)
+}
+
+// ConsumeAuthorizationCode consumes the code atomically if the wrapped backend implements
+// AuthorizationCodeConsumer.
+func (a *ArchivingSessionStoreBackend) ConsumeAuthorizationCode(code Secret) (AuthorizationCode, error) {
+	return NewSessionStore(a.SessionStoreBackend).ConsumeAuthorizationCode(code)
+}
+
+// UpdateGrant updates the grant atomically if the wrapped backend implements GrantUpdater.
+func (a *ArchivingSessionStoreBackend) UpdateGrant(grant Grant, expectedVersion int64) error {
+	return NewSessionStore(a.SessionStoreBackend).updateGrant(grant, expectedVersion)
+}
+
+// PutBackChannelRequest stores the request if the wrapped backend implements BackChannelRequestStore.
+func (a *ArchivingSessionStoreBackend) PutBackChannelRequest(req BackChannelRequest) error {
+	return NewSessionStore(a.SessionStoreBackend).PutBackChannelRequest(req)
+}
+
+// GetBackChannelRequest retrieves the request if the wrapped backend implements BackChannelRequestStore.
+func (a *ArchivingSessionStoreBackend) GetBackChannelRequest(authReqID Secret) (BackChannelRequest, error) {
+	return NewSessionStore(a.SessionStoreBackend).GetBackChannelRequest(authReqID)
+}
+
+// DeleteBackChannelRequest removes the request if the wrapped backend implements BackChannelRequestStore.
+func (a *ArchivingSessionStoreBackend) DeleteBackChannelRequest(authReqID Secret) error {
+	return NewSessionStore(a.SessionStoreBackend).DeleteBackChannelRequest(authReqID)
+}
+
+// UpdateBackChannelRequest updates the request atomically if the wrapped backend implements
+// BackChannelRequestUpdater.
+func (a *ArchivingSessionStoreBackend) UpdateBackChannelRequest(req BackChannelRequest, expectedStatus BackChannelStatus) error {
+	return NewSessionStore(a.SessionStoreBackend).UpdateBackChannelRequest(req, expectedStatus)
+}
+
+// PutDeviceAuthorization stores the request if the wrapped backend implements DeviceAuthorizationStore.
+func (a *ArchivingSessionStoreBackend) PutDeviceAuthorization(d DeviceAuthorization) error {
+	return NewSessionStore(a.SessionStoreBackend).PutDeviceAuthorization(d)
+}
+
+// GetDeviceAuthorization retrieves the request if the wrapped backend implements DeviceAuthorizationStore.
+func (a *ArchivingSessionStoreBackend) GetDeviceAuthorization(deviceCode Secret) (DeviceAuthorization, error) {
+	return NewSessionStore(a.SessionStoreBackend).GetDeviceAuthorization(deviceCode)
+}
+
+// GetDeviceAuthorizationByUserCode retrieves the request if the wrapped backend implements
+// DeviceAuthorizationStore.
+func (a *ArchivingSessionStoreBackend) GetDeviceAuthorizationByUserCode(userCode string) (DeviceAuthorization, error) {
+	return NewSessionStore(a.SessionStoreBackend).GetDeviceAuthorizationByUserCode(userCode)
+}
+
+// DeleteDeviceAuthorization removes the request if the wrapped backend implements DeviceAuthorizationStore.
+func (a *ArchivingSessionStoreBackend) DeleteDeviceAuthorization(deviceCode Secret) error {
+	return NewSessionStore(a.SessionStoreBackend).DeleteDeviceAuthorization(deviceCode)
+}
+
+// PutVerificationCode stores the code if the wrapped backend implements VerificationCodeStore.
+func (a *ArchivingSessionStoreBackend) PutVerificationCode(v VerificationCode) error {
+	return NewSessionStore(a.SessionStoreBackend).PutVerificationCode(v)
+}
+
+// GetVerificationCode retrieves the code if the wrapped backend implements VerificationCodeStore.
+func (a *ArchivingSessionStoreBackend) GetVerificationCode(code Secret) (VerificationCode, error) {
+	return NewSessionStore(a.SessionStoreBackend).GetVerificationCode(code)
+}
+
+// DeleteVerificationCode removes the code if the wrapped backend implements VerificationCodeStore.
+func (a *ArchivingSessionStoreBackend) DeleteVerificationCode(code Secret) error {
+	return NewSessionStore(a.SessionStoreBackend).DeleteVerificationCode(code)
+}
+
+// PutIdempotentResponse stores the response if the wrapped backend implements IdempotentResponseStore.
+func (a *ArchivingSessionStoreBackend) PutIdempotentResponse(resp IdempotentResponse) error {
+	return NewSessionStore(a.SessionStoreBackend).PutIdempotentResponse(resp)
+}
+
+// GetIdempotentResponse retrieves the response if the wrapped backend implements IdempotentResponseStore.
+func (a *ArchivingSessionStoreBackend) GetIdempotentResponse(key string) (IdempotentResponse, error) {
+	return NewSessionStore(a.SessionStoreBackend).GetIdempotentResponse(key)
+}
+
+// UpdateDeviceAuthorization updates the request atomically if the wrapped backend implements
+// DeviceAuthorizationUpdater.
+func (a *ArchivingSessionStoreBackend) UpdateDeviceAuthorization(d DeviceAuthorization, expectedStatus DeviceStatus) error {
+	return NewSessionStore(a.SessionStoreBackend).UpdateDeviceAuthorization(d, expectedStatus)
+}
+
+// RotateGrant rotates the grant atomically if the wrapped backend implements GrantRotator, archiving the old
+// grant if it is removed rather than kept for the grace period.
+func (a *ArchivingSessionStoreBackend) RotateGrant(old, new Grant, expectedVersion int64) error {
+	if old.ReplacedBy == "" {
+		err := a.Archive.ArchiveGrant(NewArchivedGrant(old, ArchiveReasonDeleted))
+		if err != nil {
+			return err
+		}
+	}
+	return NewSessionStore(a.SessionStoreBackend).rotateGrant(old, new, expectedVersion)
+}
+
+// GetGrants retrieves the grants in one request if the wrapped backend implements GrantBatchGetter.
+func (a *ArchivingSessionStoreBackend) GetGrants(accessTokens []Secret) (map[Secret]Grant, error) {
+	if getter, ok := a.SessionStoreBackend.(GrantBatchGetter); ok {
+		return getter.GetGrants(accessTokens)
+	}
+	grants := make(map[Secret]Grant, len(accessTokens))
+	for _, accessToken := range accessTokens {
+		grant, err := a.SessionStoreBackend.GetGrant(accessToken)
+		if err == nil {
+			grants[accessToken] = grant
+		}
+	}
+	return grants, nil
+}
+
+// SweepExpired removes expired records from the backend, archiving each grant removed.
+func (a *ArchivingSessionStoreBackend) SweepExpired(ctx context.Context, limit int, onRemove func(Grant) error) (int, error) {
+	sweeper, ok := a.SessionStoreBackend.(ExpirySweeper)
+	if !ok {
+		return 0, ErrSweepUnsupported
+	}
+	return sweeper.SweepExpired(ctx, limit, func(grant Grant) error {
+		err := a.Archive.ArchiveGrant(NewArchivedGrant(grant, ArchiveReasonExpired))
+		if err != nil {
+			return err
+		}
+		if onRemove != nil {
+			return onRemove(grant)
+		}
+		return nil
+	})
+}
+
+// ExportRecords enumerates the records of the wrapped backend if it implements SessionExporter.
+func (a *ArchivingSessionStoreBackend) ExportRecords(ctx context.Context, fn func(SessionRecord) error) error {
+	if exporter, ok := a.SessionStoreBackend.(SessionExporter); ok {
+		return exporter.ExportRecords(ctx, fn)
+	}
+	return ErrExportUnsupported
+}
+
+// Namespace returns the namespace of the wrapped backend, archiving the grants removed from it, if the
+// wrapped backend implements NamespacedSessionStoreBackend.
+func (a *ArchivingSessionStoreBackend) Namespace(name string) (SessionStoreBackend, error) {
+	nb, ok := a.SessionStoreBackend.(NamespacedSessionStoreBackend)
+	if !ok {
+		return nil, ErrNamespaceUnsupported
+	}
+	b, err := nb.Namespace(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchivingSessionStoreBackend{b, a.Archive}, nil
+}
+
+// PurgeNamespace removes all records held in the namespace of the wrapped backend, archiving each grant
+// removed.
+func (a *ArchivingSessionStoreBackend) PurgeNamespace(ctx context.Context, name string, onRemove func(Grant) error) (int, error) {
+	nb, ok := a.SessionStoreBackend.(NamespacedSessionStoreBackend)
+	if !ok {
+		return 0, ErrNamespaceUnsupported
+	}
+	return nb.PurgeNamespace(ctx, name, func(grant Grant) error {
+		err := a.Archive.ArchiveGrant(NewArchivedGrant(grant, ArchiveReasonDeleted))
+		if err != nil {
+			return err
+		}
+		if onRemove != nil {
+			return onRemove(grant)
+		}
+		return nil
+	})
+}
+
+// WithContext binds the wrapped backend to the context if it implements ContextSessionStoreBackend.
+func (a *ArchivingSessionStoreBackend) WithContext(ctx context.Context) SessionStoreBackend {
+	if cb, ok := a.SessionStoreBackend.(ContextSessionStoreBackend); ok {
+		return &ArchivingSessionStoreBackend{cb.WithContext(ctx), a.Archive}
+	}
+	return a
+}
+
+// Stats returns the stats of the wrapped backend if it implements StatsReporter.
+func (a *ArchivingSessionStoreBackend) Stats() (SessionStoreStats, error) {
+	if reporter, ok := a.SessionStoreBackend.(StatsReporter); ok {
+		return reporter.Stats()
+	}
+	return SessionStoreStats{}, ErrStatsUnsupported
+}
+
+// MemGrantArchive is a GrantArchive holding archived grants in memory.
+type MemGrantArchive struct {
+	// Retention overrides DefaultGrantArchiveRetention if greater than zero.
+	Retention time.Duration
+	mtx       sync.Mutex
+	grants    []ArchivedGrant
+}
+
+// NewMemGrantArchive returns an empty MemGrantArchive.
+func NewMemGrantArchive() *MemGrantArchive {
+	return &MemGrantArchive{}
+}
+
+func (m *MemGrantArchive) retention() time.Duration {
+	if m.Retention > 0 {
+		return m.Retention
+	}
+	return DefaultGrantArchiveRetention
+}
+
+// ArchiveGrant stores the archived grant, discarding grants archived before the retention period.
+func (m *MemGrantArchive) ArchiveGrant(grant ArchivedGrant) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	cutoff := timeNow().Add(-m.retention())
+	i := 0
+	for i < len(m.grants) && m.grants[i].ArchivedAt.Before(cutoff) {
+		i++
+	}
+	m.grants = append(m.grants[i:], grant)
+	return nil
+}
+
+// FindArchivedGrant returns the most recently archived grant whose access or refresh token has the hash.
+func (m *MemGrantArchive) FindArchivedGrant(tokenHash string) (ArchivedGrant, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	cutoff := timeNow().Add(-m.retention())
+	for i := len(m.grants) - 1; i >= 0; i-- {
+		g := m.grants[i]
+		if g.ArchivedAt.Before(cutoff) {
+			break
+		}
+		if tokenHash != "" && (g.AccessTokenHash == tokenHash || g.RefreshTokenHash == tokenHash) {
+			return g, nil
+		}
+	}
+	return ArchivedGrant{}, ErrorAccessDenied
+}
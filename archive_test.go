@@ -0,0 +1,77 @@
+package goauth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestArchivingSessionStoreBackend(t *testing.T) {
+	archive := NewMemGrantArchive()
+	store := NewSessionStore(NewArchivingSessionStoreBackend(NewMemSessionStoreBackend(), archive))
+	now := time.Now()
+	deleted := Grant{AccessToken: "deleted", RefreshToken: "refresh", ClientID: "testclient", Scope: []string{"testscope"}, CreatedAt: now, ExpiresIn: time.Hour}
+	expired := Grant{AccessToken: "expired", ClientID: "testclient", Username: "testuser", CreatedAt: now.Add(-2 * time.Hour), ExpiresIn: time.Hour}
+	for _, g := range []Grant{deleted, expired} {
+		err := store.PutGrant(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.DeleteGrant("deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := store.Sweep(context.Background(), nil)
+	if err != nil || p.Removed != 1 {
+		t.Fatalf("Test failed, unexpected sweep %+v %v", p, err)
+	}
+
+	a, err := archive.FindArchivedGrant(HashToken("refresh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Reason != ArchiveReasonDeleted || a.AccessTokenHash != HashToken("deleted") || !reflect.DeepEqual(a.Scope, deleted.Scope) {
+		t.Errorf("Test failed, unexpected archived grant %+v", a)
+	}
+	a, err = archive.FindArchivedGrant(HashToken("expired"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Reason != ArchiveReasonExpired || a.Username != "testuser" {
+		t.Errorf("Test failed, unexpected archived grant %+v", a)
+	}
+
+	// Grants are discarded after the retention period
+	archive.Retention = time.Hour
+	timeNow = func() time.Time { return now.Add(2 * time.Hour) }
+	defer func() { timeNow = time.Now }()
+	_, err = archive.FindArchivedGrant(HashToken("expired"))
+	if err == nil {
+		t.Error("Test failed, expected the archived grant to have been discarded")
+	}
+}
+
+func TestArchivingSessionStoreBackendRotateGrant(t *testing.T) {
+	archive := NewMemGrantArchive()
+	store := NewSessionStore(NewArchivingSessionStoreBackend(NewMemSessionStoreBackend(), archive))
+	old, err := store.NewGrantFor(Grant{ClientID: "testclient", ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	new := Grant{AccessToken: "new", RefreshToken: "newrefresh", ClientID: "testclient", ExpiresIn: time.Hour}
+	_, err = store.RotateGrant(old, new, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := archive.FindArchivedGrant(HashToken(old.AccessToken))
+	if err != nil || a.Reason != ArchiveReasonDeleted {
+		t.Errorf("Test failed, expected the rotated grant to be archived, got %+v %v", a, err)
+	}
+	// The rotated refresh token can only be used once
+	_, err = store.RotateGrant(old, Grant{AccessToken: "other", ClientID: "testclient"}, 0)
+	if err != ErrGrantRotated {
+		t.Errorf("Test failed, expected ErrGrantRotated, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package goauth
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:embed assets
+var embeddedAssets embed.FS
+
+var (
+	// DefaultAssetsPath is the path on the Server mux under which the assets of the authorization pages are
+	// served. It must end with a slash and be set before calling New.
+	DefaultAssetsPath = "/assets/"
+	// DefaultAssets contains the stylesheets and scripts used by the default authorization pages. Its
+	// theme.css is empty and is loaded last, so a theme can restyle the pages by replacing it.
+	DefaultAssets fs.FS = mustSub(embeddedAssets, "assets")
+)
+
+// mustSub returns the subtree of fsys rooted at dir.
+func mustSub(fsys fs.FS, dir string) fs.FS {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// assetsPath returns the location of the assets relative to the request's path, so that the links in the
+// rendered pages remain valid when the Server is mounted under a prefix.
+func assetsPath(r *http.Request) string {
+	dir := path.Dir(r.URL.Path)
+	if dir == "/" || dir == "." {
+		return strings.TrimPrefix(DefaultAssetsPath, "/")
+	}
+	return strings.Repeat("../", strings.Count(strings.Trim(dir, "/"), "/")+1) + strings.TrimPrefix(DefaultAssetsPath, "/")
+}
+
+// assetsHandler serves the Server's Assets, or DefaultAssets if none are set. Directory listings are not
+// served.
+func (s *Server) assetsHandler(w http.ResponseWriter, r *http.Request) {
+	i := strings.Index(r.URL.Path, DefaultAssetsPath)
+	if i < 0 || strings.HasSuffix(r.URL.Path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	assets := s.Assets
+	if assets == nil {
+		assets = DefaultAssets
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	// The assets may be served beneath a path prefix when registered on another router
+	http.StripPrefix(r.URL.Path[:i]+DefaultAssetsPath, http.FileServer(http.FS(assets))).ServeHTTP(w, r)
+}
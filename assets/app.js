@@ -0,0 +1,10 @@
+// Prevent forms from being submitted twice while the authorization server
+// responds.
+document.addEventListener("submit", function (event) {
+	var buttons = event.target.querySelectorAll("button");
+	setTimeout(function () {
+		for (var i = 0; i < buttons.length; i++) {
+			buttons[i].disabled = true;
+		}
+	}, 0);
+});
@@ -0,0 +1,45 @@
+package goauth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssets(t *testing.T) {
+	server := newTestHandler()
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", DefaultAssetsPath+"style.css", nil))
+	if w.Code != 200 || !strings.Contains(w.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("Test failed, expected the default stylesheet got status %d", w.Code)
+	}
+
+	// Directories are not listed
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", DefaultAssetsPath, nil))
+	if w.Code != 404 {
+		t.Errorf("Test failed, expected status 404 got %d", w.Code)
+	}
+
+	// The assets can be replaced with a theme
+	server.Assets = fstest.MapFS{"theme.css": {Data: []byte(":root { --goauth-primary: red; }")}}
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", DefaultAssetsPath+"theme.css", nil))
+	if !strings.Contains(w.Body.String(), "red") {
+		t.Errorf("Test failed, expected the themed stylesheet got %q", w.Body.String())
+	}
+
+	// The default pages link to the assets relative to their own path
+	for path, expected := range map[string]string{
+		"/authorize":       `href="assets/style.css"`,
+		"/oauth/authorize": `href="../assets/style.css"`,
+	} {
+		w = httptest.NewRecorder()
+		DefaultAuthorizationHandler(AuthorizationRequest{}).ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Test failed, expected %s to contain %s", path, expected)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package goauth
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -10,56 +11,69 @@ import (
 )
 
 var (
-	// DefaultAuthorizationCodeExpiry is the default expiry for an AuthorizationCode.
-	// It should be a short period of time as it is intended that Authorization Codes
-	// are used immediately.
+	// DefaultAuthorizationCodeExpiry is the default expiry for an AuthorizationCode, used to initialize
+	// the AuthorizationCodeExpiry of each Server created by New. It should be a short period of time as
+	// it is intended that Authorization Codes are used immediately.
 	DefaultAuthorizationCodeExpiry = 10 * time.Second
 
-	DefaultAuthorizationTemplate = template.Must(template.New("authorize").Parse(`
-<!DOCTYPE html>
-<html>
+	DefaultAuthorizationTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
 <head>
-	<title></title>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Sign in</title>
+	<link rel="stylesheet" href="{{.AssetsPath}}style.css">
+	<link rel="stylesheet" href="{{.AssetsPath}}theme.css">
 </head>
 <body>
-{{if .Error}}
-	<h3>{{.Error}}</h3>
-{{end}}
-{{if .Client}}
-	{{if .Scope}}		
-		<h3>{{.Client}} has requested access using the following scope:</h3>
+<main class="card">
+	<h1>Sign in</h1>
+	{{if .EmbeddedBrowser}}
+	<p class="alert alert-warning">For your security, please open this page in your device's browser before signing in.</p>
+	{{end}}
+	{{if .Error}}
+	<p class="alert alert-error" role="alert">{{.Error}}</p>
+	{{end}}
+	{{if and .Client (not .Trusted)}}
+	<p>{{with .ClientMetadata.Name}}{{.}}{{else}}{{if .ClientID}}{{.ClientID}}{{else}}An application{{end}}{{end}} has requested access{{if .Scope}} using the following scope:{{else}}.{{end}}</p>
+	{{if .Scope}}
+	<ul class="scope">
 		{{range .Scope}}
-		<h3>{{.}}</h3>
+		<li>{{.}}</li>
 		{{end}}
-	{{else}}
-		<h3>{{.Client}} has requested access.</h3>
+	</ul>
+	{{end}}
 	{{end}}
-{{end}}
-<form action="{{.ActionPath}}" method="POST">
-	<input type="text" name="username">
-	<input type="password" name="password">
-	<input type="submit" value="Login">
-</form>
+	<form action="{{.ActionURL}}" method="POST">
+		{{if .AuthorizationDetails}}
+		<input type="hidden" name="authorization_details_reviewed" value="1">
+		<fieldset class="authorization-details">
+			<legend>Requested permissions</legend>
+			{{range .AuthorizationDetails}}
+			<label><input type="checkbox" name="approved_authorization_details" value="{{.Index}}" checked> {{.Description}}</label>
+			{{end}}
+		</fieldset>
+		{{end}}
+		<label for="username">Username</label>
+		<input type="text" id="username" name="{{.LoginFields.Username}}" value="{{.LoginHint}}" autocomplete="username" autofocus>
+		<label for="password">Password</label>
+		<input type="password" id="password" name="{{.LoginFields.Password}}" autocomplete="current-password">
+		{{range .LoginFields.Extra}}
+		<label for="{{.}}">{{.}}</label>
+		<input type="text" id="{{.}}" name="{{.}}">
+		{{end}}
+		<div class="actions">
+			<button type="submit" class="primary">Sign in</button>
+		</div>
+	</form>
+</main>
+<script src="{{.AssetsPath}}app.js"></script>
 </body>
 </html>
 `))
 
-	DefaultAuthorizationHandler = func(client Client, scope []string, authErr error, actionURL string) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if authErr != nil {
-				w.WriteHeader(http.StatusUnauthorized)
-			}
-			err := DefaultAuthorizationTemplate.Execute(w, map[string]interface{}{
-				"Client":    client,
-				"Scope":     scope,
-				"ActionURL": actionURL,
-				"Error":     authErr,
-			})
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
-		})
-	}
+	// DefaultAuthorizationHandler renders ViewAuthorize using DefaultRenderer.
+	DefaultAuthorizationHandler = NewAuthorizationHandler(RendererFunc(renderWithDefaultRenderer))
 )
 
 // AuthorizationCode is a temporary authorization request
@@ -71,6 +85,20 @@ type AuthorizationCode struct {
 	Scope       []string
 	CreatedAt   time.Time
 	ExpiresIn   time.Duration
+	// Username identifies the resource owner who approved the authorization request.
+	Username string
+	// AuthTime is the time at which the resource owner authenticated, which may be before the code was
+	// created if they approved the request using an existing login session.
+	AuthTime time.Time
+	// CodeChallenge and CodeChallengeMethod are set if the client used PKCE, in which case the code can
+	// only be exchanged using the matching code verifier.
+	CodeChallenge       string
+	CodeChallengeMethod CodeChallengeMethod
+	// AuthorizationDetails are the fine-grained permissions approved by the resource owner.
+	AuthorizationDetails []AuthorizationDetail
+	// Nonce is the nonce parameter of the authorization request, included in the ID token issued for the
+	// code.
+	Nonce string
 }
 
 // IsExpired returns true if the AuthorizationCode has expired.
@@ -86,13 +114,14 @@ func (a AuthorizationCode) CheckRedirectURI(s string) bool {
 	return a.RedirectURI == s
 }
 
-func (s Server) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request) {
+	// Make the login hints available to the SessionAuthenticator and AuthorizationHandler
+	r = withAuthorizationHints(r)
 	// Get the client
 	clientID := r.FormValue(ParamClientID)
-	client, err := s.Authenticator.GetClient(clientID)
+	client, err := s.authenticator(r).GetClient(clientID)
 	if err != nil {
 		// Failed to retrieve client, therefore, return an error and DO NOT redirect
-		w.WriteHeader(http.StatusUnauthorized)
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
 		return
 	}
@@ -100,7 +129,6 @@ func (s Server) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Requ
 	ok := client.AllowStrategy(StrategyAuthorizationCode)
 	if !ok {
 		// The client is not authorized for the grant type, therefore, return an error
-		w.WriteHeader(http.StatusUnauthorized)
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
 		return
 	}
@@ -108,11 +136,11 @@ func (s Server) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Requ
 	uri, err := url.Parse(rawurl)
 	if err != nil {
 		// The redirect URI is an invalid url, therefore, return an error and DO NOT redirect
-		s.ErrorHandler(w, http.StatusInternalServerError, err)
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 		return
 	}
 	// Ensure the redirect URI is allowed
-	ok = client.AllowRedirectURI(uri.String())
+	ok = client.AllowRedirectURI(uri.String()) && s.secureRedirectURI(uri.String())
 	if !ok {
 		// The redirect URI is invalid, therefore, return an error and DO NOT redirect
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
@@ -129,57 +157,122 @@ func (s Server) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Requ
 		http.Redirect(w, r, urlStr, http.StatusFound)
 		return
 	}
+	// Public clients must use PKCE as they cannot authenticate when exchanging the code
+	challenge := r.FormValue(ParamCodeChallenge)
+	_, err = parseCodeChallengeMethod(r.FormValue(ParamCodeChallengeMethod))
+	if err != nil || (challenge == "" && requiresPKCE(client)) || (challenge != "" && !validCodeVerifier(challenge)) {
+		s.authCodeErrorRedirect(w, r, uri, ErrorInvalidRequest)
+		return
+	}
 	// Check that the given scope is allowed
 	rawScope := r.FormValue(ParamScope)
-	scope := strings.Split(rawScope, " ")
-	scope, err = client.AuthorizeScope(scope)
+	scope := s.parseScope(rawScope)
+	scope, err = s.authorizeScope(clientID, client, scope)
 	if err != nil {
 		s.ErrorHandler(w, http.StatusUnauthorized, err)
 		return
 	}
+	// Check that the given authorization details are allowed
+	details, err := s.requestAuthorizationDetails(r, clientID, client)
+	if err != nil {
+		s.authCodeErrorRedirect(w, r, uri, ErrorInvalidAuthorizationDetails)
+		return
+	}
+	r = s.withConsentDetails(r, details)
+	r = s.withLoginFields(r)
+	// Check the prompt and max_age parameters against any existing login session
+	prompts, err := parsePrompt(r.FormValue(ParamPrompt))
+	if err != nil {
+		s.authCodeErrorRedirect(w, r, uri, ErrorInvalidRequest)
+		return
+	}
+	maxAge, err := parseMaxAge(r.FormValue(ParamMaxAge))
+	if err != nil {
+		s.authCodeErrorRedirect(w, r, uri, ErrorInvalidRequest)
+		return
+	}
+	session, hasSession := s.activeLoginSession(r, prompts, maxAge)
 	// If the method is POST then check resource owner credentials
 	if r.Method == "POST" {
 		err := r.ParseForm()
 		if err != nil {
-			s.AuthorizationHandler(client, nil, err, "").ServeHTTP(w, r)
+			s.renderAuthorization(w, r, ChallengeError, client, nil, err, "")
+			return
+		}
+		credentials := s.credentials(r)
+		username := credentials.Username
+		// The resource owner may decline some of the requested authorization details
+		details = approvedAuthorizationDetails(r, details)
+		// If no credentials were submitted by an authenticated resource owner then the submission approves
+		// the requested scope using the existing login session.
+		if username == "" && hasSession {
+			// The approval must come from the consent form rendered for this session, not another site
+			if !s.checkConsentToken(r, consentPurposeAuthorize, clientID, session) {
+				s.renderAuthorization(w, r, ChallengeError, client, scope, ErrorAccessDenied, "")
+				return
+			}
+			allowed, err := s.authorizeSession(r, client, session, scope)
+			if err != nil || !allowed {
+				s.renderAuthorization(w, r, ChallengeError, client, scope, ErrorUnauthorizedClient, "")
+				return
+			}
+			s.recordConsent(r, clientID, session.Username, scope)
+			s.redirectWithAuthorizationCode(w, r, client, uri, session.Username, session.AuthTime, scope, details)
 			return
 		}
-		username := r.PostFormValue("username")
-		password := r.PostFormValue("password")
 		// Check that the client is permitted to act on behalf of the resource owner.
 		allowed, err := client.AuthorizeResourceOwner(username)
 		if err != nil {
-			s.AuthorizationHandler(client, scope, err, "").ServeHTTP(w, r)
+			s.renderAuthorization(w, r, ChallengeError, client, scope, err, "")
 			return
 		}
 		if !allowed {
-			s.AuthorizationHandler(client, scope, ErrorUnauthorizedClient, "").ServeHTTP(w, r)
+			s.renderAuthorization(w, r, ChallengeError, client, scope, ErrorUnauthorizedClient, "")
 			return
 		}
-		isAuthorized, err := s.Authenticator.AuthorizeResourceOwner(username, Secret(password), scope)
+		isAuthorized, err := s.authorizeResourceOwner(r, s.resourceOwnerRequest(r, credentials, r.FormValue(ParamClientID), client, scope))
 		if err != nil {
-			s.AuthorizationHandler(client, scope, fmt.Errorf("username or password invalid"), "").ServeHTTP(w, r)
+			s.renderAuthorization(w, r, ChallengeError, client, scope, fmt.Errorf("username or password invalid"), "")
 			return
 		}
 		if !isAuthorized {
-			s.AuthorizationHandler(client, scope, fmt.Errorf("not authorized for requested scope"), "").ServeHTTP(w, r)
+			s.renderAuthorization(w, r, ChallengeError, client, scope, fmt.Errorf("not authorized for requested scope"), "")
 			return
 		}
-		authCode, err := s.SessionStore.NewAuthorizationCode(clientID, r.FormValue(ParamRedirectURI), scope)
-		if err != nil {
-			s.AuthorizationHandler(client, scope, fmt.Errorf("an internal server error occurred, please try again"), "").ServeHTTP(w, r)
+		// The resource owner approved the scope shown alongside the login form
+		s.recordConsent(r, clientID, username, scope)
+		// Remember the resource owner so that subsequent requests can skip the login form
+		authTime := timeNow()
+		if s.SessionAuthenticator != nil {
+			err = s.SessionAuthenticator.SetLoginSession(w, r, LoginSession{Username: username, AuthTime: authTime})
+			if err != nil {
+				s.renderAuthorization(w, r, ChallengeError, client, scope, fmt.Errorf("an internal server error occurred, please try again"), "")
+				return
+			}
+		}
+		s.redirectWithAuthorizationCode(w, r, client, uri, username, authTime, scope, details)
+		return
+	}
+	// Trusted clients never require consent, so only a request to select an account prompts the resource
+	// owner. Other clients require consent unless the resource owner has already approved the scope.
+	consent := !isTrustedClient(client) && (hasPrompt(PromptConsent, prompts) || (hasSession && !s.hasConsent(r, client, clientID, session.Username, scope)))
+	if hasSession && !consent && !hasPrompt(PromptSelectAccount, prompts) {
+		// The resource owner is already authenticated so the code can be issued without interaction
+		allowed, err := s.authorizeSession(r, client, session, scope)
+		if err != nil || !allowed {
+			s.authCodeErrorRedirect(w, r, uri, ErrorAccessDenied)
 			return
 		}
-		// The AuthorizationCode has been approved therefore redirect including the code
-		values := uri.Query()
-		values.Add(ParamCode, authCode.Code.RawString())
-		// If the state param was included then make sure it is passed onto the redirect
-		if r.FormValue(ParamState) != "" {
-			values.Add(ParamState, r.FormValue(ParamState))
+		s.redirectWithAuthorizationCode(w, r, client, uri, session.Username, session.AuthTime, scope, details)
+		return
+	}
+	if hasPrompt(PromptNone, prompts) {
+		// The resource owner would need to interact with the authorization server
+		e := ErrorLoginRequired
+		if hasSession {
+			e = ErrorConsentRequired
 		}
-		uri.RawQuery = values.Encode()
-		urlStr := uri.String()
-		http.Redirect(w, r, urlStr, http.StatusFound)
+		s.authCodeErrorRedirect(w, r, uri, e)
 		return
 	}
 	actionURL := url.Values{}
@@ -188,95 +281,251 @@ func (s Server) handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Requ
 	if r.FormValue(ParamState) != "" {
 		actionURL.Add(ParamState, r.FormValue(ParamState))
 	}
-	s.AuthorizationHandler(client, scope, nil, actionURL.Encode()).ServeHTTP(w, r)
+	if details != nil {
+		actionURL.Add(ParamAuthorizationDetails, r.FormValue(ParamAuthorizationDetails))
+	}
+	// Carry max_age to the form submission so that a login session too old for the request is not used
+	if r.FormValue(ParamMaxAge) != "" {
+		actionURL.Add(ParamMaxAge, r.FormValue(ParamMaxAge))
+	}
+	if r.FormValue(ParamNonce) != "" {
+		actionURL.Add(ParamNonce, r.FormValue(ParamNonce))
+	}
+	if challenge != "" {
+		actionURL.Add(ParamCodeChallenge, challenge)
+		actionURL.Add(ParamCodeChallengeMethod, r.FormValue(ParamCodeChallengeMethod))
+	}
+	// An authenticated resource owner only needs to consent to the request
+	authChallenge := ChallengeLoginRequired
+	if hasSession {
+		authChallenge = ChallengeConsentRequired
+		actionURL.Add(ParamConsentToken, s.consentToken(consentPurposeAuthorize, clientID, session))
+	}
+	action, err := s.sealFlow(r, actionURL)
+	if err != nil {
+		s.authCodeErrorRedirect(w, r, uri, ErrorServerError)
+		return
+	}
+	s.renderAuthorization(w, r, authChallenge, client, scope, nil, s.authorizationActionURL(action))
+}
+
+// authorizationActionURL returns the URL of the authorization endpoint with the encoded query. Without an
+// Issuer the URL only contains the query, which resolves against the authorization endpoint wherever the
+// Server is mounted.
+func (s *Server) authorizationActionURL(query string) string {
+	return s.issuerURL(AuthorizeEnpoint) + "?" + query
+}
+
+// issuerURL returns the absolute URL of the endpoint beneath the Issuer, or an empty string if the Issuer
+// is not set.
+func (s *Server) issuerURL(endpoint string) string {
+	if s.Issuer == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.Issuer, "/") + endpoint
+}
+
+// redirectWithAuthorizationCode creates a new AuthorizationCode for the request approved by the resource owner
+// and redirects the user agent to the redirect URI including the code.
+func (s *Server) redirectWithAuthorizationCode(w http.ResponseWriter, r *http.Request, client Client, uri *url.URL, username string, authTime time.Time, scope []string, details []AuthorizationDetail) {
+	scope, err := s.authorizeOwnerScope(username, scope)
+	if err != nil {
+		e, ok := asError(err)
+		if !ok {
+			e = ErrorServerError
+		}
+		s.authCodeErrorRedirect(w, r, uri, e)
+		return
+	}
+	// The code challenge method has already been validated by the authorization endpoint
+	method, _ := parseCodeChallengeMethod(r.FormValue(ParamCodeChallengeMethod))
+	challenge := r.FormValue(ParamCodeChallenge)
+	if challenge == "" {
+		method = ""
+	}
+	authCode, err := s.sessionStore(r).NewAuthorizationCodeFor(AuthorizationCode{
+		ClientID:             r.FormValue(ParamClientID),
+		RedirectURI:          r.FormValue(ParamRedirectURI),
+		Scope:                scope,
+		Username:             username,
+		AuthTime:             authTime,
+		CodeChallenge:        challenge,
+		CodeChallengeMethod:  method,
+		AuthorizationDetails: details,
+		Nonce:                r.FormValue(ParamNonce),
+		ExpiresIn:            s.authorizationCodeExpiry(),
+	})
+	if err != nil {
+		s.renderAuthorization(w, r, ChallengeError, client, scope, fmt.Errorf("an internal server error occurred, please try again"), "")
+		return
+	}
+	s.PublishEvent(r.Context(), Event{Type: EventConsentGranted, ClientID: authCode.ClientID, Username: username, Scope: scope})
+	// The AuthorizationCode has been approved therefore redirect including the code
+	values := uri.Query()
+	values.Add(ParamCode, authCode.Code.RawString())
+	// If the state param was included then make sure it is passed onto the redirect
+	if r.FormValue(ParamState) != "" {
+		values.Add(ParamState, r.FormValue(ParamState))
+	}
+	s.addIssuer(values)
+	uri.RawQuery = values.Encode()
+	urlStr := uri.String()
+	s.authorizationRedirect(w, r, urlStr)
+}
+
+// authCodeErrorRedirect redirects the user agent to the redirect URI including the error in the query.
+func (s *Server) authCodeErrorRedirect(w http.ResponseWriter, r *http.Request, uri *url.URL, e Error) {
+	if localized, ok := asError(s.ErrorMessages.Localize(r, e)); ok {
+		e = localized
+	}
+	values := uri.Query()
+	values.Add(ParamError, e.Code)
+	values.Add(ParamErrorDescription, e.Description)
+	if r.FormValue(ParamState) != "" {
+		values.Add(ParamState, r.FormValue(ParamState))
+	}
+	s.addIssuer(values)
+	uri.RawQuery = values.Encode()
+	s.authorizationRedirect(w, r, uri.String())
+}
+
+// addIssuer adds the Issuer to the parameters of an authorization response, allowing clients to detect
+// mix-up attacks.
+func (s *Server) addIssuer(values url.Values) {
+	if s.Issuer != "" {
+		values.Set(ParamIssuer, s.Issuer)
+	}
 }
 
-func (s Server) handleAuthCodeTokenRequest(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleAuthCodeTokenRequest(w http.ResponseWriter, r *http.Request) {
 	// Parse the form
 	err := r.ParseForm()
 	if err != nil {
-		s.ErrorHandler(w, http.StatusInternalServerError, err)
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 		return
 	}
-	// Authorize the client using basic auth
-	clientID, clientSecret, ok := r.BasicAuth()
-	if !ok {
+	// Authorize confidential clients using basic auth, public clients are identified by the client_id
+	clientID, client, err := s.authenticateClient(r)
+	if err == ErrorAccessDenied {
 		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
 		return
 	}
-	client, err := s.Authenticator.GetClientWithSecret(clientID, Secret(clientSecret))
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
 		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorUnauthorizedClient)
 		return
 	}
 	// Check that the client is allowed for this grant type
-	ok = client.AllowStrategy(StrategyAuthorizationCode)
+	ok := client.AllowStrategy(StrategyAuthorizationCode)
 	if !ok {
 		// The client is not authorized for the grant type, therefore, return an error
-		w.WriteHeader(http.StatusUnauthorized)
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
 		return
 	}
 	// Check that the request is using the correct grant type
 	if r.PostFormValue(ParamGrantType) != GrantTypeAuthorizationCode {
-		w.WriteHeader(http.StatusBadRequest)
 		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 		return
 	}
 	// Get the code value from the request
 	code := r.PostFormValue(ParamCode)
 	if code == "" {
-		w.WriteHeader(http.StatusUnauthorized)
 		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
 		return
 	}
 	// Get the redirect URI, this is required if a redirect URI was used to generate the token
 	redirectURI := r.PostFormValue(ParamRedirectURI)
+	// Retries of a request with an idempotency key receive the original response as the code has been used.
+	// The retry must repeat the redirect URI and code verifier, which are checked against the code before
+	// the response is first stored, so the response cannot be replayed without them.
+	var idempotent *idempotentRequest
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+			return
+		}
+		idempotent = &idempotentRequest{clientID, key, code, redirectURI, r.PostFormValue(ParamCodeVerifier)}
+		if s.replayIdempotentResponse(w, r, *idempotent) {
+			return
+		}
+	}
 	// Check that the authorization code is valid
-	authCode, err := s.SessionStore.CheckAuthorizationCode(Secret(code), redirectURI)
+	authCode, err := s.sessionStore(r).CheckAuthorizationCode(Secret(code), redirectURI)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
 		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
 		return
 	}
 	// Check that the auth code was created for this client
 	if authCode.ClientID != clientID {
-		w.WriteHeader(http.StatusUnauthorized)
+		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+		return
+	}
+	// Check the PKCE code verifier if the code was issued with a code challenge
+	if !authCode.CheckCodeVerifier(r.PostFormValue(ParamCodeVerifier)) {
 		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
 		return
 	}
 	// Also check the redirect URI against the authenticated client
 	ok = client.AllowRedirectURI(redirectURI)
 	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
 		return
 	}
-	// If valid, remove the authorization code
-	err = s.SessionStore.DeleteAuthorizationCode(Secret(code))
+	// If valid, consume the authorization code so that concurrent exchanges of the same code cannot both
+	// succeed
+	_, err = s.sessionStore(r).ConsumeAuthorizationCode(Secret(code))
+	if errors.Is(err, ErrorAccessDenied) {
+		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+		return
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+		s.internalError(w, r, err)
+		return
+	}
+	// Check that the risk of issuing the grant is acceptable
+	e, ok := s.evaluateRisk(r, RiskContext{
+		ClientID:  clientID,
+		Client:    client,
+		Username:  authCode.Username,
+		GrantType: GrantTypeAuthorizationCode,
+		Scope:     authCode.Scope,
+	})
+	if !ok {
+		s.ErrorHandler(w, e.StatusCode, e)
 		return
 	}
-	grant, err := client.CreateGrant(authCode.Scope)
+	grant, err := s.createGrant(r, client, authCode.Username, authCode.Scope)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+		s.internalError(w, r, err)
 		return
 	}
-	err = s.SessionStore.PutGrant(grant)
+	grant.AuthorizationDetails = authCode.AuthorizationDetails
+	grant.AuthTime = authCode.AuthTime
+	grant.Nonce = authCode.Nonce
+	// A refresh token is only issued if the resource owner consented to offline access
+	if !s.offlineAccess(authCode.Scope) {
+		grant.RefreshToken = ""
+	}
+	err = s.issueGrant(r, clientID, client, authCode.Username, &grant)
+	if err == nil {
+		err = s.storeGrant(r, &grant)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+		s.internalError(w, r, err)
 		return
 	}
 	// Write the grant to the http response
-	err = grant.Write(w)
+	err = s.writeIdempotentGrant(w, r, idempotent, grant)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+		s.internalError(w, r, err)
 		return
 	}
 }
+
+// authorizationCodeExpiry returns the Server's AuthorizationCodeExpiry, or DefaultAuthorizationCodeExpiry if
+// it is not set.
+func (s *Server) authorizationCodeExpiry() time.Duration {
+	if s.AuthorizationCodeExpiry > 0 {
+		return s.AuthorizationCodeExpiry
+	}
+	return DefaultAuthorizationCodeExpiry
+}
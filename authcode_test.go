@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -51,17 +52,15 @@ func (t *testAuthCodeGrant) AuthorizeResourceOwner(username string, password Sec
 // should check against the specified behaviour documented here: http://tools.ietf.org/html/rfc6749#section-4.1
 func TestAuthCodeHandler(t *testing.T) {
 
-	// Override NewToken to return a known value
-	NewToken = func() (Secret, error) {
-		return Secret("testtoken"), nil
-	}
-
-	// Set the default expiry for authorization codes to a low value
-	DefaultAuthorizationCodeExpiry = time.Millisecond
-
 	server := newTestHandler()
+	// Set the expiry for authorization codes to a low value
+	server.AuthorizationCodeExpiry = time.Millisecond
+	// Generate a known value for each token
+	server.TokenSource = TokenSourceFunc(func() (Secret, error) {
+		return Secret("testtoken"), nil
+	})
 	var err error
-	server.AuthorizationHandler = func(client Client, scope []string, authErr error, actionURL string) http.Handler {
+	server.AuthorizationHandler = func(req AuthorizationRequest) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			t, err := template.New("authcodegrant").Parse(`{{.Client.ID}}|{{.Scope}}|{{.Error}}`)
 			if err != nil {
@@ -69,10 +68,10 @@ func TestAuthCodeHandler(t *testing.T) {
 				return
 			}
 			err = t.Execute(w, map[string]interface{}{
-				"Client":    client,
-				"Scope":     scope,
-				"Error":     authErr,
-				"ActionURL": actionURL,
+				"Client":    req.Client,
+				"Scope":     req.Scope,
+				"Error":     req.Error,
+				"ActionURL": req.ActionURL,
 			})
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -238,7 +237,8 @@ func TestAuthCodeHandler(t *testing.T) {
 				if m["access_token"] != "testtoken" {
 					t.Errorf("Test failed, got %s but expected something else", r.Body.Bytes())
 				}
-				if m["refresh_token"] != "testtoken" {
+				// Offline access was not requested so no refresh token is issued
+				if _, ok := m["refresh_token"]; ok {
 					t.Errorf("Test failed, got %s but expected something else", r.Body.Bytes())
 				}
 				if m["expires_in"] != 3600.00 {
@@ -385,3 +385,45 @@ func TestAuthCodeHandler(t *testing.T) {
 		},
 	})
 }
+
+func TestConcurrentCodeExchange(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	authCode, err := server.SessionStore.NewAuthorizationCodeFor(AuthorizationCode{
+		ClientID:    "testclientid",
+		RedirectURI: "https://testuri.com",
+		Scope:       []string{"testscope"},
+		Username:    "testusername",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only one of the concurrent exchanges of the code receives a grant
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=authorization_code&redirect_uri=https://testuri.com&code="+authCode.Code.RawString()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.SetBasicAuth("testclientid", "testclientsecret")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	var succeeded int
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		} else if code != http.StatusUnauthorized {
+			t.Errorf("Test failed, expected status %d got %d", http.StatusUnauthorized, code)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("Test failed, expected one exchange to succeed got %d", succeeded)
+	}
+}
@@ -0,0 +1,167 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultFailureWindow is the period over which a MemFailureCounter counts failed attempts if its Window
+	// is not set.
+	DefaultFailureWindow = 15 * time.Minute
+)
+
+// AuthContext describes the circumstances of an attempt by a resource owner to authenticate, allowing
+// Authenticators to apply adaptive policies such as requiring a second factor for unfamiliar locations or
+// slowing down repeated failures.
+type AuthContext struct {
+	// IP is the IP address of the request, as returned by Server.RealIP.
+	IP string
+	// UserAgent is the User-Agent header of the request.
+	UserAgent string
+	// Geo is the location of the IP address according to the Server's GeoResolver. It is nil if the Server
+	// has no GeoResolver or the address could not be resolved.
+	Geo *GeoHint
+	// RecentFailures is the number of failed attempts to authenticate as the username recorded by the
+	// Server's FailureCounter, not including this attempt. It is zero if the Server has no FailureCounter.
+	RecentFailures int
+}
+
+// GeoHint is the approximate location of an IP address. Fields that are unknown are empty.
+type GeoHint struct {
+	// Country is the ISO 3166-1 alpha-2 country code.
+	Country   string
+	Region    string
+	City      string
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoResolver resolves the location of IP addresses, such as using a GeoIP database. It should return
+// quickly, as it is called while serving each attempt to authenticate.
+type GeoResolver interface {
+	ResolveGeo(ctx context.Context, ip string) (GeoHint, error)
+}
+
+// GeoResolverFunc is an adapter allowing a function to be used as a GeoResolver.
+type GeoResolverFunc func(ctx context.Context, ip string) (GeoHint, error)
+
+// ResolveGeo calls f(ctx, ip).
+func (f GeoResolverFunc) ResolveGeo(ctx context.Context, ip string) (GeoHint, error) {
+	return f(ctx, ip)
+}
+
+// FailureCounter records failed attempts by resource owners to authenticate. The Server records a failure
+// each time the Authenticator rejects the credentials of a username, and resets the failures once it
+// accepts them. Servers sharing a FailureCounter, such as one backed by Redis, see the attempts made to each.
+type FailureCounter interface {
+	// RecordFailure records a failed attempt to authenticate as the username.
+	RecordFailure(ctx context.Context, username string) error
+	// RecentFailures returns the number of recent failed attempts to authenticate as the username.
+	RecentFailures(ctx context.Context, username string) (int, error)
+	// ResetFailures forgets the failed attempts to authenticate as the username.
+	ResetFailures(ctx context.Context, username string) error
+}
+
+// MemFailureCounter is an in-memory FailureCounter counting the failures within its Window.
+type MemFailureCounter struct {
+	// Window is the period over which failures are counted. If zero, DefaultFailureWindow is used.
+	Window time.Duration
+
+	mtx      sync.Mutex
+	failures map[string][]time.Time
+}
+
+// NewMemFailureCounter returns a MemFailureCounter counting failures within the window.
+func NewMemFailureCounter(window time.Duration) *MemFailureCounter {
+	return &MemFailureCounter{Window: window}
+}
+
+func (m *MemFailureCounter) window() time.Duration {
+	if m.Window > 0 {
+		return m.Window
+	}
+	return DefaultFailureWindow
+}
+
+// recent returns the failures of the username within the window, discarding older failures. The lock must
+// be held.
+func (m *MemFailureCounter) recent(username string) []time.Time {
+	since := timeNow().Add(-m.window())
+	failures := m.failures[username]
+	i := 0
+	for i < len(failures) && !failures[i].After(since) {
+		i++
+	}
+	failures = failures[i:]
+	if len(failures) == 0 {
+		delete(m.failures, username)
+		return nil
+	}
+	m.failures[username] = failures
+	return failures
+}
+
+// RecordFailure records a failed attempt to authenticate as the username.
+func (m *MemFailureCounter) RecordFailure(ctx context.Context, username string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.failures == nil {
+		m.failures = make(map[string][]time.Time)
+	}
+	m.failures[username] = append(m.recent(username), timeNow())
+	return nil
+}
+
+// RecentFailures returns the number of failed attempts to authenticate as the username within the window.
+func (m *MemFailureCounter) RecentFailures(ctx context.Context, username string) (int, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.failures == nil {
+		return 0, nil
+	}
+	return len(m.recent(username)), nil
+}
+
+// ResetFailures forgets the failed attempts to authenticate as the username.
+func (m *MemFailureCounter) ResetFailures(ctx context.Context, username string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.failures, username)
+	return nil
+}
+
+// authContext returns the AuthContext of an attempt to authenticate as the username. Failures of the
+// GeoResolver and FailureCounter do not prevent the attempt, their fields are left empty.
+func (s *Server) authContext(r *http.Request, username string) AuthContext {
+	fingerprint := s.fingerprint(r)
+	ac := AuthContext{
+		IP:        fingerprint.IP,
+		UserAgent: fingerprint.UserAgent,
+	}
+	if s.GeoResolver != nil && ac.IP != "" {
+		geo, err := s.GeoResolver.ResolveGeo(r.Context(), ac.IP)
+		if err == nil {
+			ac.Geo = &geo
+		}
+	}
+	if s.FailureCounter != nil && username != "" {
+		ac.RecentFailures, _ = s.FailureCounter.RecentFailures(r.Context(), username)
+	}
+	return ac
+}
+
+// recordAttempt records the outcome of an attempt to authenticate as the username with the Server's
+// FailureCounter, if any.
+func (s *Server) recordAttempt(r *http.Request, username string, authorized bool) {
+	if s.FailureCounter == nil || username == "" {
+		return
+	}
+	if authorized {
+		s.FailureCounter.ResetFailures(r.Context(), username)
+		return
+	}
+	s.FailureCounter.RecordFailure(r.Context(), username)
+}
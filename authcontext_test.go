@@ -0,0 +1,103 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthContext(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	authenticator := &testResourceOwnerAuthenticator{testAuthenticator: server.Authenticator.(*testAuthenticator)}
+	server.Authenticator = authenticator
+	server.FailureCounter = NewMemFailureCounter(time.Hour)
+	server.GeoResolver = GeoResolverFunc(func(ctx context.Context, ip string) (GeoHint, error) {
+		if ip == "198.51.100.7" {
+			return GeoHint{Country: "NZ", City: "Wellington"}, nil
+		}
+		return GeoHint{}, errors.New("unknown address")
+	})
+
+	attempt := func(remoteAddr, password string) int {
+		w := httptest.NewRecorder()
+		body := url.Values{"grant_type": {"password"}, "username": {"testusername"}, "password": {password}, "scope": {"testscope"}}
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(body.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("User-Agent", "testagent")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		r.RemoteAddr = remoteAddr
+		server.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := attempt("203.0.113.9:1234", "wrongpassword"); code != http.StatusUnauthorized {
+			t.Fatalf("Test failed, expected the attempt to fail got %d", code)
+		}
+	}
+	if code := attempt("198.51.100.7:1234", "testpassword"); code != http.StatusOK {
+		t.Fatalf("Test failed, expected the attempt to succeed got %d", code)
+	}
+	if code := attempt("198.51.100.7:1234", "wrongpassword"); code != http.StatusUnauthorized {
+		t.Fatalf("Test failed, expected the attempt to fail got %d", code)
+	}
+	expected := []struct {
+		IP       string
+		Country  string
+		Failures int
+	}{
+		{"203.0.113.9", "", 0},
+		{"203.0.113.9", "", 1},
+		{"198.51.100.7", "NZ", 2},
+		// Failures are reset once the resource owner authenticates
+		{"198.51.100.7", "NZ", 0},
+	}
+	if len(authenticator.requests) != len(expected) {
+		t.Fatalf("Test failed, expected %d requests got %d", len(expected), len(authenticator.requests))
+	}
+	for i, e := range expected {
+		ac := authenticator.requests[i].AuthContext
+		if ac.IP != e.IP || ac.UserAgent != "testagent" || ac.RecentFailures != e.Failures {
+			t.Errorf("Test failed, unexpected auth context %+v for attempt %d", ac, i)
+		}
+		if (ac.Geo == nil) != (e.Country == "") || (ac.Geo != nil && ac.Geo.Country != e.Country) {
+			t.Errorf("Test failed, expected country %q for attempt %d got %+v", e.Country, i, ac.Geo)
+		}
+	}
+}
+
+func TestMemFailureCounter(t *testing.T) {
+	now := time.Now()
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+	ctx := context.Background()
+	counter := NewMemFailureCounter(time.Minute)
+	if n, err := counter.RecentFailures(ctx, "alice"); err != nil || n != 0 {
+		t.Errorf("Test failed, expected no failures got %d: %v", n, err)
+	}
+	counter.RecordFailure(ctx, "alice")
+	now = now.Add(30 * time.Second)
+	counter.RecordFailure(ctx, "alice")
+	counter.RecordFailure(ctx, "bob")
+	if n, _ := counter.RecentFailures(ctx, "alice"); n != 2 {
+		t.Errorf("Test failed, expected 2 failures got %d", n)
+	}
+	// Failures outside the window are not counted
+	now = now.Add(45 * time.Second)
+	if n, _ := counter.RecentFailures(ctx, "alice"); n != 1 {
+		t.Errorf("Test failed, expected 1 failure got %d", n)
+	}
+	counter.ResetFailures(ctx, "alice")
+	if n, _ := counter.RecentFailures(ctx, "alice"); n != 0 {
+		t.Errorf("Test failed, expected the failures to be reset got %d", n)
+	}
+	if n, _ := counter.RecentFailures(ctx, "bob"); n != 1 {
+		t.Errorf("Test failed, expected the failures of other usernames to be kept got %d", n)
+	}
+}
@@ -0,0 +1,59 @@
+package goauth
+
+import "net/http"
+
+// AuthorizationRequest is an authorization request as parsed and validated by the authorization endpoint. It
+// is passed to the AuthorizationHandler so that custom consent UIs do not need to parse the request again.
+type AuthorizationRequest struct {
+	// ClientID identifies the Client making the request. The Client is nil if it could not be found.
+	ClientID string
+	Client   Client
+	// ClientMetadata describes the client if it is a MetadataProvider.
+	ClientMetadata ClientMetadata
+	// RequestedScope is the scope parameter of the request and Scope the scope approved by the client and
+	// ScopePolicy, which the resource owner is asked to grant.
+	RequestedScope []string
+	Scope          []string
+	RedirectURI    string
+	State          string
+	// CodeChallenge and CodeChallengeMethod are the PKCE parameters of the request, if any.
+	CodeChallenge       string
+	CodeChallengeMethod CodeChallengeMethod
+	// Prompt lists the prompt values of the request and LoginHint is its login_hint parameter.
+	Prompt    []Prompt
+	LoginHint string
+	// AuthorizationDetails are the authorization details that the resource owner may approve.
+	AuthorizationDetails []ConsentDetail
+	// Locales are the languages accepted by the user agent in order of preference.
+	Locales []string
+	// ActionURL is the URL to which the form should be submitted. It is absolute if the Server's Issuer is
+	// set, otherwise it is relative to the authorization endpoint. It is empty if the request failed.
+	ActionURL string
+	// Error is the reason the request failed, if any, localized according to Locales.
+	Error error
+}
+
+// authorizationRequest returns the AuthorizationRequest displayed by the authorization UI.
+func (s *Server) authorizationRequest(r *http.Request, client Client, scope []string, authErr error, actionURL string) AuthorizationRequest {
+	req := AuthorizationRequest{
+		ClientID:             r.FormValue(ParamClientID),
+		Client:               client,
+		ClientMetadata:       clientMetadata(client),
+		RequestedScope:       s.parseScope(r.FormValue(ParamScope)),
+		Scope:                scope,
+		RedirectURI:          r.FormValue(ParamRedirectURI),
+		State:                r.FormValue(ParamState),
+		CodeChallenge:        r.FormValue(ParamCodeChallenge),
+		LoginHint:            GetAuthorizationHints(r).LoginHint,
+		AuthorizationDetails: GetConsentDetails(r),
+		Locales:              acceptedLanguages(r),
+		ActionURL:            actionURL,
+		Error:                s.ErrorMessages.Localize(r, authErr),
+	}
+	if req.CodeChallenge != "" {
+		req.CodeChallengeMethod, _ = parseCodeChallengeMethod(r.FormValue(ParamCodeChallengeMethod))
+	}
+	// The prompt parameter has already been validated by the authorization endpoint
+	req.Prompt, _ = parsePrompt(r.FormValue(ParamPrompt))
+	return req
+}
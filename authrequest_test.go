@@ -0,0 +1,43 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuthorizationRequest(t *testing.T) {
+	server := newTestHandler()
+	var req AuthorizationRequest
+	server.AuthorizationHandler = func(r AuthorizationRequest) http.Handler {
+		req = r
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	}
+	challenge := strings.Repeat("a", 43)
+	r := httptest.NewRequest("GET", AuthorizeEnpoint+"?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope+otherscope&state=xyz&prompt=login&login_hint=alice&code_challenge="+challenge+"&code_challenge_method=S256", nil)
+	r.Header.Set("Accept-Language", "fr-FR, en;q=0.5")
+	server.ServeHTTP(httptest.NewRecorder(), r)
+
+	expected := AuthorizationRequest{
+		ClientID:            "testclientid",
+		Client:              server.Authenticator.(*testAuthenticator).client,
+		RequestedScope:      []string{"testscope", "otherscope"},
+		Scope:               []string{"testscope"},
+		RedirectURI:         "https://testuri.com",
+		State:               "xyz",
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: CodeChallengeMethodS256,
+		Prompt:              []Prompt{PromptLogin},
+		LoginHint:           "alice",
+		Locales:             []string{"fr-FR", "en"},
+		ActionURL:           req.ActionURL,
+	}
+	if !reflect.DeepEqual(req, expected) {
+		t.Errorf("Test failed, expected %+v got %+v", expected, req)
+	}
+	if !strings.HasPrefix(req.ActionURL, "?") {
+		t.Errorf("Test failed, unexpected action URL %q", req.ActionURL)
+	}
+}
@@ -0,0 +1,141 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// ParamAuthorizationDetails is the parameter of authorization and token requests containing a JSON array
+// of AuthorizationDetail objects as per https://tools.ietf.org/html/rfc9396.
+const ParamAuthorizationDetails = "authorization_details"
+
+// AuthorizationDetail describes fine-grained access requested by a client, such as a payment initiation,
+// where scope is too coarse. Every detail has a type which determines its other fields.
+type AuthorizationDetail map[string]interface{}
+
+// Type returns the type of the AuthorizationDetail.
+func (a AuthorizationDetail) Type() string {
+	t, _ := a["type"].(string)
+	return t
+}
+
+// AuthorizationDetailsValidator validates the authorization details requested by clients. Requests
+// containing authorization details are rejected unless the Server has an AuthorizationDetailsValidator.
+type AuthorizationDetailsValidator interface {
+	// ValidateAuthorizationDetails returns the details that may be granted to the client, or an error if
+	// the details are invalid or include an unknown type.
+	ValidateAuthorizationDetails(ctx context.Context, clientID string, client Client, details []AuthorizationDetail) ([]AuthorizationDetail, error)
+}
+
+// AuthorizationDetailsValidatorFunc is a function implementing the AuthorizationDetailsValidator interface.
+type AuthorizationDetailsValidatorFunc func(ctx context.Context, clientID string, client Client, details []AuthorizationDetail) ([]AuthorizationDetail, error)
+
+// ValidateAuthorizationDetails calls f(ctx, clientID, client, details).
+func (f AuthorizationDetailsValidatorFunc) ValidateAuthorizationDetails(ctx context.Context, clientID string, client Client, details []AuthorizationDetail) ([]AuthorizationDetail, error) {
+	return f(ctx, clientID, client, details)
+}
+
+// ParseAuthorizationDetails parses the value of the authorization_details parameter. It returns an error
+// if the value is not an array of objects each having a type.
+func ParseAuthorizationDetails(raw string) ([]AuthorizationDetail, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var details []AuthorizationDetail
+	err := json.Unmarshal([]byte(raw), &details)
+	if err != nil {
+		return nil, ErrorInvalidAuthorizationDetails
+	}
+	for _, d := range details {
+		if d.Type() == "" {
+			return nil, ErrorInvalidAuthorizationDetails
+		}
+	}
+	return details, nil
+}
+
+// requestAuthorizationDetails parses the authorization details of the request and validates them for the
+// client. It returns ErrorInvalidAuthorizationDetails if they are invalid.
+func (s *Server) requestAuthorizationDetails(r *http.Request, clientID string, client Client) ([]AuthorizationDetail, error) {
+	details, err := ParseAuthorizationDetails(r.FormValue(ParamAuthorizationDetails))
+	if err != nil || details == nil {
+		return nil, err
+	}
+	if s.AuthorizationDetailsValidator == nil {
+		return nil, ErrorInvalidAuthorizationDetails
+	}
+	details, err = s.AuthorizationDetailsValidator.ValidateAuthorizationDetails(r.Context(), clientID, client, details)
+	if err != nil {
+		return nil, ErrorInvalidAuthorizationDetails
+	}
+	return details, nil
+}
+
+const (
+	// ParamApprovedAuthorizationDetails is submitted to the authorization endpoint with the index of each
+	// authorization detail approved by the resource owner.
+	ParamApprovedAuthorizationDetails = "approved_authorization_details"
+	// ParamAuthorizationDetailsReviewed is submitted to the authorization endpoint to indicate that the
+	// resource owner was able to approve the authorization details individually. Without it all of the
+	// requested details are approved.
+	ParamAuthorizationDetailsReviewed = "authorization_details_reviewed"
+)
+
+// AuthorizationDetailDescriber may be implemented by an AuthorizationDetailsValidator to describe each
+// detail to the resource owner, such as "Transfer £20.00 to account X". Without it the type is shown.
+type AuthorizationDetailDescriber interface {
+	DescribeAuthorizationDetail(detail AuthorizationDetail) string
+}
+
+// ConsentDetail is an AuthorizationDetail presented to the resource owner for approval.
+type ConsentDetail struct {
+	// Index identifies the detail in the ParamApprovedAuthorizationDetails parameter.
+	Index       int                 `json:"index"`
+	Detail      AuthorizationDetail `json:"detail"`
+	Description string              `json:"description"`
+}
+
+type consentDetailsKey struct{}
+
+// GetConsentDetails returns the authorization details of an authorization request for display by the
+// AuthorizationHandler.
+func GetConsentDetails(r *http.Request) []ConsentDetail {
+	details, _ := r.Context().Value(consentDetailsKey{}).([]ConsentDetail)
+	return details
+}
+
+// withConsentDetails attaches the validated authorization details of an authorization request to its
+// context.
+func (s *Server) withConsentDetails(r *http.Request, details []AuthorizationDetail) *http.Request {
+	if details == nil {
+		return r
+	}
+	describer, _ := s.AuthorizationDetailsValidator.(AuthorizationDetailDescriber)
+	consent := make([]ConsentDetail, len(details))
+	for i, d := range details {
+		consent[i] = ConsentDetail{Index: i, Detail: d, Description: d.Type()}
+		if describer != nil {
+			consent[i].Description = describer.DescribeAuthorizationDetail(d)
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), consentDetailsKey{}, consent))
+}
+
+// approvedAuthorizationDetails returns the subset of the details approved by the resource owner in the
+// submission of the authorization form.
+func approvedAuthorizationDetails(r *http.Request, details []AuthorizationDetail) []AuthorizationDetail {
+	if details == nil || r.PostFormValue(ParamAuthorizationDetailsReviewed) == "" {
+		return details
+	}
+	approved := []AuthorizationDetail{}
+	for _, v := range r.PostForm[ParamApprovedAuthorizationDetails] {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(details) {
+			continue
+		}
+		approved = append(approved, details[i])
+	}
+	return approved
+}
@@ -0,0 +1,126 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAuthorizationDetails(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	details := `[{"type":"payment_initiation","instructedAmount":{"currency":"GBP","amount":"20.00"},"creditorAccount":"X"}]`
+	request := func(path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	body := "grant_type=client_credentials&scope=testscope&authorization_details=" + url.QueryEscape(details)
+
+	// Authorization details are rejected without a validator
+	if w := request(TokenEndpoint, body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_authorization_details") {
+		t.Errorf("Test failed, expected invalid_authorization_details got %d %s", w.Code, w.Body.String())
+	}
+
+	server.AuthorizationDetailsValidator = AuthorizationDetailsValidatorFunc(func(ctx context.Context, clientID string, client Client, details []AuthorizationDetail) ([]AuthorizationDetail, error) {
+		for _, d := range details {
+			if d.Type() != "payment_initiation" {
+				return nil, ErrorInvalidAuthorizationDetails
+			}
+		}
+		return details, nil
+	})
+	if w := request(TokenEndpoint, "grant_type=client_credentials&authorization_details="+url.QueryEscape(`[{"type":"unknown"}]`)); w.Code != http.StatusBadRequest {
+		t.Errorf("Test failed, expected status 400 for an unknown type got %d", w.Code)
+	}
+	if w := request(TokenEndpoint, "grant_type=client_credentials&authorization_details="+url.QueryEscape(`[{"actions":["read"]}]`)); w.Code != http.StatusBadRequest {
+		t.Errorf("Test failed, expected status 400 for a detail without a type got %d", w.Code)
+	}
+
+	w := request(TokenEndpoint, body)
+	var resp struct {
+		AccessToken          string                `json:"access_token"`
+		AuthorizationDetails []AuthorizationDetail `json:"authorization_details"`
+	}
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.AuthorizationDetails) != 1 || resp.AuthorizationDetails[0]["creditorAccount"] != "X" {
+		t.Errorf("Test failed, unexpected token response %s", w.Body.String())
+	}
+
+	// The details are returned by introspection
+	w = request(IntrospectionEndpoint, "token="+resp.AccessToken)
+	var i struct {
+		Active               bool                  `json:"active"`
+		AuthorizationDetails []AuthorizationDetail `json:"authorization_details"`
+	}
+	err = json.NewDecoder(w.Body).Decode(&i)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !i.Active || len(i.AuthorizationDetails) != 1 || i.AuthorizationDetails[0].Type() != "payment_initiation" {
+		t.Errorf("Test failed, unexpected introspection %+v", i)
+	}
+}
+
+// testPaymentValidator approves payment_initiation details and describes them for consent.
+type testPaymentValidator struct{}
+
+func (testPaymentValidator) ValidateAuthorizationDetails(ctx context.Context, clientID string, client Client, details []AuthorizationDetail) ([]AuthorizationDetail, error) {
+	return details, nil
+}
+
+func (testPaymentValidator) DescribeAuthorizationDetail(detail AuthorizationDetail) string {
+	return "Transfer " + detail["amount"].(string) + " to account " + detail["creditorAccount"].(string)
+}
+
+func TestAuthorizationDetailsConsent(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	session := LoginSession{Username: "testusername", AuthTime: timeNow()}
+	server.SessionAuthenticator = &testSessionAuthenticator{session: &session}
+	server.AuthorizationDetailsValidator = testPaymentValidator{}
+	details := url.QueryEscape(`[{"type":"payment_initiation","amount":"£20.00","creditorAccount":"X"},{"type":"payment_initiation","amount":"£5.00","creditorAccount":"Y"}]`)
+
+	authorize := func(method, body string) AuthorizationChallenge {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&prompt=consent&authorization_details="+details, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", "application/json")
+		server.ServeHTTP(w, r)
+		var c AuthorizationChallenge
+		err := json.NewDecoder(w.Body).Decode(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := authorize("GET", "")
+	if c.Type != ChallengeConsentRequired || len(c.AuthorizationDetails) != 2 || c.AuthorizationDetails[0].Description != "Transfer £20.00 to account X" {
+		t.Fatalf("Test failed, got %+v", c)
+	}
+
+	// The resource owner declines the first payment
+	c = authorize("POST", "authorization_details_reviewed=1&approved_authorization_details=1&consent_token="+server.consentToken(consentPurposeAuthorize, "testclientid", session))
+	redirect, err := url.Parse(c.RedirectTo)
+	if err != nil || c.Type != ChallengeRedirect {
+		t.Fatalf("Test failed, got %+v", c)
+	}
+	code, err := server.SessionStore.GetAuthorizationCode(Secret(redirect.Query().Get(ParamCode)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code.AuthorizationDetails) != 1 || code.AuthorizationDetails[0]["creditorAccount"] != "Y" {
+		t.Errorf("Test failed, expected only the approved detail got %v", code.AuthorizationDetails)
+	}
+}
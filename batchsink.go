@@ -0,0 +1,214 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultEventBatchSize is the maximum number of events in a batch for a BatchingEventSink that does not
+	// set BatchSize.
+	DefaultEventBatchSize = 100
+	// DefaultEventFlushInterval is the maximum time events are buffered by a BatchingEventSink that does not
+	// set FlushInterval.
+	DefaultEventFlushInterval = time.Second
+	// DefaultEventCloseTimeout is the maximum time a BatchingEventSink run as a Component spends delivering
+	// buffered events once stopped, if it does not set CloseTimeout.
+	DefaultEventCloseTimeout = 10 * time.Second
+	// ErrEventSinkClosed is returned when publishing to a BatchingEventSink that has been closed.
+	ErrEventSinkClosed = errors.New("event sink closed")
+)
+
+// EventBatchPublisher delivers a batch of events to an external system. It must return an error unless
+// every event in the batch has been accepted.
+type EventBatchPublisher interface {
+	PublishBatch(ctx context.Context, events []Event) error
+}
+
+// BatchingEventSink is an EventSink that buffers events and delivers them in batches using an
+// EventBatchPublisher. Failed batches are retried, so events are delivered at least once and receivers
+// should use the Event ID to discard duplicates. Close must be called to deliver buffered events before
+// the application exits, or the sink added to the Server using AddComponent so that Server.Close does so.
+type BatchingEventSink struct {
+	// Publisher delivers each batch.
+	Publisher EventBatchPublisher
+	// BatchSize overrides DefaultEventBatchSize if greater than zero.
+	BatchSize int
+	// FlushInterval overrides DefaultEventFlushInterval if greater than zero.
+	FlushInterval time.Duration
+	// MaxRetries is the number of times a failed batch is retried before it is passed to OnError. If zero,
+	// DefaultWebhookMaxRetries is used. If negative, batches are retried until they succeed or the sink is
+	// closed.
+	MaxRetries int
+	// Backoff overrides DefaultWebhookBackoff if greater than zero. The delay doubles with each retry.
+	Backoff time.Duration
+	// CloseTimeout overrides DefaultEventCloseTimeout if greater than zero.
+	CloseTimeout time.Duration
+	// OnError is called with batches that could not be delivered.
+	OnError  func(events []Event, err error)
+	once     sync.Once
+	stopOnce sync.Once
+	mtx      sync.RWMutex
+	closed   bool
+	events   chan Event
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewBatchingEventSink returns a BatchingEventSink delivering events using the publisher.
+func NewBatchingEventSink(publisher EventBatchPublisher) *BatchingEventSink {
+	return &BatchingEventSink{
+		Publisher: publisher,
+	}
+}
+
+// start starts the goroutine delivering events on first use, once the sink has been configured.
+func (b *BatchingEventSink) start() {
+	b.once.Do(func() {
+		b.events = make(chan Event, b.batchSize())
+		b.stop = make(chan struct{})
+		b.done = make(chan struct{})
+		go b.run()
+	})
+}
+
+// Publish satisfies the EventSink interface. It blocks if the buffer is full until the event can be
+// buffered or the context is done.
+func (b *BatchingEventSink) Publish(ctx context.Context, e Event) error {
+	b.start()
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	if b.closed {
+		return ErrEventSinkClosed
+	}
+	select {
+	case b.events <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close delivers any buffered events and stops the sink. It returns once delivery has completed or the
+// context is done, in which case pending retries are abandoned.
+func (b *BatchingEventSink) Close(ctx context.Context) error {
+	b.start()
+	b.mtx.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.events)
+	}
+	b.mtx.Unlock()
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		b.stopOnce.Do(func() { close(b.stop) })
+		<-b.done
+		return ctx.Err()
+	}
+}
+
+// Run satisfies the Component interface. It waits until the context is cancelled, then closes the sink,
+// delivering buffered events for up to the CloseTimeout.
+func (b *BatchingEventSink) Run(ctx context.Context) error {
+	b.start()
+	select {
+	case <-ctx.Done():
+	case <-b.done:
+		return nil
+	}
+	timeout := b.CloseTimeout
+	if timeout <= 0 {
+		timeout = DefaultEventCloseTimeout
+	}
+	closeCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return b.Close(closeCtx)
+}
+
+func (b *BatchingEventSink) batchSize() int {
+	if b.BatchSize > 0 {
+		return b.BatchSize
+	}
+	return DefaultEventBatchSize
+}
+
+func (b *BatchingEventSink) run() {
+	defer close(b.done)
+	interval := b.FlushInterval
+	if interval <= 0 {
+		interval = DefaultEventFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var batch []Event
+	for {
+		select {
+		case e, ok := <-b.events:
+			if !ok {
+				if len(batch) > 0 {
+					b.flush(batch)
+				}
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= b.batchSize() {
+				b.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				b.flush(batch)
+				batch = nil
+			}
+		}
+	}
+}
+
+// flush publishes the batch, retrying with exponential backoff.
+func (b *BatchingEventSink) flush(batch []Event) {
+	retries := b.MaxRetries
+	if retries == 0 {
+		retries = DefaultWebhookMaxRetries
+	}
+	backoff := b.Backoff
+	if backoff <= 0 {
+		backoff = DefaultWebhookBackoff
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-b.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := b.publish(ctx, batch, retries, backoff)
+	if err != nil && b.OnError != nil {
+		b.OnError(batch, err)
+	}
+}
+
+// publish attempts to publish the batch until it succeeds, the retries are exhausted or the context is
+// done.
+func (b *BatchingEventSink) publish(ctx context.Context, batch []Event, retries int, backoff time.Duration) error {
+	for attempt := 0; ; attempt++ {
+		err := b.Publisher.PublishBatch(ctx, batch)
+		if err == nil || (retries > 0 && attempt >= retries) {
+			return err
+		}
+		delay := backoff << uint(attempt)
+		if delay <= 0 || delay > time.Minute {
+			delay = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBatchPublisher records published batches, failing the first failures attempts.
+type testBatchPublisher struct {
+	mtx      sync.Mutex
+	failures int
+	batches  [][]Event
+}
+
+func (t *testBatchPublisher) PublishBatch(ctx context.Context, events []Event) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.failures > 0 {
+		t.failures--
+		return errors.New("unavailable")
+	}
+	t.batches = append(t.batches, events)
+	return nil
+}
+
+func TestBatchingEventSink(t *testing.T) {
+	publisher := &testBatchPublisher{failures: 1}
+	sink := NewBatchingEventSink(publisher)
+	sink.BatchSize = 2
+	sink.FlushInterval = time.Hour
+	sink.Backoff = time.Millisecond
+	for _, id := range []string{"1", "2", "3"} {
+		if err := sink.Publish(context.Background(), Event{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Closing the sink flushes the remaining event
+	if err := sink.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.batches) != 2 || len(publisher.batches[0]) != 2 || publisher.batches[1][0].ID != "3" {
+		t.Errorf("Test failed, unexpected batches %v", publisher.batches)
+	}
+	if err := sink.Publish(context.Background(), Event{}); err != ErrEventSinkClosed {
+		t.Errorf("Test failed, expected %v got %v", ErrEventSinkClosed, err)
+	}
+
+	// Batches that cannot be delivered are passed to OnError
+	var failed []Event
+	sink = NewBatchingEventSink(&testBatchPublisher{failures: 2})
+	sink.MaxRetries = 1
+	sink.Backoff = time.Millisecond
+	sink.OnError = func(events []Event, err error) { failed = events }
+	sink.Publish(context.Background(), Event{ID: "1"})
+	sink.Close(context.Background())
+	if len(failed) != 1 {
+		t.Errorf("Test failed, expected the batch to fail got %v", failed)
+	}
+}
+
+func TestBatchingEventSinkComponent(t *testing.T) {
+	publisher := &testBatchPublisher{}
+	sink := NewBatchingEventSink(publisher)
+	sink.FlushInterval = time.Hour
+	server := newTestHandler()
+	server.EventSink = sink
+	server.AddComponent(sink)
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	server.PublishEvent(context.Background(), Event{ID: "1"})
+	// Closing the Server delivers the buffered event
+	if err := server.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(publisher.batches) != 1 || publisher.batches[0][0].ID != "1" {
+		t.Errorf("Test failed, unexpected batches %v", publisher.batches)
+	}
+
+	// Delivery is abandoned after the CloseTimeout
+	sink = NewBatchingEventSink(&testBatchPublisher{failures: 1})
+	sink.MaxRetries = -1
+	sink.Backoff = time.Hour
+	sink.CloseTimeout = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	sink.Publish(ctx, Event{ID: "1"})
+	cancel()
+	if err := sink.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Test failed, expected %v got %v", context.DeadlineExceeded, err)
+	}
+}
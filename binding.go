@@ -0,0 +1,75 @@
+package goauth
+
+import (
+	"net"
+	"net/http"
+)
+
+// RequestFingerprint identifies the context in which a request was made. When token binding is
+// enabled it is recorded on each Grant and compared against the requests presenting its access token.
+type RequestFingerprint struct {
+	IP        string
+	UserAgent string
+}
+
+// IsZero returns true if no fingerprint has been recorded.
+func (f RequestFingerprint) IsZero() bool {
+	return f.IP == "" && f.UserAgent == ""
+}
+
+// FingerprintMatcher returns true if a token recorded with the fingerprint recorded may be used by a
+// request with the fingerprint presented.
+type FingerprintMatcher func(recorded, presented RequestFingerprint) bool
+
+var (
+	// DefaultFingerprintMatcher is the matcher used when the Server does not define one.
+	DefaultFingerprintMatcher FingerprintMatcher = matchFingerprint
+)
+
+// matchFingerprint requires the user agent to be identical and the IP address to belong to the same /24
+// IPv4 or /64 IPv6 network, tolerating clients that move between addresses of the same provider.
+func matchFingerprint(recorded, presented RequestFingerprint) bool {
+	if recorded.UserAgent != presented.UserAgent {
+		return false
+	}
+	a, b := net.ParseIP(recorded.IP), net.ParseIP(presented.IP)
+	if a == nil || b == nil {
+		return recorded.IP == presented.IP
+	}
+	mask := net.CIDRMask(64, 128)
+	if a.To4() != nil {
+		a, b = a.To4(), b.To4()
+		mask = net.CIDRMask(24, 32)
+	}
+	if b == nil {
+		return false
+	}
+	return a.Mask(mask).Equal(b.Mask(mask))
+}
+
+// fingerprint returns the RequestFingerprint of the request.
+func (s *Server) fingerprint(r *http.Request) RequestFingerprint {
+	return RequestFingerprint{
+		IP:        s.RealIP(r),
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// bindGrant records the fingerprint of the request on the grant if token binding is enabled.
+func (s *Server) bindGrant(r *http.Request, grant *Grant) {
+	if s.TokenBinding {
+		grant.Fingerprint = s.fingerprint(r)
+	}
+}
+
+// checkBinding returns true if the request may use the grant.
+func (s *Server) checkBinding(r *http.Request, grant Grant) bool {
+	if !s.TokenBinding || grant.Fingerprint.IsZero() {
+		return true
+	}
+	match := s.FingerprintMatcher
+	if match == nil {
+		match = DefaultFingerprintMatcher
+	}
+	return match(grant.Fingerprint, s.fingerprint(r))
+}
@@ -0,0 +1,66 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMatchFingerprint(t *testing.T) {
+	recorded := RequestFingerprint{IP: "203.0.113.10", UserAgent: "testagent"}
+	for _, tc := range []struct {
+		presented RequestFingerprint
+		expected  bool
+	}{
+		{RequestFingerprint{IP: "203.0.113.10", UserAgent: "testagent"}, true},
+		{RequestFingerprint{IP: "203.0.113.200", UserAgent: "testagent"}, true},
+		{RequestFingerprint{IP: "198.51.100.10", UserAgent: "testagent"}, false},
+		{RequestFingerprint{IP: "203.0.113.10", UserAgent: "otheragent"}, false},
+		{RequestFingerprint{IP: "2001:db8::1", UserAgent: "testagent"}, false},
+	} {
+		if matchFingerprint(recorded, tc.presented) != tc.expected {
+			t.Errorf("Test failed, expected %v for %v", tc.expected, tc.presented)
+		}
+	}
+}
+
+func TestTokenBinding(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.TokenBinding = true
+
+	grant := Grant{AccessToken: "testtoken", ExpiresIn: time.Hour, Scope: []string{"testscope"}, CreatedAt: timeNow()}
+	issuing, err := http.NewRequest("POST", "/token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuing.RemoteAddr = "203.0.113.10:1234"
+	issuing.Header.Set("User-Agent", "testagent")
+	server.bindGrant(issuing, &grant)
+	err = server.SessionStore.PutGrant(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := server.Secure([]string{"testscope"}, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("approved"))
+	})
+	for remoteAddr, expected := range map[string]int{
+		"203.0.113.11:4321":  200,
+		"198.51.100.10:1234": 401,
+	} {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("User-Agent", "testagent")
+		r.Header.Set("Authorization", "Bearer testtoken")
+		handler(w, r)
+		if w.Code != expected {
+			t.Errorf("Test failed, expected status %v for %s but got %v", expected, remoteAddr, w.Code)
+		}
+	}
+}
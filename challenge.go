@@ -0,0 +1,107 @@
+package goauth
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ChallengeType identifies the action a user agent must take to continue an authorization request.
+type ChallengeType string
+
+const (
+	// ChallengeLoginRequired requires the resource owner to submit their credentials to the action URL.
+	ChallengeLoginRequired ChallengeType = "login_required"
+	// ChallengeConsentRequired requires the already authenticated resource owner to approve the
+	// requested scope by submitting to the action URL.
+	ChallengeConsentRequired ChallengeType = "consent_required"
+	// ChallengeRedirect completes the authorization request, the user agent should navigate to RedirectTo.
+	ChallengeRedirect ChallengeType = "redirect"
+	// ChallengeError indicates that the last submission failed. The challenge may be retried.
+	ChallengeError ChallengeType = "error"
+)
+
+// AuthorizationChallenge is returned by the authorization endpoint instead of HTML when the request
+// accepts application/json, allowing single page apps to render their own authorization UI.
+type AuthorizationChallenge struct {
+	Type             ChallengeType `json:"type"`
+	ClientID         string        `json:"client_id,omitempty"`
+	Scope            []string      `json:"scope,omitempty"`
+	ActionURL        string        `json:"action_url,omitempty"`
+	LoginHint        string        `json:"login_hint,omitempty"`
+	RedirectTo       string        `json:"redirect_to,omitempty"`
+	Error            string        `json:"error,omitempty"`
+	ErrorDescription string        `json:"error_description,omitempty"`
+	// AuthorizationDetails may be approved individually by submitting ParamApprovedAuthorizationDetails
+	// and ParamAuthorizationDetailsReviewed to the action URL.
+	AuthorizationDetails []ConsentDetail `json:"authorization_details,omitempty"`
+}
+
+// acceptsJSON returns true if the request's Accept header prefers application/json.
+func acceptsJSON(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		if mediaType == "application/json" {
+			return true
+		}
+		if mediaType == "text/html" {
+			return false
+		}
+	}
+	return false
+}
+
+// writeChallenge writes the AuthorizationChallenge to the http response.
+func (s *Server) writeChallenge(w http.ResponseWriter, status int, c AuthorizationChallenge) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	err := enc.Encode(c)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// renderAuthorization responds with the authorization UI, either using the AuthorizationHandler or
+// as an AuthorizationChallenge if the request accepts JSON.
+func (s *Server) renderAuthorization(w http.ResponseWriter, r *http.Request, challenge ChallengeType, client Client, scope []string, authErr error, actionURL string) {
+	req := s.authorizationRequest(r, client, scope, authErr, actionURL)
+	if !acceptsJSON(r) {
+		s.AuthorizationHandler(req).ServeHTTP(w, r)
+		return
+	}
+	c := AuthorizationChallenge{
+		Type:                 challenge,
+		ClientID:             req.ClientID,
+		Scope:                req.Scope,
+		ActionURL:            req.ActionURL,
+		AuthorizationDetails: req.AuthorizationDetails,
+		LoginHint:            req.LoginHint,
+	}
+	status := http.StatusOK
+	if req.Error != nil {
+		status = http.StatusUnauthorized
+		c.Type = ChallengeError
+		c.Error = ErrorAccessDenied.Code
+		c.ErrorDescription = req.Error.Error()
+		if e, ok := asError(req.Error); ok {
+			c.Error = e.Code
+			c.ErrorDescription = e.Description
+		}
+	}
+	s.writeChallenge(w, status, c)
+}
+
+// authorizationRedirect redirects the user agent to urlStr, or returns a redirect challenge
+// if the request accepts JSON.
+func (s *Server) authorizationRedirect(w http.ResponseWriter, r *http.Request, urlStr string) {
+	if acceptsJSON(r) {
+		s.writeChallenge(w, http.StatusOK, AuthorizationChallenge{Type: ChallengeRedirect, RedirectTo: urlStr})
+		return
+	}
+	http.Redirect(w, r, urlStr, http.StatusFound)
+}
@@ -0,0 +1,124 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptsJSON(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"application/json":                    true,
+		"application/json; charset=utf-8":     true,
+		"text/html,application/xhtml+xml,*/*": false,
+		"text/html;q=0.9, application/json":   false,
+		"":                                    false,
+	} {
+		r, err := http.NewRequest("GET", "/authorize", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Accept", accept)
+		if acceptsJSON(r) != expected {
+			t.Errorf("Test failed, expected %v for %s", expected, accept)
+		}
+	}
+}
+
+func TestAuthorizationChallenges(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	authenticator := &testSessionAuthenticator{}
+	server.SessionAuthenticator = authenticator
+
+	authorize := func(method, query, body string) AuthorizationChallenge {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest(method, "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&"+query, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", "application/json")
+		server.ServeHTTP(w, r)
+		var c AuthorizationChallenge
+		err = json.NewDecoder(w.Body).Decode(&c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// Without a session the resource owner must log in
+	c := authorize("GET", "", "")
+	if c.Type != ChallengeLoginRequired || !reflect.DeepEqual(c.Scope, []string{"testscope"}) || c.ActionURL == "" {
+		t.Errorf("Test failed, got %v", c)
+	}
+
+	// Failed logins are reported as errors
+	c = authorize("POST", "", "username=testusername&password=wrong")
+	if c.Type != ChallengeError || c.ErrorDescription != "username or password invalid" {
+		t.Errorf("Test failed, got %v", c)
+	}
+
+	// An authenticated resource owner only needs to consent
+	authenticator.session = &LoginSession{Username: "testusername", AuthTime: time.Now()}
+	c = authorize("GET", "prompt=consent", "")
+	if c.Type != ChallengeConsentRequired {
+		t.Errorf("Test failed, got %v", c)
+	}
+
+	// Consenting completes the request with a redirect including the code
+	c = authorize("POST", "prompt=consent&state=teststate", "consent_token="+server.consentToken(consentPurposeAuthorize, "testclientid", *authenticator.session))
+	if c.Type != ChallengeRedirect || !strings.HasPrefix(c.RedirectTo, "https://testuri.com?code=") || !strings.HasSuffix(c.RedirectTo, "&state=teststate") {
+		t.Errorf("Test failed, got %v", c)
+	}
+}
+
+func TestAuthorizationActionURL(t *testing.T) {
+	server := newTestHandler()
+	authorize := func() string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", nil)
+		server.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+
+	// Without an issuer the form submits to the authorization endpoint at the current path, carrying the
+	// client ID and response type of the request
+	if body := authorize(); !strings.Contains(body, `<form action="?client_id=testclientid&amp;redirect_uri=`) || !strings.Contains(body, `&amp;response_type=code`) {
+		t.Errorf("Test failed, expected a relative action URL got %s", body)
+	}
+
+	// The issuer includes the prefix under which the Server is mounted
+	server.Issuer = "https://example.com/oauth/"
+	if body := authorize(); !strings.Contains(body, `<form action="https://example.com/oauth/authorize?client_id=testclientid&amp;redirect_uri=`) {
+		t.Errorf("Test failed, expected an absolute action URL got %s", body)
+	}
+}
+
+func TestAuthorizationResponseIssuer(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.Issuer = "https://example.com/oauth"
+	for query, param := range map[string]string{
+		"":                              ParamCode,
+		"&code_challenge_method=plain2": ParamError,
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope"+query, strings.NewReader("username=testusername&password=testpassword"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		server.ServeHTTP(w, r)
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if location.Query().Get(param) == "" || location.Query().Get(ParamIssuer) != server.Issuer {
+			t.Errorf("Test failed, expected %s and the issuer in %s", param, location)
+		}
+	}
+}
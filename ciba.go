@@ -0,0 +1,374 @@
+package goauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	BackChannelAuthorizeEndpoint = "/bc-authorize"
+)
+
+var (
+	// DefaultBackChannelRequestExpiry is the default lifetime of a back-channel authentication request. The
+	// resource owner must approve the request on their authentication device within this period.
+	DefaultBackChannelRequestExpiry = 2 * time.Minute
+	// DefaultBackChannelPollingInterval is the minimum amount of time a client must wait between polling
+	// requests to the token endpoint.
+	DefaultBackChannelPollingInterval = 5 * time.Second
+)
+
+// BackChannelDeliveryMode defines how the result of a back-channel authentication request
+// is delivered to the client.
+type BackChannelDeliveryMode string
+
+const (
+	// BackChannelDeliveryPoll requires the client to poll the token endpoint until the request is approved.
+	BackChannelDeliveryPoll BackChannelDeliveryMode = "poll"
+	// BackChannelDeliveryPing notifies the client at its registered notification endpoint once the
+	// request has been approved or denied, after which the client retrieves the tokens from the token endpoint.
+	BackChannelDeliveryPing BackChannelDeliveryMode = "ping"
+)
+
+// BackChannelStatus is the state of a back-channel authentication request.
+type BackChannelStatus string
+
+const (
+	BackChannelStatusPending  BackChannelStatus = "pending"
+	BackChannelStatusApproved BackChannelStatus = "approved"
+	BackChannelStatusDenied   BackChannelStatus = "denied"
+)
+
+// BackChannelRequest is a Client Initiated Backchannel Authentication request as per
+// https://openid.net/specs/openid-client-initiated-backchannel-authentication-core-1_0.html. It
+// is awaiting approval by the resource owner on a separate authentication device.
+type BackChannelRequest struct {
+	AuthReqID Secret
+	ClientID  string
+	Scope     []string
+	LoginHint string
+	// Subject is the username of the resource owner who approved the request, as verified by their
+	// authentication device. It is empty until the request is approved.
+	Subject                 string
+	BindingMessage          string
+	DeliveryMode            BackChannelDeliveryMode
+	ClientNotificationToken Secret
+	Status                  BackChannelStatus
+	CreatedAt               time.Time
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+	LastPolledAt            time.Time
+}
+
+// IsExpired returns true if the BackChannelRequest has expired.
+func (b BackChannelRequest) IsExpired() bool {
+	if b.CreatedAt.Add(b.ExpiresIn).After(timeNow()) {
+		return false
+	}
+	return true
+}
+
+// BackChannelNotifier triggers the out-of-band approval of a back-channel authentication request,
+// for example by sending a push notification to the resource owner's phone.
+type BackChannelNotifier interface {
+	// NotifyResourceOwner asks the resource owner identified by the request's login hint to approve
+	// the request. It should return ErrorUnknownUserID if the resource owner cannot be identified. The
+	// outcome must be reported using Server.ApproveBackChannelRequest, with the username of the resource
+	// owner authenticated by the device, or Server.DenyBackChannelRequest.
+	NotifyResourceOwner(req BackChannelRequest) error
+}
+
+// BackChannelClient can be implemented by a Client in order to use the ping token delivery mode.
+type BackChannelClient interface {
+	Client
+	// ClientNotificationEndpoint returns the registered endpoint that is notified once a back-channel
+	// authentication request has been approved or denied.
+	ClientNotificationEndpoint() string
+}
+
+func (s *Server) handleBackChannelAuthorize(w http.ResponseWriter, r *http.Request) {
+	if s.BackChannelNotifier == nil {
+		// Back-channel authentication is not configured for this server
+		s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+		return
+	}
+	// Authorize the client using basic auth
+	clientID, client, err := s.authenticateConfidentialClient(r)
+	if err != nil {
+		s.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	// Check that the client is allowed for this grant type
+	if !client.AllowStrategy(StrategyCIBA) {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	// A hint is required in order to identify the resource owner
+	loginHint := r.PostFormValue(ParamLoginHint)
+	if loginHint == "" {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	// If a notification token was provided then the client must be registered for ping delivery
+	mode := BackChannelDeliveryPoll
+	notificationToken := r.PostFormValue(ParamClientNotificationToken)
+	if notificationToken != "" {
+		bc, ok := client.(BackChannelClient)
+		if !ok || bc.ClientNotificationEndpoint() == "" {
+			s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+			return
+		}
+		mode = BackChannelDeliveryPing
+	}
+	// The client may request a shorter expiry than the default
+	expiresIn := DefaultBackChannelRequestExpiry
+	if rawExpiry := r.PostFormValue(ParamRequestedExpiry); rawExpiry != "" {
+		seconds, err := strconv.Atoi(rawExpiry)
+		if err != nil || seconds <= 0 {
+			s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+			return
+		}
+		if requested := time.Duration(seconds) * time.Second; requested < expiresIn {
+			expiresIn = requested
+		}
+	}
+	// Check that the given scope is allowed
+	rawScope := r.PostFormValue(ParamScope)
+	scope := s.parseScope(rawScope)
+	scope, err = s.authorizeScope(clientID, client, scope)
+	if err != nil {
+		s.ErrorHandler(w, ErrorInvalidScope.StatusCode, ErrorInvalidScope)
+		return
+	}
+	req, err := s.sessionStore(r).NewBackChannelRequest(BackChannelRequest{
+		ClientID:                clientID,
+		Scope:                   scope,
+		LoginHint:               loginHint,
+		BindingMessage:          r.PostFormValue(ParamBindingMessage),
+		DeliveryMode:            mode,
+		ClientNotificationToken: Secret(notificationToken),
+		ExpiresIn:               expiresIn,
+	})
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// Trigger the out-of-band approval, removing the request if the resource owner can't be notified
+	err = s.BackChannelNotifier.NotifyResourceOwner(req)
+	if err != nil {
+		s.sessionStore(r).DeleteBackChannelRequest(req.AuthReqID)
+		if e, ok := asError(err); ok {
+			s.ErrorHandler(w, e.StatusCode, e)
+			return
+		}
+		s.internalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(map[string]interface{}{
+		ParamAuthReqID: req.AuthReqID.RawString(),
+		ParamExpiresIn: req.ExpiresIn.Seconds(),
+		"interval":     req.Interval.Seconds(),
+	})
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) handleBackChannelTokenRequest(w http.ResponseWriter, r *http.Request) {
+	// Check that the request is using the correct grant type
+	if r.PostFormValue(ParamGrantType) != GrantTypeCIBA {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	// Authorize the client using basic auth
+	clientID, client, err := s.authenticateConfidentialClient(r)
+	if err != nil {
+		s.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	// Check that the client is allowed for this grant type
+	if !client.AllowStrategy(StrategyCIBA) {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	authReqID := Secret(r.PostFormValue(ParamAuthReqID))
+	req, err := s.sessionStore(r).GetBackChannelRequest(authReqID)
+	if err != nil || req.ClientID != clientID {
+		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+		return
+	}
+	if req.IsExpired() {
+		s.sessionStore(r).DeleteBackChannelRequest(authReqID)
+		s.ErrorHandler(w, ErrorExpiredToken.StatusCode, ErrorExpiredToken)
+		return
+	}
+	if req.Status == BackChannelStatusPending {
+		// Record the poll and tell the client to slow down if it is polling too frequently
+		now := timeNow()
+		tooFast := !req.LastPolledAt.IsZero() && req.LastPolledAt.Add(req.Interval).After(now)
+		req.LastPolledAt = now
+		// The poll is only recorded while the request is pending so that it cannot undo a concurrent approval
+		err = s.sessionStore(r).UpdateBackChannelRequest(req, BackChannelStatusPending)
+		if err == nil {
+			if tooFast {
+				s.ErrorHandler(w, ErrorSlowDown.StatusCode, ErrorSlowDown)
+				return
+			}
+			s.ErrorHandler(w, ErrorAuthorizationPending.StatusCode, ErrorAuthorizationPending)
+			return
+		}
+		if err != ErrStatusConflict {
+			s.internalError(w, r, err)
+			return
+		}
+		// The request was approved or denied since it was retrieved
+		req, err = s.sessionStore(r).GetBackChannelRequest(authReqID)
+		if err != nil || req.Status == BackChannelStatusPending {
+			s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+			return
+		}
+	}
+	// Requests approved without a verified subject cannot be exchanged
+	if req.Status == BackChannelStatusDenied || req.Subject == "" {
+		s.sessionStore(r).DeleteBackChannelRequest(authReqID)
+		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+		return
+	}
+	// The request has been approved, therefore, it can only be exchanged once
+	err = s.sessionStore(r).DeleteBackChannelRequest(authReqID)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// Check that the risk of issuing the grant is acceptable
+	e, ok := s.evaluateRisk(r, RiskContext{
+		ClientID:  clientID,
+		Client:    client,
+		Username:  req.Subject,
+		GrantType: GrantTypeCIBA,
+		Scope:     req.Scope,
+	})
+	if !ok {
+		s.ErrorHandler(w, e.StatusCode, e)
+		return
+	}
+	grant, err := s.createGrant(r, client, req.Subject, req.Scope)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	err = s.issueGrant(r, clientID, client, req.Subject, &grant)
+	if err == nil {
+		err = s.storeGrant(r, &grant)
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// Write the grant to the http response
+	err = s.writeGrant(w, r, grant)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+}
+
+// ApproveBackChannelRequest records the resource owner's approval of a pending back-channel
+// authentication request. The subject is the username of the resource owner as verified by their
+// authentication device, and is the resource owner the grant is issued for. The login hint supplied by
+// the client is never used as the subject, as it could name any resource owner. If the client uses ping
+// delivery then it is notified before returning.
+func (s *Server) ApproveBackChannelRequest(authReqID Secret, subject string) error {
+	if subject == "" {
+		return ErrorInvalidRequest
+	}
+	return s.completeBackChannelRequest(authReqID, subject, BackChannelStatusApproved)
+}
+
+// DenyBackChannelRequest records the resource owner's rejection of a pending back-channel
+// authentication request. If the client uses ping delivery then it is notified before returning.
+func (s *Server) DenyBackChannelRequest(authReqID Secret) error {
+	return s.completeBackChannelRequest(authReqID, "", BackChannelStatusDenied)
+}
+
+func (s *Server) completeBackChannelRequest(authReqID Secret, subject string, status BackChannelStatus) error {
+	req, err := s.SessionStore.GetBackChannelRequest(authReqID)
+	if err != nil {
+		return err
+	}
+	if req.IsExpired() {
+		return ErrorExpiredToken
+	}
+	if req.Status != BackChannelStatusPending {
+		return ErrorInvalidRequest
+	}
+	if status == BackChannelStatusApproved {
+		// Restrict the scope to that permitted for the resource owner who approved the request
+		req.Subject = subject
+		req.Scope, err = s.authorizeOwnerScope(subject, req.Scope)
+		if err != nil {
+			return err
+		}
+	}
+	req.Status = status
+	err = s.SessionStore.UpdateBackChannelRequest(req, BackChannelStatusPending)
+	if err == ErrStatusConflict {
+		return ErrorInvalidRequest
+	}
+	if err != nil {
+		return err
+	}
+	if status == BackChannelStatusApproved {
+		s.PublishEvent(context.Background(), Event{Type: EventConsentGranted, ClientID: req.ClientID, Username: req.Subject, Scope: req.Scope})
+	}
+	if req.DeliveryMode == BackChannelDeliveryPing {
+		return s.pingBackChannelClient(req)
+	}
+	return nil
+}
+
+// pingBackChannelClient notifies the client's registered notification endpoint that the result of
+// the request can be retrieved from the token endpoint.
+func (s *Server) pingBackChannelClient(req BackChannelRequest) error {
+	client, err := s.Authenticator.GetClient(req.ClientID)
+	if err != nil {
+		return err
+	}
+	bc, ok := client.(BackChannelClient)
+	if !ok || bc.ClientNotificationEndpoint() == "" {
+		return ErrorUnauthorizedClient
+	}
+	body, err := json.Marshal(map[string]string{
+		ParamAuthReqID: req.AuthReqID.RawString(),
+	})
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("POST", bc.ClientNotificationEndpoint(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Authorization", "Bearer "+req.ClientNotificationToken.RawString())
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("client notification endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testBackChannelNotifier implements the BackChannelNotifier interface and
+// is intended for use only in testing.
+type testBackChannelNotifier struct {
+	requests []BackChannelRequest
+}
+
+// NotifyResourceOwner records the request, returning an error if the login hint is unknown.
+func (t *testBackChannelNotifier) NotifyResourceOwner(req BackChannelRequest) error {
+	if req.LoginHint != "testusername" {
+		return ErrorUnknownUserID
+	}
+	t.requests = append(t.requests, req)
+	return nil
+}
+
+// TestBackChannelAuthentication tests the request/response for the Client Initiated Backchannel
+// Authentication flow using the poll delivery mode.
+func TestBackChannelAuthentication(t *testing.T) {
+
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	notifier := &testBackChannelNotifier{}
+	server.BackChannelNotifier = notifier
+
+	var authReqID string
+
+	setForm := func(r *http.Request) {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+	}
+
+	expectError := func(code string) func(r *httptest.ResponseRecorder) {
+		return func(r *httptest.ResponseRecorder) {
+			var e Error
+			err := json.NewDecoder(r.Body).Decode(&e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Code != code {
+				t.Errorf("Test failed, expected %s but got %s", code, e.Code)
+			}
+		}
+	}
+
+	poll := func() testCase {
+		return testCase{
+			"POST",
+			"/token",
+			strings.NewReader("grant_type=" + GrantTypeCIBA + "&auth_req_id=" + authReqID),
+			server.ServeHTTP,
+			setForm,
+			nil,
+		}
+	}
+
+	testCases([]testCase{
+		// Should throw an error as no login hint was provided
+		{
+			"POST",
+			"/bc-authorize",
+			strings.NewReader("scope=testscope"),
+			server.ServeHTTP,
+			setForm,
+			expectError("invalid_request"),
+		},
+		// Should throw an error as the resource owner is unknown to the notifier
+		{
+			"POST",
+			"/bc-authorize",
+			strings.NewReader("scope=testscope&login_hint=unknown"),
+			server.ServeHTTP,
+			setForm,
+			expectError("unknown_user_id"),
+		},
+		// Should create a pending request and notify the resource owner
+		{
+			"POST",
+			"/bc-authorize",
+			strings.NewReader("scope=testscope&login_hint=testusername"),
+			server.ServeHTTP,
+			setForm,
+			func(r *httptest.ResponseRecorder) {
+				if r.Code != 200 {
+					t.Fatalf("Test failed, status %v", r.Code)
+				}
+				var resp map[string]interface{}
+				err := json.NewDecoder(r.Body).Decode(&resp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				authReqID, _ = resp["auth_req_id"].(string)
+				if authReqID == "" {
+					t.Fatalf("Test failed, expected an auth_req_id but got %v", resp)
+				}
+				if len(notifier.requests) != 1 || notifier.requests[0].AuthReqID.RawString() != authReqID {
+					t.Errorf("Test failed, expected the notifier to receive the request")
+				}
+			},
+		},
+	})
+
+	// The request should be pending until approved and polling too quickly should be rejected
+	pending := poll()
+	pending.expect = expectError("authorization_pending")
+	slowDown := poll()
+	slowDown.expect = expectError("slow_down")
+	testCases([]testCase{pending, slowDown})
+
+	// The subject must be the resource owner verified by the authentication device
+	if err := server.ApproveBackChannelRequest(Secret(authReqID), ""); err != ErrorInvalidRequest {
+		t.Errorf("Test failed, expected %v but got %v", ErrorInvalidRequest, err)
+	}
+	err := server.ApproveBackChannelRequest(Secret(authReqID), "testusername")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Once approved, the request can be exchanged for a grant exactly once
+	approved := poll()
+	approved.expect = func(r *httptest.ResponseRecorder) {
+		if r.Code != 200 {
+			t.Errorf("Test failed, status %v", r.Code)
+		}
+		var resp map[string]interface{}
+		err := json.NewDecoder(r.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp["access_token"] == nil {
+			t.Errorf("Test failed, expected an access token but got %v", resp)
+		}
+	}
+	replayed := poll()
+	replayed.expect = expectError("access_denied")
+	testCases([]testCase{approved, replayed})
+}
+
+func TestBackChannelAuthenticationDenied(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.BackChannelNotifier = &testBackChannelNotifier{}
+
+	req, err := server.SessionStore.NewBackChannelRequest(BackChannelRequest{
+		ClientID:  "testclientid",
+		LoginHint: "testusername",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.DenyBackChannelRequest(req.AuthReqID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A request can only be completed once
+	err = server.ApproveBackChannelRequest(req.AuthReqID, "testusername")
+	if err != ErrorInvalidRequest {
+		t.Errorf("Test failed, expected %v but got %v", ErrorInvalidRequest, err)
+	}
+}
+
+func TestBackChannelPollAfterApproval(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.BackChannelNotifier = &testBackChannelNotifier{}
+
+	req, err := server.SessionStore.NewBackChannelRequest(BackChannelRequest{
+		ClientID:  "testclientid",
+		Scope:     []string{"testscope"},
+		LoginHint: "someone@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.ApproveBackChannelRequest(req.AuthReqID, "testusername")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Recording a poll of the request as retrieved before the approval does not undo it
+	req.LastPolledAt = timeNow()
+	if err := server.SessionStore.UpdateBackChannelRequest(req, BackChannelStatusPending); err != ErrStatusConflict {
+		t.Errorf("Test failed, expected %v but got %v", ErrStatusConflict, err)
+	}
+	stored, err := server.SessionStore.GetBackChannelRequest(req.AuthReqID)
+	if err != nil || stored.Status != BackChannelStatusApproved || stored.Subject != "testusername" {
+		t.Fatalf("Test failed, expected the approval to be kept got %+v", stored)
+	}
+
+	// The grant is issued for the verified subject rather than the login hint
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type="+url.QueryEscape(GrantTypeCIBA)+"&auth_req_id="+req.AuthReqID.RawString()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	accessToken, _ := resp["access_token"].(string)
+	grant, err := server.SessionStore.GetGrant(Secret(accessToken))
+	if err != nil || grant.Username != "testusername" {
+		t.Errorf("Test failed, expected a grant for the subject got %v %+v", resp, grant)
+	}
+}
+
+func TestBackChannelAuthenticationUnsupported(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(baseSessionStoreBackend{NewMemSessionStoreBackend()})
+	server.BackChannelNotifier = &testBackChannelNotifier{}
+	var internalErr error
+	server.OnInternalError = func(r *http.Request, err error) {
+		internalErr = err
+	}
+
+	r := httptest.NewRequest("POST", BackChannelAuthorizeEndpoint, strings.NewReader("scope=openid&login_hint=testusername"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != ErrorServerError.StatusCode || internalErr != ErrBackChannelRequestsUnsupported {
+		t.Errorf("Test failed, expected %v got %d %v", ErrBackChannelRequestsUnsupported, w.Code, internalErr)
+	}
+	if _, err := server.SessionStore.GetBackChannelRequest("unknown"); err != ErrBackChannelRequestsUnsupported {
+		t.Errorf("Test failed, expected %v got %v", ErrBackChannelRequestsUnsupported, err)
+	}
+}
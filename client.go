@@ -1,5 +1,10 @@
 package goauth
 
+import (
+	"net/http"
+	"net/url"
+)
+
 // Client is an interface that implements methods for performing authorization checks on a client.
 type Client interface {
 	// AllowStrategy checks that the client is authorized to authenticate using the provided Strategy.
@@ -16,5 +21,168 @@ type Client interface {
 	// owner. It returns a bool indicating whether the client is allowed and an error if one occurs.
 	AuthorizeResourceOwner(username string) (bool, error)
 	// CreateGrant creates a new grant for the Client with the provided scope.
+	//
+	// Deprecated: Grants are created by the Server and CreateGrant is no longer called. Use the Server's
+	// GrantDecorator to customise them.
 	CreateGrant(scope []string) (Grant, error)
 }
+
+// ClientType is the type of a Client as defined in https://tools.ietf.org/html/rfc6749#section-2.1.
+type ClientType string
+
+const (
+	// ClientTypeConfidential is the type of clients capable of keeping their credentials confidential, such
+	// as web applications running on a server. Confidential clients must authenticate at the token endpoint.
+	ClientTypeConfidential ClientType = "confidential"
+	// ClientTypePublic is the type of clients unable to keep a secret, such as native and browser-based
+	// applications. Public clients cannot use the Client Credentials Grant, must use PKCE with the
+	// Authorization Code Grant and identify themselves at the token endpoint using the client_id parameter.
+	ClientTypePublic ClientType = "public"
+)
+
+// TypedClient is implemented by a Client that declares its ClientType. A Client that does not implement
+// TypedClient, or that returns an empty ClientType, is treated as confidential.
+type TypedClient interface {
+	Client
+	ClientType() ClientType
+}
+
+// clientType returns the ClientType of the client.
+func clientType(client Client) ClientType {
+	if typed, ok := client.(TypedClient); ok && typed.ClientType() == ClientTypePublic {
+		return ClientTypePublic
+	}
+	return ClientTypeConfidential
+}
+
+// isPublicClient returns true if the client is a public client.
+func isPublicClient(client Client) bool {
+	return clientType(client) == ClientTypePublic
+}
+
+// TrustedClient is implemented by a Client that may be marked as trusted, typically a first-party
+// application operated by the same organization as the authorization server. Trusted clients are not
+// required to obtain consent, so an authenticated resource owner is redirected with an authorization code
+// without being shown the consent screen, even if the client requests it using the prompt parameter.
+type TrustedClient interface {
+	Client
+	Trusted() bool
+}
+
+// isTrustedClient returns true if the client is a trusted client.
+func isTrustedClient(client Client) bool {
+	trusted, ok := client.(TrustedClient)
+	return ok && trusted.Trusted()
+}
+
+// ClientMetadata describes a client to resource owners, using the client metadata names of RFC 7591.
+type ClientMetadata struct {
+	Name              string `json:"client_name,omitempty"`
+	URI               string `json:"client_uri,omitempty"`
+	LogoURI           string `json:"logo_uri,omitempty"`
+	PolicyURI         string `json:"policy_uri,omitempty"`
+	TermsOfServiceURI string `json:"tos_uri,omitempty"`
+}
+
+// MetadataProvider is implemented by a Client that describes itself to resource owners, for example on the
+// authorization page. Clients that do not implement it are identified by their client ID.
+type MetadataProvider interface {
+	Client
+	Metadata() ClientMetadata
+}
+
+// clientMetadata returns the ClientMetadata of the client.
+func clientMetadata(client Client) ClientMetadata {
+	if c, ok := client.(MetadataProvider); ok {
+		return c.Metadata()
+	}
+	return ClientMetadata{}
+}
+
+// DefaultScopeClient is implemented by a Client declaring the scope it is granted when a request omits the
+// scope parameter, as per RFC 6749 section 3.3. The default scope is authorized in the same way as
+// requested scope.
+type DefaultScopeClient interface {
+	Client
+	DefaultScope() []string
+}
+
+// defaultScope returns the default scope of the client, or nil if it does not declare one.
+func defaultScope(client Client) []string {
+	if c, ok := client.(DefaultScopeClient); ok {
+		return NormalizeScope(c.DefaultScope())
+	}
+	return nil
+}
+
+// authenticateClient authenticates the client of a token request. Confidential clients must authenticate
+// using basic auth, whereas public clients identify themselves using the client_id parameter and must not
+// present a secret. It returns ErrorAccessDenied if no client is identified and ErrorUnauthorizedClient if
+// the client is not permitted to authenticate as it attempted to or from the network of the request.
+func (s *Server) authenticateClient(r *http.Request) (string, Client, error) {
+	if _, _, ok := r.BasicAuth(); ok {
+		return s.authenticateConfidentialClient(r)
+	}
+	clientID := r.PostFormValue(ParamClientID)
+	if clientID == "" {
+		return "", nil, ErrorAccessDenied
+	}
+	client, err := s.authenticator(r).GetClient(clientID)
+	if err != nil {
+		return clientID, nil, ErrorUnauthorizedClient
+	}
+	if !isPublicClient(client) {
+		// Confidential clients must authenticate
+		return clientID, nil, ErrorUnauthorizedClient
+	}
+	if !s.allowClientNetwork(r, client) {
+		return clientID, nil, ErrorUnauthorizedClient
+	}
+	return clientID, client, nil
+}
+
+// authenticateConfidentialClient authenticates a confidential client using basic auth. It returns
+// ErrorAccessDenied if the request does not use basic auth and ErrorUnauthorizedClient if the credentials
+// are invalid, the client is public or the request was made from a network the client may not use.
+func (s *Server) authenticateConfidentialClient(r *http.Request) (string, Client, error) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		return "", nil, ErrorAccessDenied
+	}
+	client, err := s.authenticator(r).GetClientWithSecret(clientID, Secret(clientSecret))
+	if err != nil {
+		// Clients following https://tools.ietf.org/html/rfc6749#section-2.3.1, such as golang.org/x/oauth2,
+		// form encode their credentials, whereas others send them as they are
+		decodedID, decodedSecret, ok := decodeClientCredentials(clientID, clientSecret)
+		if !ok {
+			return clientID, nil, ErrorUnauthorizedClient
+		}
+		clientID = decodedID
+		client, err = s.authenticator(r).GetClientWithSecret(clientID, Secret(decodedSecret))
+		if err != nil {
+			return clientID, nil, ErrorUnauthorizedClient
+		}
+	}
+	// Public clients cannot keep a secret and so must not authenticate with one
+	if isPublicClient(client) {
+		return clientID, nil, ErrorUnauthorizedClient
+	}
+	if !s.allowClientNetwork(r, client) {
+		return clientID, nil, ErrorUnauthorizedClient
+	}
+	return clientID, client, nil
+}
+
+// decodeClientCredentials form decodes the client ID and secret of a basic auth header. It returns false if
+// they cannot be decoded or are unchanged by decoding.
+func decodeClientCredentials(clientID, clientSecret string) (string, string, bool) {
+	decodedID, err := url.QueryUnescape(clientID)
+	if err != nil {
+		return "", "", false
+	}
+	decodedSecret, err := url.QueryUnescape(clientSecret)
+	if err != nil {
+		return "", "", false
+	}
+	return decodedID, decodedSecret, decodedID != clientID || decodedSecret != clientSecret
+}
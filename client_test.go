@@ -1,6 +1,14 @@
 package goauth
 
-import "time"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
 
 // testClient implements the Client interface and is
 // intended for use only in testing.
@@ -10,6 +18,8 @@ type testClient struct {
 	username    string
 	redirectURI string
 	scope       []string
+	clientType  ClientType
+	trusted     bool
 }
 
 // AllowStrategy satisfies the Client interface, returning true if the client is approved for the
@@ -49,6 +59,16 @@ func (t *testClient) AuthorizeResourceOwner(username string) (bool, error) {
 	return true, nil
 }
 
+// ClientType satisfies the TypedClient interface.
+func (t *testClient) ClientType() ClientType {
+	return t.clientType
+}
+
+// Trusted satisfies the TrustedClient interface.
+func (t *testClient) Trusted() bool {
+	return t.trusted
+}
+
 func (t *testClient) CreateGrant(scope []string) (Grant, error) {
 	return Grant{
 		AccessToken:  "testtoken",
@@ -59,3 +79,148 @@ func (t *testClient) CreateGrant(scope []string) (Grant, error) {
 		CreatedAt:    time.Now(),
 	}, nil
 }
+
+// testTokenDecorator gives grants the fixed access and refresh token "testtoken".
+var testTokenDecorator = GrantDecoratorFunc(func(ctx context.Context, client Client, grant *Grant) error {
+	grant.AccessToken = "testtoken"
+	if grant.RefreshToken != "" {
+		grant.RefreshToken = "testtoken"
+	}
+	return nil
+})
+
+func TestTrustedClient(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.SessionAuthenticator = &testSessionAuthenticator{
+		session: &LoginSession{Username: "testusername", AuthTime: time.Now()},
+	}
+	client := server.Authenticator.(*testAuthenticator).client
+
+	authorize := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&"+query, nil)
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// Untrusted clients show the consent screen when requested
+	if w := authorize("prompt=consent"); w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected the consent screen but got status %v", w.Code)
+	}
+
+	// Trusted clients skip the consent screen
+	client.trusted = true
+	w := authorize("prompt=consent")
+	if w.Code != http.StatusFound {
+		t.Fatalf("Test failed, expected a redirect but got status %v", w.Code)
+	}
+	uri, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Query().Get(ParamCode) == "" {
+		t.Errorf("Test failed, expected a code but got %s", uri)
+	}
+	// Selecting an account still requires interaction
+	if w := authorize("prompt=select_account"); w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected the login form but got status %v", w.Code)
+	}
+
+	// The login form of a trusted client does not ask for consent
+	server.SessionAuthenticator = nil
+	w = authorize("")
+	if strings.Contains(w.Body.String(), "has requested access") {
+		t.Errorf("Test failed, expected no consent message but got %s", w.Body)
+	}
+}
+
+// testCapabilityClient is a testClient implementing the PKCERequirer, TokenPolicyProvider and
+// MetadataProvider interfaces.
+type testCapabilityClient struct {
+	*testClient
+}
+
+func (t testCapabilityClient) RequirePKCE() bool {
+	return true
+}
+
+func (t testCapabilityClient) TokenPolicy() TokenPolicy {
+	return TokenPolicy{AccessTokenLifetime: 5 * time.Minute}
+}
+
+func (t testCapabilityClient) Metadata() ClientMetadata {
+	return ClientMetadata{Name: "Test Application"}
+}
+
+type testCapabilityAuthenticator struct {
+	*testAuthenticator
+}
+
+func (t testCapabilityAuthenticator) GetClient(clientID string) (Client, error) {
+	client, err := t.testAuthenticator.GetClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return testCapabilityClient{client.(*testClient)}, nil
+}
+
+func (t testCapabilityAuthenticator) GetClientWithSecret(clientID string, clientSecret Secret) (Client, error) {
+	client, err := t.testAuthenticator.GetClientWithSecret(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return testCapabilityClient{client.(*testClient)}, nil
+}
+
+func TestClientCapabilities(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.Authenticator = testCapabilityAuthenticator{server.Authenticator.(*testAuthenticator)}
+
+	// A confidential client requiring PKCE cannot omit the code challenge
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", nil))
+	uri, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Query().Get(ParamError) != ErrorInvalidRequest.Code {
+		t.Errorf("Test failed, expected invalid_request got %s", uri)
+	}
+
+	// The client's metadata is shown on the authorization page
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&code_challenge=dBjftJeZ4CVP-mB92K27uhbUJU1p1r-wW1gOWFkOjXk", nil))
+	if !strings.Contains(w.Body.String(), "Test Application has requested access") {
+		t.Errorf("Test failed, expected the client name got %s", w.Body)
+	}
+
+	// The client's TokenPolicy overrides the lifetime of its access tokens
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	server.ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), `"expires_in":300`) {
+		t.Errorf("Test failed, expected the access token lifetime of the policy got %s", w.Body)
+	}
+}
+
+func TestDecodeClientCredentials(t *testing.T) {
+	for _, test := range []struct {
+		id, secret                 string
+		expectedID, expectedSecret string
+		ok                         bool
+	}{
+		{"client", "s3cret%2F%2B%3D", "client", "s3cret/+=", true},
+		{"my+client", "secret", "my client", "secret", true},
+		{"client", "secret", "", "", false},
+		{"client", "100%", "", "", false},
+	} {
+		id, secret, ok := decodeClientCredentials(test.id, test.secret)
+		if ok != test.ok || (ok && (id != test.expectedID || secret != test.expectedSecret)) {
+			t.Errorf("Test failed, expected %q %q %v got %q %q %v", test.expectedID, test.expectedSecret, test.ok, id, secret, ok)
+		}
+	}
+}
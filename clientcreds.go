@@ -2,30 +2,22 @@ package goauth
 
 import (
 	"net/http"
-	"strings"
 )
 
-func (s Server) handleClientCredentialsGrant(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleClientCredentialsGrant(w http.ResponseWriter, r *http.Request) {
 	// Check that the grant type is set to password
 	if r.PostFormValue(ParamGrantType) != GrantTypeClientCredentials {
-		w.WriteHeader(http.StatusBadRequest)
 		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 		return
 	}
 	// Authorize the client using basic auth
-	clientID, clientSecret, ok := r.BasicAuth()
-	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
-		return
-	}
-	client, err := s.Authenticator.GetClientWithSecret(clientID, Secret(clientSecret))
+	clientID, client, err := s.authenticateConfidentialClient(r)
 	if err != nil {
 		s.ErrorHandler(w, http.StatusUnauthorized, err)
 		return
 	}
 	// Check that the client is allowed for this grant type
-	ok = client.AllowStrategy(StrategyClientCredentials)
+	ok := client.AllowStrategy(StrategyClientCredentials)
 	if !ok {
 		// The client is not authorized for the grant type, therefore, return an error
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
@@ -33,27 +25,46 @@ func (s Server) handleClientCredentialsGrant(w http.ResponseWriter, r *http.Requ
 	}
 	// Get the scope (OPTIONAL)
 	rawScope := r.PostFormValue(ParamScope)
-	scope := strings.Split(rawScope, " ")
-	scope, err = client.AuthorizeScope(scope)
+	scope := s.parseScope(rawScope)
+	scope, err = s.authorizeScope(clientID, client, scope)
 	if err != nil {
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
 		return
 	}
-	grant, err := client.CreateGrant(scope)
+	details, err := s.requestAuthorizationDetails(r, clientID, client)
+	if err != nil {
+		s.ErrorHandler(w, ErrorInvalidAuthorizationDetails.StatusCode, ErrorInvalidAuthorizationDetails)
+		return
+	}
+	// Check that the risk of issuing the grant is acceptable
+	e, ok := s.evaluateRisk(r, RiskContext{
+		ClientID:  clientID,
+		Client:    client,
+		GrantType: GrantTypeClientCredentials,
+		Scope:     scope,
+	})
+	if !ok {
+		s.ErrorHandler(w, e.StatusCode, e)
+		return
+	}
+	grant, err := s.createGrant(r, client, "", scope)
 	if err != nil {
-		s.ErrorHandler(w, http.StatusInternalServerError, err)
+		s.internalError(w, r, err)
 		return
 	}
-	err = s.SessionStore.PutGrant(grant)
+	grant.AuthorizationDetails = details
+	err = s.issueGrant(r, clientID, client, "", &grant)
+	if err == nil {
+		err = s.storeGrant(r, &grant)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+		s.internalError(w, r, err)
 		return
 	}
 	// Write the grant to the http response
-	err = grant.Write(w)
+	err = s.writeGrant(w, r, grant)
 	if err != nil {
-		s.ErrorHandler(w, http.StatusInternalServerError, err)
+		s.internalError(w, r, err)
 		return
 	}
 }
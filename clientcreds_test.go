@@ -7,17 +7,12 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
-	"time"
 )
 
 func TestClientCredentialsGrant(t *testing.T) {
-	// Set the default expiry for authorization codes to a low value
-	DefaultAuthorizationCodeExpiry = time.Millisecond
-
-	// Create a new instance of the mem session store
-	DefaultSessionStore = NewSessionStore(NewMemSessionStoreBackend())
-
 	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.GrantDecorator = testTokenDecorator
 
 	// Generate a method to check the authentication of a request
 	securedHandler := server.Secure([]string{"testscope"}, func(w http.ResponseWriter, r *http.Request) {
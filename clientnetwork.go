@@ -0,0 +1,59 @@
+package goauth
+
+import (
+	"net"
+	"net/http"
+)
+
+// NetworkRestrictedClient is implemented by a Client whose credentials may only be used from known
+// networks, such as a machine to machine client. Networks can be parsed using ParseCIDRs.
+type NetworkRestrictedClient interface {
+	Client
+	// AllowedNetworks returns the networks from which the client may authenticate. If empty, all networks
+	// not denied are allowed.
+	AllowedNetworks() []*net.IPNet
+	// DeniedNetworks returns the networks from which the client may not authenticate. It takes precedence
+	// over AllowedNetworks.
+	DeniedNetworks() []*net.IPNet
+}
+
+// allowClientNetwork returns true if the request was made from a network from which the client may
+// authenticate. The address of the request is determined using RealIP.
+func (s *Server) allowClientNetwork(r *http.Request, client Client) bool {
+	restricted, ok := client.(NetworkRestrictedClient)
+	if !ok {
+		return true
+	}
+	ip := net.ParseIP(s.RealIP(r))
+	if ip == nil {
+		return false
+	}
+	if networksContain(restricted.DeniedNetworks(), ip) {
+		return false
+	}
+	allowed := restricted.AllowedNetworks()
+	return len(allowed) == 0 || networksContain(allowed, ip)
+}
+
+// allowGrantNetwork returns true if the request was made from a network from which the client the grant
+// was issued to may authenticate.
+func (s *Server) allowGrantNetwork(r *http.Request, grant Grant) bool {
+	if grant.ClientID == "" {
+		return true
+	}
+	client, err := s.authenticator(r).GetClient(grant.ClientID)
+	if err != nil {
+		return false
+	}
+	return s.allowClientNetwork(r, client)
+}
+
+// networksContain returns true if ip belongs to one of the networks.
+func networksContain(networks []*net.IPNet, ip net.IP) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package goauth
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testNetworkClient is a testClient restricted to the configured networks.
+type testNetworkClient struct {
+	*testClient
+	allowed []*net.IPNet
+	denied  []*net.IPNet
+}
+
+func (t *testNetworkClient) AllowedNetworks() []*net.IPNet {
+	return t.allowed
+}
+
+func (t *testNetworkClient) DeniedNetworks() []*net.IPNet {
+	return t.denied
+}
+
+// testNetworkAuthenticator returns a testNetworkClient.
+type testNetworkAuthenticator struct {
+	*testAuthenticator
+	client *testNetworkClient
+}
+
+func (t *testNetworkAuthenticator) GetClient(clientID string) (Client, error) {
+	if _, err := t.testAuthenticator.GetClient(clientID); err != nil {
+		return nil, err
+	}
+	return t.client, nil
+}
+
+func (t *testNetworkAuthenticator) GetClientWithSecret(clientID string, clientSecret Secret) (Client, error) {
+	if _, err := t.testAuthenticator.GetClientWithSecret(clientID, clientSecret); err != nil {
+		return nil, err
+	}
+	return t.client, nil
+}
+
+func TestClientNetworks(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	allowed, _ := ParseCIDRs("10.0.0.0/8")
+	denied, _ := ParseCIDRs("10.0.0.1")
+	client := &testNetworkClient{server.Authenticator.(*testAuthenticator).client, allowed, denied}
+	server.Authenticator = &testNetworkAuthenticator{server.Authenticator.(*testAuthenticator), client}
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials&scope=testscope"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, test := range []struct {
+		remoteAddr string
+		expected   int
+	}{
+		{"10.1.2.3:1234", http.StatusOK},
+		{"10.0.0.1:1234", http.StatusUnauthorized},
+		{"192.168.0.1:1234", http.StatusUnauthorized},
+	} {
+		if w := request(test.remoteAddr); w.Code != test.expected {
+			t.Errorf("Test failed, expected status %d from %s got %d", test.expected, test.remoteAddr, w.Code)
+		}
+	}
+
+	// Secure enforces the networks of the client when enabled
+	err := server.SessionStore.PutGrant(Grant{AccessToken: "access", ExpiresIn: DefaultTokenExpiry, CreatedAt: timeNow(), ClientID: "testclientid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secure := func(remoteAddr string) int {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer access")
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		server.Secure(nil, func(w http.ResponseWriter, r *http.Request) {})(w, r)
+		return w.Code
+	}
+	if code := secure("192.168.0.1:1234"); code != http.StatusOK {
+		t.Errorf("Test failed, expected status 200 got %d", code)
+	}
+	server.EnforceClientNetworks = true
+	if code := secure("192.168.0.1:1234"); code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected status 401 got %d", code)
+	}
+	if code := secure("10.1.2.3:1234"); code != http.StatusOK {
+		t.Errorf("Test failed, expected status 200 got %d", code)
+	}
+}
@@ -0,0 +1,110 @@
+package goauth
+
+import (
+	"time"
+)
+
+// ClientSecret is one of the secrets registered for a confidential client. Clients may have several
+// active secrets so that a new secret can be issued before the previous one expires.
+type ClientSecret struct {
+	// ID identifies the secret, allowing it to be revoked individually.
+	ID string
+	// Hash is the hash of the secret created by a PasswordHasher.
+	Hash string
+	// CreatedAt is the time at which the secret was created.
+	CreatedAt time.Time
+	// ExpiresAt is the time after which the secret is no longer accepted. If zero, it does not expire.
+	ExpiresAt time.Time
+}
+
+// IsExpired returns true if the ClientSecret has expired.
+func (c ClientSecret) IsExpired() bool {
+	return !c.ExpiresAt.IsZero() && !timeNow().Before(c.ExpiresAt)
+}
+
+// NewClientSecret generates a new random secret, returning it along with the ClientSecret storing its hash
+// created using the DefaultPasswordHasher. The secret itself is not stored and must be passed to the client.
+func NewClientSecret(expiresAt time.Time) (Secret, ClientSecret, error) {
+	secret, err := NewToken()
+	if err != nil {
+		return "", ClientSecret{}, err
+	}
+	id, err := NewToken()
+	if err != nil {
+		return "", ClientSecret{}, err
+	}
+	hash, err := DefaultPasswordHasher.Hash(secret)
+	if err != nil {
+		return "", ClientSecret{}, err
+	}
+	return secret, ClientSecret{
+		ID:        id.RawString(),
+		Hash:      hash,
+		CreatedAt: timeNow(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// ClientSecretResolver looks up the secrets registered for a client, allowing them to be kept in a secrets
+// manager rather than application configuration.
+type ClientSecretResolver interface {
+	ClientSecrets(clientID string) ([]ClientSecret, error)
+}
+
+// ResolveClientSecret returns true if the secret matches one of the unexpired secrets of the client
+// returned by the resolver.
+func ResolveClientSecret(resolver ClientSecretResolver, clientID string, secret Secret) (bool, error) {
+	secrets, err := resolver.ClientSecrets(clientID)
+	if err != nil {
+		return false, err
+	}
+	return VerifyClientSecret(secrets, secret), nil
+}
+
+// VerifyClientSecret returns true if the secret matches one of the unexpired secrets. It is intended for
+// use by Authenticator implementations in GetClientWithSecret.
+func VerifyClientSecret(secrets []ClientSecret, secret Secret) bool {
+	for _, s := range secrets {
+		if s.IsExpired() {
+			continue
+		}
+		ok, err := CheckPasswordHash(s.Hash, secret)
+		if err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RotateClientSecret generates a new secret and adds it to the secrets. Secrets that do not expire within
+// the grace period are set to expire at its end, so that the client can be updated without downtime, and
+// secrets that have already expired are removed. It returns the new secret and the secrets to be stored.
+func RotateClientSecret(secrets []ClientSecret, gracePeriod time.Duration) (Secret, []ClientSecret, error) {
+	secret, created, err := NewClientSecret(time.Time{})
+	if err != nil {
+		return "", nil, err
+	}
+	deadline := timeNow().Add(gracePeriod)
+	rotated := make([]ClientSecret, 0, len(secrets)+1)
+	for _, s := range secrets {
+		if s.IsExpired() {
+			continue
+		}
+		if s.ExpiresAt.IsZero() || s.ExpiresAt.After(deadline) {
+			s.ExpiresAt = deadline
+		}
+		rotated = append(rotated, s)
+	}
+	return secret, append(rotated, created), nil
+}
+
+// RevokeClientSecret returns the secrets without the secret with the given ID.
+func RevokeClientSecret(secrets []ClientSecret, id string) []ClientSecret {
+	revoked := make([]ClientSecret, 0, len(secrets))
+	for _, s := range secrets {
+		if s.ID != id {
+			revoked = append(revoked, s)
+		}
+	}
+	return revoked
+}
@@ -0,0 +1,47 @@
+package goauth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotateClientSecret(t *testing.T) {
+	DefaultPasswordHasher = BcryptHasher{Cost: 4}
+	defer func() { DefaultPasswordHasher = Argon2Hasher{} }()
+
+	first, secret, err := NewClientSecret(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := []ClientSecret{secret}
+	if !VerifyClientSecret(secrets, first) || VerifyClientSecret(secrets, "invalid") {
+		t.Fatal("Test failed, expected only the first secret to be valid")
+	}
+
+	// Both secrets are valid during the grace period
+	second, secrets, err := RotateClientSecret(secrets, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets) != 2 || !VerifyClientSecret(secrets, first) || !VerifyClientSecret(secrets, second) {
+		t.Fatalf("Test failed, expected both secrets to be valid got %v", secrets)
+	}
+
+	// After the grace period only the new secret is valid and the old secret is removed on rotation
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	defer func() { timeNow = time.Now }()
+	if VerifyClientSecret(secrets, first) || !VerifyClientSecret(secrets, second) {
+		t.Error("Test failed, expected only the second secret to be valid")
+	}
+	_, rotated, err := RotateClientSecret(secrets, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 || rotated[0].ID != secrets[1].ID {
+		t.Errorf("Test failed, expected the expired secret to be removed got %v", rotated)
+	}
+
+	if revoked := RevokeClientSecret(secrets, secrets[1].ID); len(revoked) != 1 || revoked[0].ID != secrets[0].ID {
+		t.Errorf("Test failed, unexpected secrets %v", revoked)
+	}
+}
@@ -0,0 +1,171 @@
+package goauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// ParamConsentToken carries the token proving that a consent or verification form submitted using an
+// existing login session was rendered by the Server for that session, preventing cross-site request forgery.
+const ParamConsentToken = "consent_token"
+
+const (
+	// consentPurposeAuthorize is the purpose of the consent token of the authorization form.
+	consentPurposeAuthorize = "authorize"
+	// consentPurposeDevice is the purpose of the consent token of the device verification form.
+	consentPurposeDevice = "device"
+)
+
+// ConsentStore remembers the scope each resource owner has approved for each client, so that a resource
+// owner with a login session is only asked to consent to scope they have not approved before.
+type ConsentStore interface {
+	// GetConsent returns the scope the resource owner has approved for the client, which is empty if the
+	// resource owner has not approved any.
+	GetConsent(ctx context.Context, username, clientID string) ([]string, error)
+	// PutConsent adds the scope to that approved by the resource owner for the client.
+	PutConsent(ctx context.Context, username, clientID string, scope []string) error
+}
+
+// SessionScopeAuthenticator may be implemented by an Authenticator to authorize the scope requested for a
+// resource owner authenticated by an existing login session rather than by credentials, as
+// AuthorizeResourceOwner does when the resource owner submits their credentials.
+type SessionScopeAuthenticator interface {
+	AuthorizeSessionScope(ctx context.Context, username string, scope []string) (bool, error)
+}
+
+// MemConsentStore is an in-memory ConsentStore.
+type MemConsentStore struct {
+	mtx      sync.Mutex
+	consents map[[2]string][]string
+}
+
+// NewMemConsentStore returns an empty MemConsentStore.
+func NewMemConsentStore() *MemConsentStore {
+	return &MemConsentStore{consents: make(map[[2]string][]string)}
+}
+
+// GetConsent returns the scope the resource owner has approved for the client.
+func (m *MemConsentStore) GetConsent(ctx context.Context, username, clientID string) ([]string, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return append([]string(nil), m.consents[[2]string{username, clientID}]...), nil
+}
+
+// PutConsent adds the scope to that approved by the resource owner for the client.
+func (m *MemConsentStore) PutConsent(ctx context.Context, username, clientID string, scope []string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	key := [2]string{username, clientID}
+	approved := m.consents[key]
+	for _, s := range scope {
+		if !containsScope(approved, s) {
+			approved = append(approved, s)
+		}
+	}
+	m.consents[key] = approved
+	return nil
+}
+
+// containsScope returns true if the scope contains the value.
+func containsScope(scope []string, value string) bool {
+	for _, s := range scope {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// hasConsent returns true if the resource owner need not be asked to consent to the scope for the client,
+// because the client is trusted or the resource owner has already approved all of the scope.
+func (s *Server) hasConsent(r *http.Request, client Client, clientID, username string, scope []string) bool {
+	if isTrustedClient(client) {
+		return true
+	}
+	if s.ConsentStore == nil {
+		return false
+	}
+	approved, err := s.ConsentStore.GetConsent(r.Context(), username, clientID)
+	if err != nil {
+		return false
+	}
+	for _, v := range scope {
+		if v != "" && !containsScope(approved, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// recordConsent remembers the scope approved by the resource owner for the client in the ConsentStore, if
+// any. Failing to remember consent only means the resource owner is asked again.
+func (s *Server) recordConsent(r *http.Request, clientID, username string, scope []string) {
+	if s.ConsentStore == nil {
+		return
+	}
+	s.ConsentStore.PutConsent(r.Context(), username, clientID, scope)
+}
+
+// authorizeSession checks that the client may act on behalf of the resource owner authenticated by the login
+// session with the scope, using the Authenticator if it is a SessionScopeAuthenticator.
+func (s *Server) authorizeSession(r *http.Request, client Client, session LoginSession, scope []string) (bool, error) {
+	allowed, err := client.AuthorizeResourceOwner(session.Username)
+	if err != nil || !allowed {
+		return false, err
+	}
+	if sa, ok := s.authenticator(r).(SessionScopeAuthenticator); ok {
+		return sa.AuthorizeSessionScope(r.Context(), session.Username, scope)
+	}
+	return true, nil
+}
+
+// formKey returns the key used to sign the tokens of the Server's forms, which is that of the StateCodec if
+// set and otherwise a random key generated for the Server.
+func (s *Server) formKey() []byte {
+	if s.StateCodec != nil {
+		return s.StateCodec.Key
+	}
+	s.formKeyOnce.Do(func() {
+		s.randomFormKey = make([]byte, 32)
+		rand.Read(s.randomFormKey)
+	})
+	return s.randomFormKey
+}
+
+// consentToken returns the token of a form submitted for the purpose using the login session, such as to
+// approve the request of a client. It is bound to the session so that it cannot be obtained by other sites.
+func (s *Server) consentToken(purpose, subject string, session LoginSession) string {
+	h := hmac.New(sha256.New, s.formKey())
+	for _, v := range []string{purpose, subject, session.Username, strconv.FormatInt(session.AuthTime.Unix(), 10)} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+type consentTokenKey struct{}
+
+// GetConsentToken returns the token that the DeviceVerificationHandler must include in the form as the
+// consent_token parameter, which is empty if the resource owner has no login session.
+func GetConsentToken(r *http.Request) string {
+	token, _ := r.Context().Value(consentTokenKey{}).(string)
+	return token
+}
+
+// withConsentToken attaches the consent token of the form to the context of the request.
+func withConsentToken(r *http.Request, token string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), consentTokenKey{}, token))
+}
+
+// checkConsentToken returns true if the request includes the token of a form rendered for the purpose and
+// login session.
+func (s *Server) checkConsentToken(r *http.Request, purpose, subject string, session LoginSession) bool {
+	token := r.FormValue(ParamConsentToken)
+	return token != "" && hmac.Equal([]byte(token), []byte(s.consentToken(purpose, subject, session)))
+}
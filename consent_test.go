@@ -0,0 +1,91 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSessionScopeAuthenticator denies the listed scope to resource owners authenticated by a login session.
+type testSessionScopeAuthenticator struct {
+	*testAuthenticator
+	denied string
+}
+
+func (t testSessionScopeAuthenticator) AuthorizeSessionScope(ctx context.Context, username string, scope []string) (bool, error) {
+	return !containsScope(scope, t.denied), nil
+}
+
+func TestSessionConsent(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	session := LoginSession{Username: "testusername", AuthTime: time.Now().Add(-time.Minute)}
+	server.SessionAuthenticator = &testSessionAuthenticator{session: &session}
+	client := server.Authenticator.(*testAuthenticator).client
+
+	authorize := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		server.ServeHTTP(w, r)
+		return w
+	}
+	code := func(w *httptest.ResponseRecorder) string {
+		uri, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return uri.Query().Get(ParamCode)
+	}
+	token := "consent_token=" + server.consentToken(consentPurposeAuthorize, "testclientid", session)
+
+	// An untrusted client must obtain the consent of the resource owner
+	if w := authorize("GET", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), ParamConsentToken) {
+		t.Errorf("Test failed, expected the consent form got %d", w.Code)
+	}
+
+	// Approving without the token of the consent form is rejected
+	for _, body := range []string{"", "consent_token=forged"} {
+		if w := authorize("POST", body); w.Code == http.StatusFound {
+			t.Errorf("Test failed, expected %q to be rejected", body)
+		}
+	}
+
+	// The token is bound to the login session
+	other := LoginSession{Username: "otheruser", AuthTime: session.AuthTime}
+	if w := authorize("POST", "consent_token="+server.consentToken(consentPurposeAuthorize, "testclientid", other)); w.Code == http.StatusFound {
+		t.Errorf("Test failed, expected the token of another session to be rejected")
+	}
+
+	// Approving using the consent form issues a code
+	if w := authorize("POST", token); code(w) == "" {
+		t.Errorf("Test failed, expected a code got %d", w.Code)
+	}
+
+	// Approved scope is remembered by the ConsentStore
+	server.ConsentStore = NewMemConsentStore()
+	if w := authorize("POST", token); code(w) == "" {
+		t.Errorf("Test failed, expected a code got %d", w.Code)
+	}
+	if w := authorize("GET", ""); code(w) == "" {
+		t.Errorf("Test failed, expected a code for approved scope got %d", w.Code)
+	}
+
+	// The Authenticator may deny the scope to the session
+	server.Authenticator = testSessionScopeAuthenticator{server.Authenticator.(*testAuthenticator), "testscope"}
+	if w := authorize("GET", ""); w.Code != http.StatusFound || code(w) != "" {
+		t.Errorf("Test failed, expected the scope to be denied got %d", w.Code)
+	}
+
+	// Trusted clients never require consent
+	server.Authenticator = server.Authenticator.(testSessionScopeAuthenticator).testAuthenticator
+	server.ConsentStore = nil
+	client.trusted = true
+	if w := authorize("GET", ""); code(w) == "" {
+		t.Errorf("Test failed, expected a code for a trusted client got %d", w.Code)
+	}
+}
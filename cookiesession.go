@@ -0,0 +1,283 @@
+package goauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultLoginSessionCookieName is the name of the cookie set by a CookieSessionAuthenticator if its
+	// Cookie options have no Name.
+	DefaultLoginSessionCookieName = "goauth_session"
+	// DefaultLoginSessionMaxAge is the lifetime of the login sessions of a CookieSessionAuthenticator if its
+	// MaxAge is not set.
+	DefaultLoginSessionMaxAge = 24 * time.Hour
+
+	// ErrNoLoginSession is returned by a CookieSessionAuthenticator and LoginSessionStore when the request
+	// has no valid login session.
+	ErrNoLoginSession = errors.New("goauth: no login session")
+)
+
+// CookieCodec encodes and decodes the values of cookies, binding each value to the name of its cookie. Its
+// methods match those of securecookie.SecureCookie from github.com/gorilla/securecookie, which can be used
+// as a CookieCodec.
+type CookieCodec interface {
+	Encode(name string, value interface{}) (string, error)
+	Decode(name, value string, dst interface{}) error
+}
+
+// StateCookieCodec is a CookieCodec sealing values using a StateCodec, so that they are signed, optionally
+// encrypted and expire after the MaxAge of the StateCodec.
+type StateCookieCodec struct {
+	Codec *StateCodec
+}
+
+// namedCookieValue is the value sealed by a StateCookieCodec, bound to the name of its cookie.
+type namedCookieValue struct {
+	Name  string          `json:"n"`
+	Value json.RawMessage `json:"v"`
+}
+
+// Encode seals the JSON encoding of the value.
+func (s StateCookieCodec) Encode(name string, value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return s.Codec.Encode(namedCookieValue{name, data})
+}
+
+// Decode verifies the sealed value and stores its contents in dst. It returns ErrInvalidState if the value
+// was not encoded by the StateCodec for a cookie with the name.
+func (s StateCookieCodec) Decode(name, value string, dst interface{}) error {
+	var v namedCookieValue
+	err := s.Codec.Decode(value, &v)
+	if err != nil {
+		return err
+	}
+	if v.Name != name {
+		return ErrInvalidState
+	}
+	return json.Unmarshal(v.Value, dst)
+}
+
+// CookieOptions are the attributes of the cookie set by a CookieSessionAuthenticator. The cookie is always
+// HttpOnly.
+type CookieOptions struct {
+	// Name is the name of the cookie. If empty, DefaultLoginSessionCookieName is used.
+	Name string
+	// Path is the path of the cookie. If empty, the cookie is sent with every request to the host.
+	Path string
+	// Domain is the domain of the cookie. If empty, the cookie is only sent to the host that set it.
+	Domain string
+	// Secure restricts the cookie to HTTPS requests.
+	Secure bool
+	// SameSite restricts the cookie to first-party requests. If zero, http.SameSiteLaxMode is used so that
+	// the cookie is sent when clients redirect the user agent to the authorization endpoint.
+	SameSite http.SameSite
+}
+
+// LoginSessionStore holds the login sessions of a CookieSessionAuthenticator by their ID. Servers sharing
+// login sessions must use a shared LoginSessionStore, such as one backed by Redis or a database.
+type LoginSessionStore interface {
+	// PutLoginSession stores the session with the ID until it expires.
+	PutLoginSession(id Secret, session LoginSession, expiresAt time.Time) error
+	// GetLoginSession returns the unexpired session with the ID. It returns ErrNoLoginSession if there is
+	// none.
+	GetLoginSession(id Secret) (LoginSession, error)
+	// DeleteLoginSession removes the session with the ID, if any.
+	DeleteLoginSession(id Secret) error
+}
+
+// CookieSessionAuthenticator is a SessionAuthenticator identifying the login session of the user agent by a
+// random ID held in a cookie. A new ID is generated each time a session is set, which happens whenever the
+// resource owner authenticates, and the previous session is removed, so that an ID planted in the user
+// agent before authentication, or belonging to another resource owner, never identifies the new session.
+type CookieSessionAuthenticator struct {
+	// Store holds the login sessions.
+	Store LoginSessionStore
+	// Codec encodes the session ID in the cookie.
+	Codec CookieCodec
+	// Cookie are the attributes of the cookie.
+	Cookie CookieOptions
+	// MaxAge is the lifetime of login sessions. If zero, DefaultLoginSessionMaxAge is used.
+	MaxAge time.Duration
+	// TokenSource generates session IDs. If nil, NewToken is used.
+	TokenSource TokenSource
+}
+
+// NewCookieSessionAuthenticator returns a CookieSessionAuthenticator holding sessions in memory, whose
+// cookies are Secure and signed using the key by a StateCookieCodec. The key should be at least 32 random
+// bytes. Values signed by the codec expire after DefaultLoginSessionMaxAge, so the codec must be replaced
+// if MaxAge is set to a longer lifetime.
+func NewCookieSessionAuthenticator(key []byte) *CookieSessionAuthenticator {
+	return &CookieSessionAuthenticator{
+		Store:  NewMemLoginSessionStore(),
+		Codec:  StateCookieCodec{&StateCodec{Key: key, MaxAge: DefaultLoginSessionMaxAge}},
+		Cookie: CookieOptions{Secure: true},
+	}
+}
+
+func (c *CookieSessionAuthenticator) cookieName() string {
+	if c.Cookie.Name != "" {
+		return c.Cookie.Name
+	}
+	return DefaultLoginSessionCookieName
+}
+
+func (c *CookieSessionAuthenticator) maxAge() time.Duration {
+	if c.MaxAge > 0 {
+		return c.MaxAge
+	}
+	return DefaultLoginSessionMaxAge
+}
+
+// cookie returns the cookie with the value and max age, using the Cookie options.
+func (c *CookieSessionAuthenticator) cookie(value string, maxAge int) *http.Cookie {
+	sameSite := c.Cookie.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	path := c.Cookie.Path
+	if path == "" {
+		path = "/"
+	}
+	return &http.Cookie{
+		Name:     c.cookieName(),
+		Value:    value,
+		Path:     path,
+		Domain:   c.Cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   c.Cookie.Secure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+}
+
+// sessionID returns the ID of the login session decoded from the cookie of the request.
+func (c *CookieSessionAuthenticator) sessionID(r *http.Request) (Secret, error) {
+	cookie, err := r.Cookie(c.cookieName())
+	if err != nil {
+		return "", ErrNoLoginSession
+	}
+	var id string
+	err = c.Codec.Decode(c.cookieName(), cookie.Value, &id)
+	if err != nil || id == "" {
+		return "", ErrNoLoginSession
+	}
+	return Secret(id), nil
+}
+
+// GetLoginSession returns the LoginSession identified by the cookie of the request.
+func (c *CookieSessionAuthenticator) GetLoginSession(r *http.Request) (LoginSession, error) {
+	id, err := c.sessionID(r)
+	if err != nil {
+		return LoginSession{}, err
+	}
+	return c.Store.GetLoginSession(id)
+}
+
+// SetLoginSession stores the session under a new ID, removing any existing session of the request, and
+// sets the cookie identifying it.
+func (c *CookieSessionAuthenticator) SetLoginSession(w http.ResponseWriter, r *http.Request, session LoginSession) error {
+	id, err := newTokenFrom(c.TokenSource)
+	if err != nil {
+		return err
+	}
+	value, err := c.Codec.Encode(c.cookieName(), id.RawString())
+	if err != nil {
+		return err
+	}
+	if old, err := c.sessionID(r); err == nil {
+		err = c.Store.DeleteLoginSession(old)
+		if err != nil {
+			return err
+		}
+	}
+	err = c.Store.PutLoginSession(id, session, timeNow().Add(c.maxAge()))
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, c.cookie(value, int(c.maxAge()/time.Second)))
+	return nil
+}
+
+// RegenerateLoginSession moves the login session of the request to a new ID. Applications should call it
+// whenever the privileges of the session change outside of the Server, such as after a resource owner
+// completes step-up authentication, to prevent session fixation.
+func (c *CookieSessionAuthenticator) RegenerateLoginSession(w http.ResponseWriter, r *http.Request) error {
+	session, err := c.GetLoginSession(r)
+	if err != nil {
+		return err
+	}
+	return c.SetLoginSession(w, r, session)
+}
+
+// ClearLoginSession removes the login session of the request, if any, and expires its cookie, such as
+// when the resource owner logs out.
+func (c *CookieSessionAuthenticator) ClearLoginSession(w http.ResponseWriter, r *http.Request) error {
+	id, err := c.sessionID(r)
+	if err != nil {
+		return nil
+	}
+	err = c.Store.DeleteLoginSession(id)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, c.cookie("", -1))
+	return nil
+}
+
+// memLoginSession is a LoginSession held by a MemLoginSessionStore.
+type memLoginSession struct {
+	session   LoginSession
+	expiresAt time.Time
+}
+
+// MemLoginSessionStore is an in-memory LoginSessionStore.
+type MemLoginSessionStore struct {
+	mtx      sync.Mutex
+	sessions map[string]memLoginSession
+}
+
+// NewMemLoginSessionStore returns an empty MemLoginSessionStore.
+func NewMemLoginSessionStore() *MemLoginSessionStore {
+	return &MemLoginSessionStore{sessions: make(map[string]memLoginSession)}
+}
+
+// PutLoginSession stores the session with the ID until it expires.
+func (m *MemLoginSessionStore) PutLoginSession(id Secret, session LoginSession, expiresAt time.Time) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	now := timeNow()
+	// Remove expired sessions so that abandoned sessions do not accumulate
+	for k, v := range m.sessions {
+		if !v.expiresAt.After(now) {
+			delete(m.sessions, k)
+		}
+	}
+	m.sessions[id.RawString()] = memLoginSession{session, expiresAt}
+	return nil
+}
+
+// GetLoginSession returns the unexpired session with the ID.
+func (m *MemLoginSessionStore) GetLoginSession(id Secret) (LoginSession, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	s, ok := m.sessions[id.RawString()]
+	if !ok || !s.expiresAt.After(timeNow()) {
+		return LoginSession{}, ErrNoLoginSession
+	}
+	return s.session, nil
+}
+
+// DeleteLoginSession removes the session with the ID.
+func (m *MemLoginSessionStore) DeleteLoginSession(id Secret) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.sessions, id.RawString())
+	return nil
+}
@@ -0,0 +1,163 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// setLoginSession sets the session using the authenticator for a request carrying the cookies, returning
+// the cookie set on the response.
+func setLoginSession(t *testing.T, c *CookieSessionAuthenticator, session LoginSession, cookies ...*http.Cookie) *http.Cookie {
+	r := httptest.NewRequest("POST", AuthorizeEnpoint, nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	err := c.SetLoginSession(w, r, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := w.Result().Cookies()
+	if len(set) != 1 {
+		t.Fatalf("Test failed, expected a cookie to be set got %v", set)
+	}
+	return set[0]
+}
+
+// getLoginSession returns the session of a request carrying the cookie.
+func getLoginSession(c *CookieSessionAuthenticator, cookie *http.Cookie) (LoginSession, error) {
+	r := httptest.NewRequest("GET", AuthorizeEnpoint, nil)
+	r.AddCookie(cookie)
+	return c.GetLoginSession(r)
+}
+
+func TestCookieSessionAuthenticator(t *testing.T) {
+	c := NewCookieSessionAuthenticator([]byte("testkeytestkeytestkeytestkeytest"))
+	c.Cookie.Domain = "auth.example.com"
+	authTime := time.Now().Truncate(time.Second)
+
+	cookie := setLoginSession(t, c, LoginSession{Username: "alice", AuthTime: authTime})
+	if cookie.Name != DefaultLoginSessionCookieName || cookie.Path != "/" || cookie.Domain != "auth.example.com" ||
+		!cookie.Secure || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge != int(DefaultLoginSessionMaxAge/time.Second) {
+		t.Errorf("Test failed, unexpected cookie %v", cookie)
+	}
+	session, err := getLoginSession(c, cookie)
+	if err != nil || session.Username != "alice" || !session.AuthTime.Equal(authTime) {
+		t.Errorf("Test failed, unexpected session %v: %v", session, err)
+	}
+
+	// Authenticating again, even as another resource owner, moves the session to a new ID so that a cookie
+	// planted by an attacker does not identify the session
+	renewed := setLoginSession(t, c, LoginSession{Username: "bob", AuthTime: authTime}, cookie)
+	if renewed.Value == cookie.Value {
+		t.Errorf("Test failed, expected a new session ID")
+	}
+	if _, err := getLoginSession(c, cookie); err != ErrNoLoginSession {
+		t.Errorf("Test failed, expected the previous session to be removed got %v", err)
+	}
+	if session, err := getLoginSession(c, renewed); err != nil || session.Username != "bob" {
+		t.Errorf("Test failed, unexpected session %v: %v", session, err)
+	}
+
+	// Regenerating keeps the session under a new ID
+	r := httptest.NewRequest("GET", AuthorizeEnpoint, nil)
+	r.AddCookie(renewed)
+	w := httptest.NewRecorder()
+	err = c.RegenerateLoginSession(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regenerated := w.Result().Cookies()[0]
+	if session, err := getLoginSession(c, regenerated); err != nil || session.Username != "bob" {
+		t.Errorf("Test failed, unexpected session %v: %v", session, err)
+	}
+	if _, err := getLoginSession(c, renewed); err != ErrNoLoginSession {
+		t.Errorf("Test failed, expected the regenerated session to be removed got %v", err)
+	}
+
+	// Clearing the session removes it and expires the cookie
+	r = httptest.NewRequest("GET", AuthorizeEnpoint, nil)
+	r.AddCookie(regenerated)
+	w = httptest.NewRecorder()
+	err = c.ClearLoginSession(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cleared := w.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge != -1 {
+		t.Errorf("Test failed, expected the cookie to be expired got %v", cleared)
+	}
+	if _, err := getLoginSession(c, regenerated); err != ErrNoLoginSession {
+		t.Errorf("Test failed, expected the session to be removed got %v", err)
+	}
+}
+
+func TestCookieSessionAuthenticatorCodec(t *testing.T) {
+	c := NewCookieSessionAuthenticator([]byte("testkeytestkeytestkeytestkeytest"))
+	c.Cookie = CookieOptions{Name: "login", Path: "/oauth", SameSite: http.SameSiteStrictMode}
+	cookie := setLoginSession(t, c, LoginSession{Username: "alice"})
+	if cookie.Name != "login" || cookie.Path != "/oauth" || cookie.Secure || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("Test failed, unexpected cookie %v", cookie)
+	}
+
+	// Cookies that were modified, signed with another key or encoded for another cookie are rejected
+	tampered := *cookie
+	tampered.Value = cookie.Value[:len(cookie.Value)-2] + "AA"
+	other := NewCookieSessionAuthenticator([]byte("otherkeyotherkeyotherkeyotherkey"))
+	other.Cookie.Name = "login"
+	other.Store = c.Store
+	for i, invalid := range []*http.Cookie{
+		&tampered,
+		setLoginSession(t, other, LoginSession{Username: "mallory"}),
+	} {
+		if _, err := getLoginSession(c, invalid); err != ErrNoLoginSession {
+			t.Errorf("Test failed, expected cookie %d to be rejected got %v", i, err)
+		}
+	}
+	value, err := c.Codec.Encode("other", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id string
+	if err := c.Codec.Decode("login", value, &id); err != ErrInvalidState {
+		t.Errorf("Test failed, expected a value encoded for another cookie to be rejected got %v", err)
+	}
+
+	// Sessions expire after MaxAge
+	c.MaxAge = time.Minute
+	cookie = setLoginSession(t, c, LoginSession{Username: "alice"})
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	defer func() { timeNow = time.Now }()
+	if _, err := getLoginSession(c, cookie); err != ErrNoLoginSession {
+		t.Errorf("Test failed, expected the session to have expired got %v", err)
+	}
+}
+
+func TestCookieSessionAuthenticatorLogin(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	authenticator := NewCookieSessionAuthenticator([]byte("testkeytestkeytestkeytestkeytest"))
+	server.SessionAuthenticator = authenticator
+	planted := setLoginSession(t, authenticator, LoginSession{Username: "testusername", AuthTime: time.Now()})
+
+	r := httptest.NewRequest("POST", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&prompt=login", nil)
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.PostForm = map[string][]string{"username": {"testusername"}, "password": {"testpassword"}}
+	r.AddCookie(planted)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Test failed, expected a redirect got %d: %s", w.Code, w.Body.Bytes())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value == planted.Value {
+		t.Fatalf("Test failed, expected a new session cookie got %v", cookies)
+	}
+	if _, err := getLoginSession(authenticator, planted); err != ErrNoLoginSession {
+		t.Errorf("Test failed, expected the planted session to be removed got %v", err)
+	}
+	if session, err := getLoginSession(authenticator, cookies[0]); err != nil || session.Username != "testusername" {
+		t.Errorf("Test failed, unexpected session %v: %v", session, err)
+	}
+}
@@ -0,0 +1,139 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// LoginFields are the names of the fields of the login forms rendered by the authorization and device
+// verification endpoints.
+type LoginFields struct {
+	Username string
+	Password string
+	// Extra are the names of additional fields, such as a tenant or one-time password, whose values are
+	// passed to a CredentialsAuthenticator.
+	Extra []string
+}
+
+var (
+	// DefaultLoginFields are the login form fields used if the Server's LoginFields are not set.
+	DefaultLoginFields = LoginFields{Username: "username", Password: "password"}
+)
+
+// Credentials are the values submitted by a resource owner to a login form.
+type Credentials struct {
+	Username string
+	Password Secret
+	// Extra contains the values of the LoginFields' Extra fields.
+	Extra url.Values
+}
+
+// CredentialsAuthenticator may be implemented by an Authenticator to receive the extra fields of the login
+// form. If implemented, AuthorizeCredentials is called instead of AuthorizeResourceOwner.
+type CredentialsAuthenticator interface {
+	AuthorizeCredentials(credentials Credentials, scope []string) (bool, error)
+}
+
+// loginFields returns the Server's LoginFields, using DefaultLoginFields for any name not set.
+func (s *Server) loginFields() LoginFields {
+	fields := s.LoginFields
+	if fields.Username == "" {
+		fields.Username = DefaultLoginFields.Username
+	}
+	if fields.Password == "" {
+		fields.Password = DefaultLoginFields.Password
+	}
+	if fields.Extra == nil {
+		fields.Extra = DefaultLoginFields.Extra
+	}
+	return fields
+}
+
+type loginFieldsKey struct{}
+
+// GetLoginFields returns the names of the login form fields for display by the AuthorizationHandler and
+// DeviceVerificationHandler.
+func GetLoginFields(r *http.Request) LoginFields {
+	fields, ok := r.Context().Value(loginFieldsKey{}).(LoginFields)
+	if !ok {
+		return DefaultLoginFields
+	}
+	return fields
+}
+
+// withLoginFields attaches the Server's LoginFields to the context of the request.
+func (s *Server) withLoginFields(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), loginFieldsKey{}, s.loginFields()))
+}
+
+// credentials returns the Credentials submitted to the login form.
+func (s *Server) credentials(r *http.Request) Credentials {
+	fields := s.loginFields()
+	c := Credentials{
+		Username: r.PostFormValue(fields.Username),
+		Password: Secret(r.PostFormValue(fields.Password)),
+	}
+	for _, name := range fields.Extra {
+		if values, ok := r.PostForm[name]; ok {
+			if c.Extra == nil {
+				c.Extra = url.Values{}
+			}
+			c.Extra[name] = values
+		}
+	}
+	return c
+}
+
+// ResourceOwnerRequest describes an attempt by a resource owner to authenticate on behalf of a client.
+type ResourceOwnerRequest struct {
+	Credentials Credentials
+	ClientID    string
+	Client      Client
+	// RemoteAddr is the IP address of the resource owner's user agent, or of the client for the resource
+	// owner password credentials grant, as returned by Server.RealIP.
+	RemoteAddr string
+	Scope      []string
+	// AuthContext describes the request, including the location of its address and the recent failed
+	// attempts to authenticate as the username.
+	AuthContext AuthContext
+}
+
+// ResourceOwnerAuthenticator may be implemented by an Authenticator to receive the context and client of
+// each request authenticating a resource owner, allowing per-client policies and throttling by address. If
+// implemented, AuthorizeResourceOwnerRequest is called instead of AuthorizeCredentials and
+// AuthorizeResourceOwner.
+type ResourceOwnerAuthenticator interface {
+	AuthorizeResourceOwnerRequest(ctx context.Context, req ResourceOwnerRequest) (bool, error)
+}
+
+// resourceOwnerRequest returns the ResourceOwnerRequest of the credentials submitted to the request.
+func (s *Server) resourceOwnerRequest(r *http.Request, credentials Credentials, clientID string, client Client, scope []string) ResourceOwnerRequest {
+	return ResourceOwnerRequest{
+		Credentials: credentials,
+		ClientID:    clientID,
+		Client:      client,
+		RemoteAddr:  s.RealIP(r),
+		Scope:       scope,
+		AuthContext: s.authContext(r, credentials.Username),
+	}
+}
+
+// authorizeResourceOwner checks the credentials of the request using the Authenticator, calling the most
+// specific of the ResourceOwnerAuthenticator, CredentialsAuthenticator and Authenticator interfaces it
+// implements. The outcome is recorded by the Server's FailureCounter.
+func (s *Server) authorizeResourceOwner(r *http.Request, req ResourceOwnerRequest) (bool, error) {
+	ok, err := authorizeResourceOwner(r.Context(), s.authenticator(r), req)
+	s.recordAttempt(r, req.Credentials.Username, ok && err == nil)
+	return ok, err
+}
+
+func authorizeResourceOwner(ctx context.Context, a Authenticator, req ResourceOwnerRequest) (bool, error) {
+	if ra, ok := a.(ResourceOwnerAuthenticator); ok {
+		return ra.AuthorizeResourceOwnerRequest(ctx, req)
+	}
+	if ca, ok := a.(CredentialsAuthenticator); ok {
+		return ca.AuthorizeCredentials(req.Credentials, req.Scope)
+	}
+	return a.AuthorizeResourceOwner(req.Credentials.Username, req.Credentials.Password, req.Scope)
+}
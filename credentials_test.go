@@ -0,0 +1,94 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testCredentialsAuthenticator struct {
+	*testAuthenticator
+	credentials Credentials
+}
+
+func (t *testCredentialsAuthenticator) AuthorizeCredentials(credentials Credentials, scope []string) (bool, error) {
+	t.credentials = credentials
+	if credentials.Extra.Get("otp") != "123456" {
+		return false, ErrorAccessDenied
+	}
+	return t.AuthorizeResourceOwner(credentials.Username, credentials.Password, scope)
+}
+
+func TestLoginFields(t *testing.T) {
+	server := newTestHandler()
+	authenticator := &testCredentialsAuthenticator{testAuthenticator: server.Authenticator.(*testAuthenticator)}
+	server.Authenticator = authenticator
+	server.LoginFields = LoginFields{Username: "email", Extra: []string{"otp"}}
+	const authorize = "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope"
+
+	// The login form uses the configured field names
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", authorize, nil))
+	for _, field := range []string{`name="email"`, `name="password"`, `name="otp"`} {
+		if !strings.Contains(w.Body.String(), field) {
+			t.Errorf("Test failed, expected the form to contain %s", field)
+		}
+	}
+
+	login := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", authorize, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		server.ServeHTTP(w, r)
+		return w
+	}
+	if w := login("email=testusername&password=testpassword&otp=000000"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected an invalid one-time password to be rejected got %d", w.Code)
+	}
+	if w := login("email=testusername&password=testpassword&otp=123456&other=value"); w.Code != http.StatusFound {
+		t.Errorf("Test failed, expected a redirect got %d", w.Code)
+	}
+	expected := Credentials{Username: "testusername", Password: "testpassword", Extra: url.Values{"otp": {"123456"}}}
+	if !reflect.DeepEqual(authenticator.credentials, expected) {
+		t.Errorf("Test failed, expected %v got %v", expected, authenticator.credentials)
+	}
+}
+
+type testResourceOwnerAuthenticator struct {
+	*testAuthenticator
+	requests []ResourceOwnerRequest
+	ids      []string
+}
+
+func (t *testResourceOwnerAuthenticator) AuthorizeResourceOwnerRequest(ctx context.Context, req ResourceOwnerRequest) (bool, error) {
+	t.requests = append(t.requests, req)
+	t.ids = append(t.ids, RequestIDFromContext(ctx))
+	return t.AuthorizeResourceOwner(req.Credentials.Username, req.Credentials.Password, req.Scope)
+}
+
+func TestResourceOwnerAuthenticator(t *testing.T) {
+	server := newTestHandler()
+	authenticator := &testResourceOwnerAuthenticator{testAuthenticator: server.Authenticator.(*testAuthenticator)}
+	server.Authenticator = authenticator
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=password&username=testusername&password=testpassword&scope=testscope"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	r.RemoteAddr = "198.51.100.7:1234"
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || len(authenticator.requests) != 1 {
+		t.Fatalf("Test failed, got %d with %d requests", w.Code, len(authenticator.requests))
+	}
+	req := authenticator.requests[0]
+	if req.ClientID != "testclientid" || req.Client == nil || req.RemoteAddr != "198.51.100.7" || req.Credentials.Username != "testusername" {
+		t.Errorf("Test failed, unexpected request %v", req)
+	}
+	if authenticator.ids[0] != w.Header().Get(RequestIDHeader) {
+		t.Errorf("Test failed, expected the request context got request ID %s", authenticator.ids[0])
+	}
+}
@@ -0,0 +1,79 @@
+package goauth
+
+import (
+	"net/http"
+	"sync"
+)
+
+// DeprecatedFlow identifies a flow omitted from OAuth 2.1.
+type DeprecatedFlow string
+
+const (
+	// DeprecatedFlowImplicit is the Implicit Grant, requested using the token response type.
+	DeprecatedFlowImplicit DeprecatedFlow = "implicit"
+	// DeprecatedFlowPassword is the Resource Owner Password Credentials Grant.
+	DeprecatedFlowPassword DeprecatedFlow = "password"
+)
+
+// DeprecatedFlowPolicy disables the flows omitted from OAuth 2.1 and reports their use, helping to migrate
+// clients off them.
+type DeprecatedFlowPolicy struct {
+	// DisableImplicit rejects authorization requests using the Implicit Grant with
+	// unsupported_response_type.
+	DisableImplicit bool
+	// DisablePassword rejects token requests using the Resource Owner Password Credentials Grant with
+	// unauthorized_client.
+	DisablePassword bool
+	// MigrationURI is the URI of a page explaining how to migrate to a supported flow. It is returned as the
+	// error URI of requests using a disabled flow.
+	MigrationURI string
+	// OnAttempt is called with each request using a deprecated flow, whether or not the flow is disabled,
+	// allowing the clients still using it to be identified.
+	OnAttempt func(r *http.Request, flow DeprecatedFlow, clientID string)
+}
+
+// deprecatedFlowCounter counts the requests using each deprecated flow.
+type deprecatedFlowCounter struct {
+	mtx      sync.Mutex
+	attempts map[DeprecatedFlow]int64
+}
+
+// DeprecatedFlowAttempts returns the number of requests that have used each deprecated flow since the
+// Server was created, including those rejected because the flow is disabled.
+func (s *Server) DeprecatedFlowAttempts() map[DeprecatedFlow]int64 {
+	s.deprecatedFlows.mtx.Lock()
+	defer s.deprecatedFlows.mtx.Unlock()
+	attempts := make(map[DeprecatedFlow]int64, len(s.deprecatedFlows.attempts))
+	for flow, n := range s.deprecatedFlows.attempts {
+		attempts[flow] = n
+	}
+	return attempts
+}
+
+// deprecatedFlowAttempt records a request using a deprecated flow. It returns the error to respond with if
+// the flow is disabled, or nil if the request may continue.
+func (s *Server) deprecatedFlowAttempt(r *http.Request, flow DeprecatedFlow, clientID string) error {
+	s.deprecatedFlows.mtx.Lock()
+	if s.deprecatedFlows.attempts == nil {
+		s.deprecatedFlows.attempts = make(map[DeprecatedFlow]int64)
+	}
+	s.deprecatedFlows.attempts[flow]++
+	s.deprecatedFlows.mtx.Unlock()
+	policy := s.DeprecatedFlows
+	if policy.OnAttempt != nil {
+		policy.OnAttempt(r, flow, clientID)
+	}
+	var e Error
+	switch {
+	case flow == DeprecatedFlowImplicit && policy.DisableImplicit:
+		e = ErrorUnsupportedResponseType.WithDetail("The implicit grant is not supported, use the authorization code grant with PKCE instead.")
+	case flow == DeprecatedFlowPassword && policy.DisablePassword:
+		e = ErrorUnauthorizedClient.WithDetail("The resource owner password credentials grant is not supported, use the authorization code grant instead.")
+	default:
+		return nil
+	}
+	if policy.MigrationURI != "" {
+		return e.WithURI(policy.MigrationURI)
+	}
+	return e
+}
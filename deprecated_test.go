@@ -0,0 +1,68 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeprecatedFlows(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	var attempts []string
+	server.DeprecatedFlows.OnAttempt = func(r *http.Request, flow DeprecatedFlow, clientID string) {
+		attempts = append(attempts, string(flow)+":"+clientID)
+	}
+	implicit := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", AuthorizeEnpoint+"?response_type=token&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", nil))
+		return w
+	}
+	password := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=password&username=testusername&password=testpassword&scope=testscope"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// Deprecated flows are enabled by default but their use is counted
+	if w := implicit(); !strings.Contains(w.Header().Get("Location"), "access_token=") {
+		t.Errorf("Test failed, expected an access token got %s", w.Header().Get("Location"))
+	}
+	if w := password(); w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected status 200 got %d", w.Code)
+	}
+
+	// Disabled flows return errors including the migration URI
+	server.DeprecatedFlows.DisableImplicit = true
+	server.DeprecatedFlows.DisablePassword = true
+	server.DeprecatedFlows.MigrationURI = "https://example.com/migrate"
+	location, err := url.Parse(implicit().Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fragment, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fragment.Get(ParamError) != ErrorUnsupportedResponseType.Code || fragment.Get(ParamErrorURI) != "https://example.com/migrate" || fragment.Get(ParamAccessToken) != "" {
+		t.Errorf("Test failed, unexpected redirect %s", location)
+	}
+	w := password()
+	if w.Code != ErrorUnauthorizedClient.StatusCode || !strings.Contains(w.Body.String(), `"code":"unauthorized_client"`) || !strings.Contains(w.Body.String(), `"uri":"https://example.com/migrate"`) {
+		t.Errorf("Test failed, got %d %s", w.Code, w.Body)
+	}
+
+	expected := map[DeprecatedFlow]int64{DeprecatedFlowImplicit: 2, DeprecatedFlowPassword: 2}
+	if got := server.DeprecatedFlowAttempts(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Test failed, expected %v got %v", expected, got)
+	}
+	if len(attempts) != 4 || attempts[0] != "implicit:testclientid" || attempts[1] != "password:testclientid" {
+		t.Errorf("Test failed, unexpected attempts %v", attempts)
+	}
+}
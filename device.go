@@ -0,0 +1,562 @@
+package goauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/scritchley/goauth/qrcode"
+)
+
+const (
+	DeviceAuthorizationEndpoint = "/device_authorization"
+	DeviceVerificationEndpoint  = "/device"
+)
+
+var (
+	// DefaultDeviceCodeExpiry is the default lifetime of a device authorization request.
+	DefaultDeviceCodeExpiry = 10 * time.Minute
+	// DefaultDevicePollingInterval is the minimum amount of time a device must wait between polling
+	// requests to the token endpoint.
+	DefaultDevicePollingInterval = 5 * time.Second
+	// DefaultMaxUserCodeAttempts is the number of invalid user codes that may be entered from an address
+	// within the window of the FailureCounter before the device verification endpoint refuses further codes.
+	DefaultMaxUserCodeAttempts = 10
+	// DefaultUserCodeFormat generates user codes such as WDJB-MJHT using the character set recommended
+	// by RFC 8628, which excludes vowels and easily confused characters.
+	DefaultUserCodeFormat = UserCodeFormat{
+		Alphabet:  "BCDFGHJKLMNPQRSTVWXZ",
+		Length:    8,
+		GroupSize: 4,
+		Separator: "-",
+	}
+
+	DefaultDeviceVerificationTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<title>Connect a device</title>
+	<link rel="stylesheet" href="{{.AssetsPath}}style.css">
+	<link rel="stylesheet" href="{{.AssetsPath}}theme.css">
+</head>
+<body>
+<main class="card">
+	<h1>Connect a device</h1>
+	{{if .Approved}}
+	<p>Your device has been connected, you may now return to it.</p>
+	{{else}}
+	{{if .Error}}
+	<p class="alert alert-error" role="alert">{{.Error}}</p>
+	{{end}}
+	{{if .Client}}
+	<p>A device has requested access{{if .Scope}} using the following scope:{{else}}.{{end}}</p>
+	{{if .Scope}}
+	<ul class="scope">
+		{{range .Scope}}
+		<li>{{.}}</li>
+		{{end}}
+	</ul>
+	{{end}}
+	{{else}}
+	<p>Enter the code displayed on your device.</p>
+	{{end}}
+	<form method="POST">
+		{{if .ConsentToken}}
+		<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+		{{end}}
+		<label for="user_code">Code</label>
+		<input type="text" id="user_code" class="user-code" name="user_code" value="{{.UserCode}}" autocomplete="off">
+		<label for="username">Username</label>
+		<input type="text" id="username" name="{{.LoginFields.Username}}" autocomplete="username">
+		<label for="password">Password</label>
+		<input type="password" id="password" name="{{.LoginFields.Password}}" autocomplete="current-password">
+		{{range .LoginFields.Extra}}
+		<label for="{{.}}">{{.}}</label>
+		<input type="text" id="{{.}}" name="{{.}}">
+		{{end}}
+		<div class="actions">
+			<button type="submit" name="action" value="deny">Deny</button>
+			<button type="submit" class="primary">Approve</button>
+		</div>
+	</form>
+	{{end}}
+</main>
+<script src="{{.AssetsPath}}app.js"></script>
+</body>
+</html>
+`))
+
+	// DefaultDeviceVerificationHandler renders ViewDeviceVerification using DefaultRenderer.
+	DefaultDeviceVerificationHandler = NewDeviceVerificationHandler(RendererFunc(renderWithDefaultRenderer))
+)
+
+// UserCodeFormat defines how user codes are generated for the device authorization grant.
+type UserCodeFormat struct {
+	// Alphabet is the set of characters user codes are composed of.
+	Alphabet string
+	// Length is the number of characters from Alphabet in each user code.
+	Length int
+	// GroupSize splits the user code into groups of this many characters joined by Separator
+	// in order to make it easier to read. Zero disables grouping.
+	GroupSize int
+	// Separator is placed between groups of characters.
+	Separator string
+}
+
+// Generate returns a new random user code.
+func (f UserCodeFormat) Generate() (string, error) {
+	alphabet := []rune(f.Alphabet)
+	if len(alphabet) == 0 || f.Length <= 0 {
+		return "", ErrorServerError
+	}
+	var b strings.Builder
+	for i := 0; i < f.Length; i++ {
+		if i > 0 && f.GroupSize > 0 && i%f.GroupSize == 0 {
+			b.WriteString(f.Separator)
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteRune(alphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// Normalize converts a user code entered by a resource owner into its canonical form, ignoring
+// case, whitespace and separators.
+func (f UserCodeFormat) Normalize(input string) string {
+	var b strings.Builder
+	for _, r := range input {
+		switch {
+		case strings.ContainsRune(f.Alphabet, r):
+			b.WriteRune(r)
+		case strings.ContainsRune(f.Alphabet, unicode.ToUpper(r)):
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	code := []rune(b.String())
+	if f.GroupSize <= 0 {
+		return string(code)
+	}
+	b.Reset()
+	for i, r := range code {
+		if i > 0 && i%f.GroupSize == 0 {
+			b.WriteString(f.Separator)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// DeviceStatus is the state of a device authorization request.
+type DeviceStatus string
+
+const (
+	DeviceStatusPending  DeviceStatus = "pending"
+	DeviceStatusApproved DeviceStatus = "approved"
+	DeviceStatusDenied   DeviceStatus = "denied"
+)
+
+// DeviceAuthorization is a device authorization request as per https://tools.ietf.org/html/rfc8628. It
+// is awaiting approval by the resource owner using the verification URI on a separate device.
+type DeviceAuthorization struct {
+	DeviceCode              Secret
+	UserCode                string
+	ClientID                string
+	Scope                   []string
+	Status                  DeviceStatus
+	Username                string
+	VerificationURI         string
+	VerificationURIComplete string
+	CreatedAt               time.Time
+	ExpiresIn               time.Duration
+	Interval                time.Duration
+	LastPolledAt            time.Time
+}
+
+// IsExpired returns true if the DeviceAuthorization has expired.
+func (d DeviceAuthorization) IsExpired() bool {
+	if d.CreatedAt.Add(d.ExpiresIn).After(timeNow()) {
+		return false
+	}
+	return true
+}
+
+// QRCode renders the verification URI as a QR code PNG image scaled to fit within size pixels. The
+// complete verification URI is used if available so that the resource owner doesn't need to enter
+// the user code.
+func (d DeviceAuthorization) QRCode(size int) ([]byte, error) {
+	uri := d.VerificationURIComplete
+	if uri == "" {
+		uri = d.VerificationURI
+	}
+	return qrcode.PNG(uri, qrcode.Medium, size)
+}
+
+// defaultVerificationURIComplete appends the user code to the verification URI as a query parameter.
+func defaultVerificationURIComplete(verificationURI, userCode string) string {
+	uri, err := url.Parse(verificationURI)
+	if err != nil {
+		return ""
+	}
+	values := uri.Query()
+	values.Set(ParamUserCode, userCode)
+	uri.RawQuery = values.Encode()
+	return uri.String()
+}
+
+// userCodeFormat returns the server's UserCodeFormat or DefaultUserCodeFormat if it is not configured.
+func (s *Server) userCodeFormat() UserCodeFormat {
+	if s.UserCodeFormat.Alphabet == "" {
+		return DefaultUserCodeFormat
+	}
+	return s.UserCodeFormat
+}
+
+// verificationURI returns the configured DeviceVerificationURI or derives it from the Issuer or request.
+func (s *Server) verificationURI(r *http.Request) string {
+	if s.DeviceVerificationURI != "" {
+		return s.DeviceVerificationURI
+	}
+	if s.Issuer != "" {
+		return s.issuerURL(DeviceVerificationEndpoint)
+	}
+	return s.requestBaseURL(r) + DeviceVerificationEndpoint
+}
+
+func (s *Server) handleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	clientID, client, err := s.authenticateClient(r)
+	if err != nil {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	// Check that the client is allowed for this grant type
+	if !client.AllowStrategy(StrategyDeviceCode) {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	// Check that the given scope is allowed
+	rawScope := r.PostFormValue(ParamScope)
+	scope := s.parseScope(rawScope)
+	scope, err = s.authorizeScope(clientID, client, scope)
+	if err != nil {
+		s.ErrorHandler(w, ErrorInvalidScope.StatusCode, ErrorInvalidScope)
+		return
+	}
+	verificationURIComplete := s.DeviceVerificationURIComplete
+	if verificationURIComplete == nil {
+		verificationURIComplete = defaultVerificationURIComplete
+	}
+	d, err := s.sessionStore(r).NewDeviceAuthorization(DeviceAuthorization{
+		ClientID:        clientID,
+		Scope:           scope,
+		VerificationURI: s.verificationURI(r),
+	}, s.userCodeFormat())
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	d.VerificationURIComplete = verificationURIComplete(d.VerificationURI, d.UserCode)
+	err = s.sessionStore(r).PutDeviceAuthorization(d)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	m := map[string]interface{}{
+		ParamDeviceCode:      d.DeviceCode.RawString(),
+		ParamUserCode:        d.UserCode,
+		ParamVerificationURI: d.VerificationURI,
+		ParamExpiresIn:       d.ExpiresIn.Seconds(),
+		"interval":           d.Interval.Seconds(),
+	}
+	if d.VerificationURIComplete != "" {
+		m[ParamVerificationURIComplete] = d.VerificationURIComplete
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	err = enc.Encode(m)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) handleDeviceVerification(w http.ResponseWriter, r *http.Request) {
+	r = s.withLoginFields(r)
+	format := s.userCodeFormat()
+	userCode := format.Normalize(r.FormValue(ParamUserCode))
+	if userCode == "" {
+		s.DeviceVerificationHandler("", nil, nil, false, nil).ServeHTTP(w, r)
+		return
+	}
+	// User codes are short enough to be guessed, so the number of invalid codes is limited as per
+	// https://tools.ietf.org/html/rfc8628#section-5.1
+	if s.userCodeAttemptsExceeded(r) {
+		s.DeviceVerificationHandler(userCode, nil, nil, false, fmt.Errorf("too many invalid codes have been entered, please try again later")).ServeHTTP(w, r)
+		return
+	}
+	d, err := s.sessionStore(r).GetDeviceAuthorizationByUserCode(userCode)
+	if err != nil || d.IsExpired() || d.Status != DeviceStatusPending {
+		s.recordUserCodeFailure(r)
+		s.DeviceVerificationHandler(userCode, nil, nil, false, fmt.Errorf("the code is invalid or has expired")).ServeHTTP(w, r)
+		return
+	}
+	client, err := s.authenticator(r).GetClient(d.ClientID)
+	if err != nil {
+		s.DeviceVerificationHandler(userCode, nil, nil, false, ErrorUnauthorizedClient).ServeHTTP(w, r)
+		return
+	}
+	session, hasSession := s.activeLoginSession(r, nil, -1)
+	if hasSession {
+		// The form includes a token proving it was rendered for the session
+		r = withConsentToken(r, s.consentToken(consentPurposeDevice, userCode, session))
+	}
+	if r.Method != "POST" {
+		s.DeviceVerificationHandler(userCode, client, d.Scope, false, nil).ServeHTTP(w, r)
+		return
+	}
+	// Both approving and denying the request require the resource owner to be authenticated
+	credentials := s.credentials(r)
+	username := credentials.Username
+	useSession := hasSession && username == ""
+	if useSession {
+		// The resource owner is already authenticated, but the form must not have been submitted by
+		// another site
+		if !s.checkConsentToken(r, consentPurposeDevice, userCode, session) {
+			s.DeviceVerificationHandler(userCode, client, d.Scope, false, ErrorAccessDenied).ServeHTTP(w, r)
+			return
+		}
+		username = session.Username
+	} else {
+		isAuthorized, err := s.authorizeResourceOwner(r, s.resourceOwnerRequest(r, credentials, d.ClientID, client, d.Scope))
+		if err != nil || !isAuthorized {
+			s.DeviceVerificationHandler(userCode, client, d.Scope, false, fmt.Errorf("username or password invalid")).ServeHTTP(w, r)
+			return
+		}
+		if s.SessionAuthenticator != nil {
+			err = s.SessionAuthenticator.SetLoginSession(w, r, LoginSession{Username: username, AuthTime: timeNow()})
+			if err != nil {
+				s.DeviceVerificationHandler(userCode, client, d.Scope, false, ErrorServerError).ServeHTTP(w, r)
+				return
+			}
+		}
+	}
+	if r.PostFormValue("action") == "deny" {
+		err = s.DenyDeviceAuthorization(userCode)
+		if err != nil {
+			s.DeviceVerificationHandler(userCode, client, d.Scope, false, err).ServeHTTP(w, r)
+			return
+		}
+		s.DeviceVerificationHandler(userCode, client, d.Scope, false, ErrorAccessDenied).ServeHTTP(w, r)
+		return
+	}
+	// Check that the client is permitted to act on behalf of the resource owner.
+	var allowed bool
+	if useSession {
+		allowed, err = s.authorizeSession(r, client, session, d.Scope)
+	} else {
+		allowed, err = client.AuthorizeResourceOwner(username)
+	}
+	if err != nil || !allowed {
+		s.DeviceVerificationHandler(userCode, client, d.Scope, false, ErrorUnauthorizedClient).ServeHTTP(w, r)
+		return
+	}
+	err = s.ApproveDeviceAuthorization(userCode, username)
+	if err != nil {
+		s.DeviceVerificationHandler(userCode, client, d.Scope, false, err).ServeHTTP(w, r)
+		return
+	}
+	s.DeviceVerificationHandler(userCode, client, d.Scope, true, nil).ServeHTTP(w, r)
+}
+
+// userCodeAttemptsExceeded returns true if the address of the request has entered MaxUserCodeAttempts
+// invalid user codes recently.
+func (s *Server) userCodeAttemptsExceeded(r *http.Request) bool {
+	n, err := s.userCodeFailures().RecentFailures(r.Context(), userCodeFailureKey(s.RealIP(r)))
+	return err == nil && n >= s.maxUserCodeAttempts()
+}
+
+// recordUserCodeFailure records the entry of an invalid user code from the address of the request.
+func (s *Server) recordUserCodeFailure(r *http.Request) {
+	s.userCodeFailures().RecordFailure(r.Context(), userCodeFailureKey(s.RealIP(r)))
+}
+
+// userCodeFailures returns the FailureCounter recording invalid user codes, which is the Server's
+// FailureCounter if set and otherwise an in-memory counter of the Server.
+func (s *Server) userCodeFailures() FailureCounter {
+	if s.FailureCounter != nil {
+		return s.FailureCounter
+	}
+	s.userCodeFailuresOnce.Do(func() {
+		s.memUserCodeFailures = NewMemFailureCounter(0)
+	})
+	return s.memUserCodeFailures
+}
+
+// userCodeFailureKey returns the key under which invalid user codes entered from the address are counted,
+// which cannot be mistaken for a username.
+func userCodeFailureKey(ip string) string {
+	return "\x00user_code:" + ip
+}
+
+// maxUserCodeAttempts returns the Server's MaxUserCodeAttempts, or DefaultMaxUserCodeAttempts if it is not
+// set.
+func (s *Server) maxUserCodeAttempts() int {
+	if s.MaxUserCodeAttempts > 0 {
+		return s.MaxUserCodeAttempts
+	}
+	return DefaultMaxUserCodeAttempts
+}
+
+func (s *Server) handleDeviceCodeTokenRequest(w http.ResponseWriter, r *http.Request) {
+	// Check that the request is using the correct grant type
+	if r.PostFormValue(ParamGrantType) != GrantTypeDeviceCode {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	clientID, client, err := s.authenticateClient(r)
+	if err != nil {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	// Check that the client is allowed for this grant type
+	if !client.AllowStrategy(StrategyDeviceCode) {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	deviceCode := Secret(r.PostFormValue(ParamDeviceCode))
+	d, err := s.sessionStore(r).GetDeviceAuthorization(deviceCode)
+	if err != nil || d.ClientID != clientID {
+		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+		return
+	}
+	if d.IsExpired() {
+		s.sessionStore(r).DeleteDeviceAuthorization(deviceCode)
+		s.ErrorHandler(w, ErrorExpiredToken.StatusCode, ErrorExpiredToken)
+		return
+	}
+	if d.Status == DeviceStatusPending {
+		// Record the poll and tell the device to slow down if it is polling too frequently
+		now := timeNow()
+		tooFast := !d.LastPolledAt.IsZero() && d.LastPolledAt.Add(d.Interval).After(now)
+		d.LastPolledAt = now
+		// The poll is only recorded while the request is pending so that it cannot undo a concurrent approval
+		// or denial
+		err = s.sessionStore(r).UpdateDeviceAuthorization(d, DeviceStatusPending)
+		if err == nil {
+			if tooFast {
+				s.ErrorHandler(w, ErrorSlowDown.StatusCode, ErrorSlowDown)
+				return
+			}
+			s.ErrorHandler(w, ErrorAuthorizationPending.StatusCode, ErrorAuthorizationPending)
+			return
+		}
+		if err != ErrStatusConflict {
+			s.internalError(w, r, err)
+			return
+		}
+		// The request was approved or denied since it was retrieved
+		d, err = s.sessionStore(r).GetDeviceAuthorization(deviceCode)
+		if err != nil || d.Status == DeviceStatusPending {
+			s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+			return
+		}
+	}
+	if d.Status == DeviceStatusDenied {
+		s.sessionStore(r).DeleteDeviceAuthorization(deviceCode)
+		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+		return
+	}
+	// The request has been approved, therefore, it can only be exchanged once
+	err = s.sessionStore(r).DeleteDeviceAuthorization(deviceCode)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// Check that the risk of issuing the grant is acceptable
+	e, ok := s.evaluateRisk(r, RiskContext{
+		ClientID:  clientID,
+		Client:    client,
+		Username:  d.Username,
+		GrantType: GrantTypeDeviceCode,
+		Scope:     d.Scope,
+	})
+	if !ok {
+		s.ErrorHandler(w, e.StatusCode, e)
+		return
+	}
+	grant, err := s.createGrant(r, client, d.Username, d.Scope)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	err = s.issueGrant(r, clientID, client, d.Username, &grant)
+	if err == nil {
+		err = s.storeGrant(r, &grant)
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// Write the grant to the http response
+	err = s.writeGrant(w, r, grant)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+}
+
+// ApproveDeviceAuthorization records the approval of the pending device authorization request
+// identified by the user code on behalf of the resource owner.
+func (s *Server) ApproveDeviceAuthorization(userCode, username string) error {
+	return s.completeDeviceAuthorization(userCode, username, DeviceStatusApproved)
+}
+
+// DenyDeviceAuthorization records the rejection of the pending device authorization request
+// identified by the user code.
+func (s *Server) DenyDeviceAuthorization(userCode string) error {
+	return s.completeDeviceAuthorization(userCode, "", DeviceStatusDenied)
+}
+
+func (s *Server) completeDeviceAuthorization(userCode, username string, status DeviceStatus) error {
+	d, err := s.SessionStore.GetDeviceAuthorizationByUserCode(s.userCodeFormat().Normalize(userCode))
+	if err != nil {
+		return err
+	}
+	if d.IsExpired() {
+		return ErrorExpiredToken
+	}
+	if d.Status != DeviceStatusPending {
+		return ErrorInvalidRequest
+	}
+	if status == DeviceStatusApproved {
+		// Restrict the scope to that permitted for the resource owner
+		d.Scope, err = s.authorizeOwnerScope(username, d.Scope)
+		if err != nil {
+			return err
+		}
+	}
+	d.Status = status
+	d.Username = username
+	err = s.SessionStore.UpdateDeviceAuthorization(d, DeviceStatusPending)
+	if err == ErrStatusConflict {
+		return ErrorInvalidRequest
+	}
+	if err != nil {
+		return err
+	}
+	if status == DeviceStatusApproved {
+		s.PublishEvent(context.Background(), Event{Type: EventConsentGranted, ClientID: d.ClientID, Username: username, Scope: d.Scope})
+	}
+	return nil
+}
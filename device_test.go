@@ -0,0 +1,243 @@
+package goauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUserCodeFormat(t *testing.T) {
+	format := UserCodeFormat{Alphabet: "0123456789", Length: 6, GroupSize: 3, Separator: " "}
+	code, err := format.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(code) != 7 || code[3] != ' ' || strings.Trim(code, "0123456789 ") != "" {
+		t.Errorf("Test failed, got %s", code)
+	}
+	if n := DefaultUserCodeFormat.Normalize("wdjb mjht"); n != "WDJB-MJHT" {
+		t.Errorf("Test failed, expected WDJB-MJHT but got %s", n)
+	}
+}
+
+// TestDeviceAuthorizationGrant tests the request/response for the Device Authorization Grant as per
+// https://tools.ietf.org/html/rfc8628.
+func TestDeviceAuthorizationGrant(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	// Devices are public clients and so identify themselves using the client_id parameter
+	server.Authenticator.(*testAuthenticator).client.clientType = ClientTypePublic
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("POST", path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Host = "example.com"
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	decode := func(w *httptest.ResponseRecorder) map[string]interface{} {
+		var resp map[string]interface{}
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := decode(post("/device_authorization", "client_id=testclientid&scope=testscope"))
+	deviceCode, _ := resp["device_code"].(string)
+	userCode, _ := resp["user_code"].(string)
+	if deviceCode == "" || len(userCode) != 9 {
+		t.Fatalf("Test failed, got %v", resp)
+	}
+	if resp["verification_uri"] != "http://example.com/device" || resp["verification_uri_complete"] != "http://example.com/device?user_code="+userCode {
+		t.Errorf("Test failed, got %v", resp)
+	}
+
+	// The verification URI is beneath the issuer if it is set
+	server.Issuer = "https://example.com/oauth"
+	if resp := decode(post("/device_authorization", "client_id=testclientid&scope=testscope")); resp["verification_uri"] != "https://example.com/oauth/device" {
+		t.Errorf("Test failed, got %v", resp)
+	}
+	server.Issuer = ""
+
+	// The device should be told to wait until the request is approved
+	poll := "grant_type=" + GrantTypeDeviceCode + "&client_id=testclientid&device_code=" + deviceCode
+	if e := decode(post("/token", poll)); e["code"] != "authorization_pending" {
+		t.Errorf("Test failed, got %v", e)
+	}
+
+	// Invalid credentials should not approve the request
+	w := post("/device", "user_code="+strings.ToLower(userCode)+"&username=testusername&password=wrong")
+	if w.Code != 401 {
+		t.Errorf("Test failed, status %v", w.Code)
+	}
+	w = post("/device", "user_code="+strings.ToLower(userCode)+"&username=testusername&password=testpassword")
+	if w.Code != 200 || !bytes.Contains(w.Body.Bytes(), []byte("Your device has been connected")) {
+		t.Errorf("Test failed, status %v: %s", w.Code, w.Body.Bytes())
+	}
+
+	// Once approved the device code can be exchanged for a grant exactly once
+	if g := decode(post("/token", poll)); g["access_token"] == nil {
+		t.Errorf("Test failed, expected an access token but got %v", g)
+	}
+	if e := decode(post("/token", poll)); e["code"] != "access_denied" {
+		t.Errorf("Test failed, got %v", e)
+	}
+}
+
+func TestDeviceAuthorizationQRCode(t *testing.T) {
+	d := DeviceAuthorization{
+		VerificationURI:         "https://example.com/device",
+		VerificationURIComplete: "https://example.com/device?user_code=WDJB-MJHT",
+	}
+	b, err := d.QRCode(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b, []byte("\x89PNG")) {
+		t.Error("Test failed, expected a PNG image")
+	}
+}
+
+func TestDeviceVerificationForm(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	session := LoginSession{Username: "testusername", AuthTime: timeNow()}
+
+	newRequest := func() DeviceAuthorization {
+		d, err := server.SessionStore.NewDeviceAuthorization(DeviceAuthorization{ClientID: "testclientid", Scope: []string{"testscope"}}, DefaultUserCodeFormat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", DeviceVerificationEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	status := func(d DeviceAuthorization) DeviceStatus {
+		stored, err := server.SessionStore.GetDeviceAuthorization(d.DeviceCode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stored.Status
+	}
+
+	// Denying a request requires the resource owner to be authenticated
+	d := newRequest()
+	post("user_code=" + d.UserCode + "&action=deny")
+	if status(d) != DeviceStatusPending {
+		t.Errorf("Test failed, expected an unauthenticated denial to be rejected")
+	}
+
+	// With a login session the form must include the token rendered for the session
+	server.SessionAuthenticator = &testSessionAuthenticator{session: &session}
+	r := httptest.NewRequest("GET", DeviceVerificationEndpoint+"?user_code="+d.UserCode, nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	token := server.consentToken(consentPurposeDevice, d.UserCode, session)
+	if !strings.Contains(w.Body.String(), token) {
+		t.Errorf("Test failed, expected the form to include the consent token")
+	}
+	post("user_code=" + d.UserCode + "&consent_token=forged")
+	if status(d) != DeviceStatusPending {
+		t.Errorf("Test failed, expected a forged approval to be rejected")
+	}
+	post("user_code=" + d.UserCode + "&consent_token=" + token)
+	if status(d) != DeviceStatusApproved {
+		t.Errorf("Test failed, expected the request to be approved")
+	}
+	d = newRequest()
+	post("user_code=" + d.UserCode + "&action=deny&consent_token=" + server.consentToken(consentPurposeDevice, d.UserCode, session))
+	if status(d) != DeviceStatusDenied {
+		t.Errorf("Test failed, expected the request to be denied")
+	}
+
+	// Recording a poll of the request as retrieved before the denial does not undo it
+	d.LastPolledAt = timeNow()
+	if err := server.SessionStore.UpdateDeviceAuthorization(d, DeviceStatusPending); err != ErrStatusConflict || status(d) != DeviceStatusDenied {
+		t.Errorf("Test failed, expected %v but got %v", ErrStatusConflict, err)
+	}
+}
+
+func TestDeviceVerificationAttempts(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.MaxUserCodeAttempts = 3
+	d, err := server.SessionStore.NewDeviceAuthorization(DeviceAuthorization{ClientID: "testclientid"}, DefaultUserCodeFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func(userCode string) string {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", DeviceVerificationEndpoint+"?user_code="+userCode, nil))
+		return w.Body.String()
+	}
+	if body := verify(d.UserCode); !strings.Contains(body, "A device has requested access") {
+		t.Fatalf("Test failed, expected the request to be shown got %s", body)
+	}
+	for i := 0; i < 3; i++ {
+		verify("BBBB-BBBB")
+	}
+	// Once the limit is reached even valid codes are refused
+	if body := verify(d.UserCode); !strings.Contains(body, "too many invalid codes") {
+		t.Errorf("Test failed, expected further codes to be refused got %s", body)
+	}
+}
+
+// unavailableUserCodeBackend is a MemSessionStoreBackend that cannot look up user codes.
+type unavailableUserCodeBackend struct {
+	*MemSessionStoreBackend
+}
+
+func (u unavailableUserCodeBackend) GetDeviceAuthorizationByUserCode(userCode string) (DeviceAuthorization, error) {
+	return DeviceAuthorization{}, errors.New("backend unavailable")
+}
+
+func TestNewDeviceAuthorizationBackendError(t *testing.T) {
+	backend := NewMemSessionStoreBackend()
+	store := NewSessionStore(unavailableUserCodeBackend{backend})
+
+	// A user code is not assumed to be free when the backend cannot check it
+	d, err := store.NewDeviceAuthorization(DeviceAuthorization{ClientID: "testclientid"}, DefaultUserCodeFormat)
+	if err == nil || err.Error() != "backend unavailable" {
+		t.Errorf("Test failed, expected the backend error got %v", err)
+	}
+	if _, err := backend.GetDeviceAuthorization(d.DeviceCode); err != ErrorAccessDenied {
+		t.Errorf("Test failed, expected the request not to be stored got %v", err)
+	}
+}
+
+func TestDeviceAuthorizationUnsupported(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(baseSessionStoreBackend{NewMemSessionStoreBackend()})
+	server.Authenticator.(*testAuthenticator).client.clientType = ClientTypePublic
+	var internalErr error
+	server.OnInternalError = func(r *http.Request, err error) {
+		internalErr = err
+	}
+
+	r := httptest.NewRequest("POST", DeviceAuthorizationEndpoint, strings.NewReader("client_id=testclientid&scope=testscope"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != ErrorServerError.StatusCode || internalErr != ErrDeviceAuthorizationsUnsupported {
+		t.Errorf("Test failed, expected %v got %d %v", ErrDeviceAuthorizationsUnsupported, w.Code, internalErr)
+	}
+	if err := server.ApproveDeviceAuthorization("WDJB-MJHT", "testusername"); err != ErrDeviceAuthorizationsUnsupported {
+		t.Errorf("Test failed, expected %v got %v", ErrDeviceAuthorizationsUnsupported, err)
+	}
+}
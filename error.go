@@ -2,6 +2,7 @@ package goauth
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 )
 
@@ -9,7 +10,8 @@ import (
 type ErrorHandler func(w http.ResponseWriter, s int, e error)
 
 var (
-	// DefaultErrorHandler can be overriden in order to implement a custom error handler.
+	// DefaultErrorHandler is the initial ErrorHandler of each Server created by New, set the Server's
+	// ErrorHandler to implement a custom error handler.
 	DefaultErrorHandler ErrorHandler = defaultErrorHandler
 )
 
@@ -23,6 +25,13 @@ func defaultErrorHandler(w http.ResponseWriter, httpStatusCode int, e error) {
 		w.WriteHeader(httpStatusCode)
 	}
 
+	// Errors wrapping an Error, such as those created by WithCause, are written as the Error unless they
+	// marshal themselves, such as those created by WithURI
+	if _, ok := e.(json.Marshaler); !ok {
+		if wrapped, ok := asError(e); ok {
+			e = wrapped
+		}
+	}
 	enc := json.NewEncoder(w)
 	err := enc.Encode(e)
 	if err != nil {
@@ -30,6 +39,51 @@ func defaultErrorHandler(w http.ResponseWriter, httpStatusCode int, e error) {
 	}
 }
 
+// StandardErrorHandler writes errors using the parameter names of
+// https://tools.ietf.org/html/rfc6749#section-5.2, error, error_description and error_uri, which client
+// libraries such as golang.org/x/oauth2 expect. DefaultErrorHandler writes them as code and description,
+// set the Server's ErrorHandler to StandardErrorHandler to interoperate with such clients. Errors that do
+// not wrap an Error are written as ErrorServerError.
+func StandardErrorHandler(w http.ResponseWriter, httpStatusCode int, e error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if httpStatusCode == 0 {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else {
+		w.WriteHeader(httpStatusCode)
+	}
+
+	wrapped, ok := asError(e)
+	if !ok {
+		wrapped = ErrorServerError
+	}
+	enc := json.NewEncoder(w)
+	err := enc.Encode(struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+		URI         string `json:"error_uri,omitempty"`
+	}{wrapped.Code, wrapped.Description, errorURI(e)})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// internalError reports an internal failure, such as a storage error, to the Server's OnInternalError hook
+// and ErrorReporter and responds with ErrorServerError so that the details of the failure are not revealed
+// to the client. Protocol errors are written as they are.
+func (s *Server) internalError(w http.ResponseWriter, r *http.Request, err error) {
+	if e, ok := asError(err); ok && e.Code != ErrorServerError.Code {
+		s.ErrorHandler(w, e.StatusCode, e)
+		return
+	}
+	if s.OnInternalError != nil {
+		s.OnInternalError(r, err)
+	}
+	s.reportError(r, err)
+	s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+}
+
 // Error is an error type that can be used in response to failing authentication attempts.
 type Error struct {
 	StatusCode  int    `json:"-"`
@@ -42,12 +96,129 @@ func (e Error) Error() string {
 	return e.Code + ": " + e.Description
 }
 
+// Is reports whether the target is an Error with the same status code and code, regardless of description,
+// so that errors.Is(err, ErrorAccessDenied) holds for errors created using WithDetail.
+func (e Error) Is(target error) bool {
+	t, ok := target.(Error)
+	return ok && t.StatusCode == e.StatusCode && t.Code == e.Code
+}
+
+// WithDetail returns a copy of the Error whose description is replaced by the detail.
+func (e Error) WithDetail(detail string) Error {
+	e.Description = detail
+	return e
+}
+
+// WithCause returns an error that is written to the client as the Error while keeping the cause, such as
+// the storage error that led to it, available to errors.Is, errors.As and error reporting.
+func (e Error) WithCause(cause error) error {
+	return &causedError{e, cause}
+}
+
+// WithURI returns an error that is written to the client as the Error including the URI of a page with
+// information about the error, such as how to resolve it.
+func (e Error) WithURI(uri string) error {
+	return &uriError{e, uri}
+}
+
+// uriError is an Error with an error URI.
+type uriError struct {
+	err Error
+	uri string
+}
+
+func (u *uriError) Error() string {
+	return u.err.Error()
+}
+
+// Is reports whether the Error is the target.
+func (u *uriError) Is(target error) bool {
+	return u.err.Is(target)
+}
+
+// As sets target to the Error if it is an *Error.
+func (u *uriError) As(target interface{}) bool {
+	if t, ok := target.(*Error); ok {
+		*t = u.err
+		return true
+	}
+	return false
+}
+
+// MarshalJSON writes the Error including the error URI.
+func (u *uriError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Error
+		URI string `json:"uri"`
+	}{u.err, u.uri})
+}
+
+// errorURI returns the error URI of err, if any.
+func errorURI(err error) string {
+	var u *uriError
+	if errors.As(err, &u) {
+		return u.uri
+	}
+	return ""
+}
+
+// causedError is an Error with an underlying cause.
+type causedError struct {
+	err   Error
+	cause error
+}
+
+func (c *causedError) Error() string {
+	return c.err.Error() + ": " + c.cause.Error()
+}
+
+// Unwrap returns the cause.
+func (c *causedError) Unwrap() error {
+	return c.cause
+}
+
+// Is reports whether the Error is the target.
+func (c *causedError) Is(target error) bool {
+	return c.err.Is(target)
+}
+
+// As sets target to the Error if it is an *Error.
+func (c *causedError) As(target interface{}) bool {
+	if t, ok := target.(*Error); ok {
+		*t = c.err
+		return true
+	}
+	return false
+}
+
+// asError returns the first Error in the chain of err.
+func asError(err error) (Error, bool) {
+	var e Error
+	ok := errors.As(err, &e)
+	return e, ok
+}
+
 var (
 	ErrorInvalidRequest = Error{
 		http.StatusBadRequest,
 		"invalid_request",
 		"The request is missing a required parameter, includes an invalid parameter value, includes a parameter more than once, or is otherwise malformed.",
 	}
+	ErrorMethodNotAllowed = Error{
+		http.StatusMethodNotAllowed,
+		"invalid_request",
+		"The request method is not supported by this endpoint.",
+	}
+	ErrorRequestTooLarge = Error{
+		http.StatusRequestEntityTooLarge,
+		"invalid_request",
+		"The request body exceeds the maximum size accepted by the authorization server.",
+	}
+	ErrorHTTPSRequired = Error{
+		http.StatusBadRequest,
+		"invalid_request",
+		"The request must be made over HTTPS.",
+	}
 	ErrorUnauthorizedClient = Error{
 		http.StatusUnauthorized,
 		"unauthorized_client",
@@ -58,11 +229,26 @@ var (
 		"access_denied",
 		"The resource owner or authorization server denied the request.",
 	}
+	ErrorInvalidGrant = Error{
+		http.StatusBadRequest,
+		"invalid_grant",
+		"The provided authorization grant or refresh token is invalid, expired, revoked or was issued to another client.",
+	}
 	ErrorUnsupportedResponseType = Error{
 		http.StatusBadRequest,
 		"unsupported_response_type",
 		"The authorization server does not support obtaining an authorization code using this method.",
 	}
+	ErrorUnsupportedGrantType = Error{
+		http.StatusBadRequest,
+		"unsupported_grant_type",
+		"The authorization grant type is not supported by the authorization server.",
+	}
+	ErrorInvalidAuthorizationDetails = Error{
+		http.StatusBadRequest,
+		"invalid_authorization_details",
+		"The authorization details are invalid, of an unknown type or not permitted for the client.",
+	}
 	ErrorInvalidScope = Error{
 		http.StatusBadRequest,
 		"invalid_scope",
@@ -78,4 +264,49 @@ var (
 		"temporarily_unavailable",
 		"The authorization server is currently unable to handle the request due to a temporary overloading or maintenance of the server.",
 	}
+	ErrorAuthorizationPending = Error{
+		http.StatusBadRequest,
+		"authorization_pending",
+		"The authorization request is still pending as the end-user hasn't yet been authenticated.",
+	}
+	ErrorSlowDown = Error{
+		http.StatusBadRequest,
+		"slow_down",
+		"The authorization request is still pending and polling should continue, but the interval must be increased.",
+	}
+	ErrorExpiredToken = Error{
+		http.StatusBadRequest,
+		"expired_token",
+		"The auth_req_id has expired. The client will need to make a new authentication request.",
+	}
+	ErrorUnknownUserID = Error{
+		http.StatusBadRequest,
+		"unknown_user_id",
+		"The authorization server is not able to identify which end-user the client wishes to be authenticated by means of the hint provided in the request.",
+	}
+	ErrorDisallowedUserAgent = Error{
+		http.StatusForbidden,
+		"disallowed_useragent",
+		"The authorization request was made from an embedded browser. Please use the system browser to sign in.",
+	}
+	ErrorLoginRequired = Error{
+		http.StatusUnauthorized,
+		"login_required",
+		"The authorization server requires the end-user to authenticate.",
+	}
+	ErrorConsentRequired = Error{
+		http.StatusUnauthorized,
+		"consent_required",
+		"The authorization server requires the end-user consent.",
+	}
+	ErrorAccountSelectionRequired = Error{
+		http.StatusUnauthorized,
+		"account_selection_required",
+		"The end-user is required to select a session at the authorization server.",
+	}
+	ErrorInsufficientUserAuthentication = Error{
+		http.StatusUnauthorized,
+		"insufficient_user_authentication",
+		"The authentication event associated with the request does not meet the authorization server's requirements.",
+	}
 )
@@ -0,0 +1,134 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type failingGrantBackend struct {
+	SessionStoreBackend
+	err error
+}
+
+func (f failingGrantBackend) PutGrant(grant Grant) error {
+	return f.err
+}
+
+func TestInternalError(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(failingGrantBackend{NewMemSessionStoreBackend(), errors.New("connection refused")})
+	var reported []error
+	server.OnInternalError = func(r *http.Request, err error) {
+		reported = append(reported, err)
+	}
+	token := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// Internal errors are reported and replaced by server_error
+	w := token()
+	if w.Code != ErrorServerError.StatusCode || strings.Contains(w.Body.String(), "connection refused") || len(reported) != 1 || reported[0].Error() != "connection refused" {
+		t.Errorf("Test failed, got %d %s with reported errors %v", w.Code, w.Body.String(), reported)
+	}
+
+	// Protocol errors are returned to the client
+	reported = nil
+	server.SessionStore = NewSessionStore(failingGrantBackend{NewMemSessionStoreBackend(), ErrorInvalidScope})
+	w = token()
+	if w.Code != ErrorInvalidScope.StatusCode || !strings.Contains(w.Body.String(), ErrorInvalidScope.Code) || len(reported) != 0 {
+		t.Errorf("Test failed, got %d %s with reported errors %v", w.Code, w.Body.String(), reported)
+	}
+}
+
+type panickingGrantBackend struct {
+	SessionStoreBackend
+}
+
+func (p panickingGrantBackend) PutGrant(grant Grant) error {
+	panic("unexpected state")
+}
+
+func TestRecoverPanic(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(panickingGrantBackend{NewMemSessionStoreBackend()})
+	var reports []ErrorReport
+	server.ErrorReporter = ErrorReporterFunc(func(ctx context.Context, report ErrorReport) {
+		reports = append(reports, report)
+	})
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	server.ServeHTTP(w, r)
+	if w.Code != ErrorServerError.StatusCode || !strings.Contains(w.Body.String(), ErrorServerError.Code) {
+		t.Errorf("Test failed, expected server_error got %d %s", w.Code, w.Body.String())
+	}
+	if len(reports) != 1 || reports[0].Err != (PanicError{"unexpected state"}) || reports[0].ClientID != "testclientid" {
+		t.Fatalf("Test failed, unexpected reports %v", reports)
+	}
+	found := false
+	for _, frame := range reports[0].Stack {
+		if strings.HasSuffix(frame.Function, "panickingGrantBackend.PutGrant") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Test failed, expected the stack of the panic got %v", reports[0].Stack)
+	}
+}
+
+func TestErrorWrapping(t *testing.T) {
+	detailed := ErrorAccessDenied.WithDetail("The account is locked.")
+	if !errors.Is(detailed, ErrorAccessDenied) || errors.Is(detailed, ErrorInvalidRequest) || detailed.Description != "The account is locked." {
+		t.Errorf("Test failed, unexpected detailed error %v", detailed)
+	}
+
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("authenticating: %w", ErrorTemporarilyUnavailable.WithCause(cause))
+	var e Error
+	if !errors.As(err, &e) || e != ErrorTemporarilyUnavailable {
+		t.Errorf("Test failed, expected errors.As to find the Error got %v", e)
+	}
+	if !errors.Is(err, ErrorTemporarilyUnavailable) || !errors.Is(err, cause) {
+		t.Errorf("Test failed, expected errors.Is to match the Error and cause of %v", err)
+	}
+
+	// Wrapped errors are written as the Error
+	w := httptest.NewRecorder()
+	defaultErrorHandler(w, e.StatusCode, err)
+	expected := `{"code":"temporarily_unavailable","description":"` + ErrorTemporarilyUnavailable.Description + `"}` + "\n"
+	if w.Body.String() != expected {
+		t.Errorf("Test failed, expected %s got %s", expected, w.Body.String())
+	}
+}
+
+func TestStandardErrorHandler(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		expected string
+	}{
+		{ErrorInvalidGrant, `{"error":"invalid_grant","error_description":"` + ErrorInvalidGrant.Description + `"}`},
+		{ErrorInvalidRequest.WithURI("https://example.com/errors"), `{"error":"invalid_request","error_description":"` + ErrorInvalidRequest.Description + `","error_uri":"https://example.com/errors"}`},
+		{fmt.Errorf("storing grant: %w", ErrorAccessDenied.WithDetail("")), `{"error":"access_denied"}`},
+		{errors.New("connection refused"), `{"error":"server_error","error_description":"` + ErrorServerError.Description + `"}`},
+	} {
+		w := httptest.NewRecorder()
+		StandardErrorHandler(w, http.StatusBadRequest, test.err)
+		if w.Body.String() != test.expected+"\n" {
+			t.Errorf("Test failed, expected %s got %s", test.expected, w.Body.String())
+		}
+		if w.Code != http.StatusBadRequest || w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Test failed, unexpected response %d %v", w.Code, w.Header())
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"runtime"
+)
+
+// StackFrame is a frame of the stack trace of an ErrorReport.
+type StackFrame struct {
+	Function string
+	File     string
+	Line     int
+}
+
+// ErrorReport describes an internal error that caused a server_error response.
+type ErrorReport struct {
+	Err       error
+	RequestID string
+	Method    string
+	// URL is the URL of the request without its query, which is included in Params.
+	URL      string
+	ClientID string
+	// Params are the parameters of the request with the values of parameters other than the LoggedParams
+	// replaced.
+	Params     url.Values
+	RemoteAddr string
+	// Stack is the stack trace at which the error was reported, starting with the innermost frame.
+	Stack []StackFrame
+}
+
+// ErrorReporter receives reports of the internal errors of a Server, for example to send them to an
+// error tracking service such as Sentry.
+type ErrorReporter interface {
+	ReportError(ctx context.Context, report ErrorReport)
+}
+
+// ErrorReporterFunc is a function implementing the ErrorReporter interface.
+type ErrorReporterFunc func(ctx context.Context, report ErrorReport)
+
+// ReportError calls f(ctx, report).
+func (f ErrorReporterFunc) ReportError(ctx context.Context, report ErrorReport) {
+	f(ctx, report)
+}
+
+// reportError sends a report of the internal error to the Server's ErrorReporter.
+func (s *Server) reportError(r *http.Request, err error) {
+	if s.ErrorReporter == nil {
+		return
+	}
+	params := r.Form
+	if params == nil {
+		params = r.URL.Query()
+	}
+	clientID := params.Get(ParamClientID)
+	if username, _, ok := r.BasicAuth(); ok && clientID == "" {
+		clientID = username
+	}
+	u := *r.URL
+	u.RawQuery = ""
+	u.Scheme = s.RequestScheme(r)
+	u.Host = s.RequestHost(r)
+	s.ErrorReporter.ReportError(r.Context(), ErrorReport{
+		Err:        err,
+		RequestID:  RequestIDFromContext(r.Context()),
+		Method:     r.Method,
+		URL:        u.String(),
+		ClientID:   clientID,
+		Params:     ScrubParams(params),
+		RemoteAddr: s.RealIP(r),
+		Stack:      callers(3),
+	})
+}
+
+// callers returns the stack trace of the caller, skipping the given number of frames.
+func callers(skip int) []StackFrame {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []StackFrame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, StackFrame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			return stack
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+const (
+	// EventTokenIssued is published when a new grant is issued.
+	EventTokenIssued EventType = "token.issued"
+	// EventTokenRefreshed is published when a grant is issued using a refresh token.
+	EventTokenRefreshed EventType = "token.refreshed"
+	// EventTokenRevoked is published when a grant is revoked.
+	EventTokenRevoked EventType = "token.revoked"
+	// EventConsentGranted is published when a resource owner approves an authorization request.
+	EventConsentGranted EventType = "consent.granted"
+	// EventConsentRevoked is published by applications, using PublishEvent, when a resource owner
+	// withdraws a previously granted consent.
+	EventConsentRevoked EventType = "consent.revoked"
+)
+
+// Event describes an action taken by the Server. It never includes tokens or other secrets.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Username  string    `json:"username,omitempty"`
+	Scope     []string  `json:"scope,omitempty"`
+	GrantType string    `json:"grant_type,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// EventSink receives the events published by the Server. Publish is called while serving requests and
+// should not block, sinks performing network calls should deliver events asynchronously.
+type EventSink interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// EventSinkFunc is an adapter allowing a function to be used as an EventSink.
+type EventSinkFunc func(ctx context.Context, e Event) error
+
+// Publish calls f(ctx, e).
+func (f EventSinkFunc) Publish(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// PublishEvent sends the event to the Server's EventSink, setting its ID, Time and RequestID if they
+// are empty. It is a no-op if the Server has no EventSink.
+func (s *Server) PublishEvent(ctx context.Context, e Event) error {
+	if s.EventSink == nil {
+		return nil
+	}
+	if e.ID == "" {
+		e.ID = newRequestID()
+	}
+	if e.Time.IsZero() {
+		e.Time = timeNow()
+	}
+	if e.RequestID == "" {
+		e.RequestID = RequestIDFromContext(ctx)
+	}
+	return s.EventSink.Publish(ctx, e)
+}
+
+// publishGrantEvent publishes an event describing the grant. Errors returned by the EventSink do not
+// affect the outcome of the request.
+func (s *Server) publishGrantEvent(r *http.Request, eventType EventType, grant Grant) {
+	s.PublishEvent(r.Context(), Event{
+		Type:      eventType,
+		ClientID:  grant.ClientID,
+		Username:  grant.Username,
+		Scope:     grant.Scope,
+		GrantType: r.PostFormValue(ParamGrantType),
+	})
+}
+
+// storeGrant saves a newly issued grant in the session store and publishes an EventTokenIssued event, or
+// EventTokenRefreshed for grants issued using a refresh token. The grant is only stored if its tokens are
+// not used by another grant, otherwise new opaque tokens are assigned to it and storing is retried.
+func (s *Server) storeGrant(r *http.Request, grant *Grant) error {
+	sessionStore := s.sessionStore(r)
+	err := sessionStore.insertGrant(*grant)
+	// Collisions are unlikely but would hand one grant's tokens to another, therefore, retry a few times
+	for i := 0; i < 5 && err == ErrTokenCollision; i++ {
+		accessToken, refreshToken, tokenErr := newGrantTokens(s.tokenSource(s.SessionStore))
+		if tokenErr != nil {
+			return tokenErr
+		}
+		// JWT access tokens include a unique ID so only opaque tokens are replaced
+		if s.tokenFormat(r.Form[ParamResource]) != TokenFormatJWT {
+			grant.AccessToken = accessToken
+		}
+		if grant.RefreshToken != "" {
+			grant.RefreshToken = refreshToken
+		}
+		err = sessionStore.insertGrant(*grant)
+	}
+	if err == ErrTokenCollision {
+		return ErrorServerError
+	}
+	if err != nil {
+		return err
+	}
+	eventType := EventTokenIssued
+	if r.PostFormValue(ParamGrantType) == GrantTypeRefreshToken {
+		eventType = EventTokenRefreshed
+	}
+	s.publishGrantEvent(r, eventType, *grant)
+	return nil
+}
@@ -0,0 +1,77 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	var events []Event
+	server.EventSink = EventSinkFunc(func(ctx context.Context, e Event) error {
+		events = append(events, e)
+		return nil
+	})
+
+	r := httptest.NewRequest("POST", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", strings.NewReader("username=testusername&password=testpassword"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=authorization_code&redirect_uri=https://testuri.com&code="+location.Query().Get(ParamCode)))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Test failed, status %d", w.Code)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Test failed, expected 2 events got %v", events)
+	}
+	consent, issued := events[0], events[1]
+	if consent.Type != EventConsentGranted || consent.Username != "testusername" || consent.ClientID != "testclientid" {
+		t.Errorf("Test failed, unexpected event %+v", consent)
+	}
+	if issued.Type != EventTokenIssued || issued.ClientID != "testclientid" || issued.GrantType != GrantTypeAuthorizationCode {
+		t.Errorf("Test failed, unexpected event %+v", issued)
+	}
+	for _, e := range events {
+		if e.ID == "" || e.Time.IsZero() || e.RequestID == "" {
+			t.Errorf("Test failed, expected the ID, Time and RequestID to be set got %+v", e)
+		}
+	}
+}
+
+func TestStoreGrantCollision(t *testing.T) {
+	server := newTestHandler().WithDeterministicTokens("token-")
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	// The first access token generated is already in use
+	err := server.SessionStore.PutGrant(Grant{AccessToken: "token-1", ClientID: "otherclient", CreatedAt: timeNow(), ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials&scope=testscope"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"token-1"`) {
+		t.Fatalf("Test failed, expected new tokens got %d %s", w.Code, w.Body)
+	}
+	grant, err := server.SessionStore.GetGrant("token-1")
+	if err != nil || grant.ClientID != "otherclient" {
+		t.Errorf("Test failed, expected the existing grant to be kept got %v %v", grant.ClientID, err)
+	}
+}
@@ -8,9 +8,9 @@ import (
 )
 
 type exampleAuthServer struct {
-	client   *exampleClient
-	username string
-	password goauth.Secret
+	// UserStoreAuthenticator checks resource owner passwords against the UserStore.
+	goauth.UserStoreAuthenticator
+	client *exampleClient
 }
 
 func (t *exampleAuthServer) GetClient(clientID string) (goauth.Client, error) {
@@ -27,16 +27,6 @@ func (t *exampleAuthServer) GetClientWithSecret(clientID string, clientSecret go
 	return nil, goauth.ErrorUnauthorizedClient
 }
 
-func (t *exampleAuthServer) AuthorizeResourceOwner(username string, password goauth.Secret, scope []string) (bool, error) {
-	if username != t.username {
-		return false, goauth.ErrorAccessDenied
-	}
-	if password != t.password {
-		return false, goauth.ErrorAccessDenied
-	}
-	return true, nil
-}
-
 type exampleClient struct {
 	ID          string
 	secret      string
@@ -80,20 +70,26 @@ func (t *exampleClient) CreateGrant(scope []string) (goauth.Grant, error) {
 }
 
 var example = &exampleAuthServer{
-	&exampleClient{
+	client: &exampleClient{
 		"testclientid",
 		"testclientsecret",
 		"testusername",
 		"https://testuri.com",
 		[]string{"testscope"},
 	},
-	"testusername",
-	goauth.Secret("testpassword"),
 }
 
 func main() {
 
+	users := goauth.NewMemUserStore()
+	err := users.CreateUser(goauth.User{Username: "testusername"}, goauth.Secret("testpassword"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	example.UserStore = users
+
 	handler := goauth.New(example)
+	handler.UserStore = users
 
 	log.Fatal(http.ListenAndServe(":8080", handler))
 }
@@ -0,0 +1,10 @@
+module github.com/scritchley/goauth/example/oidc
+
+go 1.16
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.33
+	github.com/scritchley/goauth v0.0.0-00010101000000-000000000000
+)
+
+replace github.com/scritchley/goauth => ../..
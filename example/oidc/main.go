@@ -0,0 +1,187 @@
+// Command oidc runs an OpenID Connect provider together with a relying party using it, demonstrating the
+// authorization code flow with PKCE, ID tokens, discovery and the JWKS endpoint. Sessions, users and signing
+// keys persist in SQLite and a directory, so they survive restarts.
+//
+//	go run . -addr :8080
+//
+// Then visit http://localhost:8080 and log in as exampleuser with the password examplepassword.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/scritchley/goauth"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	exampleClientID = "oidc-example"
+	exampleUsername = "exampleuser"
+	examplePassword = "examplepassword"
+)
+
+type exampleAuthServer struct {
+	// UserStoreAuthenticator checks resource owner passwords against the UserStore.
+	goauth.UserStoreAuthenticator
+	client *exampleClient
+}
+
+func (e *exampleAuthServer) GetClient(clientID string) (goauth.Client, error) {
+	if clientID == e.client.ID {
+		return e.client, nil
+	}
+	return nil, goauth.ErrorUnauthorizedClient
+}
+
+// GetClientWithSecret always fails as the example client is public and has no secret.
+func (e *exampleAuthServer) GetClientWithSecret(clientID string, clientSecret goauth.Secret) (goauth.Client, error) {
+	return nil, goauth.ErrorUnauthorizedClient
+}
+
+// exampleClient is a public client, such as a single page or native app, which must use PKCE.
+type exampleClient struct {
+	ID          string
+	redirectURI string
+	scope       []string
+}
+
+func (c *exampleClient) ClientType() goauth.ClientType {
+	return goauth.ClientTypePublic
+}
+
+func (c *exampleClient) AuthorizeScope(scope []string) ([]string, error) {
+	var approvedScope []string
+	for _, requestedScope := range scope {
+		for _, allowedScope := range c.scope {
+			if allowedScope == requestedScope {
+				approvedScope = append(approvedScope, requestedScope)
+			}
+		}
+	}
+	return approvedScope, nil
+}
+
+func (c *exampleClient) AllowRedirectURI(uri string) bool {
+	return uri == c.redirectURI
+}
+
+func (c *exampleClient) AllowStrategy(s goauth.Strategy) bool {
+	return s == goauth.StrategyAuthorizationCode || s == goauth.StrategyRefreshToken
+}
+
+func (c *exampleClient) AuthorizeResourceOwner(username string) (bool, error) {
+	return true, nil
+}
+
+// CreateGrant is deprecated and not called; grants are created by the Server.
+func (c *exampleClient) CreateGrant(scope []string) (goauth.Grant, error) {
+	return goauth.Grant{}, nil
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:8080", "public URL of the provider")
+	dsn := flag.String("db", "oidc.db", "SQLite database holding sessions and users")
+	keys := flag.String("keys", "oidc-keys", "directory holding the ID token signing keys")
+	flag.Parse()
+	*issuer = strings.TrimSuffix(*issuer, "/")
+
+	db, err := sql.Open("sqlite3", *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	backend, err := newSQLiteSessionStoreBackend(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, err := openUserStore(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.MkdirAll(*keys, 0700)
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyStore, err := goauth.NewFileKeyStore(*keys)
+	if err != nil {
+		log.Fatal(err)
+	}
+	signer := goauth.NewKeyRotator(keyStore)
+
+	example := &exampleAuthServer{
+		client: &exampleClient{
+			ID:          exampleClientID,
+			redirectURI: *issuer + callbackPath,
+			scope:       []string{goauth.ScopeOpenID, goauth.DefaultOfflineAccessScope},
+		},
+	}
+	example.UserStore = users
+
+	server := goauth.New(example)
+	server.Issuer = *issuer
+	server.SessionStore = goauth.NewSessionStore(backend)
+	server.UserStore = users
+	server.Signer = signer
+	// Rotate signing keys and sweep expired sessions in the background
+	server.AddComponent(signer)
+	server.AddComponent(goauth.ComponentFunc(func(ctx context.Context) error {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for {
+			_, err := server.SessionStore.Sweep(ctx, nil)
+			if err != nil && err != context.Canceled {
+				log.Println(err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}))
+	err = server.Start(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	// OpenID Connect clients discover the provider at /.well-known/openid-configuration, which serves the
+	// same metadata as the OAuth 2.0 authorization server metadata endpoint
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		metadata, err := server.Metadata(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metadata)
+	})
+	newRelyingParty(*issuer, example.client).register(mux)
+
+	log.Printf("Listening on %s, visit %s to log in as %s with the password %s", *addr, *issuer, exampleUsername, examplePassword)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+// openUserStore returns a SQLUserStore using the database, creating the example user on first run.
+func openUserStore(db *sql.DB) (*goauth.SQLUserStore, error) {
+	_, err := db.Exec(goauth.SQLUserStoreSchema)
+	if err != nil {
+		return nil, err
+	}
+	users := goauth.NewSQLUserStore(db)
+	err = users.CreateUser(goauth.User{Username: exampleUsername}, goauth.Secret(examplePassword))
+	if err != nil && err != goauth.ErrUserExists {
+		return nil, err
+	}
+	return users, nil
+}
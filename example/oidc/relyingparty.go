@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/scritchley/goauth"
+)
+
+const (
+	callbackPath   = "/callback"
+	stateCookie    = "oidc_example_state"
+	verifierCookie = "oidc_example_verifier"
+)
+
+// relyingParty is a minimal OpenID Connect client of the provider, such as would run in a separate
+// application. It discovers the provider's endpoints, authenticates users with the authorization code flow
+// and PKCE, and verifies the ID tokens it receives using the provider's JWKS.
+type relyingParty struct {
+	issuer string
+	client *exampleClient
+	keys   *goauth.VerifierKeyCache
+}
+
+func newRelyingParty(issuer string, client *exampleClient) *relyingParty {
+	return &relyingParty{
+		issuer: issuer,
+		client: client,
+		keys:   &goauth.VerifierKeyCache{DiscoveryURL: issuer + "/.well-known/openid-configuration"},
+	}
+}
+
+func (rp *relyingParty) register(mux *http.ServeMux) {
+	mux.HandleFunc("/", rp.handleHome)
+	mux.HandleFunc("/login", rp.handleLogin)
+	mux.HandleFunc(callbackPath, rp.handleCallback)
+	mux.HandleFunc("/refresh", rp.handleRefresh)
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head><title>goauth OpenID Connect example</title></head>
+<body>
+<h1>goauth OpenID Connect example</h1>
+{{if .Error}}<p>Error: {{.Error}}</p>{{end}}
+{{if .Claims}}
+<h2>ID token claims</h2>
+<p>The signature of the ID token was verified using the key {{.KeyID}} from the JWKS endpoint.</p>
+<pre>{{.Claims}}</pre>
+{{end}}
+{{if .Token}}
+<h2>Token response</h2>
+<pre>{{.Token}}</pre>
+{{end}}
+{{if .RefreshToken}}
+<form method="POST" action="/refresh">
+<input type="hidden" name="refresh_token" value="{{.RefreshToken}}">
+<button type="submit">Refresh the tokens</button>
+</form>
+{{end}}
+<p><a href="/login">Log in</a></p>
+</body>
+</html>`))
+
+type page struct {
+	Error        string
+	Token        string
+	Claims       string
+	KeyID        string
+	RefreshToken string
+}
+
+func (rp *relyingParty) render(w http.ResponseWriter, p page) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	pageTemplate.Execute(w, p)
+}
+
+func (rp *relyingParty) handleHome(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	rp.render(w, page{})
+}
+
+// randomString returns a random URL safe string suitable as a state or PKCE code verifier.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// handleLogin redirects to the authorization endpoint found by discovery, remembering the state and code
+// verifier in cookies so that the callback can check the response and redeem the code.
+func (rp *relyingParty) handleLogin(w http.ResponseWriter, r *http.Request) {
+	metadata, err := rp.keys.Discovery(r.Context())
+	if err != nil {
+		rp.render(w, page{Error: err.Error()})
+		return
+	}
+	endpoint, _ := metadata["authorization_endpoint"].(string)
+	state, err := randomString()
+	if err != nil {
+		rp.render(w, page{Error: err.Error()})
+		return
+	}
+	verifier, err := randomString()
+	if err != nil {
+		rp.render(w, page{Error: err.Error()})
+		return
+	}
+	for name, value := range map[string]string{stateCookie: state, verifierCookie: verifier} {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: value, Path: callbackPath, MaxAge: 600, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		goauth.ParamResponseType:        {"code"},
+		goauth.ParamClientID:            {rp.client.ID},
+		goauth.ParamRedirectURI:         {rp.client.redirectURI},
+		goauth.ParamScope:               {strings.Join(rp.client.scope, " ")},
+		goauth.ParamState:               {state},
+		goauth.ParamCodeChallenge:       {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		goauth.ParamCodeChallengeMethod: {string(goauth.CodeChallengeMethodS256)},
+	}
+	http.Redirect(w, r, endpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+// handleCallback checks the state of the authorization response and exchanges the code for tokens.
+func (rp *relyingParty) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if e := r.FormValue(goauth.ParamError); e != "" {
+		rp.render(w, page{Error: e + ": " + r.FormValue(goauth.ParamErrorDescription)})
+		return
+	}
+	state, err := r.Cookie(stateCookie)
+	if err != nil || state.Value != r.FormValue(goauth.ParamState) {
+		rp.render(w, page{Error: "the state does not match that of the login"})
+		return
+	}
+	verifier, err := r.Cookie(verifierCookie)
+	if err != nil {
+		rp.render(w, page{Error: "the code verifier is missing"})
+		return
+	}
+	for _, name := range []string{stateCookie, verifierCookie} {
+		http.SetCookie(w, &http.Cookie{Name: name, Path: callbackPath, MaxAge: -1})
+	}
+	rp.exchange(w, r, url.Values{
+		goauth.ParamGrantType:    {"authorization_code"},
+		goauth.ParamCode:         {r.FormValue(goauth.ParamCode)},
+		goauth.ParamRedirectURI:  {rp.client.redirectURI},
+		goauth.ParamCodeVerifier: {verifier.Value},
+	})
+}
+
+// handleRefresh uses the refresh token to obtain new tokens, which replace the refresh token.
+func (rp *relyingParty) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	rp.exchange(w, r, url.Values{
+		goauth.ParamGrantType:    {"refresh_token"},
+		goauth.ParamRefreshToken: {r.PostFormValue(goauth.ParamRefreshToken)},
+	})
+}
+
+// exchange makes a token request, identifying the public client by its client_id, and renders the
+// response together with the claims of the verified ID token.
+func (rp *relyingParty) exchange(w http.ResponseWriter, r *http.Request, params url.Values) {
+	metadata, err := rp.keys.Discovery(r.Context())
+	if err != nil {
+		rp.render(w, page{Error: err.Error()})
+		return
+	}
+	endpoint, _ := metadata["token_endpoint"].(string)
+	params.Set(goauth.ParamClientID, rp.client.ID)
+	resp, err := http.PostForm(endpoint, params)
+	if err != nil {
+		rp.render(w, page{Error: err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+	var token map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		rp.render(w, page{Error: err.Error()})
+		return
+	}
+	formatted, _ := json.MarshalIndent(token, "", "  ")
+	p := page{Token: string(formatted)}
+	if resp.StatusCode != http.StatusOK {
+		p.Error = fmt.Sprintf("the token endpoint responded with %s", resp.Status)
+		rp.render(w, p)
+		return
+	}
+	p.RefreshToken, _ = token["refresh_token"].(string)
+	idToken, _ := token["id_token"].(string)
+	claims, keyID, err := rp.verifyIDToken(r.Context(), idToken)
+	if err != nil {
+		p.Error = "the ID token is invalid: " + err.Error()
+		rp.render(w, p)
+		return
+	}
+	formatted, _ = json.MarshalIndent(claims, "", "  ")
+	p.Claims = string(formatted)
+	p.KeyID = keyID
+	rp.render(w, p)
+}
+
+// verifyIDToken verifies the signature of the ID token using the key from the provider's JWKS identified by
+// the token's header, then checks its issuer, audience and expiry. It returns the claims and the key ID.
+func (rp *relyingParty) verifyIDToken(ctx context.Context, idToken string) (map[string]interface{}, string, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, "", errors.New("malformed token")
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, "", err
+	}
+	jwk, err := rp.keys.Key(ctx, header.KeyID)
+	if err != nil {
+		return nil, "", err
+	}
+	if jwk.Algorithm != "" && jwk.Algorithm != header.Algorithm {
+		return nil, "", errors.New("the algorithm does not match the key")
+	}
+	public, err := jwk.PublicKey()
+	if err != nil {
+		return nil, "", err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, "", err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if header.Algorithm != goauth.AlgorithmRS256 || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return nil, "", errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Algorithm != goauth.AlgorithmES256 || len(sig) != 64 ||
+			!ecdsa.Verify(key, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return nil, "", errors.New("invalid signature")
+		}
+	default:
+		return nil, "", goauth.ErrUnsupportedAlgorithm
+	}
+	var claims map[string]interface{}
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, "", err
+	}
+	if claims["iss"] != rp.issuer {
+		return nil, "", fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if claims["aud"] != rp.client.ID {
+		return nil, "", fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+	exp, _ := claims["exp"].(float64)
+	if time.Unix(int64(exp), 0).Before(time.Now()) {
+		return nil, "", errors.New("the token has expired")
+	}
+	return claims, header.KeyID, nil
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT.
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
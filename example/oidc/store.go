@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/scritchley/goauth"
+)
+
+// sessionSchema creates the table used by sqliteSessionStoreBackend. Every record is stored as JSON keyed by
+// its kind and token, with the refresh token and user code in their own indexed columns so that grants and
+// device authorizations can be found by them. Records without an expiry, such as grants that can still be
+// refreshed, have a NULL expires_at.
+const sessionSchema = `CREATE TABLE IF NOT EXISTS sessions (
+	kind TEXT NOT NULL,
+	key TEXT NOT NULL,
+	refresh_token TEXT UNIQUE,
+	user_code TEXT UNIQUE,
+	expires_at INTEGER,
+	data TEXT NOT NULL,
+	PRIMARY KEY (kind, key)
+);
+CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at)`
+
+const (
+	kindGrant               = "grant"
+	kindAuthorizationCode   = "authorization_code"
+	kindBackChannelRequest  = "backchannel_request"
+	kindDeviceAuthorization = "device_authorization"
+	kindVerificationCode    = "verification_code"
+	kindIdempotentResponse  = "idempotent_response"
+)
+
+// sqliteSessionStoreBackend is a goauth.SessionStoreBackend storing records in SQLite. It implements the
+// optional GrantInserter, AuthorizationCodeConsumer, GrantRotator and ExpirySweeper interfaces using
+// transactions, which SQLite serializes as the database is limited to a single connection.
+type sqliteSessionStoreBackend struct {
+	db *sql.DB
+}
+
+// newSQLiteSessionStoreBackend creates the sessions table if it does not exist and returns a backend using it.
+func newSQLiteSessionStoreBackend(db *sql.DB) (*sqliteSessionStoreBackend, error) {
+	db.SetMaxOpenConns(1)
+	_, err := db.Exec(sessionSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteSessionStoreBackend{db}, nil
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// nullString returns a NULL for the empty string so that the UNIQUE constraints only apply to set values.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// expiresAt returns the Unix time at which a record expires.
+func expiresAt(createdAt time.Time, expiresIn time.Duration) sql.NullInt64 {
+	return sql.NullInt64{Int64: createdAt.Add(expiresIn).Unix(), Valid: true}
+}
+
+// grantExpiresAt returns the time at which a grant can be swept, which is never while it can be refreshed.
+func grantExpiresAt(grant goauth.Grant) sql.NullInt64 {
+	if grant.RefreshToken != "" {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: grant.ExpiresAt().Unix(), Valid: true}
+}
+
+func put(e execer, kind, key string, refreshToken, userCode string, expires sql.NullInt64, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = e.Exec(`INSERT OR REPLACE INTO sessions (kind, key, refresh_token, user_code, expires_at, data) VALUES (?, ?, ?, ?, ?, ?)`,
+		kind, key, nullString(refreshToken), nullString(userCode), expires, data)
+	return err
+}
+
+// get decodes the record into v, returning goauth.ErrorAccessDenied if it does not exist as the in memory
+// backend does.
+func get(e execer, v interface{}, query string, args ...interface{}) error {
+	var data []byte
+	err := e.QueryRow(query, args...).Scan(&data)
+	if err == sql.ErrNoRows {
+		return goauth.ErrorAccessDenied
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func getByKey(e execer, kind, key string, v interface{}) error {
+	return get(e, v, `SELECT data FROM sessions WHERE kind = ? AND key = ?`, kind, key)
+}
+
+func remove(e execer, kind, key string) error {
+	res, err := e.Exec(`DELETE FROM sessions WHERE kind = ? AND key = ?`, kind, key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return goauth.ErrorServerError
+	}
+	return nil
+}
+
+// inTx calls fn within a transaction, committing it if fn returns nil.
+func (b *sqliteSessionStoreBackend) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (b *sqliteSessionStoreBackend) PutGrant(grant goauth.Grant) error {
+	return put(b.db, kindGrant, grant.AccessToken.RawString(), grant.RefreshToken.RawString(), "", grantExpiresAt(grant), grant)
+}
+
+func (b *sqliteSessionStoreBackend) GetGrant(accessToken goauth.Secret) (goauth.Grant, error) {
+	var grant goauth.Grant
+	err := getByKey(b.db, kindGrant, accessToken.RawString(), &grant)
+	return grant, err
+}
+
+func (b *sqliteSessionStoreBackend) DeleteGrant(accessToken goauth.Secret) error {
+	return remove(b.db, kindGrant, accessToken.RawString())
+}
+
+func (b *sqliteSessionStoreBackend) RefreshGrant(refreshToken goauth.Secret) (goauth.Grant, error) {
+	var grant goauth.Grant
+	if refreshToken == "" {
+		return grant, goauth.ErrorAccessDenied
+	}
+	err := get(b.db, &grant, `SELECT data FROM sessions WHERE kind = ? AND refresh_token = ?`, kindGrant, refreshToken.RawString())
+	return grant, err
+}
+
+// InsertGrant stores the grant unless its access or refresh token is already in use.
+func (b *sqliteSessionStoreBackend) InsertGrant(grant goauth.Grant) error {
+	return b.inTx(func(tx *sql.Tx) error {
+		var n int
+		err := tx.QueryRow(`SELECT COUNT(*) FROM sessions WHERE kind = ? AND (key = ? OR refresh_token = ?)`,
+			kindGrant, grant.AccessToken.RawString(), nullString(grant.RefreshToken.RawString())).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return goauth.ErrTokenCollision
+		}
+		return put(tx, kindGrant, grant.AccessToken.RawString(), grant.RefreshToken.RawString(), "", grantExpiresAt(grant), grant)
+	})
+}
+
+// RotateGrant stores the new grant, replacing or removing the old grant, unless the old grant has changed.
+func (b *sqliteSessionStoreBackend) RotateGrant(old, new goauth.Grant, expectedVersion int64) error {
+	return b.inTx(func(tx *sql.Tx) error {
+		var stored goauth.Grant
+		err := getByKey(tx, kindGrant, old.AccessToken.RawString(), &stored)
+		if err == goauth.ErrorAccessDenied || (err == nil && (stored.ReplacedBy != "" || stored.Version != expectedVersion)) {
+			return goauth.ErrGrantRotated
+		}
+		if err != nil {
+			return err
+		}
+		if old.ReplacedBy != "" {
+			err = put(tx, kindGrant, old.AccessToken.RawString(), old.RefreshToken.RawString(), "", grantExpiresAt(old), old)
+		} else {
+			err = remove(tx, kindGrant, old.AccessToken.RawString())
+		}
+		if err != nil {
+			return err
+		}
+		return put(tx, kindGrant, new.AccessToken.RawString(), new.RefreshToken.RawString(), "", grantExpiresAt(new), new)
+	})
+}
+
+func (b *sqliteSessionStoreBackend) PutAuthorizationCode(authCode goauth.AuthorizationCode) error {
+	return put(b.db, kindAuthorizationCode, authCode.Code.RawString(), "", "", expiresAt(authCode.CreatedAt, authCode.ExpiresIn), authCode)
+}
+
+func (b *sqliteSessionStoreBackend) GetAuthorizationCode(code goauth.Secret) (goauth.AuthorizationCode, error) {
+	var authCode goauth.AuthorizationCode
+	err := getByKey(b.db, kindAuthorizationCode, code.RawString(), &authCode)
+	return authCode, err
+}
+
+func (b *sqliteSessionStoreBackend) DeleteAuthorizationCode(code goauth.Secret) error {
+	return remove(b.db, kindAuthorizationCode, code.RawString())
+}
+
+// ConsumeAuthorizationCode removes and returns the authorization code so that it can only be used once.
+func (b *sqliteSessionStoreBackend) ConsumeAuthorizationCode(code goauth.Secret) (goauth.AuthorizationCode, error) {
+	var authCode goauth.AuthorizationCode
+	err := b.inTx(func(tx *sql.Tx) error {
+		err := getByKey(tx, kindAuthorizationCode, code.RawString(), &authCode)
+		if err != nil {
+			return err
+		}
+		return remove(tx, kindAuthorizationCode, code.RawString())
+	})
+	return authCode, err
+}
+
+func (b *sqliteSessionStoreBackend) PutBackChannelRequest(req goauth.BackChannelRequest) error {
+	return put(b.db, kindBackChannelRequest, req.AuthReqID.RawString(), "", "", expiresAt(req.CreatedAt, req.ExpiresIn), req)
+}
+
+func (b *sqliteSessionStoreBackend) GetBackChannelRequest(authReqID goauth.Secret) (goauth.BackChannelRequest, error) {
+	var req goauth.BackChannelRequest
+	err := getByKey(b.db, kindBackChannelRequest, authReqID.RawString(), &req)
+	return req, err
+}
+
+func (b *sqliteSessionStoreBackend) DeleteBackChannelRequest(authReqID goauth.Secret) error {
+	return remove(b.db, kindBackChannelRequest, authReqID.RawString())
+}
+
+func (b *sqliteSessionStoreBackend) PutDeviceAuthorization(d goauth.DeviceAuthorization) error {
+	return put(b.db, kindDeviceAuthorization, d.DeviceCode.RawString(), "", d.UserCode, expiresAt(d.CreatedAt, d.ExpiresIn), d)
+}
+
+func (b *sqliteSessionStoreBackend) GetDeviceAuthorization(deviceCode goauth.Secret) (goauth.DeviceAuthorization, error) {
+	var d goauth.DeviceAuthorization
+	err := getByKey(b.db, kindDeviceAuthorization, deviceCode.RawString(), &d)
+	return d, err
+}
+
+func (b *sqliteSessionStoreBackend) GetDeviceAuthorizationByUserCode(userCode string) (goauth.DeviceAuthorization, error) {
+	var d goauth.DeviceAuthorization
+	err := get(b.db, &d, `SELECT data FROM sessions WHERE kind = ? AND user_code = ?`, kindDeviceAuthorization, userCode)
+	return d, err
+}
+
+func (b *sqliteSessionStoreBackend) DeleteDeviceAuthorization(deviceCode goauth.Secret) error {
+	return remove(b.db, kindDeviceAuthorization, deviceCode.RawString())
+}
+
+func (b *sqliteSessionStoreBackend) PutVerificationCode(v goauth.VerificationCode) error {
+	return put(b.db, kindVerificationCode, v.Code.RawString(), "", "", expiresAt(v.CreatedAt, v.ExpiresIn), v)
+}
+
+func (b *sqliteSessionStoreBackend) GetVerificationCode(code goauth.Secret) (goauth.VerificationCode, error) {
+	var v goauth.VerificationCode
+	err := getByKey(b.db, kindVerificationCode, code.RawString(), &v)
+	return v, err
+}
+
+func (b *sqliteSessionStoreBackend) DeleteVerificationCode(code goauth.Secret) error {
+	return remove(b.db, kindVerificationCode, code.RawString())
+}
+
+func (b *sqliteSessionStoreBackend) PutIdempotentResponse(resp goauth.IdempotentResponse) error {
+	return put(b.db, kindIdempotentResponse, resp.Key, "", "", expiresAt(resp.CreatedAt, resp.ExpiresIn), resp)
+}
+
+// GetIdempotentResponse returns the response unless it has expired, leaving expired responses to be swept.
+func (b *sqliteSessionStoreBackend) GetIdempotentResponse(key string) (goauth.IdempotentResponse, error) {
+	var resp goauth.IdempotentResponse
+	err := getByKey(b.db, kindIdempotentResponse, key, &resp)
+	if err == nil && resp.IsExpired() {
+		return goauth.IdempotentResponse{}, goauth.ErrorAccessDenied
+	}
+	return resp, err
+}
+
+// SweepExpired removes at most limit expired records, calling onRemove with each grant before it is removed.
+func (b *sqliteSessionStoreBackend) SweepExpired(ctx context.Context, limit int, onRemove func(goauth.Grant) error) (int, error) {
+	rows, err := b.db.QueryContext(ctx, `SELECT kind, key, data FROM sessions WHERE expires_at <= ? LIMIT ?`, time.Now().Unix(), limit)
+	if err != nil {
+		return 0, err
+	}
+	type expired struct {
+		kind, key string
+		data      []byte
+	}
+	var records []expired
+	for rows.Next() {
+		var r expired
+		err = rows.Scan(&r.kind, &r.key, &r.data)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		records = append(records, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, r := range records {
+		if r.kind == kindGrant && onRemove != nil {
+			var grant goauth.Grant
+			err = json.Unmarshal(r.data, &grant)
+			if err != nil {
+				return n, err
+			}
+			err = onRemove(grant)
+			if err != nil {
+				return n, err
+			}
+		}
+		_, err = b.db.ExecContext(ctx, `DELETE FROM sessions WHERE kind = ? AND key = ?`, r.kind, r.key)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Close closes the database, it is called by goauth.Server.Close.
+func (b *sqliteSessionStoreBackend) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,208 @@
+// Command resource-server runs an authorization server together with a resource server whose API is
+// protected by Server.Secure, for use with the single page app in example/spa. Both allow cross-origin
+// requests from the app so that it can redeem codes, refresh tokens and call the API from the browser.
+//
+//	go run ./example/resource-server
+//	go run ./example/spa
+//
+// Then visit http://localhost:3000 and log in as demouser with the password demopassword.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scritchley/goauth"
+)
+
+const (
+	demoClientID = "spa"
+	demoUsername = "demouser"
+	demoPassword = "demopassword"
+
+	// scopeProfile allows the app to read the profile of the resource owner.
+	scopeProfile = "profile:read"
+	// scopeNotes allows the app to add notes on behalf of the resource owner.
+	scopeNotes = "notes:write"
+)
+
+type demoAuthServer struct {
+	// UserStoreAuthenticator checks resource owner passwords against the UserStore.
+	goauth.UserStoreAuthenticator
+	client *spaClient
+}
+
+func (d *demoAuthServer) GetClient(clientID string) (goauth.Client, error) {
+	if clientID == d.client.ID {
+		return d.client, nil
+	}
+	return nil, goauth.ErrorUnauthorizedClient
+}
+
+// GetClientWithSecret always fails as the single page app is a public client without a secret.
+func (d *demoAuthServer) GetClientWithSecret(clientID string, clientSecret goauth.Secret) (goauth.Client, error) {
+	return nil, goauth.ErrorUnauthorizedClient
+}
+
+// spaClient is the single page app. As a public client it must use PKCE, and its refresh tokens are rotated
+// on every use.
+type spaClient struct {
+	ID          string
+	redirectURI string
+	scope       []string
+}
+
+func (c *spaClient) ClientType() goauth.ClientType {
+	return goauth.ClientTypePublic
+}
+
+// RefreshTokenPolicy rotates refresh tokens, accepting a rotated token for a few seconds so that requests
+// refreshing concurrently, such as from two tabs, are not logged out.
+func (c *spaClient) RefreshTokenPolicy() goauth.RefreshTokenPolicy {
+	return goauth.RefreshTokenPolicy{GracePeriod: 10 * time.Second}
+}
+
+func (c *spaClient) AuthorizeScope(scope []string) ([]string, error) {
+	var approvedScope []string
+	for _, requestedScope := range scope {
+		for _, allowedScope := range c.scope {
+			if allowedScope == requestedScope {
+				approvedScope = append(approvedScope, requestedScope)
+			}
+		}
+	}
+	return approvedScope, nil
+}
+
+func (c *spaClient) AllowRedirectURI(uri string) bool {
+	return uri == c.redirectURI
+}
+
+func (c *spaClient) AllowStrategy(s goauth.Strategy) bool {
+	return s == goauth.StrategyAuthorizationCode || s == goauth.StrategyRefreshToken
+}
+
+func (c *spaClient) AuthorizeResourceOwner(username string) (bool, error) {
+	return true, nil
+}
+
+// CreateGrant is deprecated and not called; grants are created by the Server.
+func (c *spaClient) CreateGrant(scope []string) (goauth.Grant, error) {
+	return goauth.Grant{}, nil
+}
+
+// cors returns a handler allowing cross-origin requests from the origin, answering preflight requests
+// itself. The Authorization header is allowed so that the app can send bearer tokens, and the
+// X-Token-Expiring header set by Secure is exposed so that it can refresh before the token expires.
+func cors(origin string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != origin {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", goauth.TokenExpiringHeader)
+		w.Header().Add("Vary", "Origin")
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// notes holds the notes added through the API by each resource owner.
+type notes struct {
+	mtx   sync.Mutex
+	notes map[string][]string
+}
+
+func (n *notes) add(username, note string) []string {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.notes[username] = append(n.notes[username], note)
+	return n.notes[username]
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func main() {
+	authAddr := flag.String("auth-addr", ":8080", "address of the authorization server")
+	issuer := flag.String("issuer", "http://localhost:8080", "public URL of the authorization server")
+	apiAddr := flag.String("api-addr", ":9000", "address of the resource server")
+	origin := flag.String("origin", "http://localhost:3000", "origin of the single page app")
+	expiry := flag.Duration("token-expiry", time.Minute, "lifetime of access tokens, short so that refreshes can be seen")
+	flag.Parse()
+
+	users := goauth.NewMemUserStore()
+	err := users.CreateUser(goauth.User{Username: demoUsername}, goauth.Secret(demoPassword))
+	if err != nil {
+		log.Fatal(err)
+	}
+	demo := &demoAuthServer{
+		client: &spaClient{
+			ID:          demoClientID,
+			redirectURI: *origin + "/",
+			scope:       []string{scopeProfile, scopeNotes, goauth.DefaultOfflineAccessScope},
+		},
+	}
+	demo.UserStore = users
+
+	server := goauth.New(demo)
+	server.Issuer = strings.TrimSuffix(*issuer, "/")
+	server.SessionStore = goauth.NewSessionStore(goauth.NewMemSessionStoreBackend())
+	server.UserStore = users
+	server.TokenExpiry = *expiry
+	server.TokenExpiryWarning = *expiry / 2
+
+	// The app discovers the endpoints, redeems codes and refreshes tokens from the browser, so the metadata
+	// and token endpoints must allow its origin. The authorization endpoint is navigated to and needs no
+	// CORS headers.
+	auth := http.NewServeMux()
+	server.RegisterRoutes(goauth.RouterFunc(func(pattern string, handler http.Handler) {
+		if pattern == goauth.TokenEndpoint || pattern == goauth.MetadataEndpoint {
+			handler = cors(*origin, handler)
+		}
+		auth.Handle(pattern, handler)
+	}))
+
+	// The API shares the Server's session store, so Secure checks the tokens it issued and their scope
+	api := http.NewServeMux()
+	n := &notes{notes: make(map[string][]string)}
+	api.HandleFunc("/api/profile", server.Secure([]string{scopeProfile}, func(w http.ResponseWriter, r *http.Request) {
+		grant, _ := goauth.GrantFromContext(r.Context())
+		writeJSON(w, map[string]interface{}{
+			"username":   grant.Username,
+			"scope":      grant.Scope,
+			"expires_at": grant.ExpiresAt(),
+		})
+	}))
+	api.HandleFunc("/api/notes", server.Secure([]string{scopeNotes}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		grant, _ := goauth.GrantFromContext(r.Context())
+		writeJSON(w, map[string]interface{}{
+			"notes": n.add(grant.Username, r.PostFormValue("note")),
+		})
+	}))
+
+	go func() {
+		log.Printf("Resource server listening on %s", *apiAddr)
+		log.Fatal(http.ListenAndServe(*apiAddr, cors(*origin, api)))
+	}()
+	log.Printf("Authorization server listening on %s, log in as %s with the password %s", *authAddr, demoUsername, demoPassword)
+	log.Fatal(http.ListenAndServe(*authAddr, auth))
+}
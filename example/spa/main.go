@@ -0,0 +1,48 @@
+// Command spa serves a single page app that logs in to the authorization server run by
+// example/resource-server using the authorization code flow with PKCE, calls its API with the access token
+// and rotates its refresh token when the access token is about to expire. All OAuth requests are made by
+// the browser, the server only serves the files.
+//
+//	go run ./example/spa
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"flag"
+	"io/fs"
+	"log"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+func main() {
+	addr := flag.String("addr", ":3000", "address to listen on")
+	issuer := flag.String("issuer", "http://localhost:8080", "URL of the authorization server")
+	api := flag.String("api", "http://localhost:9000", "URL of the resource server")
+	flag.Parse()
+
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		log.Fatal(err)
+	}
+	config, err := json.Marshal(map[string]string{
+		"issuer":   *issuer,
+		"api":      *api,
+		"clientID": "spa",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(files)))
+	mux.HandleFunc("/config.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Write([]byte("window.config = " + string(config) + ";\n"))
+	})
+
+	log.Printf("Listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
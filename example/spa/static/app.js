@@ -0,0 +1,157 @@
+// The tokens are kept in session storage so that they survive reloads of the demo. Apps handling real
+// accounts should prefer keeping them in memory.
+const config = window.config;
+const storage = window.sessionStorage;
+let metadata;
+
+function log(message) {
+	const el = document.getElementById("log");
+	el.textContent = new Date().toLocaleTimeString() + " " + message + "\n" + el.textContent;
+}
+
+function short(token) {
+	return token ? token.slice(0, 8) + "…" : "none";
+}
+
+function base64URL(bytes) {
+	return btoa(String.fromCharCode(...new Uint8Array(bytes))).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+function randomString() {
+	return base64URL(crypto.getRandomValues(new Uint8Array(32)));
+}
+
+// discover fetches the authorization server metadata, which lists its endpoints.
+async function discover() {
+	if (!metadata) {
+		const resp = await fetch(config.issuer + "/.well-known/oauth-authorization-server");
+		metadata = await resp.json();
+	}
+	return metadata;
+}
+
+// login redirects to the authorization endpoint with a PKCE code challenge. The code verifier and state are
+// kept for the redirect back to the app.
+async function login() {
+	const scope = Array.from(document.querySelectorAll("input[name=scope]:checked")).map(el => el.value);
+	const verifier = randomString();
+	const state = randomString();
+	storage.setItem("verifier", verifier);
+	storage.setItem("state", state);
+	const challenge = base64URL(await crypto.subtle.digest("SHA-256", new TextEncoder().encode(verifier)));
+	const params = new URLSearchParams({
+		response_type: "code",
+		client_id: config.clientID,
+		redirect_uri: location.origin + "/",
+		scope: scope.join(" "),
+		state: state,
+		code_challenge: challenge,
+		code_challenge_method: "S256",
+	});
+	location.assign((await discover()).authorization_endpoint + "?" + params);
+}
+
+// token makes a request to the token endpoint, storing the tokens it returns.
+async function token(params) {
+	params.set("client_id", config.clientID);
+	const resp = await fetch((await discover()).token_endpoint, {method: "POST", body: params});
+	const body = await resp.json();
+	if (!resp.ok) {
+		throw new Error(body.code || resp.statusText);
+	}
+	storage.setItem("access_token", body.access_token);
+	storage.setItem("scope", body.scope || "");
+	if (body.refresh_token) {
+		storage.setItem("refresh_token", body.refresh_token);
+	} else {
+		storage.removeItem("refresh_token");
+	}
+	return body;
+}
+
+// callback checks the state of the authorization response and redeems the code.
+async function callback(query) {
+	history.replaceState(null, "", "/");
+	if (query.get("error")) {
+		throw new Error(query.get("error"));
+	}
+	if (query.get("state") !== storage.getItem("state")) {
+		throw new Error("the state does not match that of the login");
+	}
+	const body = await token(new URLSearchParams({
+		grant_type: "authorization_code",
+		code: query.get("code"),
+		redirect_uri: location.origin + "/",
+		code_verifier: storage.getItem("verifier"),
+	}));
+	storage.removeItem("state");
+	storage.removeItem("verifier");
+	log("Logged in, access token " + short(body.access_token) + ", refresh token " + short(body.refresh_token));
+}
+
+// refresh replaces the tokens using the refresh token. The refresh token is rotated, so the previous one can
+// no longer be used once the grace period of the client has passed.
+let refreshing;
+function refresh() {
+	if (!refreshing) {
+		const previous = storage.getItem("refresh_token");
+		if (!previous) {
+			return Promise.reject(new Error("no refresh token, request offline_access to refresh"));
+		}
+		refreshing = token(new URLSearchParams({grant_type: "refresh_token", refresh_token: previous})).then(body => {
+			log("Refreshed, refresh token rotated from " + short(previous) + " to " + short(body.refresh_token));
+			render();
+		}).finally(() => refreshing = undefined);
+	}
+	return refreshing;
+}
+
+// api calls the resource server with the access token. If the token has expired it is refreshed and the
+// request retried once, and when the resource server warns that it is about to expire it is refreshed in
+// the background.
+async function api(path, options = {}, retry = true) {
+	options.headers = {Authorization: "Bearer " + storage.getItem("access_token")};
+	const resp = await fetch(config.api + path, options);
+	if (resp.status === 401 && retry && storage.getItem("refresh_token")) {
+		log(path + " was refused, refreshing before retrying");
+		await refresh();
+		return api(path, options, false);
+	}
+	if (!resp.ok) {
+		throw new Error(path + " responded with " + resp.status + ", is the scope granted?");
+	}
+	const expiring = resp.headers.get("X-Token-Expiring");
+	if (expiring !== null) {
+		log("The access token expires in " + expiring + "s, refreshing");
+		refresh().catch(err => log(err.message));
+	}
+	return resp.json();
+}
+
+function render() {
+	const loggedIn = storage.getItem("access_token") !== null;
+	document.getElementById("login").hidden = loggedIn;
+	document.getElementById("app").hidden = !loggedIn;
+	document.getElementById("scope").textContent = storage.getItem("scope");
+}
+
+function handle(id, fn) {
+	document.getElementById(id).addEventListener("click", () => fn().catch(err => log("Error: " + err.message)));
+}
+
+handle("login-button", login);
+handle("refresh-button", refresh);
+handle("profile-button", async () => log("Profile " + JSON.stringify(await api("/api/profile"))));
+handle("note-button", async () => {
+	const body = new URLSearchParams({note: document.getElementById("note").value});
+	log("Notes " + JSON.stringify(await api("/api/notes", {method: "POST", body: body})));
+});
+handle("logout-button", async () => {
+	storage.clear();
+	render();
+});
+
+const query = new URLSearchParams(location.search);
+(query.has("code") || query.has("error") ? callback(query) : Promise.resolve())
+	.catch(err => log("Error: " + err.message))
+	.then(render);
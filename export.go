@@ -0,0 +1,161 @@
+package goauth
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// ExportFormat identifies the stream written by SessionStore.Export.
+	ExportFormat = "goauth-session-store"
+	// ExportVersion is the version of the format written by SessionStore.Export. SessionStore.Import reads
+	// streams of this or an earlier version.
+	ExportVersion = 1
+)
+
+var (
+	// ErrExportUnsupported is returned by SessionStore.Export if the SessionStoreBackend does not implement
+	// SessionExporter.
+	ErrExportUnsupported = errors.New("session store does not support export")
+)
+
+// SessionRecord is a record held by a SessionStoreBackend. Exactly one of its fields is set.
+type SessionRecord struct {
+	Grant               *Grant               `json:"grant,omitempty"`
+	AuthorizationCode   *AuthorizationCode   `json:"authorization_code,omitempty"`
+	BackChannelRequest  *BackChannelRequest  `json:"back_channel_request,omitempty"`
+	DeviceAuthorization *DeviceAuthorization `json:"device_authorization,omitempty"`
+	VerificationCode    *VerificationCode    `json:"verification_code,omitempty"`
+	IdempotentResponse  *IdempotentResponse  `json:"idempotent_response,omitempty"`
+}
+
+// isExpired returns true if the record has expired and would not be used by the Server. Grants with a
+// refresh token are kept until they are replaced or revoked, as for Sweepable.
+func (r SessionRecord) isExpired() bool {
+	switch {
+	case r.Grant != nil:
+		return r.Grant.Sweepable()
+	case r.AuthorizationCode != nil:
+		return r.AuthorizationCode.IsExpired()
+	case r.BackChannelRequest != nil:
+		return r.BackChannelRequest.IsExpired()
+	case r.DeviceAuthorization != nil:
+		return r.DeviceAuthorization.IsExpired()
+	case r.VerificationCode != nil:
+		return r.VerificationCode.IsExpired()
+	case r.IdempotentResponse != nil:
+		return r.IdempotentResponse.IsExpired()
+	}
+	return true
+}
+
+// SessionExporter may be implemented by a SessionStoreBackend to enumerate the records it holds, allowing
+// them to be exported using SessionStore.Export.
+type SessionExporter interface {
+	// ExportRecords calls fn with each record held by the backend, stopping if fn returns an error or the
+	// context is cancelled. Records may be stored concurrently, in which case they may or may not be
+	// included, but the backend must remain usable while they are enumerated.
+	ExportRecords(ctx context.Context, fn func(SessionRecord) error) error
+}
+
+// exportHeader is the first line of an export, identifying its format.
+type exportHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// Export writes the unexpired records held by the backend to w, returning the number of records written.
+// The export is a stream of JSON values separated by newlines, a header identifying the format and version
+// followed by a SessionRecord per line, which can be read by Import into the same or another backend.
+// Exports contain the tokens in plain text and must be stored securely. It returns ErrExportUnsupported if
+// the backend does not implement SessionExporter.
+func (s *SessionStore) Export(ctx context.Context, w io.Writer) (int, error) {
+	exporter, ok := s.SessionStoreBackend.(SessionExporter)
+	if !ok {
+		return 0, ErrExportUnsupported
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := enc.Encode(exportHeader{ExportFormat, ExportVersion})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = exporter.ExportRecords(ctx, func(record SessionRecord) error {
+		if record.isExpired() {
+			return nil
+		}
+		err := enc.Encode(record)
+		if err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+// Import stores the unexpired records read from an export written by Export, returning the number of
+// records stored. Records replace any existing record with the same token, so an interrupted import can
+// be repeated. The backend remains usable during the import, allowing records to be migrated from another
+// backend without downtime.
+func (s *SessionStore) Import(ctx context.Context, r io.Reader) (int, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var header exportHeader
+	err := dec.Decode(&header)
+	if err != nil {
+		return 0, fmt.Errorf("goauth: reading export header: %w", err)
+	}
+	if header.Format != ExportFormat || header.Version < 1 || header.Version > ExportVersion {
+		return 0, fmt.Errorf("goauth: unsupported export format %q version %d", header.Format, header.Version)
+	}
+	n := 0
+	for {
+		err = ctx.Err()
+		if err != nil {
+			return n, err
+		}
+		var record SessionRecord
+		err = dec.Decode(&record)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("goauth: reading export record %d: %w", n+1, err)
+		}
+		if record.isExpired() {
+			continue
+		}
+		err = s.importRecord(record)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// importRecord stores a record in the backend.
+func (s *SessionStore) importRecord(record SessionRecord) error {
+	switch {
+	case record.Grant != nil:
+		return s.PutGrant(*record.Grant)
+	case record.AuthorizationCode != nil:
+		return s.PutAuthorizationCode(*record.AuthorizationCode)
+	case record.BackChannelRequest != nil:
+		return s.PutBackChannelRequest(*record.BackChannelRequest)
+	case record.DeviceAuthorization != nil:
+		return s.PutDeviceAuthorization(*record.DeviceAuthorization)
+	case record.VerificationCode != nil:
+		return s.PutVerificationCode(*record.VerificationCode)
+	case record.IdempotentResponse != nil:
+		return s.PutIdempotentResponse(*record.IdempotentResponse)
+	}
+	return nil
+}
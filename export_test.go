@@ -0,0 +1,94 @@
+package goauth
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreExportImport(t *testing.T) {
+	src := NewSessionStore(NewMemSessionStoreBackend())
+	now := time.Now()
+	refreshable := Grant{AccessToken: "refreshable", RefreshToken: "refresh", ClientID: "testclient", Scope: []string{"testscope"}, CreatedAt: now.Add(-2 * time.Hour), ExpiresIn: time.Hour, Version: 3}
+	active := Grant{AccessToken: "active", ClientID: "testclient", Username: "testuser", CreatedAt: now, ExpiresIn: time.Hour}
+	for _, g := range []Grant{refreshable, active, {AccessToken: "expired", CreatedAt: now.Add(-2 * time.Hour), ExpiresIn: time.Hour}} {
+		err := src.PutGrant(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := src.PutAuthorizationCode(AuthorizationCode{Code: "code", ClientID: "testclient", CreatedAt: now, ExpiresIn: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = src.PutDeviceAuthorization(DeviceAuthorization{DeviceCode: "devicecode", UserCode: "ABCD-EFGH", CreatedAt: now, ExpiresIn: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := src.Export(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("Test failed, expected 4 records to be exported, got %d", n)
+	}
+	if !strings.HasPrefix(buf.String(), `{"format":"goauth-session-store","version":1}`+"\n") {
+		t.Errorf("Test failed, unexpected export header %q", strings.SplitN(buf.String(), "\n", 2)[0])
+	}
+
+	dst := NewSessionStore(NewMemSessionStoreBackend())
+	n, err = dst.Import(context.Background(), &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("Test failed, expected 4 records to be imported, got %d", n)
+	}
+	for _, expected := range []Grant{refreshable, active} {
+		g, err := dst.GetGrant(expected.AccessToken)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.RefreshToken != expected.RefreshToken || g.Username != expected.Username || !reflect.DeepEqual(g.Scope, expected.Scope) ||
+			!g.CreatedAt.Equal(expected.CreatedAt) || g.ExpiresIn != expected.ExpiresIn || g.Version != expected.Version {
+			t.Errorf("Test failed, expected grant %+v, got %+v", expected, g)
+		}
+	}
+	if _, err := dst.RefreshGrant("refresh"); err != nil {
+		t.Errorf("Test failed, expected the refresh token to be imported, got %v", err)
+	}
+	if _, err := dst.GetGrant("expired"); err == nil {
+		t.Error("Test failed, expected the expired grant not to be exported")
+	}
+	if _, err := dst.GetAuthorizationCode("code"); err != nil {
+		t.Errorf("Test failed, expected the authorization code to be imported, got %v", err)
+	}
+	if _, err := dst.GetDeviceAuthorizationByUserCode("ABCD-EFGH"); err != nil {
+		t.Errorf("Test failed, expected the device authorization to be imported, got %v", err)
+	}
+}
+
+func TestSessionStoreImportErrors(t *testing.T) {
+	store := NewSessionStore(NewMemSessionStoreBackend())
+	for _, input := range []string{
+		``,
+		`{"format":"other","version":1}`,
+		`{"format":"goauth-session-store","version":2}`,
+		"{\"format\":\"goauth-session-store\",\"version\":1}\n{\"grant\":",
+	} {
+		_, err := store.Import(context.Background(), strings.NewReader(input))
+		if err == nil {
+			t.Errorf("Test failed, expected an error importing %q", input)
+		}
+	}
+
+	_, err := NewSessionStore(struct{ SessionStoreBackend }{NewMemSessionStoreBackend()}).Export(context.Background(), &bytes.Buffer{})
+	if err != ErrExportUnsupported {
+		t.Errorf("Test failed, expected ErrExportUnsupported, got %v", err)
+	}
+}
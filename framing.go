@@ -0,0 +1,45 @@
+package goauth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// frameAncestorsSelf is the frame-ancestors source permitting framing by pages of the same origin.
+const frameAncestorsSelf = "'self'"
+
+// frameAncestors returns the frame-ancestors directive of the Content-Security-Policy of interactive pages
+// and the equivalent X-Frame-Options header, which is empty if it cannot express the directive.
+func (s *Server) frameAncestors() (string, string) {
+	switch {
+	case len(s.FrameAncestors) == 0:
+		return "frame-ancestors 'none'", "DENY"
+	case len(s.FrameAncestors) == 1 && s.FrameAncestors[0] == frameAncestorsSelf:
+		return "frame-ancestors 'self'", "SAMEORIGIN"
+	}
+	return "frame-ancestors " + strings.Join(s.FrameAncestors, " "), ""
+}
+
+// denyFraming returns an http.HandlerFunc setting headers that prevent the pages served by the handler from
+// being embedded in frames by other sites, where they could be overlaid to trick the resource owner into
+// approving a request (clickjacking), unless permitted by the Server's FrameAncestors.
+func (s *Server) denyFraming(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.setFrameHeaders(w)
+		handler(w, r)
+	}
+}
+
+// setFrameHeaders sets the Content-Security-Policy and X-Frame-Options headers of a page, permitting it to
+// be framed only by the Server's FrameAncestors. The policy includes that of the Server's SecurityHeaders,
+// if enabled.
+func (s *Server) setFrameHeaders(w http.ResponseWriter) {
+	csp, xfo := s.frameAncestors()
+	if s.SecurityHeaders != nil {
+		csp = s.SecurityHeaders.contentSecurityPolicy() + "; " + csp
+	}
+	w.Header().Set("Content-Security-Policy", csp)
+	if xfo != "" {
+		w.Header().Set("X-Frame-Options", xfo)
+	}
+}
@@ -0,0 +1,42 @@
+package goauth
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDenyFraming(t *testing.T) {
+	cases := []struct {
+		FrameAncestors []string
+		CSP            string
+		XFO            string
+	}{
+		{nil, "frame-ancestors 'none'", "DENY"},
+		{[]string{"'self'"}, "frame-ancestors 'self'", "SAMEORIGIN"},
+		// X-Frame-Options cannot permit other origins, so only the Content-Security-Policy is set
+		{[]string{"'self'", "https://app.example.com"}, "frame-ancestors 'self' https://app.example.com", ""},
+	}
+	for i, c := range cases {
+		server := newTestHandler()
+		server.FrameAncestors = c.FrameAncestors
+		for _, path := range []string{
+			AuthorizeEnpoint + "?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com",
+			DeviceVerificationEndpoint,
+		} {
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+			if csp := w.Header().Get("Content-Security-Policy"); csp != c.CSP {
+				t.Errorf("Test failed, expected Content-Security-Policy %q for case %d at %s got %q", c.CSP, i, path, csp)
+			}
+			if xfo := w.Header().Get("X-Frame-Options"); xfo != c.XFO {
+				t.Errorf("Test failed, expected X-Frame-Options %q for case %d at %s got %q", c.XFO, i, path, xfo)
+			}
+		}
+	}
+	// Endpoints that do not serve pages are unaffected
+	w := httptest.NewRecorder()
+	newTestHandler().ServeHTTP(w, httptest.NewRequest("POST", TokenEndpoint, nil))
+	if w.Header().Get("X-Frame-Options") != "" || w.Header().Get("Content-Security-Policy") != "" {
+		t.Errorf("Test failed, unexpected headers %v", w.Header())
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/scritchley/goauth
 
-go 1.14
+go 1.16
+
+require golang.org/x/crypto v0.17.0
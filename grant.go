@@ -0,0 +1,64 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// GrantDecorator customises the grants created by the Server, for example to shorten the lifetime of
+// grants including a sensitive scope or to add an ID token. The context is that of the token request.
+// Returning an error fails the request.
+type GrantDecorator interface {
+	DecorateGrant(ctx context.Context, client Client, grant *Grant) error
+}
+
+// GrantDecoratorFunc is an adapter allowing a function to be used as a GrantDecorator.
+type GrantDecoratorFunc func(ctx context.Context, client Client, grant *Grant) error
+
+// DecorateGrant calls f(ctx, client, grant).
+func (f GrantDecoratorFunc) DecorateGrant(ctx context.Context, client Client, grant *Grant) error {
+	return f(ctx, client, grant)
+}
+
+// NewGrant returns a new grant of the scope for the client acting on behalf of the subject, which is empty
+// for a client acting on its own behalf. The grant has new access and refresh tokens of the DefaultTokenType
+// and expires after the Server's TokenExpiry. The grant is not stored.
+func (s *Server) NewGrant(client Client, subject string, scope []string) (Grant, error) {
+	accessToken, refreshToken, err := newGrantTokens(s.tokenSource(s.SessionStore))
+	if err != nil {
+		return Grant{}, err
+	}
+	return Grant{
+		AccessToken:  accessToken,
+		TokenType:    DefaultTokenType,
+		ExpiresIn:    s.tokenExpiry(),
+		RefreshToken: refreshToken,
+		Scope:        scope,
+		CreatedAt:    timeNow(),
+		Username:     subject,
+	}, nil
+}
+
+// createGrant creates the grant of a token request using NewGrant, then applies the GrantDecorator.
+func (s *Server) createGrant(r *http.Request, client Client, subject string, scope []string) (Grant, error) {
+	grant, err := s.NewGrant(client, subject, scope)
+	if err != nil {
+		return Grant{}, err
+	}
+	if s.GrantDecorator != nil {
+		err = s.GrantDecorator.DecorateGrant(r.Context(), client, &grant)
+		if err != nil {
+			return Grant{}, err
+		}
+	}
+	return grant, nil
+}
+
+// tokenExpiry returns the Server's TokenExpiry, or DefaultTokenExpiry if it is not set.
+func (s *Server) tokenExpiry() time.Duration {
+	if s.TokenExpiry > 0 {
+		return s.TokenExpiry
+	}
+	return DefaultTokenExpiry
+}
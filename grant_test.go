@@ -0,0 +1,53 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewGrant(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+
+	token := func(body string) map[string]interface{} {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Test failed, status %d %s", w.Code, w.Body.String())
+		}
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	// The Server creates grants, ignoring the deprecated Client.CreateGrant
+	resp := token("grant_type=password&username=testusername&password=testpassword&scope=testscope")
+	if resp["access_token"] == "" || resp["access_token"] == "testtoken" || resp["refresh_token"] == nil || resp["expires_in"] != DefaultTokenExpiry.Seconds() || resp["scope"] != "testscope" {
+		t.Errorf("Test failed, unexpected grant %v", resp)
+	}
+	grant, err := server.SessionStore.GetGrant(Secret(resp["access_token"].(string)))
+	if err != nil || grant.Username != "testusername" || grant.ClientID != "testclientid" {
+		t.Errorf("Test failed, unexpected stored grant %v %v", grant, err)
+	}
+
+	// The GrantDecorator customises the grants
+	server.GrantDecorator = GrantDecoratorFunc(func(ctx context.Context, client Client, grant *Grant) error {
+		if grant.Username == "" {
+			grant.ExpiresIn = time.Minute
+			grant.RefreshToken = ""
+		}
+		return nil
+	})
+	resp = token("grant_type=client_credentials&scope=testscope")
+	if resp["expires_in"] != time.Minute.Seconds() || resp["refresh_token"] != nil {
+		t.Errorf("Test failed, unexpected grant %v", resp)
+	}
+}
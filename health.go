@@ -0,0 +1,181 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// HealthEndpoint is the conventional path at which HealthHandler is mounted.
+	HealthEndpoint = "/healthz"
+	// ReadinessEndpoint is the conventional path at which ReadinessHandler is mounted.
+	ReadinessEndpoint = "/readyz"
+)
+
+var (
+	// DefaultHealthCheckTimeout limits how long each readiness check may take.
+	DefaultHealthCheckTimeout = 5 * time.Second
+)
+
+// HealthChecker can be implemented by a SessionStoreBackend, Authenticator or any other dependency
+// registered with Server.AddHealthCheck in order to report whether it is able to serve requests.
+type HealthChecker interface {
+	// Ping returns an error if the dependency is unavailable.
+	Ping(ctx context.Context) error
+}
+
+// HealthCheckFunc is a function implementing the HealthChecker interface.
+type HealthCheckFunc func(ctx context.Context) error
+
+// Ping calls f(ctx).
+func (f HealthCheckFunc) Ping(ctx context.Context) error {
+	return f(ctx)
+}
+
+// HealthStatus is the structured response of the health and readiness endpoints.
+type HealthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks,omitempty"`
+}
+
+// CheckStatus is the result of an individual readiness check. The error of a failed check is not
+// included, as it may reveal internal details, and is passed to the Server's OnInternalError instead.
+type CheckStatus struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+}
+
+const (
+	healthStatusOK   = "ok"
+	healthStatusFail = "fail"
+)
+
+// AddHealthCheck registers a named check that must pass for the readiness endpoint to report the
+// Server as ready. Checks are also registered automatically for the SessionStoreBackend and
+// Authenticator if they implement HealthChecker, and for the Signer if it is set.
+func (s *Server) AddHealthCheck(name string, check HealthChecker) {
+	s.healthMtx.Lock()
+	defer s.healthMtx.Unlock()
+	if s.healthChecks == nil {
+		s.healthChecks = make(map[string]HealthChecker)
+	}
+	s.healthChecks[name] = check
+}
+
+// checks returns all registered health checks including those of the Server's dependencies.
+func (s *Server) checks() map[string]HealthChecker {
+	s.healthMtx.Lock()
+	defer s.healthMtx.Unlock()
+	checks := make(map[string]HealthChecker)
+	for name, check := range s.healthChecks {
+		checks[name] = check
+	}
+	if s.SessionStore != nil {
+		if check, ok := s.SessionStore.SessionStoreBackend.(HealthChecker); ok {
+			checks["session_store"] = check
+		}
+	}
+	if check, ok := s.Authenticator.(HealthChecker); ok {
+		checks["authenticator"] = check
+	}
+	if s.Signer != nil {
+		checks["signing_key"] = HealthCheckFunc(s.checkSigningKey)
+	}
+	return checks
+}
+
+// checkSigningKey returns an error if the Signer has no key with which to sign tokens, for example because
+// its KeyStore is unavailable.
+func (s *Server) checkSigningKey(ctx context.Context) error {
+	key, err := s.Signer.SigningKey()
+	if err != nil {
+		return err
+	}
+	if key.Signer == nil {
+		return ErrNoSigner
+	}
+	return nil
+}
+
+// Ready runs all health checks concurrently and returns the aggregated HealthStatus.
+func (s *Server) Ready(ctx context.Context) HealthStatus {
+	status, _ := s.ready(ctx)
+	return status
+}
+
+// ready runs all health checks concurrently and returns the aggregated HealthStatus and the errors of the
+// failed checks by name.
+func (s *Server) ready(ctx context.Context) (HealthStatus, map[string]error) {
+	checks := s.checks()
+	errs := make(map[string]error)
+	status := HealthStatus{Status: healthStatusOK, Checks: make(map[string]CheckStatus)}
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthChecker) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, DefaultHealthCheckTimeout)
+			defer cancel()
+			start := timeNow()
+			err := check.Ping(ctx)
+			result := CheckStatus{Status: healthStatusOK, Latency: timeNow().Sub(start).String()}
+			if err != nil {
+				result.Status = healthStatusFail
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			status.Checks[name] = result
+			if err != nil {
+				status.Status = healthStatusFail
+				errs[name] = err
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return status, errs
+}
+
+// HealthHandler returns a handler reporting that the process is able to serve requests. It performs no
+// dependency checks and is suitable for liveness probes. It is not mounted by default, use
+// EnableHealthEndpoints or mount it on a separate mux.
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthStatus(w, HealthStatus{Status: healthStatusOK})
+	})
+}
+
+// ReadinessHandler returns a handler reporting whether all health checks pass. It responds with
+// 503 Service Unavailable if any check fails and is suitable for readiness probes and load balancer
+// health checks. The errors of failed checks are passed to the Server's OnInternalError.
+func (s *Server) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, errs := s.ready(r.Context())
+		if s.OnInternalError != nil {
+			for name, err := range errs {
+				s.OnInternalError(r, fmt.Errorf("health check %s failed: %w", name, err))
+			}
+		}
+		writeHealthStatus(w, status)
+	})
+}
+
+// EnableHealthEndpoints mounts the HealthHandler and ReadinessHandler at HealthEndpoint and
+// ReadinessEndpoint on the Server.
+func (s *Server) EnableHealthEndpoints() {
+	s.handle(HealthEndpoint, s.HealthHandler())
+	s.handle(ReadinessEndpoint, s.ReadinessHandler())
+}
+
+func writeHealthStatus(w http.ResponseWriter, status HealthStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if status.Status != healthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
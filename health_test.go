@@ -0,0 +1,80 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadinessHandler(t *testing.T) {
+	server := newTestHandler()
+	server.EnableHealthEndpoints()
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", HealthEndpoint, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected status %d got %d", http.StatusOK, w.Code)
+	}
+
+	healthy := true
+	server.AddHealthCheck("upstream", HealthCheckFunc(func(ctx context.Context) error {
+		if !healthy {
+			return errors.New("unreachable")
+		}
+		return nil
+	}))
+
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", ReadinessEndpoint, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected status %d got %d", http.StatusOK, w.Code)
+	}
+
+	healthy = false
+	var reported error
+	server.OnInternalError = func(r *http.Request, err error) {
+		reported = err
+	}
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", ReadinessEndpoint, nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Test failed, expected status %d got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var status HealthStatus
+	err := json.NewDecoder(w.Body).Decode(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != "fail" || status.Checks["upstream"].Status != "fail" {
+		t.Errorf("Test failed, unexpected status %+v", status)
+	}
+	// The error is reported rather than included in the response
+	if strings.Contains(w.Body.String(), "unreachable") || reported == nil || !strings.Contains(reported.Error(), "unreachable") {
+		t.Errorf("Test failed, expected the error to be reported got %s %v", w.Body.String(), reported)
+	}
+}
+
+// unavailableKeyStore is a KeyStore whose keys cannot be read.
+type unavailableKeyStore struct {
+	*MemKeyStore
+}
+
+func (u unavailableKeyStore) Keys() ([]SigningKey, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestSigningKeyReadiness(t *testing.T) {
+	server := newTestHandler()
+	server.Signer = NewKeyRotator(NewMemKeyStore())
+	if status := server.Ready(context.Background()); status.Status != "ok" || status.Checks["signing_key"].Status != "ok" {
+		t.Errorf("Test failed, expected the check to pass got %+v", status)
+	}
+	server.Signer = NewKeyRotator(unavailableKeyStore{NewMemKeyStore()})
+	if status := server.Ready(context.Background()); status.Checks["signing_key"].Status != "fail" {
+		t.Errorf("Test failed, expected the check to fail got %+v", status)
+	}
+}
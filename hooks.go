@@ -0,0 +1,71 @@
+package goauth
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Middleware wraps an http.Handler, such as to log requests or set response headers.
+type Middleware func(next http.Handler) http.Handler
+
+// endpointHooks holds the middleware registered for each endpoint of a Server.
+type endpointHooks struct {
+	mtx    sync.RWMutex
+	before map[string][]Middleware
+	after  map[string][]Middleware
+}
+
+// Before registers middleware to run before requests to the endpoint are handled by the Server,
+// including before the request method is checked. The endpoint is the path of one of the endpoints
+// receiving client or resource owner credentials: the authorization, token, introspection, backchannel
+// authentication, device authorization, device verification or password reset endpoint, such as
+// TokenEndpoint. goauth does not implement token revocation, so there is no revocation endpoint to
+// hook; applications serving one wrap its handler themselves. Middleware runs in the order it is
+// registered.
+func (s *Server) Before(endpoint string, m ...Middleware) {
+	s.hooks.mtx.Lock()
+	defer s.hooks.mtx.Unlock()
+	if s.hooks.before == nil {
+		s.hooks.before = make(map[string][]Middleware)
+	}
+	s.hooks.before[endpoint] = append(s.hooks.before[endpoint], m...)
+}
+
+// After registers middleware to run once the Server has accepted a request to the endpoint, immediately
+// before it is handled. Middleware runs in the order it is registered.
+func (s *Server) After(endpoint string, m ...Middleware) {
+	s.hooks.mtx.Lock()
+	defer s.hooks.mtx.Unlock()
+	if s.hooks.after == nil {
+		s.hooks.after = make(map[string][]Middleware)
+	}
+	s.hooks.after[endpoint] = append(s.hooks.after[endpoint], m...)
+}
+
+// chain wraps the handler in the middleware so that the first middleware runs first.
+func chain(middleware []Middleware, handler http.Handler) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// beforeHooks returns an http.HandlerFunc running the Before middleware of the endpoint.
+func (s *Server) beforeHooks(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.hooks.mtx.RLock()
+		m := s.hooks.before[endpoint]
+		s.hooks.mtx.RUnlock()
+		chain(m, handler).ServeHTTP(w, r)
+	}
+}
+
+// afterHooks returns an http.HandlerFunc running the After middleware of the endpoint.
+func (s *Server) afterHooks(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.hooks.mtx.RLock()
+		m := s.hooks.after[endpoint]
+		s.hooks.mtx.RUnlock()
+		chain(m, handler).ServeHTTP(w, r)
+	}
+}
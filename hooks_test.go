@@ -0,0 +1,61 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEndpointHooks(t *testing.T) {
+	server := newTestHandler()
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	server.Before(TokenEndpoint, record("before1"), record("before2"))
+	server.After(TokenEndpoint, record("after"))
+	server.Before(IntrospectionEndpoint, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Frame-Options", "DENY")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("")))
+	if strings.Join(calls, ",") != "before1,before2,after" {
+		t.Errorf("Test failed, unexpected calls %v", calls)
+	}
+
+	// After hooks do not run for requests rejected by the Server
+	calls = nil
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", TokenEndpoint, nil))
+	if w.Code != http.StatusMethodNotAllowed || strings.Join(calls, ",") != "before1,before2" {
+		t.Errorf("Test failed, unexpected calls %v with status %d", calls, w.Code)
+	}
+
+	// Hooks only apply to their endpoint
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", IntrospectionEndpoint, nil))
+	if w.Header().Get("X-Frame-Options") != "DENY" {
+		t.Error("Test failed, expected the introspection hook to set the header")
+	}
+
+	// Hooks also apply to the backchannel and device endpoints
+	for _, endpoint := range []string{BackChannelAuthorizeEndpoint, DeviceAuthorizationEndpoint, DeviceVerificationEndpoint} {
+		calls = nil
+		server.Before(endpoint, record("before"))
+		server.After(endpoint, record("after"))
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", endpoint, strings.NewReader("")))
+		if strings.Join(calls, ",") != "before,after" {
+			t.Errorf("Test failed, unexpected calls %v for %s", calls, endpoint)
+		}
+	}
+}
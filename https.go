@@ -0,0 +1,81 @@
+package goauth
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	// DefaultHSTSMaxAge is the max-age of the Strict-Transport-Security header set when HTTPS is required
+	// and the Server's HSTSMaxAge is not set.
+	DefaultHSTSMaxAge = 365 * 24 * time.Hour
+)
+
+// isLoopbackHost returns true if the host, which may include a port, is localhost or a loopback address.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isLoopbackRequest returns true if the request was made directly over the loopback interface. The Host
+// header is chosen by the client so the addresses of the connection are used instead, and requests
+// forwarded by a proxy are excluded as the proxy may be connected over loopback on behalf of any client.
+func isLoopbackRequest(r *http.Request) bool {
+	if r.Header.Get("Forwarded") != "" || r.Header.Get("X-Forwarded-For") != "" {
+		return false
+	}
+	if !isLoopbackHost(r.RemoteAddr) {
+		return false
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && !isLoopbackHost(addr.String()) {
+		return false
+	}
+	return true
+}
+
+// requireHTTPS returns a http.HandlerFunc rejecting requests made over plaintext HTTP when the Server's
+// RequireHTTPS is set, unless they are made over the loopback interface during development.
+func (s *Server) requireHTTPS(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.RequireHTTPS && s.RequestScheme(r) != "https" && !isLoopbackRequest(r) {
+			s.ErrorHandler(w, ErrorHTTPSRequired.StatusCode, ErrorHTTPSRequired)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// setHSTS sets the Strict-Transport-Security header on responses to HTTPS requests when the Server's
+// RequireHTTPS is set.
+func (s *Server) setHSTS(w http.ResponseWriter, r *http.Request) {
+	if !s.RequireHTTPS || s.RequestScheme(r) != "https" {
+		return
+	}
+	maxAge := s.HSTSMaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultHSTSMaxAge
+	}
+	w.Header().Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", int64(maxAge/time.Second)))
+}
+
+// secureRedirectURI returns false if the Server's RequireHTTPS is set and the redirect URI uses plaintext
+// HTTP to a host other than loopback. Private-use schemes of native apps are allowed.
+func (s *Server) secureRedirectURI(redirectURI string) bool {
+	if !s.RequireHTTPS {
+		return true
+	}
+	uri, err := url.Parse(redirectURI)
+	if err != nil {
+		return false
+	}
+	return uri.Scheme != "http" || isLoopbackHost(uri.Host)
+}
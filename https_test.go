@@ -0,0 +1,95 @@
+package goauth
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequireHTTPS(t *testing.T) {
+	server := newTestHandler()
+	server.RequireHTTPS = true
+
+	request := func(target string, secure bool) *http.Request {
+		r := httptest.NewRequest("POST", target, strings.NewReader("grant_type=client_credentials"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		if secure {
+			r.TLS = &tls.ConnectionState{}
+		}
+		return r
+	}
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	token := func(target string, secure bool) *httptest.ResponseRecorder {
+		return serve(request(target, secure))
+	}
+
+	w := token("http://example.com/token", false)
+	if w.Code != ErrorHTTPSRequired.StatusCode || !strings.Contains(w.Body.String(), "HTTPS") || w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("Test failed, expected plaintext requests to be rejected got %d %s", w.Code, w.Body.String())
+	}
+	w = token("https://example.com/token", true)
+	if w.Code != http.StatusOK || w.Header().Get("Strict-Transport-Security") != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Test failed, expected HSTS on the HTTPS response got %d %v", w.Code, w.Header())
+	}
+	// Connections over loopback are allowed for development
+	r := request("http://localhost:8080/token", false)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{IP: net.IPv6loopback, Port: 8080}))
+	if w = serve(r); w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected loopback requests to be allowed got %d", w.Code)
+	}
+	// The Host header does not exempt remote clients
+	if w = token("http://localhost:8080/token", false); w.Code != ErrorHTTPSRequired.StatusCode {
+		t.Errorf("Test failed, expected a remote client to be rejected got %d", w.Code)
+	}
+	// Nor does a proxy connecting over loopback
+	r = request("http://localhost:8080/token", false)
+	r.RemoteAddr = "127.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.1")
+	if w = serve(r); w.Code != ErrorHTTPSRequired.StatusCode {
+		t.Errorf("Test failed, expected a forwarded request to be rejected got %d", w.Code)
+	}
+
+	// Other endpoints receiving client credentials are rejected over plaintext too
+	for _, target := range []string{IntrospectionEndpoint, BackChannelAuthorizeEndpoint, DeviceAuthorizationEndpoint} {
+		if w = token("http://example.com"+target, false); w.Code != ErrorHTTPSRequired.StatusCode || !strings.Contains(w.Body.String(), "HTTPS") {
+			t.Errorf("Test failed, expected plaintext requests to %s to be rejected got %d", target, w.Code)
+		}
+	}
+
+	// Plaintext redirect URIs are rejected without redirecting
+	for uri, allowed := range map[string]bool{
+		"https://testuri.com":      true,
+		"http://testuri.com":       false,
+		"http://127.0.0.1:1234/cb": true,
+		"com.example.app:/cb":      true,
+	} {
+		if server.secureRedirectURI(uri) != allowed {
+			t.Errorf("Test failed, expected %v for %s", allowed, uri)
+		}
+	}
+	server.Authenticator.(*testAuthenticator).client.redirectURI = "http://testuri.com"
+	authorize := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "https://example.com/authorize?response_type=code&client_id=testclientid&redirect_uri=http://testuri.com&scope=testscope", nil)
+		r.TLS = &tls.ConnectionState{}
+		server.ServeHTTP(w, r)
+		return w
+	}
+	if w = authorize(); w.Code != ErrorUnauthorizedClient.StatusCode || w.Header().Get("Location") != "" {
+		t.Errorf("Test failed, expected the redirect URI to be rejected got %d", w.Code)
+	}
+	server.RequireHTTPS = false
+	if w = authorize(); w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected the redirect URI to be allowed got %d", w.Code)
+	}
+}
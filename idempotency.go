@@ -0,0 +1,154 @@
+package goauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header containing the idempotency key of a token request. A client
+// retrying an authorization code exchange with the same key and code receives the original response instead
+// of an error caused by the code having already been used.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the maximum length of idempotency keys accepted by the token endpoint.
+const maxIdempotencyKeyLength = 255
+
+var (
+	// DefaultIdempotencyExpiry is the default period for which responses are replayed for retries.
+	DefaultIdempotencyExpiry = time.Minute
+)
+
+// IdempotentResponse is a token response stored so that it can be replayed for retries of the request.
+type IdempotentResponse struct {
+	// Key identifies the request, it is derived from the client ID, idempotency key, authorization code,
+	// redirect URI and code verifier.
+	Key         string
+	StatusCode  int
+	ContentType string
+	// Body is the response encrypted using a key derived from the same values as the Key, which is not
+	// stored, so that the tokens it contains can only be read by a retry of the request.
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresIn time.Duration
+}
+
+// IsExpired returns true if the response can no longer be replayed.
+func (i IdempotentResponse) IsExpired() bool {
+	return !i.CreatedAt.Add(i.ExpiresIn).After(timeNow())
+}
+
+// idempotentRequest identifies a token request with an idempotency key. Retries must repeat every parameter
+// that authenticates the exchange, including the PKCE code verifier, in order to match.
+type idempotentRequest struct {
+	clientID       string
+	idempotencyKey string
+	code           string
+	redirectURI    string
+	codeVerifier   string
+}
+
+// hash returns the SHA-256 hash of the purpose and values of the request. The values are hashed so that
+// the authorization code and code verifier are not stored.
+func (i idempotentRequest) hash(purpose string) []byte {
+	h := sha256.New()
+	for _, v := range []string{purpose, i.clientID, i.idempotencyKey, i.code, i.redirectURI, i.codeVerifier} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil)
+}
+
+// key returns the key of the IdempotentResponse for the request.
+func (i idempotentRequest) key() string {
+	return hex.EncodeToString(i.hash("key"))
+}
+
+// aead returns the AES-GCM cipher encrypting the IdempotentResponse for the request.
+func (i idempotentRequest) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(i.hash("body"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the body of the response to the request.
+func (i idempotentRequest) seal(body []byte) ([]byte, error) {
+	aead, err := i.aead()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, body, nil), nil
+}
+
+// open decrypts the body of the response to the request.
+func (i idempotentRequest) open(sealed []byte) ([]byte, error) {
+	aead, err := i.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrorAccessDenied
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
+
+// replayIdempotentResponse writes the stored response to an earlier token request identical to req, if
+// any, returning true if a response was written.
+func (s *Server) replayIdempotentResponse(w http.ResponseWriter, r *http.Request, req idempotentRequest) bool {
+	resp, err := s.sessionStore(r).GetIdempotentResponse(req.key())
+	if err != nil || resp.IsExpired() {
+		return false
+	}
+	body, err := req.open(resp.Body)
+	if err != nil {
+		return false
+	}
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+	return true
+}
+
+// writeIdempotentGrant writes the Grant to the http response, storing the encrypted response for replay if
+// the request has an idempotency key. The key is ignored if the backend cannot store responses.
+func (s *Server) writeIdempotentGrant(w http.ResponseWriter, r *http.Request, req *idempotentRequest, grant Grant) error {
+	if req == nil {
+		return s.writeGrant(w, r, grant)
+	}
+	contentType, body, err := s.encodeGrant(r, grant)
+	if err != nil {
+		return err
+	}
+	sealed, err := req.seal(body)
+	if err != nil {
+		return err
+	}
+	err = s.sessionStore(r).PutIdempotentResponse(IdempotentResponse{
+		Key:         req.key(),
+		StatusCode:  http.StatusOK,
+		ContentType: contentType,
+		Body:        sealed,
+		CreatedAt:   timeNow(),
+		ExpiresIn:   DefaultIdempotencyExpiry,
+	})
+	if err != nil && err != ErrIdempotentResponsesUnsupported {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, err = w.Write(body)
+	return err
+}
@@ -0,0 +1,136 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIdempotentCodeExchange(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+
+	newCode := func() string {
+		r := httptest.NewRequest("POST", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", strings.NewReader("username=testusername&password=testpassword"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return location.Query().Get(ParamCode)
+	}
+	exchange := func(code, key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=authorization_code&redirect_uri=https://testuri.com&code="+code))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		if key != "" {
+			r.Header.Set(IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	code := newCode()
+	first := exchange(code, "testkey")
+	if first.Code != http.StatusOK {
+		t.Fatalf("Test failed, status %d", first.Code)
+	}
+	// A retry with the same key replays the original response
+	retry := exchange(code, "testkey")
+	if retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Errorf("Test failed, expected the original response got %d %s", retry.Code, retry.Body)
+	}
+	// Without the key, or with a different key, the code cannot be used again
+	if w := exchange(code, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected status 401 got %d", w.Code)
+	}
+	if w := exchange(code, "otherkey"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected status 401 got %d", w.Code)
+	}
+	// The key is scoped to the code
+	if w := exchange(newCode(), "testkey"); w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected status 200 got %d", w.Code)
+	}
+}
+
+func TestIdempotentPublicCodeExchange(t *testing.T) {
+	server := newTestHandler()
+	backend := NewMemSessionStoreBackend()
+	server.SessionStore = NewSessionStore(backend)
+	server.Authenticator.(*testAuthenticator).client.clientType = ClientTypePublic
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r-wW1gOWFkOjXk"
+	r := httptest.NewRequest("POST", AuthorizeEnpoint+"?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&code_challenge=S0eYrId2ewB_22zgT40H9hqLMpvFhlsUekZoJ4MJ5MQ&code_challenge_method=S256", strings.NewReader("username=testusername&password=testpassword"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := location.Query().Get(ParamCode)
+	exchange := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=authorization_code&client_id=testclientid&code="+code+body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set(IdempotencyKeyHeader, "testkey")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	first := exchange("&redirect_uri=https://testuri.com&code_verifier=" + verifier)
+	if first.Code != http.StatusOK {
+		t.Fatalf("Test failed, status %d %s", first.Code, first.Body)
+	}
+	// The stored response does not reveal the tokens
+	for _, record := range backend.records() {
+		if record.IdempotentResponse != nil && strings.Contains(string(record.IdempotentResponse.Body), "access_token") {
+			t.Errorf("Test failed, expected the stored response to be encrypted")
+		}
+	}
+	// The response is only replayed for retries repeating the code verifier and redirect URI
+	for _, body := range []string{"", "&redirect_uri=https://testuri.com", "&redirect_uri=https://testuri.com&code_verifier=wrong", "&code_verifier=" + verifier} {
+		if w := exchange(body); w.Code != http.StatusUnauthorized {
+			t.Errorf("Test failed, expected status 401 for %q got %d", body, w.Code)
+		}
+	}
+	if retry := exchange("&redirect_uri=https://testuri.com&code_verifier=" + verifier); retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() {
+		t.Errorf("Test failed, expected the original response got %d %s", retry.Code, retry.Body)
+	}
+}
+
+func TestIdempotentCodeExchangeUnsupported(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(baseSessionStoreBackend{NewMemSessionStoreBackend()})
+
+	r := httptest.NewRequest("POST", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", strings.NewReader("username=testusername&password=testpassword"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchange := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=authorization_code&redirect_uri=https://testuri.com&code="+location.Query().Get(ParamCode)))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		r.Header.Set(IdempotencyKeyHeader, "testkey")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// The key is ignored if the backend cannot store the response
+	if w := exchange(); w.Code != http.StatusOK {
+		t.Fatalf("Test failed, status %d %s", w.Code, w.Body)
+	}
+	if w := exchange(); w.Code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected status 401 got %d", w.Code)
+	}
+}
@@ -0,0 +1,48 @@
+package goauth
+
+// ScopeOpenID is the scope requested by OpenID Connect clients to receive an ID token.
+const ScopeOpenID = "openid"
+
+// idTokenClaims are the claims of ID tokens issued by the Server as per
+// https://openid.net/specs/openid-connect-core-1_0.html#IDToken.
+type idTokenClaims struct {
+	Issuer   string `json:"iss,omitempty"`
+	Subject  string `json:"sub"`
+	Audience string `json:"aud"`
+	Expiry   int64  `json:"exp"`
+	IssuedAt int64  `json:"iat"`
+	AuthTime int64  `json:"auth_time,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+}
+
+// issueIDToken sets the ID token of a grant authorized by a resource owner that includes the openid scope,
+// signed using the algorithm preferred by the client. Grants that already have an ID token, such as one set
+// by a GrantDecorator, keep it, and no ID token is issued without a Signer. The auth_time claim is included if the
+// time at which the resource owner authenticated is known, and the nonce claim if the authorization request
+// included one.
+func (s *Server) issueIDToken(client Client, grant *Grant) error {
+	if grant.IDToken != "" || grant.Username == "" || s.Signer == nil || !checkInScope(ScopeOpenID, grant.Scope) {
+		return nil
+	}
+	subject, err := s.subject(client, grant.Username)
+	if err != nil {
+		return err
+	}
+	claims := idTokenClaims{
+		Issuer:   s.Issuer,
+		Subject:  subject,
+		Audience: grant.ClientID,
+		Expiry:   grant.ExpiresAt().Unix(),
+		IssuedAt: grant.IssuedAt.Unix(),
+		Nonce:    grant.Nonce,
+	}
+	if !grant.AuthTime.IsZero() {
+		claims.AuthTime = grant.AuthTime.Unix()
+	}
+	token, err := s.SignJWTForClient(client, claims)
+	if err != nil {
+		return err
+	}
+	grant.IDToken = token
+	return nil
+}
@@ -0,0 +1,104 @@
+package goauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIDTokenAuthTime(t *testing.T) {
+	key, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := New(&testAuthenticator{
+		&testClient{"testclientid", "testclientsecret", "testusername", "https://testuri.com", []string{"testscope", ScopeOpenID, "offline_access"}, "", true},
+		"testusername",
+		Secret("testpassword"),
+	})
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.Signer = &StaticSigner{Key: key}
+	authTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	server.SessionAuthenticator = &testSessionAuthenticator{&LoginSession{Username: "testusername", AuthTime: authTime}}
+
+	token := func(body string) map[string]interface{} {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+	claims := func(resp map[string]interface{}) map[string]interface{} {
+		idToken, _ := resp["id_token"].(string)
+		parts := strings.Split(idToken, ".")
+		if len(parts) != 3 {
+			t.Fatalf("Test failed, expected an ID token got %v", resp)
+		}
+		data, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var c map[string]interface{}
+		json.Unmarshal(data, &c)
+		return c
+	}
+
+	// The code is issued using the existing login session, so auth_time is the time of the earlier login
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=openid+offline_access&max_age=7200", nil)
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Test failed, expected a redirect got %d", w.Code)
+	}
+	uri, _ := url.Parse(w.Header().Get("Location"))
+	resp := token("grant_type=authorization_code&redirect_uri=https://testuri.com&code=" + uri.Query().Get("code"))
+	c := claims(resp)
+	if c["auth_time"] != float64(authTime.Unix()) || c["sub"] != "testusername" || c["aud"] != "testclientid" {
+		t.Errorf("Test failed, unexpected claims %v", c)
+	}
+
+	if _, ok := c["nonce"]; ok {
+		t.Errorf("Test failed, expected no nonce without one in the request got %v", c)
+	}
+
+	// Refreshed grants keep the auth_time
+	c = claims(token("grant_type=refresh_token&refresh_token=" + resp["refresh_token"].(string)))
+	if c["auth_time"] != float64(authTime.Unix()) {
+		t.Errorf("Test failed, unexpected claims %v", c)
+	}
+
+	// The nonce of the authorization request is echoed in the ID token
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=openid&nonce=n-0S6_WzA2Mj", nil)
+	server.ServeHTTP(w, r)
+	uri, _ = url.Parse(w.Header().Get("Location"))
+	c = claims(token("grant_type=authorization_code&redirect_uri=https://testuri.com&code=" + uri.Query().Get("code")))
+	if c["nonce"] != "n-0S6_WzA2Mj" {
+		t.Errorf("Test failed, expected the nonce got %v", c)
+	}
+
+	// A session older than max_age is not used, so the action URL keeps max_age for the login form
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=openid&max_age=60", nil)
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "max_age") {
+		t.Errorf("Test failed, expected the login form got %d", w.Code)
+	}
+
+	// The resource owner authenticates when using the password grant
+	before := time.Now().Unix()
+	c = claims(token("grant_type=password&username=testusername&password=testpassword&scope=openid"))
+	if authTime, _ := c["auth_time"].(float64); int64(authTime) < before {
+		t.Errorf("Test failed, unexpected claims %v", c)
+	}
+
+	// Grants without the openid scope have no ID token
+	if resp := token("grant_type=password&username=testusername&password=testpassword&scope=testscope"); resp["id_token"] != nil {
+		t.Errorf("Test failed, unexpected ID token %v", resp["id_token"])
+	}
+}
@@ -0,0 +1,149 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+)
+
+const (
+	// GrantTypeImpersonation is the grant type of the impersonation extension grant, with which a trusted
+	// client obtains a token on behalf of a subject without the subject's involvement, such as a support
+	// tool or a service account acting for a user.
+	GrantTypeImpersonation = "urn:goauth:params:oauth:grant-type:impersonation"
+	// ParamSubject is the parameter of impersonation requests identifying the impersonated resource owner.
+	ParamSubject = "subject"
+	// ParamActorToken is the optional parameter of impersonation requests containing an access token of
+	// the party on whose behalf the client is acting, as per https://tools.ietf.org/html/rfc8693.
+	ParamActorToken = "actor_token"
+	// StrategyImpersonation must be allowed by clients using the impersonation grant.
+	StrategyImpersonation Strategy = "impersonation"
+)
+
+// ImpersonationAuthorizer decides whether a client may impersonate a subject. The impersonation grant is
+// disabled unless the Server has an ImpersonationAuthorizer.
+type ImpersonationAuthorizer interface {
+	// AuthorizeImpersonation returns true if the client may obtain a grant with the scope on behalf of the
+	// subject.
+	AuthorizeImpersonation(ctx context.Context, clientID string, client Client, subject string, scope []string) (bool, error)
+}
+
+// ImpersonationAuthorizerFunc is a function implementing the ImpersonationAuthorizer interface.
+type ImpersonationAuthorizerFunc func(ctx context.Context, clientID string, client Client, subject string, scope []string) (bool, error)
+
+// AuthorizeImpersonation calls f(ctx, clientID, client, subject, scope).
+func (f ImpersonationAuthorizerFunc) AuthorizeImpersonation(ctx context.Context, clientID string, client Client, subject string, scope []string) (bool, error) {
+	return f(ctx, clientID, client, subject, scope)
+}
+
+// Actor identifies the party acting on behalf of the subject of a grant, as per
+// https://tools.ietf.org/html/rfc8693#section-4.1. If the party was itself acting for another, Actor
+// identifies the prior actor, forming a delegation chain.
+type Actor struct {
+	Subject string `json:"sub"`
+	Actor   *Actor `json:"act,omitempty"`
+}
+
+// Chain returns the subjects of the delegation chain, starting with the current actor.
+func (a *Actor) Chain() []string {
+	var chain []string
+	for ; a != nil; a = a.Actor {
+		chain = append(chain, a.Subject)
+	}
+	return chain
+}
+
+// actorOf returns the Actor for the subject of a grant, extending the grant's own delegation chain.
+func actorOf(grant Grant) *Actor {
+	subject := grant.Username
+	if subject == "" {
+		subject = grant.ClientID
+	}
+	return &Actor{Subject: subject, Actor: grant.Actor}
+}
+
+// handleImpersonationGrant issues a grant to a confidential client on behalf of the subject of the
+// request. The grant records the client as its Actor, or the subject of the actor token if one is
+// presented, and is issued without a refresh token so that the client must be authorized again once it
+// expires.
+func (s *Server) handleImpersonationGrant(w http.ResponseWriter, r *http.Request) {
+	if r.PostFormValue(ParamGrantType) != GrantTypeImpersonation {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	if s.ImpersonationAuthorizer == nil {
+		s.ErrorHandler(w, ErrorUnsupportedGrantType.StatusCode, ErrorUnsupportedGrantType)
+		return
+	}
+	clientID, client, err := s.authenticateConfidentialClient(r)
+	if err != nil {
+		s.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	if !client.AllowStrategy(StrategyImpersonation) {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	subject := r.PostFormValue(ParamSubject)
+	if subject == "" {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	scope := s.parseScope(r.PostFormValue(ParamScope))
+	scope, err = s.authorizeScope(clientID, client, scope)
+	if err != nil {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	// Restrict the scope to that permitted for the subject
+	scope, err = s.authorizeOwnerScope(subject, scope)
+	if err != nil {
+		s.ErrorHandler(w, ErrorInvalidScope.StatusCode, ErrorInvalidScope)
+		return
+	}
+	actor := &Actor{Subject: clientID}
+	if actorToken := Secret(r.PostFormValue(ParamActorToken)); actorToken != "" {
+		actorGrant, err := s.sessionStore(r).CheckGrant(actorToken)
+		if err != nil {
+			s.ErrorHandler(w, ErrorInvalidGrant.StatusCode, ErrorInvalidGrant)
+			return
+		}
+		actor = actorOf(actorGrant)
+	}
+	ok, err := s.ImpersonationAuthorizer.AuthorizeImpersonation(r.Context(), clientID, client, subject, scope)
+	if err != nil || !ok {
+		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+		return
+	}
+	// Check that the risk of issuing the grant is acceptable
+	e, ok := s.evaluateRisk(r, RiskContext{
+		ClientID:  clientID,
+		Client:    client,
+		Username:  subject,
+		GrantType: GrantTypeImpersonation,
+		Scope:     scope,
+	})
+	if !ok {
+		s.ErrorHandler(w, e.StatusCode, e)
+		return
+	}
+	grant, err := s.createGrant(r, client, subject, scope)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	grant.RefreshToken = ""
+	grant.Actor = actor
+	err = s.issueGrant(r, clientID, client, subject, &grant)
+	if err == nil {
+		err = s.storeGrant(r, &grant)
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	err = s.writeGrant(w, r, grant)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,102 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestImpersonationGrant(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	request := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	body := "grant_type=" + GrantTypeImpersonation + "&subject=alice&scope=testscope"
+
+	// The grant is disabled without an ImpersonationAuthorizer
+	if w := request(body); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unsupported_grant_type") {
+		t.Errorf("Test failed, expected unsupported_grant_type got %d %s", w.Code, w.Body.String())
+	}
+
+	server.ImpersonationAuthorizer = ImpersonationAuthorizerFunc(func(ctx context.Context, clientID string, client Client, subject string, scope []string) (bool, error) {
+		return subject == "alice", nil
+	})
+	if w := request("grant_type=" + GrantTypeImpersonation + "&subject=bob"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected status 401 got %d", w.Code)
+	}
+	w := request(body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Test failed, expected status 200 got %d %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := resp["refresh_token"]; ok {
+		t.Error("Test failed, expected no refresh token")
+	}
+	grant, err := server.SessionStore.GetGrant(Secret(resp["access_token"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := grant.Introspect()
+	if i.Username != "alice" || i.ClientID != "testclientid" || i.Actor == nil || i.Actor.Subject != "testclientid" {
+		t.Errorf("Test failed, unexpected introspection %+v", i)
+	}
+}
+
+func TestImpersonationDelegationChain(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.ImpersonationAuthorizer = ImpersonationAuthorizerFunc(func(ctx context.Context, clientID string, client Client, subject string, scope []string) (bool, error) {
+		return true, nil
+	})
+	// The actor token was itself issued to a support tool impersonating an operator
+	err := server.SessionStore.PutGrant(Grant{
+		AccessToken: "actortoken",
+		ClientID:    "testclientid",
+		Username:    "operator",
+		Actor:       &Actor{Subject: "supporttool"},
+		CreatedAt:   timeNow(),
+		ExpiresIn:   DefaultTokenExpiry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type="+GrantTypeImpersonation+"&subject=alice&scope=testscope&actor_token=actortoken"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	var resp map[string]interface{}
+	err = json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, _ := resp["access_token"].(string)
+
+	// Resource servers can audit the delegation chain of the grant
+	var chain []string
+	handler := server.Secure([]string{"testscope"}, func(w http.ResponseWriter, r *http.Request) {
+		grant, ok := GrantFromContext(r.Context())
+		if ok && grant.Username == "alice" {
+			chain = grant.Actor.Chain()
+		}
+	})
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	handler(httptest.NewRecorder(), r)
+	if strings.Join(chain, ",") != "operator,supporttool" {
+		t.Errorf("Test failed, unexpected delegation chain %v", chain)
+	}
+}
@@ -15,25 +15,22 @@ type ImplicitGrant interface {
 	GetClient(clientID string) (Client, error)
 }
 
-func (s Server) handleImplicitGrant(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleImplicitGrant(w http.ResponseWriter, r *http.Request) {
 	// Check that the grant type is set to password
 	if r.FormValue(ParamResponseType) != ResponseTypeToken {
-		w.WriteHeader(http.StatusBadRequest)
-		DefaultErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 		return
 	}
 	rawurl := r.FormValue(ParamRedirectURI)
 	if rawurl == "" {
 		// The there is no redirect url then return an error
-		w.WriteHeader(http.StatusBadRequest)
-		DefaultErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 		return
 	}
 	uri, err := url.Parse(rawurl)
 	if err != nil {
 		// The redirect URI is an invalid url, therefore, return an error and DO NOT redirect
-		w.WriteHeader(http.StatusBadRequest)
-		DefaultErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 		return
 	}
 	// Get the client id
@@ -43,7 +40,7 @@ func (s Server) handleImplicitGrant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Find the client
-	client, err := s.Authenticator.GetClient(clientID)
+	client, err := s.authenticator(r).GetClient(clientID)
 	if err != nil {
 		implicitErrorRedirect(w, r, rawurl, ErrorUnauthorizedClient)
 		return
@@ -56,36 +53,55 @@ func (s Server) handleImplicitGrant(w http.ResponseWriter, r *http.Request) {
 	}
 	// Get the scope (OPTIONAL) and authorize it
 	rawScope := r.FormValue(ParamScope)
-	scope := strings.Split(rawScope, " ")
-	scope, err = client.AuthorizeScope(scope)
+	scope := s.parseScope(rawScope)
+	scope, err = s.authorizeScope(clientID, client, scope)
 	if err != nil {
 		implicitErrorRedirect(w, r, rawurl, ErrorInvalidScope)
 		return
 	}
 	// Get the redirect_uri and authorize it
 	redirectURI := r.FormValue(ParamRedirectURI)
-	ok = client.AllowRedirectURI(redirectURI)
+	ok = client.AllowRedirectURI(redirectURI) && s.secureRedirectURI(redirectURI)
 	if !ok {
 		implicitErrorRedirect(w, r, rawurl, ErrorUnauthorizedClient)
 		return
 	}
+	// The implicit grant may be disabled, the error is only redirected once the redirect URI is known to
+	// be allowed
+	if err := s.deprecatedFlowAttempt(r, DeprecatedFlowImplicit, clientID); err != nil {
+		implicitErrorRedirect(w, r, rawurl, err)
+		return
+	}
+	// Check that the risk of issuing the grant is acceptable
+	e, ok := s.evaluateRisk(r, RiskContext{
+		ClientID:  clientID,
+		Client:    client,
+		GrantType: ResponseTypeToken,
+		Scope:     scope,
+	})
+	if !ok {
+		implicitErrorRedirect(w, r, rawurl, e)
+		return
+	}
 	// Create a new grant
-	grant, err := client.CreateGrant(scope)
+	grant, err := s.createGrant(r, client, "", scope)
 	if err != nil {
 		implicitErrorRedirect(w, r, rawurl, ErrorUnauthorizedClient)
 		return
 	}
-	err = s.SessionStore.PutGrant(grant)
+	err = s.issueGrant(r, clientID, client, "", &grant)
+	if err == nil {
+		err = s.storeGrant(r, &grant)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+		s.internalError(w, r, err)
 		return
 	}
 	// Redirect passing the grant to the redirect uri
 	frag := url.Values{}
 	frag.Add(ParamAccessToken, grant.AccessToken.RawString())
 	frag.Add(ParamExpiresIn, strconv.FormatFloat(grant.ExpiresIn.Seconds(), 'f', 0, 64))
-	frag.Add(ParamTokenType, string(grant.TokenType))
+	frag.Add(ParamTokenType, s.TokenResponse.tokenType(grant.TokenType))
 	frag.Add(ParamScope, strings.Join(scope, " "))
 	// If the state param was included then make sure it is passed onto the redirect
 	if r.FormValue(ParamState) != "" {
@@ -96,10 +112,17 @@ func (s Server) handleImplicitGrant(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, urlStr, http.StatusFound)
 }
 
-func implicitErrorRedirect(w http.ResponseWriter, r *http.Request, redirectURI string, e Error) {
+func implicitErrorRedirect(w http.ResponseWriter, r *http.Request, redirectURI string, err error) {
+	e, ok := asError(err)
+	if !ok {
+		e = ErrorServerError
+	}
 	frag := url.Values{}
 	frag.Add(ParamError, e.Code)
 	frag.Add(ParamErrorDescription, e.Description)
+	if uri := errorURI(err); uri != "" {
+		frag.Add(ParamErrorURI, uri)
+	}
 	uri, err := url.Parse(redirectURI)
 	if err != nil {
 		http.Redirect(w, r, redirectURI, http.StatusBadRequest)
@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 )
 
 // testImplicitGrant implements the ImplicitGrant interface and
@@ -23,13 +22,9 @@ func (t *testImplicitGrant) GetClient(clientID string) (Client, error) {
 }
 
 func TestImplicitGrantHandler(t *testing.T) {
-	// Set the default expiry for authorization codes to a low value
-	DefaultAuthorizationCodeExpiry = time.Millisecond
-
-	// Create a new instance of the mem session store
-	DefaultSessionStore = NewSessionStore(NewMemSessionStoreBackend())
-
 	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.GrantDecorator = testTokenDecorator
 
 	// Generate a method to check the authentication of a request
 	securedHandler := server.Secure([]string{"testscope"}, func(w http.ResponseWriter, r *http.Request) {
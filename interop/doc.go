@@ -0,0 +1,5 @@
+// Package interop tests goauth against third party OAuth 2.0 and OpenID Connect clients, golang.org/x/oauth2
+// and github.com/coreos/go-oidc, to catch differences in the wire format that the tests of goauth itself,
+// which make requests by hand, cannot. It is a separate module so that the clients are not dependencies of
+// goauth.
+package interop
@@ -0,0 +1,17 @@
+module github.com/scritchley/goauth/interop
+
+go 1.25.0
+
+require (
+	github.com/coreos/go-oidc/v3 v3.18.0
+	github.com/scritchley/goauth v0.0.0-00010101000000-000000000000
+	golang.org/x/oauth2 v0.36.0
+)
+
+require (
+	github.com/go-jose/go-jose/v4 v4.1.4 // indirect
+	golang.org/x/crypto v0.17.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
+
+replace github.com/scritchley/goauth => ../
@@ -0,0 +1,343 @@
+package interop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/scritchley/goauth"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	testUsername    = "testuser"
+	testPassword    = "testpassword"
+	testRedirectURI = "https://client.example.com/callback"
+	// testSecret contains characters that golang.org/x/oauth2 form encodes in the basic auth header as per
+	// https://tools.ietf.org/html/rfc6749#section-2.3.1.
+	testSecret = "s3cret/+=%"
+)
+
+type testClient struct {
+	id     string
+	public bool
+}
+
+func (c *testClient) ClientType() goauth.ClientType {
+	if c.public {
+		return goauth.ClientTypePublic
+	}
+	return goauth.ClientTypeConfidential
+}
+
+func (c *testClient) AllowStrategy(s goauth.Strategy) bool {
+	return !c.public || s != goauth.StrategyClientCredentials
+}
+
+func (c *testClient) AuthorizeScope(scope []string) ([]string, error) {
+	return scope, nil
+}
+
+func (c *testClient) AllowRedirectURI(uri string) bool {
+	return uri == testRedirectURI
+}
+
+func (c *testClient) AuthorizeResourceOwner(username string) (bool, error) {
+	return username == testUsername, nil
+}
+
+func (c *testClient) CreateGrant(scope []string) (goauth.Grant, error) {
+	return goauth.Grant{}, nil
+}
+
+// RefreshTokenPolicy rotates refresh tokens on every use.
+func (c *testClient) RefreshTokenPolicy() goauth.RefreshTokenPolicy {
+	return goauth.RefreshTokenPolicy{}
+}
+
+type testAuthenticator struct {
+	clients map[string]*testClient
+}
+
+func (a *testAuthenticator) GetClient(clientID string) (goauth.Client, error) {
+	if c, ok := a.clients[clientID]; ok {
+		return c, nil
+	}
+	return nil, goauth.ErrorUnauthorizedClient
+}
+
+func (a *testAuthenticator) GetClientWithSecret(clientID string, clientSecret goauth.Secret) (goauth.Client, error) {
+	if c, ok := a.clients[clientID]; ok && !c.public && clientSecret.RawString() == testSecret {
+		return c, nil
+	}
+	return nil, goauth.ErrorUnauthorizedClient
+}
+
+func (a *testAuthenticator) AuthorizeResourceOwner(username string, password goauth.Secret, scope []string) (bool, error) {
+	if username != testUsername || password.RawString() != testPassword {
+		return false, goauth.ErrorAccessDenied
+	}
+	return true, nil
+}
+
+// newTestServer returns a Server signing ID tokens and answering with standard error responses, served by
+// an httptest.Server which also serves the OpenID Connect discovery document.
+func newTestServer(t *testing.T) (*goauth.Server, *httptest.Server) {
+	t.Helper()
+	key, err := goauth.GenerateSigningKey(goauth.AlgorithmRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := goauth.New(&testAuthenticator{clients: map[string]*testClient{
+		"confidential": {id: "confidential"},
+		"public":       {id: "public", public: true},
+	}})
+	server.SessionStore = goauth.NewSessionStore(goauth.NewMemSessionStoreBackend())
+	server.ErrorHandler = goauth.StandardErrorHandler
+	server.Signer = &goauth.StaticSigner{Key: key}
+
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		metadata, err := server.Metadata(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(w).Encode(metadata)
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	server.Issuer = ts.URL
+	return server, ts
+}
+
+// newConfig returns the configuration of an x/oauth2 client of the Server, using the endpoints advertised
+// by its metadata.
+func newConfig(t *testing.T, ts *httptest.Server, clientID string, scope ...string) *oauth2.Config {
+	t.Helper()
+	resp, err := http.Get(ts.URL + goauth.MetadataEndpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var metadata struct {
+		AuthorizationEndpoint       string `json:"authorization_endpoint"`
+		TokenEndpoint               string `json:"token_endpoint"`
+		DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &oauth2.Config{
+		ClientID:    clientID,
+		RedirectURL: testRedirectURI,
+		Scopes:      scope,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:       metadata.AuthorizationEndpoint,
+			TokenURL:      metadata.TokenEndpoint,
+			DeviceAuthURL: metadata.DeviceAuthorizationEndpoint,
+		},
+	}
+	if clientID == "confidential" {
+		config.ClientSecret = testSecret
+	}
+	return config
+}
+
+var formAction = regexp.MustCompile(`<form action="([^"]*)"`)
+
+// login follows the authorization URL as a browser would, submitting the resource owner's credentials to
+// any login form, and returns the query or fragment of the redirect to the client.
+func login(t *testing.T, authURL string) url.Values {
+	t.Helper()
+	browser := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := browser.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The implicit grant redirects without rendering a login form
+	if match := formAction.FindSubmatch(body); match != nil {
+		resp, err = browser.PostForm(html.UnescapeString(string(match[1])), url.Values{"username": {testUsername}, "password": {testPassword}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatalf("Test failed, expected a redirect got %d", resp.StatusCode)
+	}
+	if location.Fragment != "" {
+		values, err := url.ParseQuery(location.Fragment)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return values
+	}
+	return location.Query()
+}
+
+// retrieveErrorCode returns the error code of a token endpoint error as parsed by x/oauth2.
+func retrieveErrorCode(err error) string {
+	var re *oauth2.RetrieveError
+	if errors.As(err, &re) {
+		return re.ErrorCode
+	}
+	return ""
+}
+
+func TestAuthorizationCodeGrant(t *testing.T) {
+	for _, clientID := range []string{"confidential", "public"} {
+		t.Run(clientID, func(t *testing.T) {
+			_, ts := newTestServer(t)
+			ctx := context.Background()
+			config := newConfig(t, ts, clientID, oidc.ScopeOpenID, oidc.ScopeOfflineAccess)
+			provider, err := oidc.NewProvider(ctx, ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if provider.Endpoint().TokenURL != config.Endpoint.TokenURL {
+				t.Errorf("Test failed, expected the discovered token endpoint %s got %s", config.Endpoint.TokenURL, provider.Endpoint().TokenURL)
+			}
+
+			verifier := oauth2.GenerateVerifier()
+			query := login(t, config.AuthCodeURL("teststate", oauth2.S256ChallengeOption(verifier)))
+			if query.Get("state") != "teststate" {
+				t.Errorf("Test failed, expected the state to be returned got %v", query)
+			}
+			token, err := config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !token.Valid() || token.TokenType != "bearer" || token.RefreshToken == "" || token.Expiry.IsZero() {
+				t.Errorf("Test failed, unexpected token %+v", token)
+			}
+
+			// The ID token is verified using the discovered JWKS
+			rawIDToken, _ := token.Extra("id_token").(string)
+			idToken, err := provider.Verifier(&oidc.Config{ClientID: clientID}).Verify(ctx, rawIDToken)
+			if err != nil {
+				t.Fatalf("Test failed, expected a valid ID token got %v", err)
+			}
+			if idToken.Subject != testUsername {
+				t.Errorf("Test failed, expected the subject %s got %s", testUsername, idToken.Subject)
+			}
+
+			// Codes can only be used once, goauth rejects unknown codes with access_denied
+			_, err = config.Exchange(ctx, query.Get("code"), oauth2.VerifierOption(verifier))
+			if code := retrieveErrorCode(err); code != "access_denied" {
+				t.Errorf("Test failed, expected access_denied got %q %v", code, err)
+			}
+
+			// The refresh token is rotated when the expired token is refreshed
+			token.Expiry = time.Now().Add(-time.Minute)
+			refreshed, err := config.TokenSource(ctx, token).Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refreshed.AccessToken == token.AccessToken || refreshed.RefreshToken == "" || refreshed.RefreshToken == token.RefreshToken {
+				t.Errorf("Test failed, expected new tokens got %+v", refreshed)
+			}
+			_, err = config.TokenSource(ctx, token).Token()
+			if code := retrieveErrorCode(err); code != "invalid_grant" {
+				t.Errorf("Test failed, expected the rotated refresh token to be rejected with invalid_grant got %q %v", code, err)
+			}
+		})
+	}
+}
+
+func TestImplicitGrant(t *testing.T) {
+	_, ts := newTestServer(t)
+	config := newConfig(t, ts, "confidential", "testscope")
+	authURL := config.AuthCodeURL("teststate", oauth2.SetAuthURLParam("response_type", "token"))
+	fragment := login(t, authURL)
+	if fragment.Get("access_token") == "" || fragment.Get("token_type") != "bearer" || fragment.Get("state") != "teststate" {
+		t.Errorf("Test failed, unexpected implicit grant response %v", fragment)
+	}
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	_, ts := newTestServer(t)
+	ctx := context.Background()
+	config := newConfig(t, ts, "confidential", "testscope")
+	cc := &clientcredentials.Config{ClientID: config.ClientID, ClientSecret: config.ClientSecret, TokenURL: config.Endpoint.TokenURL, Scopes: config.Scopes}
+	token, err := cc.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Valid() {
+		t.Errorf("Test failed, unexpected token %+v", token)
+	}
+
+	cc.ClientSecret = "wrong"
+	_, err = cc.Token(ctx)
+	if code := retrieveErrorCode(err); code != "unauthorized_client" {
+		t.Errorf("Test failed, expected unauthorized_client got %q %v", code, err)
+	}
+}
+
+func TestResourceOwnerPasswordCredentialsGrant(t *testing.T) {
+	_, ts := newTestServer(t)
+	ctx := context.Background()
+	config := newConfig(t, ts, "confidential", "testscope")
+	token, err := config.PasswordCredentialsToken(ctx, testUsername, testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Valid() {
+		t.Errorf("Test failed, unexpected token %+v", token)
+	}
+
+	_, err = config.PasswordCredentialsToken(ctx, testUsername, "wrong")
+	if code := retrieveErrorCode(err); code != "access_denied" {
+		t.Errorf("Test failed, expected access_denied got %q %v", code, err)
+	}
+}
+
+func TestDeviceAuthorizationGrant(t *testing.T) {
+	interval := goauth.DefaultDevicePollingInterval
+	goauth.DefaultDevicePollingInterval = time.Second
+	defer func() { goauth.DefaultDevicePollingInterval = interval }()
+
+	server, ts := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// x/oauth2 does not authenticate confidential clients at the device authorization endpoint
+	config := newConfig(t, ts, "public", "testscope")
+	da, err := config.DeviceAuth(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if da.DeviceCode == "" || da.UserCode == "" || da.VerificationURI == "" || da.Expiry.IsZero() {
+		t.Fatalf("Test failed, unexpected device authorization %+v", da)
+	}
+	err = server.ApproveDeviceAuthorization(da.UserCode, testUsername)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := config.DeviceAccessToken(ctx, da)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !token.Valid() {
+		t.Errorf("Test failed, unexpected token %+v", token)
+	}
+}
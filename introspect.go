@@ -0,0 +1,92 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// IntrospectionEndpoint is the token introspection endpoint as per https://tools.ietf.org/html/rfc7662.
+	IntrospectionEndpoint = "/introspect"
+	// ParamTokenTypeHint is the parameter containing the type of the token to introspect.
+	ParamTokenTypeHint = "token_type_hint"
+)
+
+// Introspection describes a Grant as returned by the introspection endpoint.
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	// Actor identifies the client acting on behalf of the resource owner of an impersonation grant.
+	Actor *Actor `json:"act,omitempty"`
+	// MayAct identifies the party authorized to act on behalf of the resource owner.
+	MayAct *Actor `json:"may_act,omitempty"`
+}
+
+// Introspect returns the Introspection of an active Grant.
+func (g *Grant) Introspect() Introspection {
+	i := Introspection{
+		Active:    true,
+		Scope:     strings.TrimSpace(strings.Join(g.Scope, " ")),
+		ClientID:  g.IssuedTo(),
+		Username:  g.Username,
+		TokenType: string(g.TokenType),
+		ExpiresAt: g.ExpiresAt().Unix(),
+		Actor:     g.Actor,
+		MayAct:    g.MayAct,
+	}
+	if !g.IssuedAt.IsZero() {
+		i.IssuedAt = g.IssuedAt.Unix()
+	}
+	if !g.NotBefore.IsZero() {
+		i.NotBefore = g.NotBefore.Unix()
+	}
+	return i
+}
+
+// handleIntrospection describes the access or refresh token of the request. Only confidential clients
+// may introspect tokens. Inactive or unknown tokens are described as inactive without further detail.
+func (s *Server) handleIntrospection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	_, _, err := s.authenticateConfidentialClient(r)
+	if err != nil {
+		s.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	token := Secret(r.PostFormValue(ParamToken))
+	if token == "" {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	introspection := Introspection{}
+	var details []AuthorizationDetail
+	grant, err := s.sessionStore(r).CheckGrant(token)
+	if err != nil && r.PostFormValue(ParamTokenTypeHint) == ParamRefreshToken {
+		grant, err = s.sessionStore(r).RefreshGrant(token)
+		if err == nil && (grant.ReplacedBy != "" || grant.refreshTokenExpired()) {
+			err = ErrorAccessDenied
+		}
+	}
+	if err == nil {
+		introspection = grant.Introspect()
+		details = grant.AuthorizationDetails
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(struct {
+		Introspection
+		AuthorizationDetails []AuthorizationDetail `json:"authorization_details,omitempty"`
+	}{introspection, details})
+	if err != nil {
+		s.internalError(w, r, err)
+	}
+}
@@ -0,0 +1,65 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntrospection(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	now := time.Now()
+	err := server.SessionStore.PutGrant(Grant{
+		AccessToken:  "access",
+		TokenType:    TokenTypeBearer,
+		RefreshToken: "refresh",
+		ExpiresIn:    time.Hour,
+		Scope:        []string{"testscope"},
+		CreatedAt:    now,
+		ClientID:     "testclientid",
+		IssuedAt:     now,
+		NotBefore:    now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	introspect := func(body string) Introspection {
+		r := httptest.NewRequest("POST", IntrospectionEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != 200 {
+			t.Fatalf("Test failed, status %d", w.Code)
+		}
+		var i Introspection
+		err := json.NewDecoder(w.Body).Decode(&i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return i
+	}
+
+	expected := Introspection{
+		Active:    true,
+		Scope:     "testscope",
+		ClientID:  "testclientid",
+		TokenType: "bearer",
+		ExpiresAt: now.Add(time.Hour).Unix(),
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+	}
+	if i := introspect("token=access"); i != expected {
+		t.Errorf("Test failed, expected %v got %v", expected, i)
+	}
+	if i := introspect("token=refresh&token_type_hint=refresh_token"); i != expected {
+		t.Errorf("Test failed, expected %v got %v", expected, i)
+	}
+	if i := introspect("token=unknown"); i != (Introspection{}) {
+		t.Errorf("Test failed, expected an inactive token got %v", i)
+	}
+}
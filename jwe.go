@@ -0,0 +1,271 @@
+package goauth
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	// AlgorithmRSAOAEP is RSAES-OAEP using SHA-1, a key management algorithm for JWE.
+	AlgorithmRSAOAEP = "RSA-OAEP"
+	// AlgorithmRSAOAEP256 is RSAES-OAEP using SHA-256, a key management algorithm for JWE.
+	AlgorithmRSAOAEP256 = "RSA-OAEP-256"
+	// EncryptionA128CBCHS256 is AES-128-CBC with HMAC-SHA-256, the default content encryption of OpenID
+	// Connect.
+	EncryptionA128CBCHS256 = "A128CBC-HS256"
+	// EncryptionA128GCM is AES-128-GCM content encryption.
+	EncryptionA128GCM = "A128GCM"
+	// EncryptionA256GCM is AES-256-GCM content encryption.
+	EncryptionA256GCM = "A256GCM"
+)
+
+var (
+	// ErrInvalidJWE is returned when decrypting a malformed or modified JWE.
+	ErrInvalidJWE = errors.New("invalid JWE")
+)
+
+// Encryption identifies the key and algorithms used to encrypt tokens for a client as a JWE.
+type Encryption struct {
+	// Key is the client's RSA public key. Its KeyID, if any, is included in the JWE header.
+	Key JWK
+	// Algorithm is the key management algorithm, AlgorithmRSAOAEP or AlgorithmRSAOAEP256.
+	Algorithm string
+	// Encryption is the content encryption algorithm. If empty, EncryptionA128CBCHS256 is used.
+	Encryption string
+}
+
+// IDTokenEncryptionClient is implemented by a Client whose ID tokens are encrypted. The signed ID token
+// created by the client is encrypted as a nested JWT before it is returned.
+type IDTokenEncryptionClient interface {
+	Client
+	IDTokenEncryption() Encryption
+}
+
+// encryptIDToken encrypts the ID token of the grant if the client requires it.
+func encryptIDToken(client Client, grant *Grant) error {
+	c, ok := client.(IDTokenEncryptionClient)
+	if !ok || grant.IDToken == "" {
+		return nil
+	}
+	token, err := EncryptJWE([]byte(grant.IDToken.RawString()), "JWT", c.IDTokenEncryption())
+	if err != nil {
+		return err
+	}
+	grant.IDToken = token
+	return nil
+}
+
+// oaepHash returns the hash used by the RSA-OAEP key management algorithm.
+func oaepHash(algorithm string) (crypto.Hash, error) {
+	switch algorithm {
+	case AlgorithmRSAOAEP:
+		return crypto.SHA1, nil
+	case AlgorithmRSAOAEP256:
+		return crypto.SHA256, nil
+	}
+	return 0, ErrUnsupportedAlgorithm
+}
+
+// contentKeySize returns the size of the content encryption key of the algorithm.
+func contentKeySize(encryption string) (int, error) {
+	switch encryption {
+	case EncryptionA128GCM:
+		return 16, nil
+	case EncryptionA128CBCHS256, EncryptionA256GCM:
+		return 32, nil
+	}
+	return 0, ErrUnsupportedAlgorithm
+}
+
+// EncryptJWE returns the plaintext encrypted for the key of the Encryption as a JWE in compact
+// serialization. The content type is included as the cty header, such as JWT for nested JWTs.
+func EncryptJWE(plaintext []byte, contentType string, e Encryption) (Secret, error) {
+	if e.Encryption == "" {
+		e.Encryption = EncryptionA128CBCHS256
+	}
+	h, err := oaepHash(e.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	size, err := contentKeySize(e.Encryption)
+	if err != nil {
+		return "", err
+	}
+	public, err := e.Key.PublicKey()
+	if err != nil {
+		return "", err
+	}
+	rsaKey, ok := public.(*rsa.PublicKey)
+	if !ok {
+		return "", ErrUnsupportedAlgorithm
+	}
+	header := map[string]string{"alg": e.Algorithm, "enc": e.Encryption}
+	if e.Key.KeyID != "" {
+		header["kid"] = e.Key.KeyID
+	}
+	if contentType != "" {
+		header["cty"] = contentType
+	}
+	b, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(b)
+	cek := make([]byte, size)
+	if _, err := rand.Read(cek); err != nil {
+		return "", err
+	}
+	encryptedKey, err := rsa.EncryptOAEP(h.New(), rand.Reader, rsaKey, cek, nil)
+	if err != nil {
+		return "", err
+	}
+	iv, ciphertext, tag, err := encryptContent(e.Encryption, cek, plaintext, []byte(encodedHeader))
+	if err != nil {
+		return "", err
+	}
+	return Secret(strings.Join([]string{
+		encodedHeader,
+		base64.RawURLEncoding.EncodeToString(encryptedKey),
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, ".")), nil
+}
+
+// DecryptJWE decrypts a JWE in compact serialization encrypted using RSA-OAEP, such as an encrypted ID
+// token, using the private key. It returns the plaintext and the JWE header.
+func DecryptJWE(token string, key crypto.Decrypter) ([]byte, map[string]string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, nil, ErrInvalidJWE
+	}
+	decoded := make([][]byte, len(parts))
+	for i, part := range parts {
+		b, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return nil, nil, ErrInvalidJWE
+		}
+		decoded[i] = b
+	}
+	var header map[string]string
+	if err := json.Unmarshal(decoded[0], &header); err != nil {
+		return nil, nil, ErrInvalidJWE
+	}
+	h, err := oaepHash(header["alg"])
+	if err != nil {
+		return nil, nil, err
+	}
+	size, err := contentKeySize(header["enc"])
+	if err != nil {
+		return nil, nil, err
+	}
+	cek, err := key.Decrypt(rand.Reader, decoded[1], &rsa.OAEPOptions{Hash: h})
+	if err != nil || len(cek) != size {
+		return nil, nil, ErrInvalidJWE
+	}
+	plaintext, err := decryptContent(header["enc"], cek, decoded[2], decoded[3], decoded[4], []byte(parts[0]))
+	if err != nil {
+		return nil, nil, ErrInvalidJWE
+	}
+	return plaintext, header, nil
+}
+
+// encryptContent encrypts the plaintext with the content encryption key, authenticating the additional
+// data, and returns the initialization vector, ciphertext and authentication tag.
+func encryptContent(encryption string, cek, plaintext, aad []byte) ([]byte, []byte, []byte, error) {
+	if encryption == EncryptionA128CBCHS256 {
+		block, err := aes.NewCipher(cek[16:])
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		iv := make([]byte, aes.BlockSize)
+		if _, err := rand.Read(iv); err != nil {
+			return nil, nil, nil, err
+		}
+		// Pad the plaintext as per PKCS #7
+		n := aes.BlockSize - len(plaintext)%aes.BlockSize
+		padded := make([]byte, len(plaintext)+n)
+		copy(padded, plaintext)
+		for i := len(plaintext); i < len(padded); i++ {
+			padded[i] = byte(n)
+		}
+		ciphertext := make([]byte, len(padded))
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+		return iv, ciphertext, cbcTag(cek[:16], aad, iv, ciphertext), nil
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+	sealed := gcm.Seal(nil, iv, plaintext, aad)
+	split := len(sealed) - gcm.Overhead()
+	return iv, sealed[:split], sealed[split:], nil
+}
+
+// decryptContent decrypts and authenticates the ciphertext with the content encryption key.
+func decryptContent(encryption string, cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	if encryption == EncryptionA128CBCHS256 {
+		if len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+			return nil, ErrInvalidJWE
+		}
+		if subtle.ConstantTimeCompare(tag, cbcTag(cek[:16], aad, iv, ciphertext)) != 1 {
+			return nil, ErrInvalidJWE
+		}
+		block, err := aes.NewCipher(cek[16:])
+		if err != nil {
+			return nil, err
+		}
+		plaintext := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+		n := int(plaintext[len(plaintext)-1])
+		if n == 0 || n > aes.BlockSize {
+			return nil, ErrInvalidJWE
+		}
+		return plaintext[:len(plaintext)-n], nil
+	}
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != gcm.NonceSize() {
+		return nil, ErrInvalidJWE
+	}
+	return gcm.Open(nil, iv, append(ciphertext, tag...), aad)
+}
+
+// cbcTag returns the authentication tag of AES-CBC-HMAC-SHA2 content encryption as per
+// https://tools.ietf.org/html/rfc7518#section-5.2.2.1.
+func cbcTag(macKey, aad, iv, ciphertext []byte) []byte {
+	al := make([]byte, 8)
+	binary.BigEndian.PutUint64(al, uint64(len(aad))*8)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(aad)
+	mac.Write(iv)
+	mac.Write(ciphertext)
+	mac.Write(al)
+	return mac.Sum(nil)[:16]
+}
@@ -0,0 +1,88 @@
+package goauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testEncryptionClient is a testClient creating ID tokens that must be encrypted.
+type testEncryptionClient struct {
+	*testClient
+	encryption Encryption
+}
+
+func (t testEncryptionClient) IDTokenEncryption() Encryption {
+	return t.encryption
+}
+
+type testEncryptionAuthenticator struct {
+	*testAuthenticator
+	encryption Encryption
+}
+
+func (t testEncryptionAuthenticator) GetClientWithSecret(clientID string, clientSecret Secret) (Client, error) {
+	client, err := t.testAuthenticator.GetClientWithSecret(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return testEncryptionClient{client.(*testClient), t.encryption}, nil
+}
+
+func TestJWE(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := NewJWK("enc-key", AlgorithmRSAOAEP256, &private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk.Use = "enc"
+	for _, algorithm := range []string{AlgorithmRSAOAEP, AlgorithmRSAOAEP256} {
+		for _, encryption := range []string{"", EncryptionA128CBCHS256, EncryptionA128GCM, EncryptionA256GCM} {
+			token, err := EncryptJWE([]byte("plaintext"), "JWT", Encryption{Key: jwk, Algorithm: algorithm, Encryption: encryption})
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext, header, err := DecryptJWE(token.RawString(), private)
+			if err != nil || string(plaintext) != "plaintext" || header["kid"] != "enc-key" || header["cty"] != "JWT" {
+				t.Errorf("Test failed, %s %s got %q %v %v", algorithm, encryption, plaintext, header, err)
+			}
+			// Modified ciphertexts are rejected
+			parts := strings.Split(token.RawString(), ".")
+			parts[3] = strings.Repeat("A", len(parts[3]))
+			if _, _, err := DecryptJWE(strings.Join(parts, "."), private); err != ErrInvalidJWE {
+				t.Errorf("Test failed, %s %s expected ErrInvalidJWE got %v", algorithm, encryption, err)
+			}
+		}
+	}
+	if _, err := EncryptJWE([]byte("plaintext"), "", Encryption{Key: jwk, Algorithm: "RSA1_5"}); err != ErrUnsupportedAlgorithm {
+		t.Errorf("Test failed, expected ErrUnsupportedAlgorithm got %v", err)
+	}
+
+	// ID tokens of clients requiring encryption are returned as nested JWTs
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.GrantDecorator = GrantDecoratorFunc(func(ctx context.Context, client Client, grant *Grant) error {
+		grant.IDToken = "header.payload.signature"
+		return nil
+	})
+	server.Authenticator = testEncryptionAuthenticator{server.Authenticator.(*testAuthenticator), Encryption{Key: jwk, Algorithm: AlgorithmRSAOAEP256}}
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=password&username=testusername&password=testpassword&scope=testscope"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	idToken, _ := resp["id_token"].(string)
+	plaintext, _, err := DecryptJWE(idToken, private)
+	if err != nil || string(plaintext) != "header.payload.signature" {
+		t.Errorf("Test failed, got %q %v from %v", plaintext, err, resp)
+	}
+}
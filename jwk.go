@@ -0,0 +1,194 @@
+package goauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// JWKSEndpoint publishes the public signing keys of the Server as a JSON Web Key Set as per
+// https://tools.ietf.org/html/rfc7517.
+const JWKSEndpoint = "/.well-known/jwks.json"
+
+// JWK is a public JSON Web Key.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve, X and Y are the curve and coordinates of EC keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK returns the JWK of an RSA or ECDSA public key used for signing with the algorithm.
+func NewJWK(keyID, algorithm string, public crypto.PublicKey) (JWK, error) {
+	jwk := JWK{
+		Use:       "sig",
+		KeyID:     keyID,
+		Algorithm: algorithm,
+	}
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k)
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = k.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(k.Y.FillBytes(make([]byte, size)))
+	default:
+		return JWK{}, ErrUnsupportedAlgorithm
+	}
+	return jwk, nil
+}
+
+// PublicKey returns the RSA, ECDSA or Ed25519 public key of the JWK.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch j.KeyType {
+	case "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if j.Curve != elliptic.P256().Params().Name {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if j.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedAlgorithm
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// jwksDocument is the encoded JSON Web Key Set last written by the JWKS endpoint.
+type jwksDocument struct {
+	mtx  sync.Mutex
+	keys string
+	body []byte
+	etag string
+}
+
+// handleJWKS writes the public keys of the Server's Signer, including retired keys that may still be
+// used to verify tokens. The document is only encoded again when the keys change, and is not sent to
+// clients presenting its ETag in If-None-Match.
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	if s.Signer == nil {
+		http.NotFound(w, r)
+		return
+	}
+	keys, err := s.Signer.VerificationKeys()
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	body, etag, err := s.jwks.encode(keys)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	writeCacheable(w, r, body, etag, "public, max-age=300")
+}
+
+// encode returns the JSON Web Key Set of the keys and its ETag, reusing the previous document if the
+// keys are unchanged.
+func (d *jwksDocument) encode(keys []SigningKey) ([]byte, string, error) {
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k.ID
+	}
+	id := strings.Join(ids, ",")
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.body != nil && d.keys == id {
+		return d.body, d.etag, nil
+	}
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range keys {
+		jwk, err := k.JWK()
+		if err != nil {
+			return nil, "", err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	body, err := json.Marshal(set)
+	if err != nil {
+		return nil, "", err
+	}
+	d.keys, d.body, d.etag = id, append(body, '\n'), documentETag(body)
+	return d.body, d.etag, nil
+}
+
+// documentETag returns a strong ETag derived from the content of a document.
+func documentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// writeCacheable writes a document with its ETag and Cache-Control headers, responding with 304 Not
+// Modified if the request's If-None-Match header matches the ETag.
+func writeCacheable(w http.ResponseWriter, r *http.Request, body []byte, etag, cacheControl string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimPrefix(strings.TrimSpace(match), "W/")
+		if match == etag || match == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	w.Write(body)
+}
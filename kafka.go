@@ -0,0 +1,73 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// KafkaMessage is a message produced to a Kafka topic.
+type KafkaMessage struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// KafkaProducer writes messages to Kafka. It must only return nil once every message has been
+// acknowledged by the brokers. Implementations typically wrap a kafka-go Writer or a sarama SyncProducer,
+// for example:
+//
+//	goauth.KafkaProducerFunc(func(ctx context.Context, messages []goauth.KafkaMessage) error {
+//		msgs := make([]kafka.Message, len(messages))
+//		for i, m := range messages {
+//			msgs[i] = kafka.Message{Topic: m.Topic, Key: m.Key, Value: m.Value}
+//		}
+//		return writer.WriteMessages(ctx, msgs...)
+//	})
+type KafkaProducer interface {
+	Produce(ctx context.Context, messages []KafkaMessage) error
+}
+
+// KafkaProducerFunc is an adapter allowing a function to be used as a KafkaProducer.
+type KafkaProducerFunc func(ctx context.Context, messages []KafkaMessage) error
+
+// Produce calls f(ctx, messages).
+func (f KafkaProducerFunc) Produce(ctx context.Context, messages []KafkaMessage) error {
+	return f(ctx, messages)
+}
+
+// KafkaEventPublisher is an EventBatchPublisher producing each event as a JSON message to a Kafka topic.
+// Messages are keyed by client ID so that the events of each client are kept in order.
+type KafkaEventPublisher struct {
+	Producer KafkaProducer
+	Topic    string
+}
+
+// PublishBatch satisfies the EventBatchPublisher interface.
+func (k *KafkaEventPublisher) PublishBatch(ctx context.Context, events []Event) error {
+	messages := make([]KafkaMessage, len(events))
+	for i, e := range events {
+		value, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		messages[i] = KafkaMessage{
+			Topic: k.Topic,
+			Key:   []byte(e.ClientID),
+			Value: value,
+			Headers: map[string]string{
+				"event_id":   e.ID,
+				"event_type": string(e.Type),
+			},
+		}
+	}
+	return k.Producer.Produce(ctx, messages)
+}
+
+// NewKafkaEventSink returns a BatchingEventSink producing events to the Kafka topic.
+func NewKafkaEventSink(producer KafkaProducer, topic string) *BatchingEventSink {
+	return NewBatchingEventSink(&KafkaEventPublisher{
+		Producer: producer,
+		Topic:    topic,
+	})
+}
@@ -0,0 +1,33 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestKafkaEventPublisher(t *testing.T) {
+	var produced []KafkaMessage
+	publisher := &KafkaEventPublisher{
+		Producer: KafkaProducerFunc(func(ctx context.Context, messages []KafkaMessage) error {
+			produced = append(produced, messages...)
+			return nil
+		}),
+		Topic: "auth-events",
+	}
+	err := publisher.PublishBatch(context.Background(), []Event{{ID: "1", Type: EventTokenIssued, ClientID: "testclientid"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(produced) != 1 {
+		t.Fatalf("Test failed, expected 1 message got %d", len(produced))
+	}
+	m := produced[0]
+	if m.Topic != "auth-events" || string(m.Key) != "testclientid" || m.Headers["event_type"] != string(EventTokenIssued) {
+		t.Errorf("Test failed, unexpected message %+v", m)
+	}
+	var e Event
+	if err := json.Unmarshal(m.Value, &e); err != nil || e.ID != "1" {
+		t.Errorf("Test failed, unexpected value %s", m.Value)
+	}
+}
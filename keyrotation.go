@@ -0,0 +1,157 @@
+package goauth
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultKeyRotationInterval is the age at which a KeyRotator that does not set Interval replaces the
+	// current signing key.
+	DefaultKeyRotationInterval = 30 * 24 * time.Hour
+	// DefaultRetainedKeys is the number of retired keys kept for verification by a KeyRotator that does not
+	// set Retain.
+	DefaultRetainedKeys = 2
+)
+
+// KeyRotator manages the signing keys held in a KeyStore. A new key is generated each Interval and the
+// previous keys are retired, remaining published by the JWKS endpoint so that tokens they signed can still
+// be verified until they are removed. Tokens are never re-signed. It is a Signer, add it to the Server
+// using AddComponent to rotate keys automatically.
+type KeyRotator struct {
+	Store KeyStore
+	// Algorithm overrides DefaultSigningAlgorithm if set.
+	Algorithm string
+	// Interval overrides DefaultKeyRotationInterval if greater than zero.
+	Interval time.Duration
+	// Retain overrides DefaultRetainedKeys if greater than zero. It should be large enough that keys are
+	// kept for longer than the lifetime of the tokens they sign.
+	Retain int
+	mtx    sync.Mutex
+}
+
+// NewKeyRotator returns a KeyRotator managing the keys in the store.
+func NewKeyRotator(store KeyStore) *KeyRotator {
+	return &KeyRotator{
+		Store: store,
+	}
+}
+
+func (k *KeyRotator) interval() time.Duration {
+	if k.Interval > 0 {
+		return k.Interval
+	}
+	return DefaultKeyRotationInterval
+}
+
+// sortedKeys returns the stored keys, newest first.
+func (k *KeyRotator) sortedKeys() ([]SigningKey, error) {
+	keys, err := k.Store.Keys()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+// SigningKey returns the key with which tokens should be signed, generating the first key if the store
+// is empty.
+func (k *KeyRotator) SigningKey() (SigningKey, error) {
+	keys, err := k.sortedKeys()
+	if err != nil {
+		return SigningKey{}, err
+	}
+	for _, key := range keys {
+		if !key.IsRetired() {
+			return key, nil
+		}
+	}
+	return k.Rotate()
+}
+
+// VerificationKeys returns the current and retained keys, newest first.
+func (k *KeyRotator) VerificationKeys() ([]SigningKey, error) {
+	keys, err := k.sortedKeys()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		key, err := k.Rotate()
+		if err != nil {
+			return nil, err
+		}
+		keys = []SigningKey{key}
+	}
+	return keys, nil
+}
+
+// Rotate generates a new signing key and retires the current key. Retired keys beyond those retained are
+// deleted. It returns the new key.
+func (k *KeyRotator) Rotate() (SigningKey, error) {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	algorithm := k.Algorithm
+	if algorithm == "" {
+		algorithm = DefaultSigningAlgorithm
+	}
+	key, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	err = k.Store.PutKey(key)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	keys, err := k.sortedKeys()
+	if err != nil {
+		return key, err
+	}
+	retain := k.Retain
+	if retain <= 0 {
+		retain = DefaultRetainedKeys
+	}
+	retained := 0
+	for _, old := range keys {
+		if old.ID == key.ID {
+			continue
+		}
+		if retained >= retain {
+			err = k.Store.DeleteKey(old.ID)
+		} else if !old.IsRetired() {
+			old.RetiredAt = key.CreatedAt
+			err = k.Store.PutKey(old)
+		}
+		if err != nil {
+			return key, err
+		}
+		retained++
+	}
+	return key, nil
+}
+
+// Run satisfies the Component interface, rotating the signing key whenever it reaches the rotation
+// interval. The age of the key is read from the KeyStore so that instances sharing a store rotate
+// together. Failed rotations are retried after a minute.
+func (k *KeyRotator) Run(ctx context.Context) error {
+	for {
+		wait := time.Minute
+		key, err := k.SigningKey()
+		if err == nil {
+			wait = key.CreatedAt.Add(k.interval()).Sub(timeNow())
+			if wait <= 0 {
+				_, err = k.Rotate()
+				wait = k.interval()
+				if err != nil {
+					wait = time.Minute
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeyRotator(t *testing.T) {
+	rotator := NewKeyRotator(NewMemKeyStore())
+	rotator.Algorithm = AlgorithmES256
+	rotator.Retain = 1
+	first, err := rotator.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := rotator.SigningKey(); again.ID != first.ID {
+		t.Fatal("Test failed, expected the same key until rotation")
+	}
+
+	jwks := func() JWKSet {
+		server := newTestHandler()
+		server.Signer = rotator
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", JWKSEndpoint, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Test failed, status %d", w.Code)
+		}
+		var set JWKSet
+		json.NewDecoder(w.Body).Decode(&set)
+		return set
+	}
+
+	// The previous key remains published after rotation
+	timeNow = func() time.Time { return time.Now().Add(time.Hour) }
+	second, err := rotator.Rotate()
+	timeNow = time.Now
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := rotator.SigningKey(); current.ID != second.ID {
+		t.Errorf("Test failed, expected the new key to be used for signing")
+	}
+	if set := jwks(); len(set.Keys) != 2 || set.Keys[0].KeyID != second.ID || set.Keys[1].KeyID != first.ID {
+		t.Errorf("Test failed, unexpected key set %+v", set)
+	}
+
+	// Keys beyond those retained are removed
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	third, err := rotator.Rotate()
+	timeNow = time.Now
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set := jwks(); len(set.Keys) != 2 || set.Keys[0].KeyID != third.ID || set.Keys[1].KeyID != second.ID {
+		t.Errorf("Test failed, unexpected key set %+v", set)
+	}
+
+	// The endpoint is disabled without a Signer
+	w := httptest.NewRecorder()
+	newTestHandler().ServeHTTP(w, httptest.NewRequest("GET", JWKSEndpoint, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Test failed, expected status 404 got %d", w.Code)
+	}
+}
+
+func TestJWKSETag(t *testing.T) {
+	rotator := NewKeyRotator(NewMemKeyStore())
+	rotator.Algorithm = AlgorithmES256
+	server := newTestHandler()
+	server.Signer = rotator
+	get := func(etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", JWKSEndpoint, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	w := get("")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Cache-Control") == "" {
+		t.Fatalf("Test failed, expected a cacheable response got %d %v", w.Code, w.Header())
+	}
+	if w = get(etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Test failed, expected status 304 got %d", w.Code)
+	}
+
+	// Rotation changes the ETag
+	timeNow = func() time.Time { return time.Now().Add(time.Hour) }
+	_, err := rotator.Rotate()
+	timeNow = time.Now
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = get(etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("Test failed, expected a new document after rotation got %d", w.Code)
+	}
+}
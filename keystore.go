@@ -0,0 +1,139 @@
+package goauth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// KeyStore persists SigningKeys so that they are shared between instances of the Server and survive
+// restarts. Implementations may store keys in files, a SQL database or a KMS.
+type KeyStore interface {
+	// Keys returns all stored keys.
+	Keys() ([]SigningKey, error)
+	// PutKey stores a new key or updates an existing key with the same ID.
+	PutKey(key SigningKey) error
+	// DeleteKey removes the key with the given ID.
+	DeleteKey(id string) error
+}
+
+// MemKeyStore is a KeyStore that holds keys in memory. It is suitable for a single instance of the Server
+// where tokens need not remain valid across restarts.
+type MemKeyStore struct {
+	mtx  sync.RWMutex
+	keys map[string]SigningKey
+}
+
+// NewMemKeyStore returns an empty MemKeyStore.
+func NewMemKeyStore() *MemKeyStore {
+	return &MemKeyStore{
+		keys: make(map[string]SigningKey),
+	}
+}
+
+// Keys returns all stored keys.
+func (m *MemKeyStore) Keys() ([]SigningKey, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	keys := make([]SigningKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// PutKey stores the key.
+func (m *MemKeyStore) PutKey(key SigningKey) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.keys[key.ID] = key
+	return nil
+}
+
+// DeleteKey removes the key with the given ID.
+func (m *MemKeyStore) DeleteKey(id string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.keys, id)
+	return nil
+}
+
+// FileKeyStore is a KeyStore that stores each key as a JSON file, readable only by its owner, in a
+// directory.
+type FileKeyStore struct {
+	Dir string
+}
+
+// NewFileKeyStore returns a FileKeyStore storing keys in the directory, creating it if necessary.
+func NewFileKeyStore(dir string) (*FileKeyStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &FileKeyStore{Dir: dir}, nil
+}
+
+// path returns the path of the file storing the key with the given ID.
+func (f *FileKeyStore) path(id string) string {
+	return filepath.Join(f.Dir, filepath.Base(id)+".json")
+}
+
+// Keys returns all stored keys ordered by ID.
+func (f *FileKeyStore) Keys() ([]SigningKey, error) {
+	entries, err := ioutil.ReadDir(f.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []SigningKey
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(f.Dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var key SigningKey
+		err = json.Unmarshal(data, &key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// PutKey writes the key to its file, replacing the file atomically.
+func (f *FileKeyStore) PutKey(key SigningKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.Dir, ".key-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key.ID))
+}
+
+// DeleteKey removes the file of the key with the given ID.
+func (f *FileKeyStore) DeleteKey(id string) error {
+	err := os.Remove(f.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+package goauth
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileKeyStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goauth-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewFileKeyStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutKey(key); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := store.Keys()
+	if err != nil || len(keys) != 1 || keys[0].ID != key.ID {
+		t.Fatalf("Test failed, unexpected keys %v %v", keys, err)
+	}
+	if err := store.DeleteKey(key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := store.Keys(); len(keys) != 0 {
+		t.Errorf("Test failed, expected the key to be deleted got %v", keys)
+	}
+}
@@ -0,0 +1,119 @@
+package goauth
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Component is a background process whose lifetime is managed by the Server, such as a janitor
+// removing expired grants or a key rotation scheduler.
+type Component interface {
+	// Run performs the component's work until the context is cancelled. It should return nil
+	// when stopped by the cancellation of the context.
+	Run(ctx context.Context) error
+}
+
+// ComponentFunc is a function implementing the Component interface.
+type ComponentFunc func(ctx context.Context) error
+
+// Run calls f(ctx).
+func (f ComponentFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// lifecycle tracks the background components of a Server.
+type lifecycle struct {
+	mtx        sync.Mutex
+	components []Component
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	errs       []error
+	closed     bool
+}
+
+// AddComponent registers a Component to be run by Start. Components added after Start has been called
+// are started immediately. If the Component also implements io.Closer it is closed by Close once it
+// has stopped running, allowing buffered work such as pending events to be flushed.
+func (s *Server) AddComponent(c Component) {
+	l := &s.lifecycle
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.components = append(l.components, c)
+	if l.ctx != nil && !l.closed {
+		l.run(c)
+	}
+}
+
+// Start runs the registered components in the background until ctx is cancelled or Close is called.
+// It returns ErrorServerError if the Server has already been started or closed.
+func (s *Server) Start(ctx context.Context) error {
+	l := &s.lifecycle
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.ctx != nil || l.closed {
+		return ErrorServerError
+	}
+	l.ctx, l.cancel = context.WithCancel(ctx)
+	for _, c := range l.components {
+		l.run(c)
+	}
+	return nil
+}
+
+// run starts the component in a new goroutine. It must be called with the mutex held.
+func (l *lifecycle) run(c Component) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		err := c.Run(l.ctx)
+		if err != nil && err != context.Canceled {
+			l.mtx.Lock()
+			l.errs = append(l.errs, err)
+			l.mtx.Unlock()
+		}
+	}()
+}
+
+// Close stops the background components, waits for them to return and then closes any components
+// and the SessionStoreBackend that implement io.Closer. It returns the first error encountered.
+// Close may be called without calling Start.
+func (s *Server) Close() error {
+	l := &s.lifecycle
+	l.mtx.Lock()
+	if l.closed {
+		l.mtx.Unlock()
+		return nil
+	}
+	l.closed = true
+	if l.cancel != nil {
+		l.cancel()
+	}
+	components := l.components
+	l.mtx.Unlock()
+
+	l.wg.Wait()
+
+	l.mtx.Lock()
+	errs := l.errs
+	l.mtx.Unlock()
+	for _, c := range components {
+		if closer, ok := c.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if s.SessionStore != nil {
+		if closer, ok := s.SessionStore.SessionStoreBackend.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
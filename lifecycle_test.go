@@ -0,0 +1,75 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testComponent implements the Component and io.Closer interfaces and
+// is intended for use only in testing.
+type testComponent struct {
+	started chan struct{}
+	stopped bool
+	closed  bool
+}
+
+// Run blocks until the context is cancelled.
+func (t *testComponent) Run(ctx context.Context) error {
+	close(t.started)
+	<-ctx.Done()
+	t.stopped = true
+	return nil
+}
+
+// Close records that the component was closed.
+func (t *testComponent) Close() error {
+	if !t.stopped {
+		return errors.New("closed before stopping")
+	}
+	t.closed = true
+	return nil
+}
+
+func TestLifecycle(t *testing.T) {
+	server := newTestHandler()
+	early := &testComponent{started: make(chan struct{})}
+	server.AddComponent(early)
+
+	err := server.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-early.started
+	if server.Start(context.Background()) != ErrorServerError {
+		t.Error("Test failed, expected an error when starting twice")
+	}
+
+	// Components added after starting are run immediately
+	late := &testComponent{started: make(chan struct{})}
+	server.AddComponent(late)
+	<-late.started
+
+	err = server.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !early.closed || !late.closed {
+		t.Error("Test failed, expected all components to be stopped and closed")
+	}
+}
+
+func TestLifecycleError(t *testing.T) {
+	server := newTestHandler()
+	expected := errors.New("test error")
+	server.AddComponent(ComponentFunc(func(ctx context.Context) error {
+		return expected
+	}))
+	err := server.Start(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Close(); err != expected {
+		t.Errorf("Test failed, expected %v but got %v", expected, err)
+	}
+}
@@ -0,0 +1,83 @@
+package goauth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// DefaultMaxRequestBodySize is the maximum size in bytes of the body of requests to the Server.
+	DefaultMaxRequestBodySize int64 = 64 << 10
+	// DefaultMaxFormValues is the maximum number of form values, including those in the query string, of
+	// requests to the Server.
+	DefaultMaxFormValues = 100
+)
+
+var (
+	// errRequestTooLarge is returned by limitRequest for requests with bodies larger than the maximum size.
+	errRequestTooLarge = errors.New("request body too large")
+	// errTooManyFormValues is returned by limitRequest for requests with more than the maximum form values.
+	errTooManyFormValues = errors.New("too many form values")
+)
+
+// limitedBody is a request body that records whether a read failed because it exceeded its maximum size.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		l.exceeded = true
+	}
+	return n, err
+}
+
+func (s *Server) maxRequestBodySize() int64 {
+	if s.MaxRequestBodySize > 0 {
+		return s.MaxRequestBodySize
+	}
+	return DefaultMaxRequestBodySize
+}
+
+func (s *Server) maxFormValues() int {
+	if s.MaxFormValues > 0 {
+		return s.MaxFormValues
+	}
+	return DefaultMaxFormValues
+}
+
+// limitRequest limits the size of the request body and parses the form of the request, so that handlers
+// never read more than the limit. It returns an error if the body is too large, the form is malformed or
+// has too many values.
+func (s *Server) limitRequest(w http.ResponseWriter, r *http.Request) error {
+	max := s.maxRequestBodySize()
+	if r.ContentLength > max {
+		return errRequestTooLarge
+	}
+	body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, max)}
+	r.Body = body
+	err := r.ParseForm()
+	if body.exceeded {
+		return errRequestTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	if countFormValues(r.Form) > s.maxFormValues() {
+		return errTooManyFormValues
+	}
+	return nil
+}
+
+// countFormValues returns the number of values of the form.
+func countFormValues(form url.Values) int {
+	n := 0
+	for _, values := range form {
+		n += len(values)
+	}
+	return n
+}
@@ -0,0 +1,39 @@
+package goauth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLimits(t *testing.T) {
+	server := newTestHandler()
+	server.MaxRequestBodySize = 64
+	server.MaxFormValues = 3
+	cases := []struct {
+		Body   io.Reader
+		Length bool
+		Status int
+	}{
+		{strings.NewReader("grant_type=" + strings.Repeat("x", 64)), true, http.StatusRequestEntityTooLarge},
+		// Bodies of unknown length are limited as they are read
+		{strings.NewReader("grant_type=" + strings.Repeat("x", 64)), false, http.StatusRequestEntityTooLarge},
+		{strings.NewReader("a=1&b=2&c=3&d=4"), true, http.StatusBadRequest},
+		{strings.NewReader("a=%zz"), true, http.StatusBadRequest},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest("POST", TokenEndpoint, c.Body)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if !c.Length {
+			r.ContentLength = -1
+			r.Body = io.NopCloser(r.Body)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != c.Status {
+			t.Errorf("Test failed, expected status %d for case %d got %d", c.Status, i, w.Code)
+		}
+	}
+}
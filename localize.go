@@ -0,0 +1,84 @@
+package goauth
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MessageCatalog contains translated error descriptions indexed by language tag, such as "fr" or "pt-BR",
+// and then by error code. Errors that are not an Error, such as the login failures shown on the
+// authorization page, are indexed by their message. The error codes themselves are never translated.
+type MessageCatalog map[string]map[string]string
+
+// acceptedLanguages returns the language tags of the Accept-Language header in order of preference.
+func acceptedLanguages(r *http.Request) []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+	var languages []language
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && kv[0] == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			languages = append(languages, language{tag, q})
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// messages returns the messages of the language preferred by the request, falling back from a regional tag
+// such as fr-CA to its primary language.
+func (c MessageCatalog) messages(r *http.Request) map[string]string {
+	for _, tag := range acceptedLanguages(r) {
+		for _, candidate := range []string{tag, strings.SplitN(tag, "-", 2)[0]} {
+			for lang, messages := range c {
+				if strings.EqualFold(lang, candidate) {
+					return messages
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Localize returns the error with its description translated to the language preferred by the request. The
+// error is returned unchanged if the catalog has no translation.
+func (c MessageCatalog) Localize(r *http.Request, err error) error {
+	if err == nil || len(c) == 0 {
+		return err
+	}
+	messages := c.messages(r)
+	if e, ok := asError(err); ok {
+		if msg, ok := messages[e.Code]; ok {
+			return e.WithDetail(msg)
+		}
+		return err
+	}
+	if msg, ok := messages[err.Error()]; ok {
+		return errors.New(msg)
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package goauth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAcceptedLanguages(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "en;q=0.5, fr-CA, de;q=0, *;q=0.1, pt-BR;q=0.8")
+	expected := []string{"fr-CA", "pt-BR", "en"}
+	if languages := acceptedLanguages(r); !reflect.DeepEqual(languages, expected) {
+		t.Errorf("Test failed, expected %v got %v", expected, languages)
+	}
+}
+
+func TestMessageCatalog(t *testing.T) {
+	catalog := MessageCatalog{
+		"fr": {
+			ErrorAccessDenied.Code:         "L'accès a été refusé.",
+			"username or password invalid": "Nom d'utilisateur ou mot de passe invalide",
+		},
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "fr-CA,fr;q=0.9")
+	err := catalog.Localize(r, ErrorAccessDenied)
+	if e, ok := err.(Error); !ok || e.Code != ErrorAccessDenied.Code || e.Description != "L'accès a été refusé." {
+		t.Errorf("Test failed, unexpected error %v", err)
+	}
+	if err := catalog.Localize(r, errors.New("username or password invalid")); err.Error() != "Nom d'utilisateur ou mot de passe invalide" {
+		t.Errorf("Test failed, unexpected error %v", err)
+	}
+	r.Header.Set("Accept-Language", "de")
+	if err := catalog.Localize(r, ErrorAccessDenied); err != ErrorAccessDenied {
+		t.Errorf("Test failed, expected the error to be unchanged got %v", err)
+	}
+
+	// Authorization error redirects and the authorization page are localized
+	server := newTestHandler()
+	server.ErrorMessages = MessageCatalog{"fr": {ErrorInvalidRequest.Code: "La requête est invalide."}, "de": {"username or password invalid": "Ungültige Anmeldedaten"}}
+	w := httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&code_challenge_method=unknown", nil)
+	r.Header.Set("Accept-Language", "fr")
+	server.ServeHTTP(w, r)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get(ParamError) != ErrorInvalidRequest.Code || location.Query().Get(ParamErrorDescription) != "La requête est invalide." {
+		t.Errorf("Test failed, unexpected redirect %s", location)
+	}
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", strings.NewReader("username=testusername&password=wrong"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept-Language", "de-DE")
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "Ungültige Anmeldedaten") {
+		t.Errorf("Test failed, expected a localized login error got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,124 @@
+package goauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	// LoggedParams are the request parameters whose values are kept by ScrubParams. They are the protocol
+	// parameters that carry neither credentials nor tokens. The values of every other parameter are replaced,
+	// including login form fields whose names are configured by the Server and the fields of extensions.
+	LoggedParams = []string{
+		ParamClientID,
+		ParamGrantType,
+		ParamResponseType,
+		"response_mode",
+		ParamScope,
+		ParamRedirectURI,
+		ParamCodeChallengeMethod,
+		ParamPrompt,
+		ParamMaxAge,
+		ParamTokenTypeHint,
+		ParamRequestedExpiry,
+		ParamResource,
+		"username",
+	}
+)
+
+// scrubbedValue replaces the values of scrubbed parameters.
+const scrubbedValue = "[scrubbed]"
+
+// ScrubParams returns a copy of the values with the values of parameters other than the LoggedParams
+// replaced.
+func ScrubParams(values url.Values) url.Values {
+	scrubbed := make(url.Values, len(values))
+	for key, v := range values {
+		scrubbed[key] = make([]string, len(v))
+		for i := range v {
+			scrubbed[key][i] = scrubbedValue
+		}
+	}
+	for _, param := range LoggedParams {
+		if v, ok := values[param]; ok {
+			scrubbed[param] = append([]string(nil), v...)
+		}
+	}
+	return scrubbed
+}
+
+// RequestLog describes a request served by the Server.
+type RequestLog struct {
+	RequestID string
+	Method    string
+	Path      string
+	ClientID  string
+	GrantType string
+	Status    int
+	Latency   time.Duration
+	// Params are the parameters of the request with the values of parameters other than the LoggedParams
+	// replaced.
+	Params url.Values
+}
+
+// String formats the RequestLog as a single line of key=value pairs.
+func (l RequestLog) String() string {
+	return fmt.Sprintf("request_id=%s method=%s path=%s client_id=%q grant_type=%q status=%d latency=%s params=%q",
+		l.RequestID, l.Method, l.Path, l.ClientID, l.GrantType, l.Status, l.Latency, l.Params.Encode())
+}
+
+// RequestLogger records the requests served by the Server.
+type RequestLogger interface {
+	LogRequest(entry RequestLog)
+}
+
+// RequestLoggerFunc is a function implementing the RequestLogger interface.
+type RequestLoggerFunc func(entry RequestLog)
+
+// LogRequest calls f(entry).
+func (f RequestLoggerFunc) LogRequest(entry RequestLog) {
+	f(entry)
+}
+
+// LogRequests returns Middleware recording each request with the logger once it has been served. Credentials
+// are never logged: only the values of LoggedParams are kept and the Authorization header is ignored. Form
+// values are only available to the middleware if it is registered using Server.Before, otherwise only the
+// query is logged so that the request body is left for the Server to parse within its limits.
+//
+//	server.Before(goauth.TokenEndpoint, goauth.LogRequests(goauth.RequestLoggerFunc(func(entry goauth.RequestLog) {
+//		log.Println(entry)
+//	})))
+func LogRequests(logger RequestLogger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = withRequestID(w, r)
+			start := timeNow()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			params := r.Form
+			if params == nil {
+				params = r.URL.Query()
+			}
+			clientID := params.Get(ParamClientID)
+			if username, _, ok := r.BasicAuth(); ok && clientID == "" {
+				clientID = username
+			}
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			logger.LogRequest(RequestLog{
+				RequestID: RequestIDFromContext(r.Context()),
+				Method:    r.Method,
+				Path:      r.URL.Path,
+				ClientID:  clientID,
+				GrantType: params.Get(ParamGrantType),
+				Status:    status,
+				Latency:   timeNow().Sub(start),
+				Params:    ScrubParams(params),
+			})
+		})
+	}
+}
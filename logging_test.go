@@ -0,0 +1,55 @@
+package goauth
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLogRequests(t *testing.T) {
+	server := newTestHandler()
+	var entries []RequestLog
+	server.Before(TokenEndpoint, LogRequests(RequestLoggerFunc(func(entry RequestLog) {
+		entries = append(entries, entry)
+	})))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=password&username=testusername&password=testpassword&scope=testscope"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	server.ServeHTTP(w, r)
+	if len(entries) != 1 {
+		t.Fatalf("Test failed, expected 1 entry got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.ClientID != "testclientid" || entry.GrantType != GrantTypePassword || entry.Status != w.Code || entry.Path != TokenEndpoint || entry.RequestID != w.Header().Get(RequestIDHeader) {
+		t.Errorf("Test failed, unexpected entry %v", entry)
+	}
+	line := entry.String()
+	if strings.Contains(line, "testpassword") || strings.Contains(line, "testclientsecret") || !strings.Contains(line, "username=testusername") {
+		t.Errorf("Test failed, expected credentials to be scrubbed got %s", line)
+	}
+
+	// Wrapping the Server logs the query without reading the body
+	entries = nil
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/authorize?client_id=testclientid&code=secretcode", nil)
+	LogRequests(RequestLoggerFunc(func(entry RequestLog) {
+		entries = append(entries, entry)
+	}))(server).ServeHTTP(w, r)
+	if len(entries) != 1 || entries[0].ClientID != "testclientid" || entries[0].Params.Get(ParamCode) != scrubbedValue || entries[0].Status != w.Code {
+		t.Errorf("Test failed, unexpected entries %v", entries)
+	}
+
+	// Login fields configured by the Server and the fields of extensions are scrubbed
+	params := ScrubParams(url.Values{"email": {"test@example.com"}, "pin": {"1234"}, "otp": {"123456"}, ParamScope: {"testscope"}})
+	for _, param := range []string{"email", "pin", "otp"} {
+		if params.Get(param) != scrubbedValue {
+			t.Errorf("Test failed, expected %s to be scrubbed got %s", param, params.Get(param))
+		}
+	}
+	if params.Get(ParamScope) != "testscope" {
+		t.Errorf("Test failed, expected the scope to be logged got %s", params.Get(ParamScope))
+	}
+}
@@ -0,0 +1,131 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prompt is a value of the OpenID Connect prompt parameter which specifies whether the authorization
+// server prompts the resource owner for reauthentication and consent.
+type Prompt string
+
+const (
+	PromptNone          Prompt = "none"
+	PromptLogin         Prompt = "login"
+	PromptConsent       Prompt = "consent"
+	PromptSelectAccount Prompt = "select_account"
+)
+
+// LoginSession is an authenticated session of a resource owner with the authorization server.
+type LoginSession struct {
+	// Username identifies the authenticated resource owner.
+	Username string
+	// AuthTime is the time at which the resource owner last authenticated.
+	AuthTime time.Time
+}
+
+// SessionAuthenticator can be provided in order to maintain login sessions between authorization
+// requests, allowing resource owners with an existing session to skip the login form.
+type SessionAuthenticator interface {
+	// GetLoginSession returns the LoginSession associated with the request. It returns an
+	// error if there is no session.
+	GetLoginSession(r *http.Request) (LoginSession, error)
+	// SetLoginSession associates the LoginSession with subsequent requests from the user agent,
+	// typically by setting a cookie on the response.
+	SetLoginSession(w http.ResponseWriter, r *http.Request, session LoginSession) error
+}
+
+// AuthorizationHints are the optional hints provided by the client about the resource owner who is
+// expected to authenticate.
+type AuthorizationHints struct {
+	// LoginHint is the login_hint parameter, typically the resource owner's username or email address.
+	LoginHint string
+	// IDTokenHint is the id_token_hint parameter, an ID token previously issued to the client.
+	IDTokenHint Secret
+}
+
+type authorizationHintsKey struct{}
+
+// GetAuthorizationHints returns the AuthorizationHints of an authorization request. It can be used by an
+// AuthorizationHandler to pre-fill the login form or by a SessionAuthenticator to select a matching session.
+func GetAuthorizationHints(r *http.Request) AuthorizationHints {
+	if hints, ok := r.Context().Value(authorizationHintsKey{}).(AuthorizationHints); ok {
+		return hints
+	}
+	return AuthorizationHints{
+		LoginHint:   r.FormValue(ParamLoginHint),
+		IDTokenHint: Secret(r.FormValue(ParamIDTokenHint)),
+	}
+}
+
+// withAuthorizationHints parses the hints of an authorization request and attaches them to its context.
+func withAuthorizationHints(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authorizationHintsKey{}, GetAuthorizationHints(r)))
+}
+
+// parsePrompt parses the space delimited prompt parameter. It returns an error if a value is unknown
+// or if none is combined with any other value.
+func parsePrompt(raw string) ([]Prompt, error) {
+	var prompts []Prompt
+	for _, v := range strings.Fields(raw) {
+		switch p := Prompt(v); p {
+		case PromptNone, PromptLogin, PromptConsent, PromptSelectAccount:
+			prompts = append(prompts, p)
+		default:
+			return nil, ErrorInvalidRequest
+		}
+	}
+	for _, p := range prompts {
+		if p == PromptNone && len(prompts) > 1 {
+			return nil, ErrorInvalidRequest
+		}
+	}
+	return prompts, nil
+}
+
+// hasPrompt checks whether check is present in prompts returning a bool.
+func hasPrompt(check Prompt, prompts []Prompt) bool {
+	for _, p := range prompts {
+		if p == check {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMaxAge parses the max_age parameter, returning a negative duration if it was not provided.
+func parseMaxAge(raw string) (time.Duration, error) {
+	if raw == "" {
+		return -1, nil
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds < 0 {
+		return 0, ErrorInvalidRequest
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// activeLoginSession returns the resource owner's existing LoginSession if one exists and it satisfies the
+// prompt and max_age parameters of the request. Otherwise it returns false and the resource owner must
+// authenticate.
+func (s *Server) activeLoginSession(r *http.Request, prompts []Prompt, maxAge time.Duration) (LoginSession, bool) {
+	if s.SessionAuthenticator == nil || hasPrompt(PromptLogin, prompts) {
+		return LoginSession{}, false
+	}
+	session, err := s.SessionAuthenticator.GetLoginSession(r)
+	if err != nil {
+		return LoginSession{}, false
+	}
+	// A session belonging to a different resource owner than the one hinted at can't be used
+	if hint := GetAuthorizationHints(r).LoginHint; hint != "" && hint != session.Username {
+		return LoginSession{}, false
+	}
+	// A session older than max_age requires the resource owner to authenticate again
+	if maxAge >= 0 && session.AuthTime.Add(maxAge).Before(timeNow()) {
+		return LoginSession{}, false
+	}
+	return session, true
+}
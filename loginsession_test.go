@@ -0,0 +1,121 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testSessionAuthenticator implements the SessionAuthenticator interface and
+// is intended for use only in testing.
+type testSessionAuthenticator struct {
+	session *LoginSession
+}
+
+// GetLoginSession returns the configured session or an error if there is none.
+func (t *testSessionAuthenticator) GetLoginSession(r *http.Request) (LoginSession, error) {
+	if t.session == nil {
+		return LoginSession{}, ErrorLoginRequired
+	}
+	return *t.session, nil
+}
+
+// SetLoginSession replaces the configured session.
+func (t *testSessionAuthenticator) SetLoginSession(w http.ResponseWriter, r *http.Request, session LoginSession) error {
+	t.session = &session
+	return nil
+}
+
+func TestParsePrompt(t *testing.T) {
+	prompts, err := parsePrompt("login consent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasPrompt(PromptLogin, prompts) || !hasPrompt(PromptConsent, prompts) {
+		t.Errorf("Test failed, got %v", prompts)
+	}
+	for _, invalid := range []string{"none login", "unknown"} {
+		_, err := parsePrompt(invalid)
+		if err != ErrorInvalidRequest {
+			t.Errorf("Test failed, expected an error for %s", invalid)
+		}
+	}
+}
+
+func TestPromptAndMaxAge(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	authenticator := &testSessionAuthenticator{}
+
+	authorize := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r, err := http.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	location := func(w *httptest.ResponseRecorder) url.Values {
+		if w.Code != 302 {
+			t.Fatalf("Test failed, status %v", w.Code)
+		}
+		uri, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return uri.Query()
+	}
+
+	// Without a session prompt=none should fail with login_required
+	if e := location(authorize("prompt=none&state=teststate")); e.Get("error") != "login_required" || e.Get("state") != "teststate" {
+		t.Errorf("Test failed, got %v", e)
+	}
+
+	// With a recent session prompt=none should fail with consent_required until the scope is approved
+	server.SessionAuthenticator = authenticator
+	authenticator.session = &LoginSession{Username: "testusername", AuthTime: time.Now().Add(-time.Minute)}
+	if e := location(authorize("prompt=none")); e.Get("error") != "consent_required" {
+		t.Errorf("Test failed, got %v", e)
+	}
+
+	// With a recent session and approved scope prompt=none should issue a code
+	server.ConsentStore = NewMemConsentStore()
+	server.ConsentStore.PutConsent(context.Background(), "testusername", "testclientid", []string{"testscope"})
+	if v := location(authorize("prompt=none")); v.Get("code") == "" {
+		t.Errorf("Test failed, expected a code but got %v", v)
+	}
+
+	// A session for a different resource owner than the login hint should not be used
+	if e := location(authorize("prompt=none&login_hint=otheruser")); e.Get("error") != "login_required" {
+		t.Errorf("Test failed, got %v", e)
+	}
+
+	// A session older than max_age should require the resource owner to authenticate again
+	if e := location(authorize("prompt=none&max_age=30")); e.Get("error") != "login_required" {
+		t.Errorf("Test failed, got %v", e)
+	}
+	if w := authorize("max_age=30"); w.Code != 200 {
+		t.Errorf("Test failed, expected the login form but got status %v", w.Code)
+	}
+
+	// prompt=login should always show the login form
+	if w := authorize("prompt=login"); w.Code != 200 {
+		t.Errorf("Test failed, expected the login form but got status %v", w.Code)
+	}
+}
+
+func TestGetAuthorizationHints(t *testing.T) {
+	r, err := http.NewRequest("GET", "/authorize?login_hint=testusername&id_token_hint=testtoken", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints := GetAuthorizationHints(withAuthorizationHints(r))
+	if hints.LoginHint != "testusername" || hints.IDTokenHint.RawString() != "testtoken" {
+		t.Errorf("Test failed, got %v", hints)
+	}
+}
@@ -0,0 +1,489 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultMemSnapshotInterval is the interval at which a persisted MemSessionStoreBackend writes a
+	// snapshot if MemPersistence.SnapshotInterval is not set.
+	DefaultMemSnapshotInterval = 5 * time.Minute
+	// DefaultMemFsyncInterval is the interval at which the log of a persisted MemSessionStoreBackend using
+	// FsyncInterval is synced if MemPersistence.FsyncInterval is not set.
+	DefaultMemFsyncInterval = time.Second
+)
+
+const (
+	memSnapshotFile   = "snapshot.json"
+	memSnapshotFormat = "goauth-mem-snapshot"
+	memWALPrefix      = "wal."
+)
+
+// FsyncPolicy determines when the log of a persisted MemSessionStoreBackend is synced to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncAlways syncs each change before it is acknowledged, so that no acknowledged change is lost.
+	FsyncAlways FsyncPolicy = iota
+	// FsyncInterval syncs the log once per FsyncInterval, losing at most the changes made during the interval
+	// if the machine fails.
+	FsyncInterval
+	// FsyncNever leaves syncing the log to the operating system.
+	FsyncNever
+)
+
+// MemPersistence configures the persistence of a MemSessionStoreBackend to disk, allowing single node
+// deployments to survive restarts without an external session store.
+type MemPersistence struct {
+	// Dir is the directory holding the snapshot and log files, it is created if necessary. The files contain
+	// tokens and are readable only by their owner.
+	Dir string
+	// Fsync determines when changes are synced to disk.
+	Fsync FsyncPolicy
+	// FsyncInterval overrides DefaultMemFsyncInterval if greater than zero.
+	FsyncInterval time.Duration
+	// SnapshotInterval overrides DefaultMemSnapshotInterval if greater than zero.
+	SnapshotInterval time.Duration
+}
+
+func (p MemPersistence) fsyncInterval() time.Duration {
+	if p.FsyncInterval > 0 {
+		return p.FsyncInterval
+	}
+	return DefaultMemFsyncInterval
+}
+
+func (p MemPersistence) snapshotInterval() time.Duration {
+	if p.SnapshotInterval > 0 {
+		return p.SnapshotInterval
+	}
+	return DefaultMemSnapshotInterval
+}
+
+// memWAL is the write-ahead log of a persisted MemSessionStoreBackend. Changes are appended to the log file
+// with the current sequence number, which is incremented when a snapshot is taken so that the logs written
+// before the snapshot can be removed.
+type memWAL struct {
+	persistence MemPersistence
+	file        *os.File
+	seq         int
+	// snapshotMtx serializes snapshots.
+	snapshotMtx sync.Mutex
+}
+
+// memWALEntry is a change written to the log, the record stored or the key of the record removed.
+type memWALEntry struct {
+	Namespace string         `json:"namespace,omitempty"`
+	Put       *SessionRecord `json:"put,omitempty"`
+	Delete    *SessionRecord `json:"delete,omitempty"`
+}
+
+// memSnapshotHeader is the first line of a snapshot. Logs with sequence numbers lower than WAL are
+// included in the snapshot.
+type memSnapshotHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	WAL     int    `json:"wal"`
+}
+
+// OpenMemSessionStoreBackend returns a MemSessionStoreBackend persisted to the directory, restoring the
+// records held when it was last closed. Changes are written to a log, which is replaced by a snapshot of
+// all records periodically while the backend is run as a Component and when it is closed:
+//
+//	backend, err := goauth.OpenMemSessionStoreBackend(goauth.MemPersistence{Dir: "/var/lib/goauth"})
+//	...
+//	server.SessionStore = goauth.NewSessionStore(backend)
+//	server.AddComponent(backend)
+//
+// Only one backend may use the directory at a time.
+func OpenMemSessionStoreBackend(p MemPersistence) (*MemSessionStoreBackend, error) {
+	err := os.MkdirAll(p.Dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	m := NewMemSessionStoreBackend()
+	m.namespace("", false)
+	seq, err := m.restore(p.Dir)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openMemWAL(p.Dir, seq)
+	if err != nil {
+		return nil, err
+	}
+	m.namespaces.wal = &memWAL{persistence: p, file: file, seq: seq}
+	return m, nil
+}
+
+// openMemWAL opens the log file with the sequence number for appending.
+func openMemWAL(dir string, seq int) (*os.File, error) {
+	return os.OpenFile(filepath.Join(dir, memWALPrefix+strconv.Itoa(seq)), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+}
+
+// memWALSeqs returns the sequence numbers of the log files in the directory in ascending order.
+func memWALSeqs(dir string) ([]int, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []int
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), memWALPrefix) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), memWALPrefix))
+		if err == nil {
+			seqs = append(seqs, seq)
+		}
+	}
+	sort.Ints(seqs)
+	return seqs, nil
+}
+
+// restore reads the snapshot and replays the logs written since, returning the sequence number of the
+// next log. Logs are replayed until the first entry that cannot be read, such as an entry partially
+// written when the process stopped.
+func (m *MemSessionStoreBackend) restore(dir string) (int, error) {
+	seq := 0
+	f, err := os.Open(filepath.Join(dir, memSnapshotFile))
+	if err == nil {
+		defer f.Close()
+		dec := json.NewDecoder(f)
+		var header memSnapshotHeader
+		err = dec.Decode(&header)
+		if err != nil || header.Format != memSnapshotFormat || header.Version != 1 {
+			return 0, fmt.Errorf("goauth: invalid snapshot %s", f.Name())
+		}
+		seq = header.WAL
+		for {
+			var entry memWALEntry
+			err = dec.Decode(&entry)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, fmt.Errorf("goauth: reading snapshot %s: %w", f.Name(), err)
+			}
+			m.replay(entry)
+		}
+	} else if !os.IsNotExist(err) {
+		return 0, err
+	}
+	seqs, err := memWALSeqs(dir)
+	if err != nil {
+		return 0, err
+	}
+	next := seq
+	for _, s := range seqs {
+		if s < seq {
+			continue
+		}
+		err = m.replayWAL(filepath.Join(dir, memWALPrefix+strconv.Itoa(s)))
+		if err != nil {
+			return 0, err
+		}
+		next = s + 1
+	}
+	return next, nil
+}
+
+// replayWAL applies the entries of a log file.
+func (m *MemSessionStoreBackend) replayWAL(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var entry memWALEntry
+		if dec.Decode(&entry) != nil {
+			return nil
+		}
+		m.replay(entry)
+	}
+}
+
+// replay applies a log entry without logging it.
+func (m *MemSessionStoreBackend) replay(entry memWALEntry) {
+	b := m.namespace(entry.Namespace, true)
+	if entry.Put != nil {
+		b.apply(*entry.Put, true)
+	}
+	if entry.Delete != nil {
+		b.apply(*entry.Delete, false)
+	}
+}
+
+// put stores the record, logging it first if the backend is persisted. The lock must be held.
+func (m *MemSessionStoreBackend) put(record SessionRecord) error {
+	err := m.log(memWALEntry{Namespace: m.name, Put: &record})
+	if err != nil {
+		return err
+	}
+	m.apply(record, true)
+	return nil
+}
+
+// remove removes the record with the key of the given record, logging it first if the backend is
+// persisted. The lock must be held.
+func (m *MemSessionStoreBackend) remove(record SessionRecord) error {
+	err := m.log(memWALEntry{Namespace: m.name, Delete: &record})
+	if err != nil {
+		return err
+	}
+	m.apply(record, false)
+	return nil
+}
+
+// log appends the entry to the log if the backend is persisted. The lock must be held.
+func (m *MemSessionStoreBackend) log(entry memWALEntry) error {
+	if m.namespaces == nil || m.namespaces.wal == nil {
+		return nil
+	}
+	wal := m.namespaces.wal
+	if wal.file == nil {
+		return os.ErrClosed
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = wal.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+	if wal.persistence.Fsync == FsyncAlways {
+		return wal.file.Sync()
+	}
+	return nil
+}
+
+// apply stores or removes the record in memory. The lock must be held.
+func (m *MemSessionStoreBackend) apply(record SessionRecord, put bool) {
+	switch {
+	case record.Grant != nil:
+		k := record.Grant.AccessToken.RawString()
+		if put {
+			m.grants[k] = *record.Grant
+		} else {
+			delete(m.grants, k)
+		}
+	case record.AuthorizationCode != nil:
+		k := record.AuthorizationCode.Code.RawString()
+		if put {
+			m.authCodes[k] = *record.AuthorizationCode
+		} else {
+			delete(m.authCodes, k)
+		}
+	case record.BackChannelRequest != nil:
+		k := record.BackChannelRequest.AuthReqID.RawString()
+		if put {
+			m.backChannelRequests[k] = *record.BackChannelRequest
+		} else {
+			delete(m.backChannelRequests, k)
+		}
+	case record.DeviceAuthorization != nil:
+		k := record.DeviceAuthorization.DeviceCode.RawString()
+		if put {
+			m.deviceAuthorizations[k] = *record.DeviceAuthorization
+			m.userCodes[record.DeviceAuthorization.UserCode] = k
+		} else {
+			if d, ok := m.deviceAuthorizations[k]; ok {
+				delete(m.userCodes, d.UserCode)
+			}
+			delete(m.deviceAuthorizations, k)
+		}
+	case record.VerificationCode != nil:
+		k := record.VerificationCode.Code.RawString()
+		if put {
+			m.verificationCodes[k] = *record.VerificationCode
+		} else {
+			delete(m.verificationCodes, k)
+		}
+	case record.IdempotentResponse != nil:
+		k := record.IdempotentResponse.Key
+		if put {
+			m.idempotentResponses[k] = *record.IdempotentResponse
+		} else {
+			delete(m.idempotentResponses, k)
+		}
+	}
+}
+
+// persisted returns the log of the backend, or nil if it is not persisted.
+func (m *MemSessionStoreBackend) persisted() *memWAL {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.namespaces == nil {
+		return nil
+	}
+	return m.namespaces.wal
+}
+
+// Snapshot writes the records of all namespaces to the snapshot file of a persisted backend and removes
+// the logs it replaces. The backend is only locked while the records are copied. It does nothing if the
+// backend is not persisted.
+func (m *MemSessionStoreBackend) Snapshot() error {
+	wal := m.persisted()
+	if wal == nil {
+		return nil
+	}
+	wal.snapshotMtx.Lock()
+	defer wal.snapshotMtx.Unlock()
+
+	// Copy the records and start a new log, so that changes made while the snapshot is written are logged
+	// for replay after it
+	m.mtx.Lock()
+	if wal.file == nil {
+		m.mtx.Unlock()
+		return os.ErrClosed
+	}
+	var entries []memWALEntry
+	for _, b := range append([]*MemSessionStoreBackend{m.namespaces.root}, m.namespaceBackends()...) {
+		for _, record := range b.records() {
+			record := record
+			entries = append(entries, memWALEntry{Namespace: b.name, Put: &record})
+		}
+	}
+	file, err := openMemWAL(wal.persistence.Dir, wal.seq+1)
+	if err == nil {
+		err = wal.file.Sync()
+	}
+	if err == nil {
+		wal.file.Close()
+		wal.file = file
+		wal.seq++
+	} else if file != nil {
+		file.Close()
+	}
+	seq := wal.seq
+	m.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = writeMemSnapshot(wal.persistence.Dir, memSnapshotHeader{memSnapshotFormat, 1, seq}, entries)
+	if err != nil {
+		return err
+	}
+	seqs, err := memWALSeqs(wal.persistence.Dir)
+	if err != nil {
+		return err
+	}
+	for _, s := range seqs {
+		if s < seq {
+			err = os.Remove(filepath.Join(wal.persistence.Dir, memWALPrefix+strconv.Itoa(s)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// namespaceBackends returns the backends of the namespaces other than the default namespace. The lock
+// must be held.
+func (m *MemSessionStoreBackend) namespaceBackends() []*MemSessionStoreBackend {
+	backends := make([]*MemSessionStoreBackend, 0, len(m.namespaces.backends))
+	for _, b := range m.namespaces.backends {
+		backends = append(backends, b)
+	}
+	return backends
+}
+
+// writeMemSnapshot writes the snapshot file, replacing it atomically.
+func writeMemSnapshot(dir string, header memSnapshotHeader, entries []memWALEntry) error {
+	tmp, err := ioutil.TempFile(dir, ".snapshot-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	err = enc.Encode(header)
+	for i := 0; err == nil && i < len(entries); i++ {
+		err = enc.Encode(entries[i])
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, memSnapshotFile))
+}
+
+// Run satisfies the Component interface, taking snapshots of a persisted backend at the snapshot interval
+// and syncing the log at the fsync interval if the FsyncInterval policy is used. Failed snapshots are
+// retried at the next interval. It returns immediately if the backend is not persisted.
+func (m *MemSessionStoreBackend) Run(ctx context.Context) error {
+	wal := m.persisted()
+	if wal == nil {
+		return nil
+	}
+	snapshots := time.NewTicker(wal.persistence.snapshotInterval())
+	defer snapshots.Stop()
+	var syncs <-chan time.Time
+	if wal.persistence.Fsync == FsyncInterval {
+		t := time.NewTicker(wal.persistence.fsyncInterval())
+		defer t.Stop()
+		syncs = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-snapshots.C:
+			m.Snapshot()
+		case <-syncs:
+			m.mtx.Lock()
+			if wal.file != nil {
+				wal.file.Sync()
+			}
+			m.mtx.Unlock()
+		}
+	}
+}
+
+// Close takes a final snapshot of a persisted backend and closes its log. Changes made after Close fail.
+// It does nothing if the backend is not persisted.
+func (m *MemSessionStoreBackend) Close() error {
+	wal := m.persisted()
+	if wal == nil {
+		return nil
+	}
+	m.mtx.Lock()
+	closed := wal.file == nil
+	m.mtx.Unlock()
+	if closed {
+		return nil
+	}
+	err := m.Snapshot()
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if wal.file == nil {
+		return err
+	}
+	if syncErr := wal.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := wal.file.Close(); err == nil {
+		err = closeErr
+	}
+	wal.file = nil
+	return err
+}
@@ -0,0 +1,117 @@
+package goauth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemSessionStoreBackendPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goauth-mem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := MemPersistence{Dir: dir}
+
+	backend, err := OpenMemSessionStoreBackend(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewSessionStore(backend)
+	now := time.Now()
+	for _, token := range []Secret{"kept", "snapshotted", "deleted"} {
+		err = store.PutGrant(Grant{AccessToken: token, RefreshToken: "refresh" + token, CreatedAt: now, ExpiresIn: time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = backend.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changes after the snapshot are replayed from the log
+	err = store.DeleteGrant("deleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.PutDeviceAuthorization(DeviceAuthorization{DeviceCode: "devicecode", UserCode: "ABCD-EFGH", CreatedAt: now, ExpiresIn: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tenant, err := store.Namespace("tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tenant.PutAuthorizationCode(AuthorizationCode{Code: "code", CreatedAt: now, ExpiresIn: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash by reopening the directory without closing the backend, leaving a partially written
+	// entry at the end of the log
+	seqs, err := memWALSeqs(dir)
+	if err != nil || len(seqs) != 1 {
+		t.Fatalf("Test failed, expected a single log, got %v %v", seqs, err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, memWALPrefix+"1"), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"put":{"grant":`)
+	f.Close()
+
+	restored, err := OpenMemSessionStoreBackend(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(store *SessionStore) {
+		t.Helper()
+		for _, token := range []Secret{"kept", "snapshotted"} {
+			if _, err := store.GetGrant(token); err != nil {
+				t.Errorf("Test failed, expected grant %s to be restored, got %v", token.RawString(), err)
+			}
+		}
+		if _, err := store.RefreshGrant("refreshkept"); err != nil {
+			t.Errorf("Test failed, expected the refresh token to be restored, got %v", err)
+		}
+		if _, err := store.GetGrant("deleted"); err == nil {
+			t.Error("Test failed, expected the deleted grant not to be restored")
+		}
+		if _, err := store.GetDeviceAuthorizationByUserCode("ABCD-EFGH"); err != nil {
+			t.Errorf("Test failed, expected the device authorization to be restored, got %v", err)
+		}
+		tenant, err := store.Namespace("tenant")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tenant.GetAuthorizationCode("code"); err != nil {
+			t.Errorf("Test failed, expected the namespaced authorization code to be restored, got %v", err)
+		}
+		if _, err := store.GetAuthorizationCode("code"); err == nil {
+			t.Error("Test failed, expected the authorization code to be restored to its namespace")
+		}
+	}
+	check(NewSessionStore(restored))
+
+	// Closing takes a snapshot replacing the logs
+	err = restored.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.PutGrant(Grant{AccessToken: "closed"}); err == nil {
+		t.Error("Test failed, expected changes to fail after Close")
+	}
+	seqs, err = memWALSeqs(dir)
+	if err != nil || len(seqs) != 1 || seqs[0] != 3 {
+		t.Errorf("Test failed, expected only the latest log to remain, got %v %v", seqs, err)
+	}
+	reopened, err := OpenMemSessionStoreBackend(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	check(NewSessionStore(reopened))
+}
@@ -0,0 +1,202 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// MetadataEndpoint publishes the authorization server metadata document as per
+// https://tools.ietf.org/html/rfc8414.
+const MetadataEndpoint = "/.well-known/oauth-authorization-server"
+
+// MetadataFunc returns the value of a field of the metadata document for the request. The field is omitted
+// if the value is nil.
+type MetadataFunc func(r *http.Request) interface{}
+
+// metadataRegistry holds the fields of the metadata document.
+type metadataRegistry struct {
+	mtx    sync.RWMutex
+	fields map[string]MetadataFunc
+}
+
+// SetMetadata sets a field of the metadata document to a fixed value, replacing any existing value,
+// including those of the fields published by default. A nil value removes the field.
+func (s *Server) SetMetadata(name string, value interface{}) {
+	if value == nil {
+		s.SetMetadataFunc(name, nil)
+		return
+	}
+	s.SetMetadataFunc(name, func(r *http.Request) interface{} {
+		return value
+	})
+}
+
+// SetMetadataFunc sets a field of the metadata document to a value computed for each request, such as a URL
+// that depends on the host of the request. A nil MetadataFunc removes the field.
+func (s *Server) SetMetadataFunc(name string, f MetadataFunc) {
+	s.metadata.mtx.Lock()
+	defer s.metadata.mtx.Unlock()
+	if f == nil {
+		delete(s.metadata.fields, name)
+		return
+	}
+	if s.metadata.fields == nil {
+		s.metadata.fields = make(map[string]MetadataFunc)
+	}
+	s.metadata.fields[name] = f
+}
+
+// AdvertiseEndpoint sets a field of the metadata document to the absolute URL of an endpoint of the Server,
+// such as an endpoint added by an extension grant. The URL is built from the Issuer or, if it is not set,
+// the request.
+func (s *Server) AdvertiseEndpoint(name, endpoint string) {
+	s.SetMetadataFunc(name, func(r *http.Request) interface{} {
+		return s.endpointURL(r, endpoint)
+	})
+}
+
+// Metadata returns the metadata document for the request. If the Server's SignedMetadata is set the
+// document includes the signed_metadata field, a JWT of the other fields signed by the Signer.
+func (s *Server) Metadata(r *http.Request) (map[string]interface{}, error) {
+	s.metadata.mtx.RLock()
+	m := make(map[string]interface{}, len(s.metadata.fields))
+	for name, f := range s.metadata.fields {
+		if value := f(r); value != nil {
+			m[name] = value
+		}
+	}
+	s.metadata.mtx.RUnlock()
+	if !s.SignedMetadata {
+		return m, nil
+	}
+	signed, err := s.signMetadata(m)
+	if err != nil {
+		return nil, err
+	}
+	m["signed_metadata"] = signed.RawString()
+	return m, nil
+}
+
+// signMetadata returns the metadata as a JWT signed by the Signer as per RFC 8414 section 2.1. The JWT
+// includes the issuer as the iss claim and the time at which it was signed.
+func (s *Server) signMetadata(m map[string]interface{}) (Secret, error) {
+	if s.Signer == nil {
+		return "", ErrNoSigner
+	}
+	claims := make(map[string]interface{}, len(m)+2)
+	for name, value := range m {
+		claims[name] = value
+	}
+	claims["iss"] = m["issuer"]
+	claims["iat"] = timeNow().Unix()
+	return SignJWT(s.Signer, claims)
+}
+
+// handleMetadata writes the metadata document.
+func (s *Server) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	m, err := s.Metadata(r)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	body, err := json.Marshal(m)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Write(body)
+}
+
+// endpointURL returns the absolute URL of an endpoint of the Server.
+func (s *Server) endpointURL(r *http.Request, endpoint string) string {
+	if s.Issuer != "" {
+		return s.issuerURL(endpoint)
+	}
+	return s.requestBaseURL(r) + endpoint
+}
+
+// registerDefaultMetadata registers the fields of the metadata document describing the Server's endpoints
+// and grants. Fields describing optional features are omitted while the feature is disabled.
+func (s *Server) registerDefaultMetadata() {
+	s.SetMetadataFunc("issuer", func(r *http.Request) interface{} {
+		return s.endpointURL(r, "")
+	})
+	s.AdvertiseEndpoint("authorization_endpoint", AuthorizeEnpoint)
+	s.AdvertiseEndpoint("token_endpoint", TokenEndpoint)
+	s.AdvertiseEndpoint("introspection_endpoint", IntrospectionEndpoint)
+	s.AdvertiseEndpoint("device_authorization_endpoint", DeviceAuthorizationEndpoint)
+	s.SetMetadataFunc("jwks_uri", func(r *http.Request) interface{} {
+		if s.Signer == nil {
+			return nil
+		}
+		return s.endpointURL(r, JWKSEndpoint)
+	})
+	s.SetMetadataFunc("id_token_signing_alg_values_supported", func(r *http.Request) interface{} {
+		algorithms, err := s.SigningAlgorithms()
+		if err != nil {
+			return nil
+		}
+		return algorithms
+	})
+	s.SetMetadataFunc("backchannel_authentication_endpoint", func(r *http.Request) interface{} {
+		if s.BackChannelNotifier == nil {
+			return nil
+		}
+		return s.endpointURL(r, BackChannelAuthorizeEndpoint)
+	})
+	s.SetMetadataFunc("response_types_supported", func(r *http.Request) interface{} {
+		return s.supportedResponseTypes()
+	})
+	s.SetMetadataFunc("grant_types_supported", func(r *http.Request) interface{} {
+		return s.supportedGrantTypes()
+	})
+	s.SetMetadataFunc("subject_types_supported", func(r *http.Request) interface{} {
+		if len(s.PairwiseSubjectKey) == 0 {
+			return []SubjectType{SubjectTypePublic}
+		}
+		return []SubjectType{SubjectTypePublic, SubjectTypePairwise}
+	})
+	s.SetMetadata("id_token_encryption_alg_values_supported", []string{AlgorithmRSAOAEP, AlgorithmRSAOAEP256})
+	s.SetMetadata("id_token_encryption_enc_values_supported", []string{EncryptionA128CBCHS256, EncryptionA128GCM, EncryptionA256GCM})
+	s.SetMetadata("token_endpoint_auth_methods_supported", []string{"client_secret_basic", "none"})
+	s.SetMetadata("code_challenge_methods_supported", []CodeChallengeMethod{CodeChallengeMethodPlain, CodeChallengeMethodS256})
+}
+
+// supportedResponseTypes returns the enabled response types of the authorization endpoint.
+func (s *Server) supportedResponseTypes() []string {
+	var responseTypes []string
+	for responseType := range s.authorizeHandlers {
+		if responseType == ResponseTypeToken && s.DeprecatedFlows.DisableImplicit {
+			continue
+		}
+		responseTypes = append(responseTypes, string(responseType))
+	}
+	sort.Strings(responseTypes)
+	return responseTypes
+}
+
+// supportedGrantTypes returns the enabled grant types, including the implicit grant if its response type is
+// enabled.
+func (s *Server) supportedGrantTypes() []string {
+	var grantTypes []string
+	for grantType := range s.tokenHandlers {
+		switch {
+		case grantType == GrantTypePassword && s.DeprecatedFlows.DisablePassword,
+			grantType == GrantTypeCIBA && s.BackChannelNotifier == nil,
+			grantType == GrantTypeImpersonation && s.ImpersonationAuthorizer == nil:
+			continue
+		}
+		grantTypes = append(grantTypes, string(grantType))
+	}
+	for _, responseType := range s.supportedResponseTypes() {
+		if responseType == ResponseTypeToken {
+			grantTypes = append(grantTypes, "implicit")
+		}
+	}
+	sort.Strings(grantTypes)
+	return grantTypes
+}
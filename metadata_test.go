@@ -0,0 +1,80 @@
+package goauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	server := newTestHandler()
+	metadata := func() map[string]interface{} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "https://auth.example.com"+MetadataEndpoint, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Test failed, status %d", w.Code)
+		}
+		m := make(map[string]interface{})
+		err := json.NewDecoder(w.Body).Decode(&m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	// The default fields describe the enabled endpoints and grants
+	m := metadata()
+	if m["issuer"] != "https://auth.example.com" || m["token_endpoint"] != "https://auth.example.com/token" {
+		t.Errorf("Test failed, unexpected endpoints %v", m)
+	}
+	if _, ok := m["backchannel_authentication_endpoint"]; ok {
+		t.Error("Test failed, expected the disabled back-channel authentication endpoint to be omitted")
+	}
+	expected := []interface{}{"authorization_code", "client_credentials", "implicit", "password", "refresh_token", "urn:ietf:params:oauth:grant-type:device_code"}
+	if !reflect.DeepEqual(m["grant_types_supported"], expected) {
+		t.Errorf("Test failed, expected %v got %v", expected, m["grant_types_supported"])
+	}
+
+	// Fields can be added, overridden and removed
+	server.Issuer = "https://example.com/oauth"
+	server.DeprecatedFlows.DisableImplicit = true
+	server.AdvertiseEndpoint("custom_endpoint", "/custom")
+	server.SetMetadata("service_documentation", "https://example.com/docs")
+	server.SetMetadata("introspection_endpoint", nil)
+	m = metadata()
+	if m["issuer"] != "https://example.com/oauth" || m["custom_endpoint"] != "https://example.com/oauth/custom" || m["service_documentation"] != "https://example.com/docs" {
+		t.Errorf("Test failed, unexpected fields %v", m)
+	}
+	if _, ok := m["introspection_endpoint"]; ok {
+		t.Error("Test failed, expected the introspection endpoint to be removed")
+	}
+	if !reflect.DeepEqual(m["response_types_supported"], []interface{}{"code"}) {
+		t.Errorf("Test failed, expected the implicit grant to be omitted got %v", m["response_types_supported"])
+	}
+
+	// The metadata can be signed by the Signer
+	key, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Signer = &StaticSigner{Key: key}
+	server.SignedMetadata = true
+	m = metadata()
+	parts := strings.Split(m["signed_metadata"].(string), ".")
+	if len(parts) != 3 {
+		t.Fatalf("Test failed, malformed signed metadata %v", m["signed_metadata"])
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	json.Unmarshal(payload, &claims)
+	if claims["iss"] != "https://example.com/oauth" || claims["custom_endpoint"] != m["custom_endpoint"] || claims["jwks_uri"] != "https://example.com/oauth"+JWKSEndpoint {
+		t.Errorf("Test failed, unexpected claims %v", claims)
+	}
+}
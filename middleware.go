@@ -1,21 +1,58 @@
 package goauth
 
 import (
+	"context"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-func (s Server) Secure(requiredScope []string, handler http.HandlerFunc) http.HandlerFunc {
+// TokenExpiringHeader is set by Secure on responses to requests authenticated with a grant that expires
+// within the Server's TokenExpiryWarning. Its value is the number of seconds until the grant expires,
+// allowing clients to refresh proactively.
+const TokenExpiringHeader = "X-Token-Expiring"
+
+// allowMethods returns an http.HandlerFunc that calls the handler only for requests made with one of the
+// methods. Other requests receive a 405 Method Not Allowed response listing the methods in the Allow header.
+func (s *Server) allowMethods(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, method := range methods {
+			if r.Method == method {
+				handler(w, r)
+				return
+			}
+		}
+		w.Header().Set("Allow", allow)
+		s.ErrorHandler(w, ErrorMethodNotAllowed.StatusCode, ErrorMethodNotAllowed)
+	}
+}
+
+func (s *Server) Secure(requiredScope []string, handler http.HandlerFunc) http.HandlerFunc {
+	var secured http.HandlerFunc
 	switch DefaultTokenType {
 	case TokenTypeBearer:
-		return s.checkBearerAuth(s.SessionStore, requiredScope, handler)
+		secured = s.traced(SpanSecure, "", "", s.checkBearerAuth(s.SessionStore, requiredScope, handler))
 	case TokenTypeMac:
-		return s.checkMacAuth(s.SessionStore, requiredScope, handler)
+		secured = s.checkMacAuth(s.SessionStore, requiredScope, handler)
 	default:
 		return func(w http.ResponseWriter, r *http.Request) {
 			s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
 		}
 	}
+	// Secured handlers are served by the application rather than the Server, so assign the request ID here
+	return func(w http.ResponseWriter, r *http.Request) {
+		secured(w, withRequestID(w, r))
+	}
+}
+
+type grantKey struct{}
+
+// GrantFromContext returns the Grant that authenticated a request to a handler protected by Secure,
+// allowing the handler to audit the resource owner, client and any Actor of the grant.
+func GrantFromContext(ctx context.Context) (Grant, bool) {
+	grant, ok := ctx.Value(grantKey{}).(Grant)
+	return grant, ok
 }
 
 func GetBearerToken(r *http.Request) (Secret, error) {
@@ -35,18 +72,26 @@ func GetBearerToken(r *http.Request) (Secret, error) {
 }
 
 // checkBearerAuth returns an http.HandlerFunc that authenticates requests using the bearer token authorization.
-func (s Server) checkBearerAuth(sessionStore *SessionStore, requiredScope []string, handler http.HandlerFunc) http.HandlerFunc {
+func (s *Server) checkBearerAuth(sessionStore *SessionStore, requiredScope []string, handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		accessToken, err := GetBearerToken(r)
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
 			s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
 			return
 		}
-		grant, err := sessionStore.CheckGrant(accessToken)
+		grant, err := s.bindSessionStore(r, sessionStore).CheckGrant(accessToken)
 		if err != nil {
 			// If not present set status and return error
-			w.WriteHeader(http.StatusUnauthorized)
+			s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+			return
+		}
+		// If the token is bound then check that it is being used from the same context
+		if !s.checkBinding(r, grant) {
+			s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
+			return
+		}
+		// Check that the token is used from a network permitted for the client it was issued to
+		if s.EnforceClientNetworks && !s.allowGrantNetwork(r, grant) {
 			s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
 			return
 		}
@@ -55,19 +100,25 @@ func (s Server) checkBearerAuth(sessionStore *SessionStore, requiredScope []stri
 			err := grant.CheckScope(requiredScope)
 			if err != nil {
 				// If not present set status and return error
-				w.WriteHeader(http.StatusUnauthorized)
 				s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
 				return
 			}
 		}
+		// Warn the client if the grant is about to expire
+		if s.TokenExpiryWarning > 0 {
+			remaining := grant.TTL(timeNow())
+			if remaining <= s.TokenExpiryWarning {
+				w.Header().Set(TokenExpiringHeader, strconv.Itoa(int(remaining.Seconds())))
+			}
+		}
 		// Assuming all of the above checks have
 		// passed then call the handler.
-		handler(w, r)
+		handler(w, r.WithContext(context.WithValue(r.Context(), grantKey{}, grant)))
 	}
 }
 
 // checkMacAuth returns an http.HandlerFunc that is currently not implemented to accept mac token authentication. s
-func (s Server) checkMacAuth(sessionStore *SessionStore, requiredScope []string, handler http.HandlerFunc) http.HandlerFunc {
+func (s *Server) checkMacAuth(sessionStore *SessionStore, requiredScope []string, handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 	}
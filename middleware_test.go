@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestCheckInScopeTrue(t *testing.T) {
@@ -26,9 +27,14 @@ func TestCheckInScopeFalse(t *testing.T) {
 }
 
 func TestCheckAuth(t *testing.T) {
-	grant := Grant{AccessToken: "testtoken", Scope: []string{"testscope"}}
+	grant := Grant{AccessToken: "testtoken", Scope: []string{"testscope"}, CreatedAt: time.Now(), ExpiresIn: time.Hour}
 
 	handler := newTestHandler()
+	// Each Server has its own SessionStore, so the grant is stored in the handler's
+	err := handler.SessionStore.PutGrant(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Create the handler
 	middlewareHandler := handler.Secure([]string{"testscope"}, func(w http.ResponseWriter, r *http.Request) {
@@ -75,3 +81,66 @@ func TestCheckAuth(t *testing.T) {
 		},
 	})
 }
+
+func TestTokenExpiryWarning(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.TokenExpiryWarning = 5 * time.Minute
+	for _, grant := range []Grant{
+		{AccessToken: "expiring", ExpiresIn: time.Minute, CreatedAt: time.Now()},
+		{AccessToken: "valid", ExpiresIn: time.Hour, CreatedAt: time.Now()},
+	} {
+		err := server.SessionStore.PutGrant(grant)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := server.Secure(nil, func(w http.ResponseWriter, r *http.Request) {})
+
+	request := func(accessToken string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer "+accessToken)
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+	if h := request("expiring").Header().Get(TokenExpiringHeader); h != "59" && h != "60" {
+		t.Errorf("Test failed, expected the grant to expire in 60 seconds got %q", h)
+	}
+	if h := request("valid").Header().Get(TokenExpiringHeader); h != "" {
+		t.Errorf("Test failed, expected no header got %q", h)
+	}
+}
+
+func TestAllowMethods(t *testing.T) {
+	server := newTestHandler()
+	cases := []struct {
+		Method string
+		Path   string
+		Allow  string
+	}{
+		{"PUT", AuthorizeEnpoint, "GET, POST"},
+		{"DELETE", AuthorizeEnpoint, "GET, POST"},
+		{"GET", TokenEndpoint, "POST"},
+		{"GET", IntrospectionEndpoint, "POST"},
+		{"GET", BackChannelAuthorizeEndpoint, "POST"},
+		{"GET", DeviceAuthorizationEndpoint, "POST"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.Method, c.Path, nil)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Test failed, expected status 405 for %s %s got %d", c.Method, c.Path, w.Code)
+		}
+		if w.Header().Get("Allow") != c.Allow {
+			t.Errorf("Test failed, expected Allow %q for %s %s got %q", c.Allow, c.Method, c.Path, w.Header().Get("Allow"))
+		}
+	}
+	r := httptest.NewRequest("POST", TokenEndpoint, nil)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code == http.StatusMethodNotAllowed {
+		t.Error("Test failed, expected POST to be allowed")
+	}
+}
@@ -0,0 +1,57 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNamespaceUnsupported is returned by SessionStore.Namespace and SessionStore.PurgeNamespace if the
+	// SessionStoreBackend does not implement NamespacedSessionStoreBackend.
+	ErrNamespaceUnsupported = errors.New("session store does not support namespaces")
+)
+
+// NamespacedSessionStoreBackend may be implemented by a SessionStoreBackend shared by multiple Servers or
+// tenants to keep their records apart. Backends enforce the isolation themselves, such as by prefixing
+// Redis keys with the namespace or by adding a namespace column to the primary key of each SQL table, so
+// that a token issued in one namespace is never found in another.
+type NamespacedSessionStoreBackend interface {
+	SessionStoreBackend
+	// Namespace returns a backend holding the records of the namespace. Namespaces are not nested, calling
+	// Namespace on the backend of a namespace returns a sibling namespace. The empty namespace is the
+	// default namespace used by the backend itself.
+	Namespace(name string) (SessionStoreBackend, error)
+	// PurgeNamespace removes all records held in the namespace, returning the number removed. If onRemove
+	// is not nil it is called with each grant before it is removed, and an error returned by it stops the
+	// purge leaving the grant in place.
+	PurgeNamespace(ctx context.Context, name string, onRemove func(Grant) error) (int, error)
+}
+
+// Namespace returns a SessionStore whose records are kept apart from those of other namespaces of the same
+// backend. Servers sharing a backend should each use a different namespace:
+//
+//	server.SessionStore, err = goauth.NewSessionStore(backend).Namespace("tenant-a")
+//
+// It returns ErrNamespaceUnsupported if the backend does not implement NamespacedSessionStoreBackend.
+func (s *SessionStore) Namespace(name string) (*SessionStore, error) {
+	nb, ok := s.SessionStoreBackend.(NamespacedSessionStoreBackend)
+	if !ok {
+		return nil, ErrNamespaceUnsupported
+	}
+	backend, err := nb.Namespace(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewSessionStore(backend), nil
+}
+
+// PurgeNamespace removes all records held in the namespace, such as when a tenant is removed, returning the
+// number removed. It returns ErrNamespaceUnsupported if the backend does not implement
+// NamespacedSessionStoreBackend.
+func (s *SessionStore) PurgeNamespace(ctx context.Context, name string) (int, error) {
+	nb, ok := s.SessionStoreBackend.(NamespacedSessionStoreBackend)
+	if !ok {
+		return 0, ErrNamespaceUnsupported
+	}
+	return nb.PurgeNamespace(ctx, name, nil)
+}
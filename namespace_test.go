@@ -0,0 +1,84 @@
+package goauth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreNamespace(t *testing.T) {
+	backend := NewMemSessionStoreBackend()
+	shared := NewSessionStore(backend)
+	a, err := shared.Namespace("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := shared.Namespace("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant := Grant{AccessToken: "token", RefreshToken: "refresh", CreatedAt: time.Now(), ExpiresIn: time.Hour}
+	err = a.PutGrant(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.PutAuthorizationCode(AuthorizationCode{Code: "code", CreatedAt: time.Now(), ExpiresIn: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]*SessionStore{"b": b, "default": shared} {
+		if _, err := store.GetGrant("token"); err == nil {
+			t.Errorf("Test failed, expected the grant not to be found in namespace %s", name)
+		}
+		if _, err := store.RefreshGrant("refresh"); err == nil {
+			t.Errorf("Test failed, expected the refresh token not to be found in namespace %s", name)
+		}
+	}
+	// Namespaces are shared by all stores using the backend
+	again, err := b.Namespace("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := again.GetGrant("token"); err != nil {
+		t.Errorf("Test failed, expected the grant to be found, got %v", err)
+	}
+
+	n, err := shared.PurgeNamespace(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Test failed, expected 2 records to be purged, got %d", n)
+	}
+	if _, err := a.GetGrant("token"); err == nil {
+		t.Error("Test failed, expected the grant to have been purged")
+	}
+	if n, err := shared.PurgeNamespace(context.Background(), "unknown"); err != nil || n != 0 {
+		t.Errorf("Test failed, unexpected purge of unknown namespace %d %v", n, err)
+	}
+
+	_, err = NewSessionStore(struct{ SessionStoreBackend }{backend}).Namespace("a")
+	if err != ErrNamespaceUnsupported {
+		t.Errorf("Test failed, expected ErrNamespaceUnsupported, got %v", err)
+	}
+}
+
+func TestArchivingSessionStoreBackendPurgeNamespace(t *testing.T) {
+	archive := NewMemGrantArchive()
+	store := NewSessionStore(NewArchivingSessionStoreBackend(NewMemSessionStoreBackend(), archive))
+	tenant, err := store.Namespace("tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tenant.PutGrant(Grant{AccessToken: "token", CreatedAt: time.Now(), ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.PurgeNamespace(context.Background(), "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archive.FindArchivedGrant(HashToken("token")); err != nil {
+		t.Errorf("Test failed, expected the purged grant to be archived, got %v", err)
+	}
+}
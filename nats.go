@@ -0,0 +1,58 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// NATSPublisher publishes messages to NATS subjects. It is satisfied by *nats.Conn.
+type NATSPublisher interface {
+	Publish(subject string, data []byte) error
+}
+
+// NATSFlusher is implemented by a NATSPublisher that can wait for the server to process published
+// messages, such as *nats.Conn.
+type NATSFlusher interface {
+	Flush() error
+}
+
+// NATSEventPublisher is an EventBatchPublisher publishing each event as JSON to the subject formed by
+// the Subject prefix and the event type, for example goauth.events.token.issued. If the Conn implements
+// NATSFlusher, each batch is flushed so that it is retried if the server did not receive it.
+type NATSEventPublisher struct {
+	Conn    NATSPublisher
+	Subject string
+}
+
+// PublishBatch satisfies the EventBatchPublisher interface.
+func (n *NATSEventPublisher) PublishBatch(ctx context.Context, events []Event) error {
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		err = n.Conn.Publish(n.subject(e.Type), data)
+		if err != nil {
+			return err
+		}
+	}
+	if f, ok := n.Conn.(NATSFlusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+func (n *NATSEventPublisher) subject(t EventType) string {
+	if n.Subject == "" {
+		return string(t)
+	}
+	return n.Subject + "." + string(t)
+}
+
+// NewNATSEventSink returns a BatchingEventSink publishing events to subjects beginning with the subject.
+func NewNATSEventSink(conn NATSPublisher, subject string) *BatchingEventSink {
+	return NewBatchingEventSink(&NATSEventPublisher{
+		Conn:    conn,
+		Subject: subject,
+	})
+}
@@ -0,0 +1,37 @@
+package goauth
+
+import (
+	"context"
+	"testing"
+)
+
+// testNATSConn records published subjects.
+type testNATSConn struct {
+	subjects []string
+	flushed  int
+}
+
+func (t *testNATSConn) Publish(subject string, data []byte) error {
+	t.subjects = append(t.subjects, subject)
+	return nil
+}
+
+func (t *testNATSConn) Flush() error {
+	t.flushed++
+	return nil
+}
+
+func TestNATSEventPublisher(t *testing.T) {
+	conn := &testNATSConn{}
+	publisher := &NATSEventPublisher{Conn: conn, Subject: "goauth.events"}
+	err := publisher.PublishBatch(context.Background(), []Event{{Type: EventTokenIssued}, {Type: EventTokenRevoked}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.subjects) != 2 || conn.subjects[0] != "goauth.events.token.issued" || conn.subjects[1] != "goauth.events.token.revoked" {
+		t.Errorf("Test failed, unexpected subjects %v", conn.subjects)
+	}
+	if conn.flushed != 1 {
+		t.Errorf("Test failed, expected the batch to be flushed once got %d", conn.flushed)
+	}
+}
@@ -1,7 +1,11 @@
 package goauth
 
 import (
+	"io/fs"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 )
 
 const (
@@ -10,13 +14,209 @@ const (
 )
 
 type Server struct {
-	mux                  *http.ServeMux
-	SessionStore         *SessionStore
-	ErrorHandler         ErrorHandler
-	Authenticator        Authenticator
-	AuthorizationHandler func(client Client, scope []string, authErr error, actionURL string) http.Handler
-	authorizeHandlers    AuthorizeHandlers
-	tokenHandlers        TokenHandlers
+	mux           *http.ServeMux
+	SessionStore  *SessionStore
+	ErrorHandler  ErrorHandler
+	Authenticator Authenticator
+	// TokenSource generates the tokens issued by the Server unless its SessionStore sets its own
+	// TokenSource. New sets it to NewToken.
+	TokenSource TokenSource
+	// TokenExpiry is the lifetime of the grants created by the Server. New sets it to DefaultTokenExpiry.
+	TokenExpiry time.Duration
+	// AuthorizationCodeExpiry is the lifetime of the authorization codes issued by the Server. New sets it
+	// to DefaultAuthorizationCodeExpiry.
+	AuthorizationCodeExpiry time.Duration
+	// AuthorizationHandler renders the authorization UI for the AuthorizationRequest.
+	AuthorizationHandler func(req AuthorizationRequest) http.Handler
+	// Issuer is the absolute URL at which the Server is publicly reachable, including any path prefix it is
+	// mounted under by a reverse proxy, such as https://example.com/oauth. It is included as the iss of
+	// authorization responses and JWTs, and is used to build the URLs of the Server's endpoints, which
+	// are otherwise derived from the request.
+	Issuer string
+	// BackChannelNotifier triggers the out-of-band approval of back-channel authentication
+	// requests. Back-channel authentication is disabled if it is nil.
+	BackChannelNotifier BackChannelNotifier
+	// HTTPClient is used for requests made by the server, such as back-channel ping notifications.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// SessionAuthenticator maintains login sessions between authorization requests. If nil, the
+	// resource owner must authenticate on every request.
+	SessionAuthenticator SessionAuthenticator
+	// ConsentStore remembers the scope approved by resource owners for each client, so that a resource owner
+	// with a login session is not asked to approve it again. If nil, resource owners are asked to approve
+	// every request of a client that is not trusted.
+	ConsentStore ConsentStore
+	// UserCodeFormat defines how user codes are generated for the device authorization grant. If its
+	// Alphabet is empty, DefaultUserCodeFormat is used.
+	UserCodeFormat UserCodeFormat
+	// DeviceVerificationURI is the absolute URI of the device verification endpoint shown to resource
+	// owners. If empty, it is derived from the Issuer or the device authorization request.
+	DeviceVerificationURI string
+	// DeviceVerificationURIComplete returns the verification URI including the user code. By default the
+	// user code is added as a query parameter. Returning an empty string omits verification_uri_complete.
+	DeviceVerificationURIComplete func(verificationURI, userCode string) string
+	// DeviceVerificationHandler renders the page on which resource owners enter user codes and approve
+	// device authorization requests.
+	DeviceVerificationHandler func(userCode string, client Client, scope []string, approved bool, authErr error) http.Handler
+	// MaxUserCodeAttempts is the number of invalid user codes that may be entered from an address within the
+	// window of the FailureCounter before the device verification endpoint refuses further codes. Attempts
+	// are counted in memory if the FailureCounter is nil. If zero, DefaultMaxUserCodeAttempts is used.
+	MaxUserCodeAttempts int
+	// LoginFields are the names of the fields of the login forms. Names that are not set default to those
+	// of DefaultLoginFields.
+	LoginFields LoginFields
+	// ScopeParser parses the scope parameter of requests. If nil, DefaultScopeParser is used.
+	ScopeParser ScopeParser
+	// ErrorMessages translates the error descriptions shown on the authorization page and included in
+	// authorization error redirects according to the Accept-Language of the request. Token endpoint errors
+	// are intended for clients rather than people and are not translated.
+	ErrorMessages MessageCatalog
+	// OnInternalError is called with internal failures, such as storage or signing errors, before
+	// ErrorServerError is returned to the client in their place.
+	OnInternalError func(r *http.Request, err error)
+	// ErrorReporter receives a report including the stack trace and scrubbed request of each internal
+	// error, such as a SentryReporter.
+	ErrorReporter ErrorReporter
+	// RequireHTTPS rejects authorization, token, introspection, backchannel authentication and device
+	// authorization requests made over plaintext HTTP, other than direct connections over the loopback
+	// interface, and authorization requests with plaintext HTTP redirect URIs. Responses to HTTPS
+	// requests include a Strict-Transport-Security header. Set TrustedProxies if TLS is terminated by a
+	// reverse proxy.
+	RequireHTTPS bool
+	// HSTSMaxAge overrides DefaultHSTSMaxAge if greater than zero.
+	HSTSMaxAge time.Duration
+	// FrameAncestors are the sources, such as https://app.example.com or 'self', permitted to embed the
+	// authorization and device verification pages in a frame, as listed by the frame-ancestors directive of
+	// their Content-Security-Policy. If empty, the pages cannot be framed, preventing clickjacking as
+	// required by the OAuth 2.0 Security Best Current Practice.
+	FrameAncestors []string
+	// SecurityHeaders sets hardening headers on every response, including a Content-Security-Policy, a
+	// Referrer-Policy preventing authorization codes from leaking through the Referer header, and a
+	// Cache-Control suited to each endpoint. The headers are not set if it is nil.
+	SecurityHeaders *SecurityHeaders
+	// TrustedProxies are the networks of reverse proxies whose Forwarded and X-Forwarded-* headers are
+	// used to determine the client's IP address and the scheme and host of the request. See RealIP,
+	// RequestScheme and RequestHost.
+	TrustedProxies []*net.IPNet
+	// TokenBinding records the fingerprint of the issuing request on each Grant and causes Secure to
+	// reject access tokens presented from a different context.
+	TokenBinding bool
+	// EnforceClientNetworks causes Secure to reject access tokens presented from networks that the client
+	// they were issued to may not authenticate from. See NetworkRestrictedClient.
+	EnforceClientNetworks bool
+	// FingerprintMatcher overrides DefaultFingerprintMatcher if set.
+	FingerprintMatcher FingerprintMatcher
+	// TokenResponse adjusts token responses for client libraries expecting non-standard responses.
+	TokenResponse TokenResponseOptions
+	// TokenExpiryWarning is the period before a grant expires during which Secure sets the
+	// TokenExpiringHeader on responses. If zero, the header is never set.
+	TokenExpiryWarning time.Duration
+	// EmbeddedBrowserPolicy defines how authorization requests made from embedded browsers are treated.
+	EmbeddedBrowserPolicy EmbeddedBrowserPolicy
+	// EmbeddedBrowserDetector overrides DefaultEmbeddedBrowserDetector if set.
+	EmbeddedBrowserDetector EmbeddedBrowserDetector
+	// Assets overrides DefaultAssets, the file system served under DefaultAssetsPath, allowing the
+	// default authorization pages to be themed.
+	Assets fs.FS
+	// ScopeAuthorizer restricts the scope of grants to that permitted for the resource owner. If nil, the
+	// scope approved by the Client is granted.
+	ScopeAuthorizer ScopeAuthorizer
+	// ScopePolicy denies scope to all clients or limits the scope of individual clients, in addition to the
+	// scope approved by each Client. If nil, only the Client restricts scope.
+	ScopePolicy *ScopePolicy
+	// OfflineAccessScope overrides DefaultOfflineAccessScope if not empty.
+	OfflineAccessScope string
+	// StateCodec seals the parameters of authorization requests between the login and consent steps so that
+	// they cannot be modified by the user agent. If nil, the parameters are passed in the clear.
+	StateCodec *StateCodec
+	// UserStore manages resource owner accounts. The password reset and email verification endpoints
+	// are disabled if it is nil.
+	UserStore UserStore
+	// VerificationSender delivers password reset and email verification links to users.
+	VerificationSender VerificationSender
+	// AccountBaseURL is the absolute URL at which the Server is reachable, used to build the links sent by
+	// the VerificationSender. If empty, the Issuer is used. Password resets and email verification links
+	// are disabled if neither is set.
+	AccountBaseURL string
+	// MinPasswordLength is the minimum length of passwords set using the password reset flow. If zero,
+	// DefaultMinPasswordLength is used.
+	MinPasswordLength int
+	// PasswordResetHandler renders the pages on which users request and complete password resets.
+	PasswordResetHandler func(token string, sent, reset bool, authErr error) http.Handler
+	// EmailVerificationHandler renders the page on which users confirm and see the result of verifying
+	// an email address.
+	EmailVerificationHandler func(token string, verified bool, authErr error) http.Handler
+	// Tracer records spans for authorization, token, introspection, backchannel authentication, device
+	// authorization and Secure requests and the Authenticator and SessionStore calls made while serving
+	// them. Tracing is disabled if it is nil.
+	Tracer Tracer
+	// EventSink receives events describing issued and revoked grants and granted consent, such as a
+	// WebhookNotifier. Events are not published if it is nil.
+	EventSink EventSink
+	// RiskEvaluator is called before each grant is issued and may deny the request or require step-up
+	// authentication. If nil, all requests are allowed.
+	RiskEvaluator RiskEvaluator
+	// GeoResolver resolves the location of the IP address of each attempt by a resource owner to
+	// authenticate, which is passed to a ResourceOwnerAuthenticator in the AuthContext of the request.
+	GeoResolver GeoResolver
+	// FailureCounter records failed attempts by resource owners to authenticate, whose number is passed to a
+	// ResourceOwnerAuthenticator in the AuthContext of the request, such as a MemFailureCounter. Failures
+	// are not counted if it is nil.
+	FailureCounter FailureCounter
+	// Signer provides the keys used to sign tokens, which are published by the JWKS endpoint. The JWKS
+	// endpoint is disabled if it is nil.
+	Signer Signer
+	// GrantTypeErrors maps grant types without a handler to the Error returned by the token endpoint, such
+	// as for a custom grant type that has been withdrawn. Other grant types without a handler receive
+	// ErrorUnsupportedGrantType.
+	GrantTypeErrors map[GrantType]Error
+	// ImpersonationAuthorizer decides whether clients may impersonate resource owners using the
+	// impersonation grant. The grant is disabled if it is nil.
+	ImpersonationAuthorizer ImpersonationAuthorizer
+	// AuthorizationDetailsValidator validates the authorization_details of authorization and token
+	// requests. Requests containing authorization details are rejected if it is nil.
+	AuthorizationDetailsValidator AuthorizationDetailsValidator
+	// TokenFormats selects the format of access tokens issued for each resource, identified by the resource
+	// parameter of token requests. Resources that are not listed receive DefaultTokenFormat.
+	TokenFormats map[string]TokenFormat
+	// DeprecatedFlows disables the Implicit and Resource Owner Password Credentials Grants and reports
+	// their use. Both are enabled by default.
+	DeprecatedFlows DeprecatedFlowPolicy
+	// SignedMetadata includes the signed_metadata field in the metadata document, a JWT of the metadata
+	// signed by the Signer for clients that require authenticated configuration.
+	SignedMetadata bool
+	// ClaimsMapper adds claims to the access tokens issued as JWTs. Claims set by the Server, such as sub
+	// and exp, cannot be replaced.
+	ClaimsMapper ClaimsMapper
+	// GrantDecorator customises the grants created by the Server. If nil, grants are issued as created by
+	// NewGrant.
+	GrantDecorator GrantDecorator
+	// PairwiseSubjectKey is the secret used to derive pairwise subject identifiers for clients implementing
+	// PairwiseSubjectClient. Changing it changes the identifiers of all resource owners.
+	PairwiseSubjectKey []byte
+	// MaxRequestBodySize overrides DefaultMaxRequestBodySize if greater than zero.
+	MaxRequestBodySize int64
+	// MaxFormValues overrides DefaultMaxFormValues if greater than zero.
+	MaxFormValues int
+	// JSONTokenRequests accepts token requests with an application/json body, whose members are used as the
+	// parameters of the request. By default only application/x-www-form-urlencoded bodies are accepted.
+	JSONTokenRequests bool
+	// MultipartTokenRequests accepts token requests with a multipart/form-data body.
+	MultipartTokenRequests bool
+	authorizeHandlers      AuthorizeHandlers
+	tokenHandlers          TokenHandlers
+	lifecycle              lifecycle
+	jwks                   jwksDocument
+	hooks                  endpointHooks
+	routes                 map[string]http.Handler
+	healthMtx              sync.Mutex
+	healthChecks           map[string]HealthChecker
+	deprecatedFlows        deprecatedFlowCounter
+	metadata               metadataRegistry
+	formKeyOnce            sync.Once
+	randomFormKey          []byte
+	userCodeFailuresOnce   sync.Once
+	memUserCodeFailures    *MemFailureCounter
 }
 
 // Authenticator implements methods required to perform
@@ -34,16 +234,22 @@ type Authenticator interface {
 }
 
 // New creates a handler implementing the http.Handler interface.
-func New(a Authenticator) Server {
-
-	s := Server{
-		mux:                  http.NewServeMux(),
-		SessionStore:         DefaultSessionStore,
-		ErrorHandler:         DefaultErrorHandler,
-		tokenHandlers:        make(TokenHandlers),
-		authorizeHandlers:    make(AuthorizeHandlers),
-		AuthorizationHandler: DefaultAuthorizationHandler,
-		Authenticator:        a,
+func New(a Authenticator) *Server {
+
+	s := &Server{
+		mux:                       http.NewServeMux(),
+		SessionStore:              NewSessionStore(NewMemSessionStoreBackend()),
+		ErrorHandler:              DefaultErrorHandler,
+		TokenSource:               TokenSourceFunc(NewToken),
+		TokenExpiry:               DefaultTokenExpiry,
+		AuthorizationCodeExpiry:   DefaultAuthorizationCodeExpiry,
+		tokenHandlers:             make(TokenHandlers),
+		authorizeHandlers:         make(AuthorizeHandlers),
+		AuthorizationHandler:      DefaultAuthorizationHandler,
+		DeviceVerificationHandler: DefaultDeviceVerificationHandler,
+		PasswordResetHandler:      DefaultPasswordResetHandler,
+		EmailVerificationHandler:  DefaultEmailVerificationHandler,
+		Authenticator:             a,
 	}
 	// Add the Authorization Code Grant handlers
 	s.tokenHandlers.AddHandler(GrantTypeAuthorizationCode, s.handleAuthCodeTokenRequest)
@@ -58,17 +264,41 @@ func New(a Authenticator) Server {
 	// Add the Client Credentials Grant handler
 	s.tokenHandlers.AddHandler(GrantTypeClientCredentials, s.handleClientCredentialsGrant)
 
+	// Add the Client Initiated Backchannel Authentication handler
+	s.tokenHandlers.AddHandler(GrantTypeCIBA, s.handleBackChannelTokenRequest)
+
+	// Add the Device Authorization Grant handler
+	s.tokenHandlers.AddHandler(GrantTypeDeviceCode, s.handleDeviceCodeTokenRequest)
+
+	// Add the Refresh Token handler
+	s.tokenHandlers.AddHandler(GrantTypeRefreshToken, s.handleRefreshTokenGrant)
+
+	// Add the impersonation extension grant handler, it is disabled without an ImpersonationAuthorizer
+	s.tokenHandlers.AddHandler(GrantTypeImpersonation, s.handleImpersonationGrant)
+
+	// Describe the endpoints and grants in the metadata document
+	s.registerDefaultMetadata()
+
 	// Configure the authorize and token handlers against the router mux
-	s.mux.HandleFunc(AuthorizeEnpoint, s.authorizeHandler)
-	s.mux.HandleFunc(TokenEndpoint, s.tokenHandler)
+	s.handle(AuthorizeEnpoint, s.denyFraming(s.beforeHooks(AuthorizeEnpoint, s.requireHTTPS(s.allowMethods(s.traced(SpanAuthorize, AttributeResponseType, ParamResponseType, s.afterHooks(AuthorizeEnpoint, s.authorizeHandler)), "GET", "POST")))))
+	s.handle(TokenEndpoint, s.parseTokenRequestBody(s.beforeHooks(TokenEndpoint, s.requireHTTPS(s.allowMethods(s.traced(SpanToken, AttributeGrantType, ParamGrantType, s.afterHooks(TokenEndpoint, s.tokenHandler)), "POST")))))
+	s.handle(BackChannelAuthorizeEndpoint, s.beforeHooks(BackChannelAuthorizeEndpoint, s.requireHTTPS(s.allowMethods(s.traced(SpanBackChannelAuthorize, AttributeScope, ParamScope, s.afterHooks(BackChannelAuthorizeEndpoint, s.handleBackChannelAuthorize)), "POST"))))
+	s.handle(DeviceAuthorizationEndpoint, s.beforeHooks(DeviceAuthorizationEndpoint, s.requireHTTPS(s.allowMethods(s.traced(SpanDeviceAuthorization, AttributeScope, ParamScope, s.afterHooks(DeviceAuthorizationEndpoint, s.handleDeviceAuthorization)), "POST"))))
+	s.handle(IntrospectionEndpoint, s.beforeHooks(IntrospectionEndpoint, s.requireHTTPS(s.allowMethods(s.traced(SpanIntrospect, AttributeTokenTypeHint, ParamTokenTypeHint, s.afterHooks(IntrospectionEndpoint, s.handleIntrospection)), "POST"))))
+	s.handle(JWKSEndpoint, http.HandlerFunc(s.handleJWKS))
+	s.handle(MetadataEndpoint, s.allowMethods(s.handleMetadata, "GET"))
+	s.handle(DeviceVerificationEndpoint, s.denyFraming(s.beforeHooks(DeviceVerificationEndpoint, s.afterHooks(DeviceVerificationEndpoint, s.handleDeviceVerification))))
+	s.handle(PasswordResetEndpoint, s.beforeHooks(PasswordResetEndpoint, s.afterHooks(PasswordResetEndpoint, s.handlePasswordReset)))
+	s.handle(EmailVerificationEndpoint, http.HandlerFunc(s.handleEmailVerification))
+	s.handle(DefaultAssetsPath, http.HandlerFunc(s.assetsHandler))
 
 	// Return the handler
 	return s
 }
 
 // ServeHTTP implements the http.Handler interface.
-func (s Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.mux.ServeHTTP(w, r)
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.prepare(s.mux).ServeHTTP(w, r)
 }
 
 // TokenHandlers is a map of http.Handerfuncs indexed by GrantType.
@@ -82,13 +312,25 @@ func (t TokenHandlers) AddHandler(grantType GrantType, handler http.HandlerFunc)
 
 // tokenHandler is a http.HandlerFunc that can be used to satisfy token requests. If a handler is registered
 // against the requests grant type then it is used, else an error is returned in the response.
-func (s Server) tokenHandler(w http.ResponseWriter, r *http.Request) {
-	grantType := r.FormValue(ParamGrantType)
-	if handler, ok := s.tokenHandlers[GrantType(grantType)]; ok {
+func (s *Server) tokenHandler(w http.ResponseWriter, r *http.Request) {
+	grantType := GrantType(r.FormValue(ParamGrantType))
+	if handler, ok := s.tokenHandlers[grantType]; ok {
 		handler(w, r)
 		return
 	}
-	s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+	err := s.unsupportedGrantTypeError(grantType)
+	s.ErrorHandler(w, err.StatusCode, err)
+}
+
+// unsupportedGrantTypeError returns the Error for a token request with a grant type that has no handler.
+func (s *Server) unsupportedGrantTypeError(grantType GrantType) Error {
+	if grantType == "" {
+		return ErrorInvalidRequest
+	}
+	if err, ok := s.GrantTypeErrors[grantType]; ok {
+		return err
+	}
+	return ErrorUnsupportedGrantType
 }
 
 // AuthorizeHandlers is a map of http.Handerfuncs indexed by ResponseType.
@@ -100,7 +342,16 @@ func (a AuthorizeHandlers) AddHandler(responseType ResponseType, handler http.Ha
 	a[responseType] = handler
 }
 
-func (s Server) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+func (s *Server) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	r, ok := s.checkEmbeddedBrowser(w, r)
+	if !ok {
+		return
+	}
+	err := s.restoreFlow(r)
+	if err != nil {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
 	responseType := r.FormValue(ParamResponseType)
 	if handler, ok := s.authorizeHandlers[ResponseType(responseType)]; ok {
 		handler(w, r)
@@ -2,8 +2,12 @@ package goauth
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // testAuthenticator implements the Authenticator interface and
@@ -42,7 +46,7 @@ func (t *testAuthenticator) AuthorizeResourceOwner(username string, password Sec
 	return true, nil
 }
 
-func newTestHandler() Server {
+func newTestHandler() *Server {
 	return New(&testAuthenticator{
 		&testClient{
 			"testclientid",
@@ -50,6 +54,8 @@ func newTestHandler() Server {
 			"testusername",
 			"https://testuri.com",
 			[]string{"testscope"},
+			"",
+			false,
 		},
 		"testusername",
 		Secret("testpassword"),
@@ -66,3 +72,61 @@ func TestNew(t *testing.T) {
 	}
 
 }
+
+func TestServerConfiguration(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	if server.TokenExpiry != DefaultTokenExpiry || server.AuthorizationCodeExpiry != DefaultAuthorizationCodeExpiry {
+		t.Errorf("Test failed, unexpected configuration %+v", server)
+	}
+	server.TokenExpiry = time.Minute
+	server.AuthorizationCodeExpiry = time.Second
+	client := server.Authenticator.(*testAuthenticator).client
+	grant, err := server.NewGrant(client, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grant.ExpiresIn != time.Minute {
+		t.Errorf("Test failed, expected the grant to expire after a minute, got %v", grant.ExpiresIn)
+	}
+
+	session := LoginSession{Username: "testusername", AuthTime: timeNow()}
+	server.SessionAuthenticator = &testSessionAuthenticator{session: &session}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope", strings.NewReader("approve=true&consent_token="+server.consentToken(consentPurposeAuthorize, "testclientid", session)))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	server.ServeHTTP(w, r)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authCode, err := server.SessionStore.GetAuthorizationCode(Secret(location.Query().Get("code")))
+	if err != nil {
+		t.Fatalf("Test failed, expected an authorization code to be issued, got %d %s", w.Code, w.Body.String())
+	}
+	if authCode.ExpiresIn != time.Second {
+		t.Errorf("Test failed, expected the authorization code to expire after a second, got %v", authCode.ExpiresIn)
+	}
+
+	// Records created using the SessionStore of a request use the Server's expiries
+	bound := server.sessionStore(r)
+	grant, err = bound.NewGrant(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grant.ExpiresIn != time.Minute {
+		t.Errorf("Test failed, expected the grant to expire after a minute, got %v", grant.ExpiresIn)
+	}
+	authCode, err = bound.NewAuthorizationCode("testclientid", "https://testuri.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authCode.ExpiresIn != time.Second {
+		t.Errorf("Test failed, expected the authorization code to expire after a second, got %v", authCode.ExpiresIn)
+	}
+
+	// Servers do not share a SessionStore
+	if New(server.Authenticator).SessionStore == New(server.Authenticator).SessionStore {
+		t.Errorf("Test failed, expected each Server to have its own SessionStore")
+	}
+}
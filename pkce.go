@@ -0,0 +1,91 @@
+package goauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+)
+
+const (
+	// ParamCodeChallenge is the PKCE code challenge sent with authorization requests.
+	ParamCodeChallenge = "code_challenge"
+	// ParamCodeChallengeMethod is the method used to derive the PKCE code challenge.
+	ParamCodeChallengeMethod = "code_challenge_method"
+	// ParamCodeVerifier is the PKCE code verifier sent with token requests.
+	ParamCodeVerifier = "code_verifier"
+)
+
+// CodeChallengeMethod is the method used to derive a code challenge from a code verifier as defined by
+// Proof Key for Code Exchange (https://tools.ietf.org/html/rfc7636).
+type CodeChallengeMethod string
+
+const (
+	// CodeChallengeMethodPlain uses the code verifier as the code challenge.
+	CodeChallengeMethodPlain CodeChallengeMethod = "plain"
+	// CodeChallengeMethodS256 uses the base64url encoded SHA-256 hash of the code verifier as the code
+	// challenge.
+	CodeChallengeMethodS256 CodeChallengeMethod = "S256"
+)
+
+// PKCERequirer is implemented by a Client that declares whether it must use PKCE with the Authorization Code
+// Grant. Public clients must always use PKCE, whereas PKCE is optional for confidential clients that do not
+// implement PKCERequirer.
+type PKCERequirer interface {
+	Client
+	RequirePKCE() bool
+}
+
+// requiresPKCE returns true if the client must use PKCE.
+func requiresPKCE(client Client) bool {
+	if isPublicClient(client) {
+		return true
+	}
+	c, ok := client.(PKCERequirer)
+	return ok && c.RequirePKCE()
+}
+
+// parseCodeChallengeMethod returns the CodeChallengeMethod of an authorization request, defaulting to plain
+// as required by the specification. It returns ErrorInvalidRequest if the method is not supported.
+func parseCodeChallengeMethod(method string) (CodeChallengeMethod, error) {
+	switch CodeChallengeMethod(method) {
+	case "", CodeChallengeMethodPlain:
+		return CodeChallengeMethodPlain, nil
+	case CodeChallengeMethodS256:
+		return CodeChallengeMethodS256, nil
+	}
+	return "", ErrorInvalidRequest
+}
+
+// validCodeVerifier returns true if the code verifier is between 43 and 128 characters long and consists
+// of unreserved characters only.
+func validCodeVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CheckCodeVerifier returns true if the code verifier matches the code challenge of the AuthorizationCode.
+// Codes issued without a code challenge do not require a code verifier.
+func (a AuthorizationCode) CheckCodeVerifier(verifier string) bool {
+	if a.CodeChallenge == "" {
+		return verifier == ""
+	}
+	if !validCodeVerifier(verifier) {
+		return false
+	}
+	computed := verifier
+	if a.CodeChallengeMethod == CodeChallengeMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(a.CodeChallenge)) == 1
+}
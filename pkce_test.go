@@ -0,0 +1,106 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCheckCodeVerifier(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r-wW1gOWFkOjXk"
+	authCode := AuthorizationCode{
+		CodeChallenge:       "S0eYrId2ewB_22zgT40H9hqLMpvFhlsUekZoJ4MJ5MQ",
+		CodeChallengeMethod: CodeChallengeMethodS256,
+	}
+	if !authCode.CheckCodeVerifier(verifier) {
+		t.Error("Test failed, expected the S256 code verifier to match")
+	}
+	if authCode.CheckCodeVerifier(verifier[1:] + "x") {
+		t.Error("Test failed, expected a different code verifier not to match")
+	}
+	if (AuthorizationCode{CodeChallenge: verifier, CodeChallengeMethod: CodeChallengeMethodPlain}).CheckCodeVerifier(verifier) != true {
+		t.Error("Test failed, expected the plain code verifier to match")
+	}
+	if (AuthorizationCode{}).CheckCodeVerifier(verifier) {
+		t.Error("Test failed, expected a code verifier to be rejected for a code issued without a challenge")
+	}
+	if !(AuthorizationCode{}).CheckCodeVerifier("") {
+		t.Error("Test failed, expected no code verifier to be required for a code issued without a challenge")
+	}
+}
+
+func TestPublicClient(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.Authenticator.(*testAuthenticator).client.clientType = ClientTypePublic
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r-wW1gOWFkOjXk"
+	authorize := func(query string) *url.URL {
+		r := httptest.NewRequest("POST", AuthorizeEnpoint+"?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope"+query, strings.NewReader("username=testusername&password=testpassword"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != http.StatusFound {
+			t.Fatalf("Test failed, status %d", w.Code)
+		}
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return location
+	}
+	token := func(body string, basicAuth bool) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if basicAuth {
+			r.SetBasicAuth("testclientid", "testclientsecret")
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// Public clients must use PKCE
+	location := authorize("")
+	if location.Query().Get(ParamError) != ErrorInvalidRequest.Code {
+		t.Errorf("Test failed, expected invalid_request got %s", location)
+	}
+	// Unsupported code challenge methods are rejected
+	location = authorize("&code_challenge=S0eYrId2ewB_22zgT40H9hqLMpvFhlsUekZoJ4MJ5MQ&code_challenge_method=S512")
+	if location.Query().Get(ParamError) != ErrorInvalidRequest.Code {
+		t.Errorf("Test failed, expected invalid_request got %s", location)
+	}
+
+	location = authorize("&code_challenge=S0eYrId2ewB_22zgT40H9hqLMpvFhlsUekZoJ4MJ5MQ&code_challenge_method=S256")
+	code := location.Query().Get(ParamCode)
+	if code == "" {
+		t.Fatalf("Test failed, expected a code got %s", location)
+	}
+	exchange := "grant_type=authorization_code&client_id=testclientid&redirect_uri=https://testuri.com&code=" + code
+	// Public clients cannot authenticate using a secret
+	if w := token(exchange+"&code_verifier="+verifier, true); w.Code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected status 401 got %d", w.Code)
+	}
+	// The code verifier must match the code challenge
+	if w := token(exchange+"&code_verifier="+strings.Repeat("a", 43), false); w.Code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected status 401 got %d", w.Code)
+	}
+	if w := token(exchange+"&code_verifier="+verifier, false); w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected status 200 got %d: %s", w.Code, w.Body)
+	}
+
+	// Public clients cannot use the client credentials grant
+	if w := token("grant_type=client_credentials", true); w.Code != ErrorUnauthorizedClient.StatusCode {
+		t.Errorf("Test failed, expected status %d got %d", ErrorUnauthorizedClient.StatusCode, w.Code)
+	}
+
+	// Confidential clients must authenticate
+	server.Authenticator.(*testAuthenticator).client.clientType = ClientTypeConfidential
+	location = authorize("")
+	code = location.Query().Get(ParamCode)
+	if w := token("grant_type=authorization_code&client_id=testclientid&redirect_uri=https://testuri.com&code="+code, false); w.Code != http.StatusUnauthorized {
+		t.Errorf("Test failed, expected status 401 got %d", w.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	// Five bytes fit in a version 1 code at every level
+	for level := Low; level <= High; level++ {
+		c, err := Encode([]byte("HELLO"), level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Size != 21 {
+			t.Errorf("Test failed, expected a version 1 code but got size %v", c.Size)
+		}
+		// The top left finder pattern should always be present
+		if !c.Dark(0, 0) || c.Dark(1, 1) || !c.Dark(3, 3) || c.Dark(7, 7) {
+			t.Error("Test failed, expected a finder pattern in the top left corner")
+		}
+	}
+	_, err := Encode([]byte(strings.Repeat("x", 3000)), Low)
+	if err != ErrTooLong {
+		t.Errorf("Test failed, expected %v but got %v", ErrTooLong, err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	b, err := PNG("https://example.com/device?user_code=WDJB-MJHT", Medium, 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() > 300 || img.Bounds().Dx() != img.Bounds().Dy() {
+		t.Errorf("Test failed, got image bounds %v", img.Bounds())
+	}
+}
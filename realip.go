@@ -0,0 +1,193 @@
+package goauth
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseCIDRs parses a list of CIDR ranges, such as 10.0.0.0/8, for use as Server.TrustedProxies. Single
+// IP addresses are accepted and treated as a range containing only that address.
+func ParseCIDRs(cidrs ...string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, n)
+	}
+	return result, nil
+}
+
+// RealIP returns the IP address of the client that made the request. If the request was received from
+// one of the Server's TrustedProxies then the Forwarded or X-Forwarded-For headers are used to find the
+// first address that is not a trusted proxy. Otherwise the remote address of the connection is used.
+func (s *Server) RealIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !s.isTrustedProxy(remote) {
+		return remote
+	}
+	chain := forwardedFor(r)
+	if len(chain) > 0 {
+		return chain[s.clientHop(chain)]
+	}
+	return remote
+}
+
+// clientHop returns the index in the chain of forwarded addresses of the client, which is the first
+// address that is not a trusted proxy walking the chain from the closest proxy towards the client. The
+// trusted proxy that received the request from that address appended the corresponding forwarded values.
+func (s *Server) clientHop(chain []string) int {
+	for i := len(chain) - 1; i > 0; i-- {
+		if !s.isTrustedProxy(chain[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
+// RequestScheme returns the scheme, http or https, with which the client made the request. If the request
+// was received from one of the Server's TrustedProxies then the Forwarded or X-Forwarded-Proto headers
+// are used, otherwise it depends on whether the connection used TLS. It can be used to decide whether
+// cookies should be marked Secure.
+func (s *Server) RequestScheme(r *http.Request) string {
+	if s.fromTrustedProxy(r) {
+		proto := s.forwardedParam(r, "proto", "X-Forwarded-Proto")
+		if strings.EqualFold(proto, "https") || strings.EqualFold(proto, "http") {
+			return strings.ToLower(proto)
+		}
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// RequestHost returns the host the client made the request to. If the request was received from one of the
+// Server's TrustedProxies then the Forwarded or X-Forwarded-Host headers are used, otherwise the Host
+// header of the request.
+func (s *Server) RequestHost(r *http.Request) string {
+	if s.fromTrustedProxy(r) {
+		if host := s.forwardedParam(r, "host", "X-Forwarded-Host"); host != "" {
+			return host
+		}
+	}
+	return r.Host
+}
+
+// requestBaseURL returns the scheme and host with which the client made the request.
+func (s *Server) requestBaseURL(r *http.Request) string {
+	return s.RequestScheme(r) + "://" + s.RequestHost(r)
+}
+
+// fromTrustedProxy returns true if the request was received from one of the Server's TrustedProxies.
+func (s *Server) fromTrustedProxy(r *http.Request) bool {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	return s.isTrustedProxy(remote)
+}
+
+// forwardedParam returns the parameter of the Forwarded header, or the X-Forwarded header if there is no
+// Forwarded header. Proxies append their values, so those to the left may have been set by the client.
+// The values are walked from the closest proxy as for RealIP, and the value appended by the trusted proxy
+// that received the request from the client is used. If that proxy appended no value it returns "".
+func (s *Server) forwardedParam(r *http.Request, param, header string) string {
+	if elements := forwardedElements(r); len(elements) > 0 {
+		chain := make([]string, len(elements))
+		for i, element := range elements {
+			chain[i] = cleanForwardedAddr(element["for"])
+		}
+		return strings.Trim(elements[s.clientHop(chain)][param], `"`)
+	}
+	var values []string
+	for _, value := range r.Header.Values(header) {
+		values = append(values, strings.Split(value, ",")...)
+	}
+	// Each proxy appends one value, so the client's proxy appended the value as far from the end as the
+	// client is from the end of the X-Forwarded-For chain
+	offset := 0
+	if chain := forwardedFor(r); len(chain) > 0 {
+		offset = len(chain) - 1 - s.clientHop(chain)
+	}
+	if offset >= len(values) {
+		return ""
+	}
+	return strings.TrimSpace(values[len(values)-1-offset])
+}
+
+// isTrustedProxy returns true if ip belongs to one of the Server's TrustedProxies.
+func (s *Server) isTrustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range s.TrustedProxies {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedElements returns the parameters of each element of the Forwarded header, ordered from the
+// client to the closest proxy, keyed by their lower case names.
+func forwardedElements(r *http.Request) []map[string]string {
+	var elements []map[string]string
+	forwarded := r.Header.Values("Forwarded")
+	if len(forwarded) == 0 {
+		return nil
+	}
+	for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+		params := make(map[string]string)
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) == 2 {
+				params[strings.ToLower(kv[0])] = kv[1]
+			}
+		}
+		elements = append(elements, params)
+	}
+	return elements
+}
+
+// forwardedFor returns the addresses the request was forwarded for, ordered from the client to the
+// closest proxy. The standard Forwarded header takes precedence over X-Forwarded-For.
+func forwardedFor(r *http.Request) []string {
+	var chain []string
+	if elements := forwardedElements(r); len(elements) > 0 {
+		for _, element := range elements {
+			if addr, ok := element["for"]; ok {
+				chain = append(chain, cleanForwardedAddr(addr))
+			}
+		}
+		return chain
+	}
+	for _, xff := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(xff, ",") {
+			chain = append(chain, cleanForwardedAddr(addr))
+		}
+	}
+	return chain
+}
+
+// cleanForwardedAddr strips quotes, brackets and ports from a forwarded address.
+func cleanForwardedAddr(addr string) string {
+	addr = strings.Trim(strings.TrimSpace(addr), `"`)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
@@ -0,0 +1,88 @@
+package goauth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	server := newTestHandler()
+	proxies, err := ParseCIDRs("10.0.0.0/8", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TrustedProxies = proxies
+
+	for _, tc := range []struct {
+		remoteAddr string
+		header     string
+		value      string
+		expected   string
+	}{
+		// Headers from untrusted peers are ignored
+		{"203.0.113.5:1234", "X-Forwarded-For", "198.51.100.1", "203.0.113.5"},
+		// The first untrusted address from the right is the client
+		{"10.0.0.1:1234", "X-Forwarded-For", "198.51.100.7, 203.0.113.9, 10.1.1.1", "203.0.113.9"},
+		{"192.0.2.1:1234", "X-Forwarded-For", "198.51.100.7", "198.51.100.7"},
+		{"10.0.0.1:1234", "Forwarded", `for=198.51.100.7;proto=https, for="[2001:db8::1]:4711"`, "2001:db8::1"},
+		// If every address is trusted the furthest is used
+		{"10.0.0.1:1234", "X-Forwarded-For", "10.2.2.2", "10.2.2.2"},
+		{"10.0.0.1:1234", "", "", "10.0.0.1"},
+	} {
+		r, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = tc.remoteAddr
+		if tc.header != "" {
+			r.Header.Set(tc.header, tc.value)
+		}
+		if ip := server.RealIP(r); ip != tc.expected {
+			t.Errorf("Test failed, expected %s but got %s", tc.expected, ip)
+		}
+	}
+}
+
+func TestRequestSchemeAndHost(t *testing.T) {
+	server := newTestHandler()
+	proxies, err := ParseCIDRs("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.TrustedProxies = proxies
+
+	for _, tc := range []struct {
+		remoteAddr string
+		headers    map[string]string
+		scheme     string
+		host       string
+	}{
+		// Headers from untrusted peers are ignored
+		{"203.0.113.5:1234", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "auth.example.com"}, "http", "internal:8080"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-Proto": "https", "X-Forwarded-Host": "auth.example.com"}, "https", "auth.example.com"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-Proto": "HTTPS"}, "https", "internal:8080"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for=198.51.100.7;proto=https;host="auth.example.com"`}, "https", "auth.example.com"},
+		// Values set by the client before those appended by the proxy are ignored
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "evil.example.com, auth.example.com"}, "http", "auth.example.com"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `host=evil.example.com;proto=https, for=198.51.100.7;proto=http;host=auth.example.com`}, "http", "auth.example.com"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for=198.51.100.7;host=evil.example.com, for=203.0.113.9`}, "http", "internal:8080"},
+		// Values appended by each trusted proxy are walked to the one that received the request from the client
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.2", "X-Forwarded-Host": "evil.example.com, auth.example.com, internal"}, "http", "auth.example.com"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for=203.0.113.9;host=evil.example.com, for=198.51.100.7;host=auth.example.com;proto=https, for=10.0.0.2;host=internal`}, "https", "auth.example.com"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.2", "X-Forwarded-Host": "auth.example.com"}, "http", "internal:8080"},
+		// Unknown schemes are ignored
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-Proto": "ftp"}, "http", "internal:8080"},
+	} {
+		r, err := http.NewRequest("GET", "http://internal:8080/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.RemoteAddr = tc.remoteAddr
+		for k, v := range tc.headers {
+			r.Header.Set(k, v)
+		}
+		if scheme, host := server.RequestScheme(r), server.RequestHost(r); scheme != tc.scheme || host != tc.host {
+			t.Errorf("Test failed, expected %s://%s but got %s://%s", tc.scheme, tc.host, scheme, host)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package goauth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// PanicError is the error reported to OnInternalError and the ErrorReporter when a panic is recovered
+// while serving a request, for example from an Authenticator, Client or SessionStoreBackend.
+type PanicError struct {
+	Value interface{}
+}
+
+func (p PanicError) Error() string {
+	return fmt.Sprintf("goauth: panic serving request: %v", p.Value)
+}
+
+// recoverPanic must be deferred by handlers. It converts a panic into a server_error response, reporting
+// the panic as an internal error. http.ErrAbortHandler is re-panicked so that the connection is aborted.
+func (s *Server) recoverPanic(w http.ResponseWriter, r *http.Request) {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if v == http.ErrAbortHandler {
+		panic(v)
+	}
+	s.internalError(w, r, PanicError{v})
+}
@@ -0,0 +1,185 @@
+package goauth
+
+import (
+	"net/http"
+	"time"
+)
+
+// RefreshTokenPolicy defines how refresh tokens are rotated when they are used.
+type RefreshTokenPolicy struct {
+	// Reuse allows a refresh token to be used multiple times. Each refresh issues a new access token
+	// while the refresh token stays the same. If false, refresh tokens are single use and each refresh
+	// issues a new refresh token.
+	Reuse bool
+	// GracePeriod is the period after a single use refresh token has been rotated during which it is still
+	// accepted, returning the same new grant. It allows clients that retry or refresh concurrently to
+	// recover without being logged out. If zero, a rotated refresh token is rejected immediately.
+	GracePeriod time.Duration
+	// ForbidScope rejects refresh requests that include the scope parameter, so that the scope of a grant
+	// cannot be narrowed on refresh.
+	ForbidScope bool
+}
+
+// RefreshTokenPolicyClient is implemented by a Client that defines its own RefreshTokenPolicy.
+type RefreshTokenPolicyClient interface {
+	Client
+	RefreshTokenPolicy() RefreshTokenPolicy
+}
+
+var (
+	// DefaultRefreshTokenPolicy is used for clients that do not implement RefreshTokenPolicyClient. By
+	// default refresh tokens are single use without a grace period.
+	DefaultRefreshTokenPolicy = RefreshTokenPolicy{}
+	// DefaultOfflineAccessScope is the scope that must be granted for the Authorization Code Grant to issue
+	// a refresh token, as per https://openid.net/specs/openid-connect-core-1_0.html#OfflineAccess. If
+	// empty, refresh tokens are issued whenever the client creates one.
+	DefaultOfflineAccessScope = "offline_access"
+)
+
+// offlineAccess checks whether the scope grants offline access, allowing a refresh token to be issued by
+// the Authorization Code Grant.
+func (s *Server) offlineAccess(scope []string) bool {
+	offlineScope := s.OfflineAccessScope
+	if offlineScope == "" {
+		offlineScope = DefaultOfflineAccessScope
+	}
+	return offlineScope == "" || checkInScope(offlineScope, scope)
+}
+
+// refreshTokenPolicy returns the RefreshTokenPolicy of the client.
+func refreshTokenPolicy(client Client) RefreshTokenPolicy {
+	if c, ok := client.(RefreshTokenPolicyClient); ok {
+		return c.RefreshTokenPolicy()
+	}
+	return DefaultRefreshTokenPolicy
+}
+
+func (s *Server) handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request) {
+	// Check that the request is using the correct grant type
+	if r.PostFormValue(ParamGrantType) != GrantTypeRefreshToken {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	// Authorize confidential clients using basic auth, public clients are identified by the client_id
+	clientID, client, err := s.authenticateClient(r)
+	if err != nil {
+		s.ErrorHandler(w, http.StatusUnauthorized, err)
+		return
+	}
+	// Check that the client is allowed for this grant type
+	if !client.AllowStrategy(StrategyRefreshToken) {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
+		return
+	}
+	refreshToken := Secret(r.PostFormValue(ParamRefreshToken))
+	if refreshToken == "" {
+		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+		return
+	}
+	grant, err := s.sessionStore(r).RefreshGrant(refreshToken)
+	if err != nil || grant.ClientID != clientID || grant.refreshTokenExpired() {
+		s.ErrorHandler(w, ErrorInvalidGrant.StatusCode, ErrorInvalidGrant)
+		return
+	}
+	policy := refreshTokenPolicy(client)
+	if grant.ReplacedBy != "" {
+		// The refresh token has already been rotated, retries within the grace period receive the same grant
+		if !grant.ReplacedAt.Add(policy.GracePeriod).After(timeNow()) {
+			if s.sessionStore(r).DeleteGrant(grant.AccessToken) == nil {
+				s.publishGrantEvent(r, EventTokenRevoked, grant)
+			}
+			s.ErrorHandler(w, ErrorInvalidGrant.StatusCode, ErrorInvalidGrant)
+			return
+		}
+		replacement, err := s.sessionStore(r).GetGrant(grant.ReplacedBy)
+		if err != nil {
+			s.ErrorHandler(w, ErrorInvalidGrant.StatusCode, ErrorInvalidGrant)
+			return
+		}
+		err = s.writeGrant(w, r, replacement)
+		if err != nil {
+			s.internalError(w, r, err)
+		}
+		return
+	}
+	scope, err := s.refreshScope(r, policy, grant)
+	if err != nil {
+		s.ErrorHandler(w, ErrorInvalidScope.StatusCode, err)
+		return
+	}
+	// Check that the risk of issuing the grant is acceptable
+	e, ok := s.evaluateRisk(r, RiskContext{
+		ClientID:  clientID,
+		Client:    client,
+		Username:  grant.Username,
+		GrantType: GrantTypeRefreshToken,
+		Scope:     scope,
+	})
+	if !ok {
+		s.ErrorHandler(w, e.StatusCode, e)
+		return
+	}
+	refreshed, err := s.createGrant(r, client, grant.Username, scope)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// The refreshed grant always has the final scope so that it is echoed in the response, while its refresh
+	// token keeps the scope originally granted
+	refreshed.Scope = scope
+	if len(scope) != len(grant.refreshScope()) {
+		refreshed.RefreshScope = grant.refreshScope()
+	}
+	if policy.Reuse {
+		refreshed.RefreshToken = grant.RefreshToken
+		refreshed.RefreshExpiresAt = grant.RefreshExpiresAt
+	}
+	refreshed.AuthorizationDetails = grant.AuthorizationDetails
+	refreshed.AuthTime = grant.AuthTime
+	err = s.issueGrant(r, clientID, client, grant.Username, &refreshed)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	// Replace the previous grant, keeping it for the grace period if its refresh token is rotated. Only one
+	// of any concurrent requests using the refresh token succeeds.
+	grant, err = s.sessionStore(r).RotateGrant(grant, refreshed, policy.GracePeriod)
+	if err == ErrGrantRotated {
+		s.ErrorHandler(w, ErrorInvalidGrant.StatusCode, ErrorInvalidGrant)
+		return
+	}
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	s.publishGrantEvent(r, EventTokenRevoked, grant)
+	s.publishGrantEvent(r, EventTokenRefreshed, refreshed)
+	// Write the grant to the http response
+	err = s.writeGrant(w, r, refreshed)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+}
+
+// refreshScope returns the scope of the grant issued by a refresh request. If the request includes the
+// scope parameter it must be a subset of the scope originally granted, otherwise the scope originally
+// granted is restored as per RFC 6749 section 6, even if the grant being refreshed was narrowed.
+func (s *Server) refreshScope(r *http.Request, policy RefreshTokenPolicy, grant Grant) ([]string, error) {
+	if _, ok := r.PostForm[ParamScope]; !ok {
+		return grant.refreshScope(), nil
+	}
+	if policy.ForbidScope {
+		return nil, ErrorInvalidScope.WithDetail("The scope parameter is not permitted when refreshing a grant issued to this client.")
+	}
+	requested := s.parseScope(r.PostFormValue(ParamScope))
+	if len(requested) == 0 {
+		return grant.refreshScope(), nil
+	}
+	for _, scope := range requested {
+		if !checkInScope(scope, grant.refreshScope()) {
+			return nil, ErrorInvalidScope.WithDetail("The requested scope exceeds the scope originally granted by the resource owner: " + scope)
+		}
+	}
+	return requested, nil
+}
@@ -0,0 +1,327 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRefreshClient is a testClient issuing unique tokens with a configurable RefreshTokenPolicy and
+// TokenPolicy.
+type testRefreshClient struct {
+	*testClient
+	policy RefreshTokenPolicy
+	tokens TokenPolicy
+}
+
+// RefreshTokenPolicy satisfies the RefreshTokenPolicyClient interface.
+func (t *testRefreshClient) RefreshTokenPolicy() RefreshTokenPolicy {
+	return t.policy
+}
+
+// TokenPolicy satisfies the TokenPolicyProvider interface.
+func (t *testRefreshClient) TokenPolicy() TokenPolicy {
+	return t.tokens
+}
+
+// testRefreshAuthenticator returns a testRefreshClient.
+type testRefreshAuthenticator struct {
+	*testAuthenticator
+	client *testRefreshClient
+}
+
+func (t *testRefreshAuthenticator) GetClient(clientID string) (Client, error) {
+	if _, err := t.testAuthenticator.GetClient(clientID); err != nil {
+		return nil, err
+	}
+	return t.client, nil
+}
+
+func (t *testRefreshAuthenticator) GetClientWithSecret(clientID string, clientSecret Secret) (Client, error) {
+	if _, err := t.testAuthenticator.GetClientWithSecret(clientID, clientSecret); err != nil {
+		return nil, err
+	}
+	return t.client, nil
+}
+
+func TestRefreshTokenGrant(t *testing.T) {
+	server := newTestHandler()
+	client := &testRefreshClient{testClient: server.Authenticator.(*testAuthenticator).client}
+	server.Authenticator = &testRefreshAuthenticator{server.Authenticator.(*testAuthenticator), client}
+
+	refresh := func(refreshToken string) (int, map[string]interface{}) {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=refresh_token&refresh_token="+refreshToken))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		resp := make(map[string]interface{})
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+	issue := func() {
+		server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+		err := server.SessionStore.PutGrant(Grant{
+			AccessToken:  "access",
+			RefreshToken: "refresh",
+			ExpiresIn:    time.Hour,
+			Scope:        []string{"testscope"},
+			CreatedAt:    time.Now(),
+			ClientID:     "testclientid",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Single use refresh tokens are rotated and cannot be used again
+	issue()
+	code, resp := refresh("refresh")
+	if code != http.StatusOK || resp["refresh_token"] == "refresh" || resp["access_token"] == "access" {
+		t.Fatalf("Test failed, got %d %v", code, resp)
+	}
+	if _, err := server.SessionStore.CheckGrant("access"); err == nil {
+		t.Error("Test failed, expected the previous access token to be revoked")
+	}
+	if code, _ := refresh("refresh"); code != ErrorInvalidGrant.StatusCode {
+		t.Errorf("Test failed, expected status %d got %d", ErrorInvalidGrant.StatusCode, code)
+	}
+	if code, _ := refresh(resp["refresh_token"].(string)); code != http.StatusOK {
+		t.Errorf("Test failed, expected the new refresh token to be accepted got %d", code)
+	}
+
+	// Within the grace period the previous refresh token returns the same grant
+	client.policy = RefreshTokenPolicy{GracePeriod: time.Minute}
+	issue()
+	_, first := refresh("refresh")
+	code, retry := refresh("refresh")
+	if code != http.StatusOK || retry["access_token"] != first["access_token"] || retry["refresh_token"] != first["refresh_token"] {
+		t.Errorf("Test failed, expected the same grant got %v and %v", first, retry)
+	}
+	if _, err := server.SessionStore.CheckGrant("access"); err == nil {
+		t.Error("Test failed, expected the previous access token to be revoked")
+	}
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	code, _ = refresh("refresh")
+	timeNow = time.Now
+	if code != ErrorInvalidGrant.StatusCode {
+		t.Errorf("Test failed, expected status %d after the grace period got %d", ErrorInvalidGrant.StatusCode, code)
+	}
+
+	// Multi use refresh tokens keep the same refresh token
+	client.policy = RefreshTokenPolicy{Reuse: true}
+	issue()
+	for i := 0; i < 2; i++ {
+		code, resp := refresh("refresh")
+		if code != http.StatusOK || resp["refresh_token"] != "refresh" {
+			t.Errorf("Test failed, got %d %v", code, resp)
+		}
+	}
+}
+
+func TestRefreshTokenDownScoping(t *testing.T) {
+	server := newTestHandler()
+	client := &testRefreshClient{testClient: server.Authenticator.(*testAuthenticator).client}
+	server.Authenticator = &testRefreshAuthenticator{server.Authenticator.(*testAuthenticator), client}
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	err := server.SessionStore.PutGrant(Grant{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresIn:    time.Hour,
+		Scope:        []string{"read", "write"},
+		CreatedAt:    time.Now(),
+		ClientID:     "testclientid",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refresh := func(body string) (int, map[string]interface{}) {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=refresh_token&"+body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		resp := make(map[string]interface{})
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	// Scope beyond that originally granted is rejected
+	code, resp := refresh("refresh_token=refresh&scope=read+admin")
+	if code != ErrorInvalidScope.StatusCode || resp["code"] != ErrorInvalidScope.Code {
+		t.Fatalf("Test failed, got %d %v", code, resp)
+	}
+
+	// A subset of the scope narrows the access token and is echoed in the response
+	code, resp = refresh("refresh_token=refresh&scope=read")
+	if code != http.StatusOK || resp["scope"] != "read" {
+		t.Fatalf("Test failed, got %d %v", code, resp)
+	}
+
+	// The refresh token keeps the scope originally granted
+	code, resp = refresh("refresh_token=" + resp["refresh_token"].(string) + "&scope=write")
+	if code != http.StatusOK || resp["scope"] != "write" {
+		t.Fatalf("Test failed, got %d %v", code, resp)
+	}
+
+	// Omitting the scope restores the scope originally granted
+	code, resp = refresh("refresh_token=" + resp["refresh_token"].(string))
+	if code != http.StatusOK || resp["scope"] != "read write" {
+		t.Fatalf("Test failed, got %d %v", code, resp)
+	}
+	code, resp = refresh("refresh_token=" + resp["refresh_token"].(string) + "&scope=read")
+	if code != http.StatusOK || resp["scope"] != "read" {
+		t.Fatalf("Test failed, got %d %v", code, resp)
+	}
+	code, resp = refresh("refresh_token=" + resp["refresh_token"].(string) + "&scope=")
+	if code != http.StatusOK || resp["scope"] != "read write" {
+		t.Fatalf("Test failed, got %d %v", code, resp)
+	}
+
+	// The scope parameter can be forbidden by the client's policy
+	client.policy = RefreshTokenPolicy{ForbidScope: true}
+	code, resp = refresh("refresh_token=" + resp["refresh_token"].(string) + "&scope=write")
+	if code != ErrorInvalidScope.StatusCode || resp["code"] != ErrorInvalidScope.Code {
+		t.Errorf("Test failed, got %d %v", code, resp)
+	}
+}
+
+func TestOfflineAccess(t *testing.T) {
+	server := New(&testAuthenticator{
+		&testClient{"testclientid", "testclientsecret", "testusername", "https://testuri.com", []string{"testscope", "offline_access", "refresh"}, "", true},
+		"testusername",
+		Secret("testpassword"),
+	})
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.SessionAuthenticator = &testSessionAuthenticator{&LoginSession{Username: "testusername", AuthTime: time.Now()}}
+
+	exchange := func(scope string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope="+scope, nil))
+		uri, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=authorization_code&redirect_uri=https://testuri.com&code="+uri.Query().Get("code")))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if resp["access_token"] == nil {
+			t.Fatalf("Test failed, expected a grant got %v", resp)
+		}
+		return resp
+	}
+
+	if resp := exchange("testscope"); resp["refresh_token"] != nil {
+		t.Errorf("Test failed, expected no refresh token without offline access got %v", resp)
+	}
+	if resp := exchange("testscope+offline_access"); resp["refresh_token"] == nil {
+		t.Errorf("Test failed, expected a refresh token with offline access got %v", resp)
+	}
+	server.OfflineAccessScope = "refresh"
+	if resp := exchange("testscope+offline_access"); resp["refresh_token"] != nil {
+		t.Errorf("Test failed, expected no refresh token without the configured scope got %v", resp)
+	}
+	if resp := exchange("refresh"); resp["refresh_token"] == nil {
+		t.Errorf("Test failed, expected a refresh token with the configured scope got %v", resp)
+	}
+}
+
+func TestRefreshTokenIssuancePolicy(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	client := &testRefreshClient{testClient: server.Authenticator.(*testAuthenticator).client}
+	server.Authenticator = &testRefreshAuthenticator{server.Authenticator.(*testAuthenticator), client}
+
+	token := func(body string) (int, map[string]interface{}) {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		resp := make(map[string]interface{})
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+	password := "grant_type=password&username=testusername&password=testpassword&scope=testscope"
+
+	// Clients that opt out never receive refresh tokens, even though they create them
+	client.tokens = TokenPolicy{NoRefreshTokens: true}
+	if code, resp := token(password); code != http.StatusOK || resp["refresh_token"] != nil {
+		t.Errorf("Test failed, expected no refresh token got %d %v", code, resp)
+	}
+
+	// Short-lived refresh tokens expire but rotation renews their lifetime
+	client.tokens = TokenPolicy{RefreshTokenLifetime: time.Minute}
+	_, resp := token(password)
+	refreshToken, _ := resp["refresh_token"].(string)
+	grant, err := server.SessionStore.RefreshGrant(Secret(refreshToken))
+	if err != nil || grant.RefreshExpiresAt.IsZero() {
+		t.Fatalf("Test failed, expected the refresh token to expire got %v %v", grant, err)
+	}
+	code, resp := token("grant_type=refresh_token&refresh_token=" + refreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("Test failed, got %d %v", code, resp)
+	}
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	defer func() { timeNow = time.Now }()
+	if code, _ := token("grant_type=refresh_token&refresh_token=" + resp["refresh_token"].(string)); code != ErrorInvalidGrant.StatusCode {
+		t.Errorf("Test failed, expected the expired refresh token to be rejected got %d", code)
+	}
+}
+
+func TestConcurrentRefresh(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	client := &testRefreshClient{testClient: server.Authenticator.(*testAuthenticator).client}
+	server.Authenticator = &testRefreshAuthenticator{server.Authenticator.(*testAuthenticator), client}
+	err := server.SessionStore.PutGrant(Grant{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresIn:    time.Hour,
+		Scope:        []string{"testscope"},
+		CreatedAt:    time.Now(),
+		ClientID:     "testclientid",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only one of the concurrent requests using the refresh token receives a new grant
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=refresh_token&refresh_token=refresh"))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.SetBasicAuth("testclientid", "testclientsecret")
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	var succeeded int
+	for code := range codes {
+		if code == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("Test failed, expected one refresh to succeed got %d", succeeded)
+	}
+	if stats, _ := server.Stats(); stats.Grants != 1 {
+		t.Errorf("Test failed, expected a single valid grant got %d", stats.Grants)
+	}
+}
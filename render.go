@@ -0,0 +1,173 @@
+package goauth
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"sync"
+)
+
+const (
+	// ViewAuthorize is the name of the view rendered by the authorization endpoint. It receives the
+	// Request, Client, ClientID, ClientMetadata, Trusted, Scope, AuthorizationDetails, ActionURL, Error,
+	// EmbeddedBrowser, LoginHint, LoginFields and AssetsPath values.
+	ViewAuthorize = "authorize"
+	// ViewDeviceVerification is the name of the view rendered by the device verification endpoint. It
+	// receives the UserCode, Client, Scope, Approved, Error, LoginFields and AssetsPath values.
+	ViewDeviceVerification = "device"
+	// ViewPasswordReset is the name of the view rendered by the password reset endpoint. It receives the
+	// Token, Sent, Reset, Error and AssetsPath values.
+	ViewPasswordReset = "password_reset"
+	// ViewEmailVerification is the name of the view rendered by the email verification endpoint. It
+	// receives the Token, Verified, Error and AssetsPath values.
+	ViewEmailVerification = "verify_email"
+)
+
+// Renderer renders the named view of the authorization UI with the given data. It allows template engines
+// other than html/template to be used by the default authorization and device verification handlers.
+type Renderer interface {
+	Render(w io.Writer, name string, data map[string]interface{}) error
+}
+
+// RendererFunc is a function implementing the Renderer interface.
+type RendererFunc func(w io.Writer, name string, data map[string]interface{}) error
+
+// Render calls f(w, name, data).
+func (f RendererFunc) Render(w io.Writer, name string, data map[string]interface{}) error {
+	return f(w, name, data)
+}
+
+var (
+	// DefaultRenderer renders the views using the package's default templates.
+	DefaultRenderer Renderer = RendererFunc(renderDefault)
+)
+
+// renderDefault renders the default templates.
+func renderDefault(w io.Writer, name string, data map[string]interface{}) error {
+	switch name {
+	case ViewAuthorize:
+		return DefaultAuthorizationTemplate.Execute(w, data)
+	case ViewDeviceVerification:
+		return DefaultDeviceVerificationTemplate.Execute(w, data)
+	case ViewPasswordReset:
+		return DefaultPasswordResetTemplate.Execute(w, data)
+	case ViewEmailVerification:
+		return DefaultEmailVerificationTemplate.Execute(w, data)
+	}
+	return fmt.Errorf("goauth: unknown view %q", name)
+}
+
+// renderWithDefaultRenderer renders using the current value of DefaultRenderer, allowing it to be replaced
+// after the default handlers have been created.
+func renderWithDefaultRenderer(w io.Writer, name string, data map[string]interface{}) error {
+	return DefaultRenderer.Render(w, name, data)
+}
+
+// NewAuthorizationHandler returns an AuthorizationHandler rendering ViewAuthorize with the given Renderer.
+func NewAuthorizationHandler(renderer Renderer) func(req AuthorizationRequest) http.Handler {
+	return func(req AuthorizationRequest) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			render(w, renderer, ViewAuthorize, req.Error, map[string]interface{}{
+				"Request":              req,
+				"Client":               req.Client,
+				"ClientID":             req.ClientID,
+				"ClientMetadata":       req.ClientMetadata,
+				"Trusted":              isTrustedClient(req.Client),
+				"Scope":                req.Scope,
+				"AuthorizationDetails": req.AuthorizationDetails,
+				"ActionURL":            req.ActionURL,
+				"Error":                req.Error,
+				"EmbeddedBrowser":      IsEmbeddedBrowserRequest(r),
+				"LoginHint":            req.LoginHint,
+				"LoginFields":          GetLoginFields(r),
+				"AssetsPath":           assetsPath(r),
+			})
+		})
+	}
+}
+
+// NewDeviceVerificationHandler returns a DeviceVerificationHandler rendering ViewDeviceVerification with the
+// given Renderer.
+func NewDeviceVerificationHandler(renderer Renderer) func(userCode string, client Client, scope []string, approved bool, authErr error) http.Handler {
+	return func(userCode string, client Client, scope []string, approved bool, authErr error) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			render(w, renderer, ViewDeviceVerification, authErr, map[string]interface{}{
+				"UserCode":     userCode,
+				"Client":       client,
+				"Scope":        scope,
+				"Approved":     approved,
+				"Error":        authErr,
+				"LoginFields":  GetLoginFields(r),
+				"ConsentToken": GetConsentToken(r),
+				"AssetsPath":   assetsPath(r),
+			})
+		})
+	}
+}
+
+// render buffers the output of the renderer so that an error can be reported if rendering fails.
+func render(w http.ResponseWriter, renderer Renderer, name string, authErr error, data map[string]interface{}) {
+	var buf bytes.Buffer
+	err := renderer.Render(&buf, name, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if authErr != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	buf.WriteTo(w)
+}
+
+// Theme is a Renderer loading html/template views from a file system, such as an embed.FS. Each view is
+// read from a file named after it with a .html extension, for example authorize.html. Views missing from
+// the theme are rendered by DefaultRenderer, so a theme only needs to contain the views it customises.
+// Files matching *.html are parsed together, allowing views to share layouts and partials.
+type Theme struct {
+	fsys   fs.FS
+	funcs  template.FuncMap
+	reload bool
+	mtx    sync.Mutex
+	tmpl   *template.Template
+}
+
+// LoadTheme parses the templates of a Theme from fsys. If reload is true the templates are parsed again on
+// every render so that changes are visible without a restart. This is intended for development using a
+// file system such as os.DirFS and should not be enabled in production.
+func LoadTheme(fsys fs.FS, funcs template.FuncMap, reload bool) (*Theme, error) {
+	t := &Theme{fsys: fsys, funcs: funcs, reload: reload}
+	tmpl, err := t.parse()
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// parse parses the templates of the Theme.
+func (t *Theme) parse() (*template.Template, error) {
+	return template.New("").Funcs(t.funcs).ParseFS(t.fsys, "*.html")
+}
+
+// Render implements the Renderer interface.
+func (t *Theme) Render(w io.Writer, name string, data map[string]interface{}) error {
+	t.mtx.Lock()
+	if t.reload {
+		tmpl, err := t.parse()
+		if err != nil {
+			t.mtx.Unlock()
+			return err
+		}
+		t.tmpl = tmpl
+	}
+	tmpl := t.tmpl
+	t.mtx.Unlock()
+	if tmpl.Lookup(name+".html") == nil {
+		return DefaultRenderer.Render(w, name, data)
+	}
+	return tmpl.ExecuteTemplate(w, name+".html", data)
+}
@@ -0,0 +1,42 @@
+package goauth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTheme(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layout.html":    {Data: []byte(`{{define "layout"}}<main>{{template "content" .}}</main>{{end}}`)},
+		"authorize.html": {Data: []byte(`{{template "layout" .}}{{define "content"}}{{upper .LoginHint}}{{end}}`)},
+	}
+	theme, err := LoadTheme(fsys, map[string]interface{}{"upper": strings.ToUpper}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewAuthorizationHandler(theme)
+	r := httptest.NewRequest("GET", "/authorize", nil)
+
+	w := httptest.NewRecorder()
+	handler(AuthorizationRequest{LoginHint: "alice"}).ServeHTTP(w, r)
+	if w.Body.String() != "<main>ALICE</main>" {
+		t.Errorf("Test failed, unexpected body %q", w.Body.String())
+	}
+
+	// Changes are picked up when reloading is enabled
+	fsys["authorize.html"] = &fstest.MapFile{Data: []byte(`{{template "layout" .}}{{define "content"}}{{.LoginHint}}{{end}}`)}
+	w = httptest.NewRecorder()
+	handler(AuthorizationRequest{LoginHint: "alice"}).ServeHTTP(w, r)
+	if w.Body.String() != "<main>alice</main>" {
+		t.Errorf("Test failed, unexpected body %q", w.Body.String())
+	}
+
+	// Views missing from the theme use the default templates
+	w = httptest.NewRecorder()
+	NewDeviceVerificationHandler(theme)("ABCD-EFGH", nil, nil, false, nil).ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), "ABCD-EFGH") {
+		t.Errorf("Test failed, expected the default device verification view got %q", w.Body.String())
+	}
+}
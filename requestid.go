@@ -0,0 +1,77 @@
+package goauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+)
+
+const (
+	// RequestIDHeader is the header used to receive and return request IDs.
+	RequestIDHeader = "X-Request-ID"
+	// AttributeRequestID is the span attribute holding the request ID.
+	AttributeRequestID = "request_id"
+	// maxRequestIDLength limits the length of request IDs accepted from clients.
+	maxRequestIDLength = 128
+)
+
+var (
+	// NewRequestID generates the ID of requests that do not provide a valid X-Request-ID header. It can be
+	// overridden to use a different ID format.
+	NewRequestID = newRequestID
+)
+
+// newRequestID generates a random 128-bit hex encoded request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, b)
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+type requestIDKey struct{}
+
+// GetRequestID returns the ID of the request being served by the Server. It is available to custom
+// handlers such as the AuthorizationHandler and to handlers protected by Secure.
+func GetRequestID(r *http.Request) string {
+	return RequestIDFromContext(r.Context())
+}
+
+// RequestIDFromContext returns the request ID stored in the context of a request served by the Server. It
+// allows Authenticator and SessionStoreBackend implementations receiving the request context to correlate
+// their logs.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID returns true if the id is safe to echo in responses and logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID assigns the request an ID, honoring a valid X-Request-ID header if present, and returns it
+// in the response headers so that it is included with any error returned to the client.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	if RequestIDFromContext(r.Context()) != "" {
+		return r
+	}
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = NewRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
@@ -0,0 +1,46 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestID(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+
+	// An error response includes the generated request ID
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", TokenEndpoint, nil))
+	if len(w.Header().Get(RequestIDHeader)) != 32 {
+		t.Errorf("Test failed, expected a generated request ID got %q", w.Header().Get(RequestIDHeader))
+	}
+
+	// A valid incoming request ID is honored and made available to the handler
+	grant := Grant{AccessToken: "testtoken", CreatedAt: timeNow(), ExpiresIn: time.Hour}
+	err := server.SessionStore.PutGrant(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	handler := server.Secure(nil, func(w http.ResponseWriter, r *http.Request) {
+		got = GetRequestID(r)
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer testtoken")
+	r.Header.Set(RequestIDHeader, "upstream-id")
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if got != "upstream-id" || w.Header().Get(RequestIDHeader) != "upstream-id" {
+		t.Errorf("Test failed, expected the incoming request ID to be used got %q", got)
+	}
+
+	// Invalid request IDs are replaced
+	r.Header.Set(RequestIDHeader, "bad\nid")
+	handler(httptest.NewRecorder(), r)
+	if got == "bad\nid" || got == "" {
+		t.Errorf("Test failed, expected the invalid request ID to be replaced got %q", got)
+	}
+}
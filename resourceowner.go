@@ -2,39 +2,35 @@ package goauth
 
 import (
 	"net/http"
-	"strings"
 )
 
-func (s Server) handleResourceOwnerPasswordCredentialsGrant(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handleResourceOwnerPasswordCredentialsGrant(w http.ResponseWriter, r *http.Request) {
 	// Check that the grant type is set to password
 	if r.PostFormValue(ParamGrantType) != GrantTypePassword {
-		w.WriteHeader(http.StatusBadRequest)
 		s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
 		return
 	}
 	// Authorize the client using basic auth
-	clientID, clientSecret, ok := r.BasicAuth()
-	if !ok {
-		w.WriteHeader(http.StatusUnauthorized)
-		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
-		return
-	}
-	client, err := s.Authenticator.GetClientWithSecret(clientID, Secret(clientSecret))
+	clientID, client, err := s.authenticateConfidentialClient(r)
 	if err != nil {
 		s.ErrorHandler(w, http.StatusUnauthorized, err)
 		return
 	}
 	// Check that the client is allowed for this grant type
-	ok = client.AllowStrategy(StrategyResourceOwnerPasswordCredentials)
+	ok := client.AllowStrategy(StrategyResourceOwnerPasswordCredentials)
 	if !ok {
 		// The client is not authorized for the grant type, therefore, return an error
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
 		return
 	}
+	// The grant may be disabled
+	if err := s.deprecatedFlowAttempt(r, DeprecatedFlowPassword, clientID); err != nil {
+		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, err)
+		return
+	}
 	// Get the username
 	username := r.PostFormValue("username")
 	if username == "" {
-		w.WriteHeader(http.StatusUnauthorized)
 		s.ErrorHandler(w, ErrorAccessDenied.StatusCode, ErrorAccessDenied)
 		return
 	}
@@ -42,8 +38,11 @@ func (s Server) handleResourceOwnerPasswordCredentialsGrant(w http.ResponseWrite
 	allowed, err := client.AuthorizeResourceOwner(username)
 	if err != nil {
 		// An error means that the Client is not approved for this resource owner.
-		// w.WriteHeader(http.StatusUnauthorized)
-		s.ErrorHandler(w, http.StatusUnauthorized, err)
+		e, ok := asError(err)
+		if !ok {
+			e = ErrorUnauthorizedClient
+		}
+		s.ErrorHandler(w, http.StatusUnauthorized, e)
 		return
 	}
 	if !allowed {
@@ -59,35 +58,68 @@ func (s Server) handleResourceOwnerPasswordCredentialsGrant(w http.ResponseWrite
 	}
 	// Get the scope (OPTIONAL)
 	rawScope := r.PostFormValue(ParamScope)
-	scope := strings.Split(rawScope, " ")
+	scope := s.parseScope(rawScope)
 	// Authorize the scope against the client
-	scope, err = client.AuthorizeScope(scope)
+	scope, err = s.authorizeScope(clientID, client, scope)
 	if err != nil {
 		s.ErrorHandler(w, ErrorUnauthorizedClient.StatusCode, ErrorUnauthorizedClient)
 		return
 	}
+	details, err := s.requestAuthorizationDetails(r, clientID, client)
+	if err != nil {
+		s.ErrorHandler(w, ErrorInvalidAuthorizationDetails.StatusCode, ErrorInvalidAuthorizationDetails)
+		return
+	}
 	// Authorize the resource owner
-	isAuthorized, err := s.Authenticator.AuthorizeResourceOwner(username, Secret(password), scope)
+	credentials := Credentials{Username: username, Password: Secret(password)}
+	isAuthorized, err := s.authorizeResourceOwner(r, s.resourceOwnerRequest(r, credentials, clientID, client, scope))
 	if err != nil || !isAuthorized {
 		// If an error occurs then the client / resource owner must not have access
-		s.ErrorHandler(w, http.StatusUnauthorized, err)
+		e, ok := asError(err)
+		if !ok {
+			e = ErrorAccessDenied
+		}
+		s.ErrorHandler(w, http.StatusUnauthorized, e)
 		return
 	}
-	grant, err := client.CreateGrant(scope)
+	// Restrict the scope to that permitted for the resource owner
+	scope, err = s.authorizeOwnerScope(username, scope)
 	if err != nil {
-		s.ErrorHandler(w, http.StatusInternalServerError, err)
+		s.ErrorHandler(w, ErrorInvalidScope.StatusCode, ErrorInvalidScope)
+		return
+	}
+	// Check that the risk of issuing the grant is acceptable
+	e, ok := s.evaluateRisk(r, RiskContext{
+		ClientID:  clientID,
+		Client:    client,
+		Username:  username,
+		GrantType: GrantTypePassword,
+		Scope:     scope,
+	})
+	if !ok {
+		s.ErrorHandler(w, e.StatusCode, e)
 		return
 	}
-	err = s.SessionStore.PutGrant(grant)
+	grant, err := s.createGrant(r, client, username, scope)
+	if err != nil {
+		s.internalError(w, r, err)
+		return
+	}
+	grant.AuthorizationDetails = details
+	// The resource owner authenticated using the credentials of this request
+	grant.AuthTime = timeNow()
+	err = s.issueGrant(r, clientID, client, username, &grant)
+	if err == nil {
+		err = s.storeGrant(r, &grant)
+	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		s.ErrorHandler(w, ErrorServerError.StatusCode, ErrorServerError)
+		s.internalError(w, r, err)
 		return
 	}
 	// Write the grant to the http response
-	err = grant.Write(w)
+	err = s.writeGrant(w, r, grant)
 	if err != nil {
-		s.ErrorHandler(w, http.StatusInternalServerError, err)
+		s.internalError(w, r, err)
 		return
 	}
 }
@@ -7,7 +7,6 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
-	"time"
 )
 
 // testResourceOwnerPasswordGrant implements the ResourceOwnerPasswordGrant interface and
@@ -40,13 +39,9 @@ func (t *testResourceOwnerPasswordGrant) AuthorizeResourceOwner(username string,
 
 func TestResourceOwnerPasswordGrantHandler(t *testing.T) {
 
-	// Set the default expiry for authorization codes to a low value
-	DefaultAuthorizationCodeExpiry = time.Millisecond
-
-	// Create a new instance of the mem session store
-	DefaultSessionStore = NewSessionStore(NewMemSessionStoreBackend())
-
 	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.GrantDecorator = testTokenDecorator
 
 	// Generate a method to check the authentication of a request
 	securedHandler := server.Secure([]string{"testscope"}, func(w http.ResponseWriter, r *http.Request) {
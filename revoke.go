@@ -0,0 +1,106 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrRevokeSubjectUnsupported is returned by SessionStore.RevokeSubject if the SessionStoreBackend
+	// implements neither SubjectRevoker nor SessionExporter.
+	ErrRevokeSubjectUnsupported = errors.New("session store does not support revoking by subject")
+)
+
+// SubjectRevoker may be implemented by a SessionStoreBackend to remove the records of a resource owner
+// without enumerating every record, such as using a DELETE on an indexed username column. RevokeSubject
+// removes the grants and authorization codes whose Username is the subject and that were created before
+// issuedBefore, including those with no CreatedAt, returning the number removed.
+type SubjectRevoker interface {
+	RevokeSubject(subject string, issuedBefore time.Time) (int, error)
+}
+
+// issuedToSubject returns true if the record is a grant or authorization code of the subject created before
+// issuedBefore.
+func (r SessionRecord) issuedToSubject(subject string, issuedBefore time.Time) bool {
+	switch {
+	case r.Grant != nil:
+		return r.Grant.Username == subject && r.Grant.CreatedAt.Before(issuedBefore)
+	case r.AuthorizationCode != nil:
+		return r.AuthorizationCode.Username == subject && r.AuthorizationCode.CreatedAt.Before(issuedBefore)
+	}
+	return false
+}
+
+// RevokeSubject removes the grants, and so the access and refresh tokens, and the unused authorization codes
+// issued to the resource owner before issuedBefore, returning the number removed. It is intended for when
+// the credentials of the resource owner change, so that sessions established using the old credentials
+// end. Backends not implementing SubjectRevoker are enumerated using SessionExporter, otherwise it returns
+// ErrRevokeSubjectUnsupported. The subject must not be empty, as grants of clients acting on their own
+// behalf have no subject.
+func (s *SessionStore) RevokeSubject(subject string, issuedBefore time.Time) (int, error) {
+	if subject == "" {
+		return 0, ErrorInvalidRequest
+	}
+	if revoker, ok := s.SessionStoreBackend.(SubjectRevoker); ok {
+		return revoker.RevokeSubject(subject, issuedBefore)
+	}
+	exporter, ok := s.SessionStoreBackend.(SessionExporter)
+	if !ok {
+		return 0, ErrRevokeSubjectUnsupported
+	}
+	var records []SessionRecord
+	err := exporter.ExportRecords(context.Background(), func(record SessionRecord) error {
+		if record.issuedToSubject(subject, issuedBefore) {
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, record := range records {
+		if record.Grant != nil {
+			err = s.DeleteGrant(record.Grant.AccessToken)
+		} else {
+			err = s.DeleteAuthorizationCode(record.AuthorizationCode.Code)
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// RevokeSubject removes the grants and authorization codes of the subject held in memory.
+func (m *MemSessionStoreBackend) RevokeSubject(subject string, issuedBefore time.Time) (int, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	n := 0
+	for _, record := range m.records() {
+		if !record.issuedToSubject(subject, issuedBefore) {
+			continue
+		}
+		err := m.remove(record)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// PasswordChanged revokes the grants and authorization codes issued to the resource owner by the Server
+// until now, publishing an EventTokenRevoked event if any were revoked. Authenticators managing their own
+// accounts should call it once the password of a resource owner has changed, so that tokens obtained by
+// anyone who knew the old password can no longer be used or refreshed. The password reset flow calls it
+// after setting the new password.
+func (s *Server) PasswordChanged(ctx context.Context, username string) error {
+	n, err := s.SessionStore.RevokeSubject(username, timeNow())
+	if n > 0 {
+		s.PublishEvent(ctx, Event{Type: EventTokenRevoked, Username: username})
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package goauth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// exportOnlyBackend hides the SubjectRevoker implementation of the MemSessionStoreBackend, so that
+// RevokeSubject enumerates its records.
+type exportOnlyBackend struct {
+	SessionStoreBackend
+	SessionExporter
+}
+
+func TestSessionStoreRevokeSubject(t *testing.T) {
+	changed := time.Now()
+	before := changed.Add(-time.Minute)
+	after := changed.Add(time.Minute)
+	for _, exportOnly := range []bool{false, true} {
+		backend := NewMemSessionStoreBackend()
+		store := NewSessionStore(backend)
+		if exportOnly {
+			store = NewSessionStore(exportOnlyBackend{backend, backend})
+		}
+		grants := []Grant{
+			{AccessToken: "old", RefreshToken: "oldrefresh", Username: "alice", CreatedAt: before, ExpiresIn: time.Hour},
+			{AccessToken: "legacy", Username: "alice", ExpiresIn: time.Hour},
+			{AccessToken: "new", Username: "alice", CreatedAt: after, ExpiresIn: time.Hour},
+			{AccessToken: "other", Username: "bob", CreatedAt: before, ExpiresIn: time.Hour},
+			{AccessToken: "client", CreatedAt: before, ExpiresIn: time.Hour},
+		}
+		for _, grant := range grants {
+			err := store.PutGrant(grant)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := store.PutAuthorizationCode(AuthorizationCode{Code: "code", Username: "alice", CreatedAt: before, ExpiresIn: time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := store.RevokeSubject("alice", changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 3 {
+			t.Errorf("Test failed, expected 3 records to be revoked got %d", n)
+		}
+		for _, accessToken := range []Secret{"old", "legacy"} {
+			if _, err := store.GetGrant(accessToken); err == nil {
+				t.Errorf("Test failed, expected grant %s to be revoked", accessToken)
+			}
+		}
+		if _, err := store.RefreshGrant("oldrefresh"); err == nil {
+			t.Errorf("Test failed, expected the refresh token to be revoked")
+		}
+		for _, accessToken := range []Secret{"new", "other", "client"} {
+			if _, err := store.GetGrant(accessToken); err != nil {
+				t.Errorf("Test failed, expected grant %s to be kept: %v", accessToken, err)
+			}
+		}
+		if _, err := store.GetAuthorizationCode("code"); err == nil {
+			t.Errorf("Test failed, expected the authorization code to be revoked")
+		}
+	}
+}
+
+func TestSessionStoreRevokeSubjectErrors(t *testing.T) {
+	store := NewSessionStore(NewMemSessionStoreBackend())
+	_, err := store.RevokeSubject("", time.Now())
+	if err != ErrorInvalidRequest {
+		t.Errorf("Test failed, expected an empty subject to be rejected got %v", err)
+	}
+	store = NewSessionStore(struct{ SessionStoreBackend }{NewMemSessionStoreBackend()})
+	_, err = store.RevokeSubject("alice", time.Now())
+	if err != ErrRevokeSubjectUnsupported {
+		t.Errorf("Test failed, expected ErrRevokeSubjectUnsupported got %v", err)
+	}
+}
+
+func TestServerPasswordChanged(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	var events []Event
+	server.EventSink = EventSinkFunc(func(ctx context.Context, e Event) error {
+		events = append(events, e)
+		return nil
+	})
+	err := server.SessionStore.PutGrant(Grant{AccessToken: "old", Username: "alice", CreatedAt: time.Now().Add(-time.Second), ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.PasswordChanged(context.Background(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.SessionStore.GetGrant("old"); err == nil {
+		t.Errorf("Test failed, expected the grant to be revoked")
+	}
+	if len(events) != 1 || events[0].Type != EventTokenRevoked || events[0].Username != "alice" {
+		t.Errorf("Test failed, unexpected events %v", events)
+	}
+	// No event is published when nothing is revoked
+	err = server.PasswordChanged(context.Background(), "alice")
+	if err != nil || len(events) != 1 {
+		t.Errorf("Test failed, expected no further events got %v: %v", events, err)
+	}
+}
@@ -0,0 +1,66 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+)
+
+// RiskDecision is the outcome of evaluating the risk of issuing a grant.
+type RiskDecision int
+
+const (
+	// RiskAllow allows the grant to be issued.
+	RiskAllow RiskDecision = iota
+	// RiskDeny rejects the request with ErrorAccessDenied.
+	RiskDeny
+	// RiskStepUp rejects the request with ErrorInsufficientUserAuthentication, requiring the resource
+	// owner to authenticate again using a stronger method before a grant is issued.
+	RiskStepUp
+)
+
+// RiskContext describes a request for a grant.
+type RiskContext struct {
+	ClientID string
+	Client   Client
+	// Username identifies the resource owner, it is empty for the Client Credentials Grant.
+	Username  string
+	GrantType string
+	Scope     []string
+	// Device is the IP address and user agent of the request.
+	Device RequestFingerprint
+}
+
+// RiskEvaluator is called before each grant is issued, allowing fraud or risk systems to allow, deny or
+// require step-up authentication for the request. The context is that of the request being served.
+type RiskEvaluator interface {
+	EvaluateRisk(ctx context.Context, rc RiskContext) (RiskDecision, error)
+}
+
+// RiskEvaluatorFunc is an adapter allowing a function to be used as a RiskEvaluator.
+type RiskEvaluatorFunc func(ctx context.Context, rc RiskContext) (RiskDecision, error)
+
+// EvaluateRisk calls f(ctx, rc).
+func (f RiskEvaluatorFunc) EvaluateRisk(ctx context.Context, rc RiskContext) (RiskDecision, error) {
+	return f(ctx, rc)
+}
+
+// evaluateRisk returns false and the Error to respond with if the Server's RiskEvaluator does not allow the
+// grant to be issued. If the evaluator fails the request is rejected with ErrorTemporarilyUnavailable.
+func (s *Server) evaluateRisk(r *http.Request, rc RiskContext) (Error, bool) {
+	if s.RiskEvaluator == nil {
+		return Error{}, true
+	}
+	rc.Device = s.fingerprint(r)
+	decision, err := s.RiskEvaluator.EvaluateRisk(r.Context(), rc)
+	if err != nil {
+		return ErrorTemporarilyUnavailable, false
+	}
+	switch decision {
+	case RiskAllow:
+		return Error{}, true
+	case RiskStepUp:
+		return ErrorInsufficientUserAuthentication, false
+	default:
+		return ErrorAccessDenied, false
+	}
+}
@@ -0,0 +1,54 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRiskEvaluator(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	var evaluated RiskContext
+	var decision RiskDecision
+	var evalErr error
+	server.RiskEvaluator = RiskEvaluatorFunc(func(ctx context.Context, rc RiskContext) (RiskDecision, error) {
+		evaluated = rc
+		return decision, evalErr
+	})
+
+	request := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=password&username=testusername&password=testpassword&scope=testscope"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("User-Agent", "testagent")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request(); w.Code != 200 {
+		t.Fatalf("Test failed, status %d", w.Code)
+	}
+	if evaluated.ClientID != "testclientid" || evaluated.Username != "testusername" || evaluated.GrantType != GrantTypePassword || evaluated.Device.UserAgent != "testagent" {
+		t.Errorf("Test failed, unexpected risk context %+v", evaluated)
+	}
+
+	for _, test := range []struct {
+		decision RiskDecision
+		err      error
+		expected Error
+	}{
+		{RiskDeny, nil, ErrorAccessDenied},
+		{RiskStepUp, nil, ErrorInsufficientUserAuthentication},
+		{RiskAllow, errors.New("unavailable"), ErrorTemporarilyUnavailable},
+	} {
+		decision, evalErr = test.decision, test.err
+		w := request()
+		if w.Code != test.expected.StatusCode || !strings.Contains(w.Body.String(), test.expected.Code) {
+			t.Errorf("Test failed, expected %s got %d %s", test.expected.Code, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package goauth
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Router is implemented by routers on which the endpoints of a Server can be registered, such as
+// chi.Router. Patterns ending with a slash, such as DefaultAssetsPath, match every path beneath them in
+// the same way as http.ServeMux. They are registered using the router's Mount method if it has one,
+// as chi.Router does.
+type Router interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// mountRouter is implemented by routers registering subtrees using Mount.
+type mountRouter interface {
+	Mount(pattern string, handler http.Handler)
+}
+
+// RouterFunc is a function implementing the Router interface. It adapts routers whose Handle method
+// has a different signature, for example gorilla/mux:
+//
+//	server.RegisterRoutes(goauth.RouterFunc(func(pattern string, h http.Handler) {
+//		if strings.HasSuffix(pattern, "/") {
+//			r.PathPrefix(pattern).Handler(h)
+//			return
+//		}
+//		r.Handle(pattern, h)
+//	}))
+//
+// or echo:
+//
+//	server.RegisterRoutes(goauth.RouterFunc(func(pattern string, h http.Handler) {
+//		if strings.HasSuffix(pattern, "/") {
+//			pattern += "*"
+//		}
+//		e.Any(pattern, echo.WrapHandler(h))
+//	}))
+type RouterFunc func(pattern string, handler http.Handler)
+
+// Handle calls f(pattern, handler).
+func (f RouterFunc) Handle(pattern string, handler http.Handler) {
+	f(pattern, handler)
+}
+
+// handle registers the handler for the pattern on the Server mux, setting the SecurityHeaders of the
+// endpoint, and records it so that it can be registered on other routers by RegisterRoutes.
+func (s *Server) handle(pattern string, handler http.Handler) {
+	handler = s.secureHeaders(pattern, handler)
+	s.mux.Handle(pattern, handler)
+	if s.routes == nil {
+		s.routes = make(map[string]http.Handler)
+	}
+	s.routes[pattern] = handler
+}
+
+// Routes returns the handlers of the endpoints of the Server indexed by their pattern. Each handler
+// applies the request limits and request ID of the Server, so that it behaves the same as when
+// requested through ServeHTTP. Endpoints enabled later, such as by EnableHealthEndpoints, are not
+// included.
+func (s *Server) Routes() map[string]http.Handler {
+	routes := make(map[string]http.Handler, len(s.routes))
+	for pattern, handler := range s.routes {
+		routes[pattern] = s.prepare(handler)
+	}
+	return routes
+}
+
+// RegisterRoutes registers the endpoints of the Server on the router, in order of their pattern, and
+// returns the handlers registered. This allows the endpoints to be composed with other routes under a
+// path prefix without http.StripPrefix, for example on a chi.Router:
+//
+//	r.Route("/oauth", func(r chi.Router) {
+//		server.RegisterRoutes(r)
+//	})
+func (s *Server) RegisterRoutes(r Router) map[string]http.Handler {
+	routes := s.Routes()
+	patterns := make([]string, 0, len(routes))
+	for pattern := range routes {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	mr, mount := r.(mountRouter)
+	for _, pattern := range patterns {
+		if mount && strings.HasSuffix(pattern, "/") {
+			mr.Mount(pattern, routes[pattern])
+			continue
+		}
+		r.Handle(pattern, routes[pattern])
+	}
+	return routes
+}
+
+// prepare returns a handler applying the request ID and request limits before calling the handler, and
+// recovering from any panic while it is served.
+func (s *Server) prepare(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withRequestID(w, r)
+		defer s.recoverPanic(w, r)
+		s.setHSTS(w, r)
+		err := s.limitRequest(w, r)
+		if err == errRequestTooLarge {
+			s.ErrorHandler(w, ErrorRequestTooLarge.StatusCode, ErrorRequestTooLarge)
+			return
+		}
+		if err != nil {
+			s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testMountRouter struct {
+	*http.ServeMux
+	prefix  string
+	mounted []string
+}
+
+func (m *testMountRouter) Handle(pattern string, handler http.Handler) {
+	m.ServeMux.Handle(m.prefix+pattern, handler)
+}
+
+func (m *testMountRouter) Mount(pattern string, handler http.Handler) {
+	m.mounted = append(m.mounted, pattern)
+	m.ServeMux.Handle(m.prefix+pattern, handler)
+}
+
+func TestRegisterRoutes(t *testing.T) {
+	server := newTestHandler()
+	router := &testMountRouter{ServeMux: http.NewServeMux(), prefix: "/oauth"}
+	routes := server.RegisterRoutes(router)
+	if routes[TokenEndpoint] == nil || routes[AuthorizeEnpoint] == nil {
+		t.Fatalf("Test failed, expected the authorization and token endpoints got %v", routes)
+	}
+	if len(router.mounted) != 1 || router.mounted[0] != DefaultAssetsPath {
+		t.Errorf("Test failed, expected the assets to be mounted got %v", router.mounted)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/oauth"+TokenEndpoint, strings.NewReader("grant_type=unknown"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "unsupported_grant_type") {
+		t.Errorf("Test failed, unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(RequestIDHeader) == "" {
+		t.Error("Test failed, expected the request ID to be set")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/oauth"+DefaultAssetsPath+"theme.css", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Test failed, expected the asset beneath the prefix got %d", w.Code)
+	}
+
+	// Routers without Mount register subtrees using Handle
+	var patterns []string
+	server.RegisterRoutes(RouterFunc(func(pattern string, handler http.Handler) {
+		patterns = append(patterns, pattern)
+	}))
+	if len(patterns) != len(routes) {
+		t.Errorf("Test failed, expected %d patterns got %v", len(routes), patterns)
+	}
+}
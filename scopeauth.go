@@ -0,0 +1,83 @@
+package goauth
+
+// ScopeAuthorizer determines the scope a resource owner may grant, for example based on their roles or
+// organization membership. When set on the Server the scope of each grant issued on behalf of a resource
+// owner is the intersection of the scope approved by the Client and the scope permitted by the
+// ScopeAuthorizer.
+type ScopeAuthorizer interface {
+	// PermittedScope returns the scope the resource owner may grant.
+	PermittedScope(username string) ([]string, error)
+}
+
+// ScopeAuthorizerFunc is a function implementing the ScopeAuthorizer interface.
+type ScopeAuthorizerFunc func(username string) ([]string, error)
+
+// PermittedScope calls f(username).
+func (f ScopeAuthorizerFunc) PermittedScope(username string) ([]string, error) {
+	return f(username)
+}
+
+// RoleScopeAuthorizer is a ScopeAuthorizer mapping the roles or groups of a resource owner to scope.
+type RoleScopeAuthorizer struct {
+	// Roles returns the roles or groups of the resource owner.
+	Roles func(username string) ([]string, error)
+	// Scopes maps each role to the scope it permits.
+	Scopes map[string][]string
+}
+
+// PermittedScope returns the union of the scope permitted by each of the resource owner's roles.
+func (a RoleScopeAuthorizer) PermittedScope(username string) ([]string, error) {
+	roles, err := a.Roles(username)
+	if err != nil {
+		return nil, err
+	}
+	var permitted []string
+	for _, role := range roles {
+		for _, scope := range a.Scopes[role] {
+			if !checkInScope(scope, permitted) {
+				permitted = append(permitted, scope)
+			}
+		}
+	}
+	return permitted, nil
+}
+
+// IntersectScope returns the members of scope that are also in permitted, preserving their order. Empty
+// values, as produced by splitting an empty scope parameter, are kept.
+func IntersectScope(scope, permitted []string) []string {
+	var result []string
+	for _, s := range scope {
+		if s == "" || checkInScope(s, permitted) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// authorizeOwnerScope narrows the scope approved by the client to that permitted for the resource owner by
+// the Server's ScopeAuthorizer. It returns ErrorInvalidScope if none of the requested scope is permitted.
+func (s *Server) authorizeOwnerScope(username string, scope []string) ([]string, error) {
+	if s.ScopeAuthorizer == nil {
+		return scope, nil
+	}
+	permitted, err := s.ScopeAuthorizer.PermittedScope(username)
+	if err != nil {
+		return nil, err
+	}
+	result := IntersectScope(scope, permitted)
+	// Removing part of the requested scope is allowed, however, nothing remaining is an error
+	if hasNonEmptyScope(scope) && !hasNonEmptyScope(result) {
+		return nil, ErrorInvalidScope
+	}
+	return result, nil
+}
+
+// hasNonEmptyScope returns true if the scope contains at least one non-empty value.
+func hasNonEmptyScope(scope []string) bool {
+	for _, s := range scope {
+		if s != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoleScopeAuthorizer(t *testing.T) {
+	authorizer := RoleScopeAuthorizer{
+		Roles: func(username string) ([]string, error) {
+			return []string{"reader", "writer"}, nil
+		},
+		Scopes: map[string][]string{
+			"reader": {"read"},
+			"writer": {"read", "write"},
+			"admin":  {"admin"},
+		},
+	}
+	permitted, err := authorizer.PermittedScope("testusername")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(permitted, []string{"read", "write"}) {
+		t.Errorf("Test failed, unexpected scope %v", permitted)
+	}
+}
+
+func TestScopeAuthorizerResourceOwnerGrant(t *testing.T) {
+	server := New(&testAuthenticator{
+		&testClient{
+			"testclientid",
+			"testclientsecret",
+			"testusername",
+			"https://testuri.com",
+			[]string{"read", "write", "admin"},
+			"",
+			false,
+		},
+		"testusername",
+		Secret("testpassword"),
+	})
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.ScopeAuthorizer = ScopeAuthorizerFunc(func(username string) ([]string, error) {
+		return []string{"read", "write"}, nil
+	})
+
+	request := func(scope string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=password&username=testusername&password=testpassword&scope="+scope))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// The granted scope is the intersection of the client's and the resource owner's scope
+	w := request("read+admin")
+	if w.Code != 200 {
+		t.Fatalf("Test failed, status %d", w.Code)
+	}
+	var resp map[string]interface{}
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp["scope"] != "read" {
+		t.Errorf("Test failed, expected scope read got %v", resp["scope"])
+	}
+
+	// Requesting only scope that the resource owner cannot grant is an error
+	w = request("admin")
+	if w.Code != ErrorInvalidScope.StatusCode {
+		t.Errorf("Test failed, expected status %d got %d", ErrorInvalidScope.StatusCode, w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package goauth
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ScopeParser parses the scope parameter of a request into its scope tokens.
+type ScopeParser interface {
+	ParseScope(raw string) []string
+}
+
+// ScopeParserFunc is a function implementing the ScopeParser interface.
+type ScopeParserFunc func(raw string) []string
+
+// ParseScope calls f(raw).
+func (f ScopeParserFunc) ParseScope(raw string) []string {
+	return f(raw)
+}
+
+var (
+	// SpaceDelimitedScopeParser parses space-delimited scope as per RFC 6749 section 3.3. An empty scope is
+	// parsed as nil.
+	SpaceDelimitedScopeParser ScopeParser = ScopeParserFunc(func(raw string) []string {
+		return splitScope(raw, func(r rune) bool {
+			return r == ' '
+		})
+	})
+	// CommaDelimitedScopeParser accepts scope delimited by commas as well as spaces, for clients that do not
+	// follow the specification.
+	CommaDelimitedScopeParser ScopeParser = ScopeParserFunc(func(raw string) []string {
+		return splitScope(raw, func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})
+	})
+	// DefaultScopeParser is used by Servers that do not set a ScopeParser.
+	DefaultScopeParser = SpaceDelimitedScopeParser
+)
+
+// splitScope splits the raw scope at the delimiters, returning nil if it contains no scope tokens.
+func splitScope(raw string, delimiter func(rune) bool) []string {
+	scope := strings.FieldsFunc(raw, delimiter)
+	if len(scope) == 0 {
+		return nil
+	}
+	return scope
+}
+
+// NormalizeScope trims the scope tokens, removing empty and duplicate tokens while preserving their order.
+// It returns nil if no tokens remain.
+func NormalizeScope(scope []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(scope))
+	for _, token := range scope {
+		token = strings.TrimSpace(token)
+		if token == "" || seen[token] {
+			continue
+		}
+		seen[token] = true
+		normalized = append(normalized, token)
+	}
+	return normalized
+}
+
+// parseScope parses the raw scope of a request using the Server's ScopeParser and normalizes the result,
+// so that an absent scope is nil.
+func (s *Server) parseScope(raw string) []string {
+	parser := s.ScopeParser
+	if parser == nil {
+		parser = DefaultScopeParser
+	}
+	return NormalizeScope(parser.ParseScope(raw))
+}
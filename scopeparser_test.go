@@ -0,0 +1,103 @@
+package goauth
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScopeParsers(t *testing.T) {
+	for _, tc := range []struct {
+		parser   ScopeParser
+		raw      string
+		expected []string
+	}{
+		{SpaceDelimitedScopeParser, "", nil},
+		{SpaceDelimitedScopeParser, "read  write", []string{"read", "write"}},
+		{SpaceDelimitedScopeParser, "read,write", []string{"read,write"}},
+		{CommaDelimitedScopeParser, "read,write, admin", []string{"read", "write", "admin"}},
+		{CommaDelimitedScopeParser, "read write", []string{"read", "write"}},
+	} {
+		if scope := tc.parser.ParseScope(tc.raw); !reflect.DeepEqual(scope, tc.expected) {
+			t.Errorf("Test failed, expected %v for %q got %v", tc.expected, tc.raw, scope)
+		}
+	}
+}
+
+func TestServerScopeParser(t *testing.T) {
+	server := newTestHandler()
+	server.ScopeParser = CommaDelimitedScopeParser
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials&scope=testscope,unknown"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	server.ServeHTTP(w, r)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"scope":"testscope"`) {
+		t.Errorf("Test failed, expected the comma separated scope to be parsed got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNormalizeScope(t *testing.T) {
+	for _, tc := range []struct {
+		scope    []string
+		expected []string
+	}{
+		{nil, nil},
+		{[]string{""}, nil},
+		{[]string{" read", "write ", "read", "", "admin"}, []string{"read", "write", "admin"}},
+	} {
+		if scope := NormalizeScope(tc.scope); !reflect.DeepEqual(scope, tc.expected) {
+			t.Errorf("Test failed, expected %v for %q got %v", tc.expected, tc.scope, scope)
+		}
+	}
+
+	// Scope returned by the client is normalized before it is granted
+	server := newTestHandler()
+	server.Authenticator.(*testAuthenticator).client.scope = []string{"testscope", ""}
+	scope, err := server.authorizeScope("testclientid", server.Authenticator.(*testAuthenticator).client, []string{"testscope", "testscope", ""})
+	if err != nil || !reflect.DeepEqual(scope, []string{"testscope"}) {
+		t.Errorf("Test failed, expected [testscope] got %v %v", scope, err)
+	}
+}
+
+type testDefaultScopeClient struct {
+	*testClient
+	defaultScope []string
+}
+
+func (t testDefaultScopeClient) DefaultScope() []string {
+	return t.defaultScope
+}
+
+type testDefaultScopeAuthenticator struct {
+	*testAuthenticator
+}
+
+func (t testDefaultScopeAuthenticator) GetClientWithSecret(clientID string, clientSecret Secret) (Client, error) {
+	client, err := t.testAuthenticator.GetClientWithSecret(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return testDefaultScopeClient{client.(*testClient), []string{"testscope", "unknown"}}, nil
+}
+
+func TestDefaultScope(t *testing.T) {
+	server := newTestHandler()
+	server.Authenticator = testDefaultScopeAuthenticator{server.Authenticator.(*testAuthenticator)}
+	token := func(body string) string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		server.ServeHTTP(w, r)
+		return w.Body.String()
+	}
+	// The default scope is authorized by the client when no scope is requested
+	if body := token("grant_type=client_credentials"); !strings.Contains(body, `"scope":"testscope"`) {
+		t.Errorf("Test failed, expected the default scope got %s", body)
+	}
+	if body := token("grant_type=client_credentials&scope=none"); strings.Contains(body, `"scope":"testscope"`) {
+		t.Errorf("Test failed, expected the requested scope got %s", body)
+	}
+}
@@ -0,0 +1,53 @@
+package goauth
+
+// ScopePolicy is a server-wide scope policy enforced on the scope approved by every Client, regardless of
+// grant type, so that security policy does not depend on each AuthorizeScope implementation.
+type ScopePolicy struct {
+	// Denied is scope that is never granted to any client.
+	Denied []string
+	// Ceilings maps client IDs to the maximum scope that may be granted to the client. Clients without a
+	// ceiling are only restricted by Denied.
+	Ceilings map[string][]string
+	// OnDenied is called with the scope removed from a request, if any, allowing policy decisions to be
+	// audited.
+	OnDenied func(clientID string, denied []string)
+}
+
+// Apply returns the members of scope permitted for the client. It returns ErrorInvalidScope if the scope
+// contained at least one value and none of it is permitted.
+func (p *ScopePolicy) Apply(clientID string, scope []string) ([]string, error) {
+	ceiling, hasCeiling := p.Ceilings[clientID]
+	var permitted, denied []string
+	for _, s := range scope {
+		if s != "" && (checkInScope(s, p.Denied) || (hasCeiling && !checkInScope(s, ceiling))) {
+			denied = append(denied, s)
+			continue
+		}
+		permitted = append(permitted, s)
+	}
+	if len(denied) > 0 && p.OnDenied != nil {
+		p.OnDenied(clientID, denied)
+	}
+	if hasNonEmptyScope(scope) && !hasNonEmptyScope(permitted) {
+		return nil, ErrorInvalidScope
+	}
+	return permitted, nil
+}
+
+// authorizeScope authorizes the scope using the client and then applies the Server's ScopePolicy to the
+// approved scope. If no scope was requested the client's default scope is authorized instead.
+func (s *Server) authorizeScope(clientID string, client Client, scope []string) ([]string, error) {
+	if len(scope) == 0 {
+		scope = defaultScope(client)
+	}
+	scope, err := client.AuthorizeScope(scope)
+	if err != nil {
+		return nil, err
+	}
+	scope = NormalizeScope(scope)
+	if s.ScopePolicy == nil {
+		return scope, nil
+	}
+	scope, err = s.ScopePolicy.Apply(clientID, scope)
+	return NormalizeScope(scope), err
+}
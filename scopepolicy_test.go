@@ -0,0 +1,79 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestScopePolicyApply(t *testing.T) {
+	var audited []string
+	policy := &ScopePolicy{
+		Denied:   []string{"admin"},
+		Ceilings: map[string][]string{"limited": {"read"}},
+		OnDenied: func(clientID string, denied []string) {
+			audited = append(audited, clientID+":"+strings.Join(denied, ","))
+		},
+	}
+	scope, err := policy.Apply("other", []string{"read", "write", "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scope, []string{"read", "write"}) {
+		t.Errorf("Test failed, unexpected scope %v", scope)
+	}
+	scope, err = policy.Apply("limited", []string{"read", "write"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(scope, []string{"read"}) {
+		t.Errorf("Test failed, unexpected scope %v", scope)
+	}
+	if _, err := policy.Apply("limited", []string{"admin"}); err != ErrorInvalidScope {
+		t.Errorf("Test failed, expected ErrorInvalidScope got %v", err)
+	}
+	// An empty scope is not affected by the policy
+	if _, err := policy.Apply("limited", []string{""}); err != nil {
+		t.Errorf("Test failed, unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(audited, []string{"other:admin", "limited:write", "limited:admin"}) {
+		t.Errorf("Test failed, unexpected audit %v", audited)
+	}
+}
+
+func TestScopePolicyClientCredentials(t *testing.T) {
+	server := New(&testAuthenticator{
+		&testClient{
+			"testclientid",
+			"testclientsecret",
+			"testusername",
+			"https://testuri.com",
+			[]string{"read", "write", "admin"},
+			"",
+			false,
+		},
+		"testusername",
+		Secret("testpassword"),
+	})
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.ScopePolicy = &ScopePolicy{Denied: []string{"admin"}}
+
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials&scope=read+admin"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatalf("Test failed, status %d", w.Code)
+	}
+	var resp map[string]interface{}
+	err := json.NewDecoder(w.Body).Decode(&resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp["scope"] != "read" {
+		t.Errorf("Test failed, expected scope read got %v", resp["scope"])
+	}
+}
@@ -0,0 +1,95 @@
+package goauth
+
+import "net/http"
+
+var (
+	// DefaultContentSecurityPolicy is the Content-Security-Policy of the pages served by the Server when
+	// SecurityHeaders are enabled without a ContentSecurityPolicy. It allows the pages to load only their
+	// own assets.
+	DefaultContentSecurityPolicy = "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'none'"
+	// DefaultReferrerPolicy is the Referrer-Policy set when SecurityHeaders are enabled without a
+	// ReferrerPolicy. Authorization codes and other parameters in the URLs of the Server's pages are never
+	// sent to other sites in the Referer header.
+	DefaultReferrerPolicy = "no-referrer"
+)
+
+// apiContentSecurityPolicy is the Content-Security-Policy of responses that are not pages, which should
+// never be rendered as documents.
+const apiContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// SecurityHeaders configures the hardening headers set on every response of the Server when enabled by
+// the Server's SecurityHeaders: Content-Security-Policy, Referrer-Policy, X-Content-Type-Options and a
+// Cache-Control suitable for the endpoint.
+type SecurityHeaders struct {
+	// ContentSecurityPolicy is the policy of the pages served by the Server, such as the authorization,
+	// device verification and password reset pages, to which the frame-ancestors directive permitted by
+	// FrameAncestors is added. If empty, DefaultContentSecurityPolicy is used. Other responses have a
+	// policy preventing them from loading any content.
+	ContentSecurityPolicy string
+	// ReferrerPolicy is the Referrer-Policy of every response. If empty, DefaultReferrerPolicy is used.
+	ReferrerPolicy string
+}
+
+func (h *SecurityHeaders) contentSecurityPolicy() string {
+	if h.ContentSecurityPolicy != "" {
+		return h.ContentSecurityPolicy
+	}
+	return DefaultContentSecurityPolicy
+}
+
+func (h *SecurityHeaders) referrerPolicy() string {
+	if h.ReferrerPolicy != "" {
+		return h.ReferrerPolicy
+	}
+	return DefaultReferrerPolicy
+}
+
+// endpointType classifies the endpoints of the Server by the headers appropriate to their responses.
+type endpointType int
+
+const (
+	// endpointAPI endpoints respond with data for clients, such as tokens, which must not be cached.
+	endpointAPI endpointType = iota
+	// endpointPage endpoints render pages for resource owners, which must not be cached or framed.
+	endpointPage
+	// endpointPublic endpoints serve public documents and assets, which set their own Cache-Control.
+	endpointPublic
+)
+
+// endpointTypeOf returns the endpointType of the endpoint registered with the pattern.
+func endpointTypeOf(pattern string) endpointType {
+	switch pattern {
+	case AuthorizeEnpoint, DeviceVerificationEndpoint, PasswordResetEndpoint, EmailVerificationEndpoint:
+		return endpointPage
+	case MetadataEndpoint, JWKSEndpoint, DefaultAssetsPath:
+		return endpointPublic
+	}
+	return endpointAPI
+}
+
+// secureHeaders returns a handler setting the headers of the Server's SecurityHeaders, if enabled, on the
+// responses of the endpoint registered with the pattern. Handlers may replace the headers, such as the
+// Cache-Control of cacheable responses.
+func (s *Server) secureHeaders(pattern string, handler http.Handler) http.Handler {
+	t := endpointTypeOf(pattern)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.SecurityHeaders == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Referrer-Policy", s.SecurityHeaders.referrerPolicy())
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		switch t {
+		case endpointPage:
+			s.setFrameHeaders(w)
+			w.Header().Set("Cache-Control", "no-store")
+		case endpointPublic:
+			w.Header().Set("Content-Security-Policy", apiContentSecurityPolicy)
+		default:
+			w.Header().Set("Content-Security-Policy", apiContentSecurityPolicy)
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Pragma", "no-cache")
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
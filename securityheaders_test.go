@@ -0,0 +1,75 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	server := newTestHandler()
+	server.SecurityHeaders = &SecurityHeaders{}
+	pageCSP := DefaultContentSecurityPolicy + "; frame-ancestors 'none'"
+	cases := []struct {
+		Method       string
+		Path         string
+		CSP          string
+		CacheControl string
+		XFO          string
+	}{
+		{"GET", AuthorizeEnpoint + "?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com", pageCSP, "no-store", "DENY"},
+		{"GET", DeviceVerificationEndpoint, pageCSP, "no-store", "DENY"},
+		{"GET", PasswordResetEndpoint, pageCSP, "no-store", "DENY"},
+		{"POST", TokenEndpoint, apiContentSecurityPolicy, "no-store", ""},
+		{"POST", IntrospectionEndpoint, apiContentSecurityPolicy, "no-store", ""},
+		// Public documents keep the Cache-Control set by their handler
+		{"GET", MetadataEndpoint, apiContentSecurityPolicy, "public, max-age=300", ""},
+		{"GET", DefaultAssetsPath + "style.css", apiContentSecurityPolicy, "public, max-age=3600", ""},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(c.Method, c.Path, nil))
+		h := w.Header()
+		if h.Get("Referrer-Policy") != "no-referrer" || h.Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("Test failed, expected hardening headers for %s got %v", c.Path, h)
+		}
+		if h.Get("Content-Security-Policy") != c.CSP {
+			t.Errorf("Test failed, expected Content-Security-Policy %q for %s got %q", c.CSP, c.Path, h.Get("Content-Security-Policy"))
+		}
+		if h.Get("Cache-Control") != c.CacheControl {
+			t.Errorf("Test failed, expected Cache-Control %q for %s got %q", c.CacheControl, c.Path, h.Get("Cache-Control"))
+		}
+		if h.Get("X-Frame-Options") != c.XFO {
+			t.Errorf("Test failed, expected X-Frame-Options %q for %s got %q", c.XFO, c.Path, h.Get("X-Frame-Options"))
+		}
+	}
+}
+
+func TestSecurityHeadersOptions(t *testing.T) {
+	server := newTestHandler()
+	server.FrameAncestors = []string{"https://app.example.com"}
+	server.SecurityHeaders = &SecurityHeaders{
+		ContentSecurityPolicy: "default-src 'self' https://fonts.example.com",
+		ReferrerPolicy:        "same-origin",
+	}
+	// Headers are also set on endpoints registered on other routers
+	mux := http.NewServeMux()
+	server.RegisterRoutes(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", AuthorizeEnpoint, nil))
+	expected := "default-src 'self' https://fonts.example.com; frame-ancestors https://app.example.com"
+	if csp := w.Header().Get("Content-Security-Policy"); csp != expected {
+		t.Errorf("Test failed, expected Content-Security-Policy %q got %q", expected, csp)
+	}
+	if rp := w.Header().Get("Referrer-Policy"); rp != "same-origin" {
+		t.Errorf("Test failed, expected Referrer-Policy same-origin got %q", rp)
+	}
+
+	// The headers are opt-in
+	server.SecurityHeaders = nil
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("POST", TokenEndpoint, nil))
+	if w.Header().Get("Referrer-Policy") != "" || w.Header().Get("X-Content-Type-Options") != "" || w.Header().Get("Content-Security-Policy") != "" {
+		t.Errorf("Test failed, unexpected headers %v", w.Header())
+	}
+}
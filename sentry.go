@@ -0,0 +1,168 @@
+package goauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SentryReporter is an ErrorReporter sending reports to Sentry using its store API, without depending on
+// the Sentry SDK. Reports are sent in the background so that they do not delay the response.
+type SentryReporter struct {
+	endpoint string
+	key      string
+	// Environment and Release are attached to each event if set.
+	Environment string
+	Release     string
+	// Client is used to send events. If nil, a client with a 10 second timeout is used.
+	Client *http.Client
+	// OnError is called if an event cannot be sent.
+	OnError func(err error)
+}
+
+// NewSentryReporter returns a SentryReporter for the project identified by the DSN, such as
+// https://public@o0.ingest.sentry.io/1.
+func NewSentryReporter(dsn string) (*SentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("goauth: invalid sentry dsn")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	project := path[i+1:]
+	if project == "" {
+		return nil, fmt.Errorf("goauth: invalid sentry dsn")
+	}
+	return &SentryReporter{
+		endpoint: u.Scheme + "://" + u.Host + path[:i] + "/api/" + project + "/store/",
+		key:      u.User.Username(),
+	}, nil
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+}
+
+type sentryEvent struct {
+	EventID     string                 `json:"event_id"`
+	Timestamp   string                 `json:"timestamp"`
+	Level       string                 `json:"level"`
+	Platform    string                 `json:"platform"`
+	Logger      string                 `json:"logger"`
+	Environment string                 `json:"environment,omitempty"`
+	Release     string                 `json:"release,omitempty"`
+	Tags        map[string]string      `json:"tags"`
+	Request     map[string]interface{} `json:"request"`
+	User        map[string]string      `json:"user,omitempty"`
+	Exception   struct {
+		Values []sentryException `json:"values"`
+	} `json:"exception"`
+}
+
+type sentryException struct {
+	Type       string `json:"type"`
+	Value      string `json:"value"`
+	Stacktrace struct {
+		Frames []sentryFrame `json:"frames"`
+	} `json:"stacktrace"`
+}
+
+// event returns the Sentry event of the report.
+func (s *SentryReporter) event(report ErrorReport) (sentryEvent, error) {
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return sentryEvent{}, err
+	}
+	e := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   timeNow().UTC().Format(time.RFC3339),
+		Level:       "error",
+		Platform:    "go",
+		Logger:      "goauth",
+		Environment: s.Environment,
+		Release:     s.Release,
+		Tags: map[string]string{
+			"request_id": report.RequestID,
+			"client_id":  report.ClientID,
+		},
+		Request: map[string]interface{}{
+			"method":       report.Method,
+			"url":          report.URL,
+			"query_string": report.Params.Encode(),
+		},
+	}
+	if report.RemoteAddr != "" {
+		e.User = map[string]string{"ip_address": report.RemoteAddr}
+	}
+	e.Exception.Values = make([]sentryException, 1)
+	value := &e.Exception.Values[0]
+	value.Type = fmt.Sprintf("%T", report.Err)
+	if report.Err != nil {
+		value.Value = report.Err.Error()
+	}
+	// Sentry expects frames ordered from the outermost to the innermost
+	for i := len(report.Stack) - 1; i >= 0; i-- {
+		f := report.Stack[i]
+		value.Stacktrace.Frames = append(value.Stacktrace.Frames, sentryFrame{f.Function, f.File, f.Line})
+	}
+	return e, nil
+}
+
+// ReportError sends the report to Sentry in the background.
+func (s *SentryReporter) ReportError(ctx context.Context, report ErrorReport) {
+	e, err := s.event(report)
+	if err == nil {
+		go s.send(e)
+		return
+	}
+	if s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// send posts the event to the store API.
+func (s *SentryReporter) send(e sentryEvent) {
+	err := s.post(e)
+	if err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+func (s *SentryReporter) post(e sentryEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", "Sentry sentry_version=7, sentry_client=goauth/1.0, sentry_key="+s.key)
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("goauth: sentry responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
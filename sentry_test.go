@@ -0,0 +1,71 @@
+package goauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSentryReporter(t *testing.T) {
+	events := make(chan sentryEvent, 1)
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/42/store/" {
+			http.NotFound(w, r)
+			return
+		}
+		auth = r.Header.Get("X-Sentry-Auth")
+		var e sentryEvent
+		json.NewDecoder(r.Body).Decode(&e)
+		events <- e
+	}))
+	defer ts.Close()
+
+	if _, err := NewSentryReporter("https://sentry.io/"); err == nil {
+		t.Error("Test failed, expected an invalid dsn to be rejected")
+	}
+	reporter, err := NewSentryReporter(strings.Replace(ts.URL, "://", "://publickey@", 1) + "/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter.OnError = func(err error) {
+		t.Error(err)
+	}
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(failingGrantBackend{NewMemSessionStoreBackend(), errors.New("connection refused")})
+	server.ErrorReporter = reporter
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", TokenEndpoint+"?code=secretcode", strings.NewReader("grant_type=client_credentials&client_secret=testclientsecret"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	server.ServeHTTP(w, r)
+	if w.Code != ErrorServerError.StatusCode {
+		t.Fatalf("Test failed, expected server_error got %d", w.Code)
+	}
+
+	select {
+	case e := <-events:
+		if !strings.Contains(auth, "sentry_key=publickey") {
+			t.Errorf("Test failed, unexpected auth header %s", auth)
+		}
+		if e.Tags["client_id"] != "testclientid" || e.Tags["request_id"] != w.Header().Get(RequestIDHeader) {
+			t.Errorf("Test failed, unexpected tags %v", e.Tags)
+		}
+		query, _ := e.Request["query_string"].(string)
+		if strings.Contains(query, "testclientsecret") || strings.Contains(query, "secretcode") || !strings.Contains(query, "grant_type=client_credentials") {
+			t.Errorf("Test failed, expected a scrubbed query got %s", query)
+		}
+		value := e.Exception.Values[0]
+		frames := value.Stacktrace.Frames
+		if value.Value != "connection refused" || len(frames) == 0 || !strings.HasSuffix(frames[len(frames)-1].Function, "handleClientCredentialsGrant") {
+			t.Errorf("Test failed, unexpected exception %v", value)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Test failed, expected an event to be sent")
+	}
+}
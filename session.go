@@ -1,11 +1,39 @@
 package goauth
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
 
 var (
-	// DefaultSessionStore is a default implementation of the session store using
-	// the MemSessionStoreBackend.
+	// DefaultSessionStore is a default implementation of the session store using the
+	// MemSessionStoreBackend. Servers created by New do not share it, each has its own SessionStore.
 	DefaultSessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	// ErrTokenCollision is returned by a GrantInserter if the access or refresh token of a new grant is
+	// already used by a stored grant.
+	ErrTokenCollision = errors.New("goauth: token already in use")
+	// ErrGrantRotated is returned when rotating the refresh token of a grant that has already been rotated
+	// or revoked, such as by a concurrent refresh request.
+	ErrGrantRotated = errors.New("goauth: grant already rotated")
+	// ErrVersionConflict is returned when updating a grant that has been modified since it was retrieved.
+	ErrVersionConflict = errors.New("goauth: grant modified concurrently")
+	// ErrStatusConflict is returned when updating a pending request that has been approved, denied or removed
+	// since it was retrieved.
+	ErrStatusConflict = errors.New("goauth: request completed concurrently")
+	// ErrBackChannelRequestsUnsupported is returned when storing back-channel authentication requests if the
+	// SessionStoreBackend does not implement BackChannelRequestStore.
+	ErrBackChannelRequestsUnsupported = errors.New("session store does not support back-channel authentication requests")
+	// ErrDeviceAuthorizationsUnsupported is returned when storing device authorization requests if the
+	// SessionStoreBackend does not implement DeviceAuthorizationStore.
+	ErrDeviceAuthorizationsUnsupported = errors.New("session store does not support device authorization requests")
+	// ErrVerificationCodesUnsupported is returned when storing verification codes if the SessionStoreBackend
+	// does not implement VerificationCodeStore.
+	ErrVerificationCodesUnsupported = errors.New("session store does not support verification codes")
+	// ErrIdempotentResponsesUnsupported is returned when storing idempotent responses if the
+	// SessionStoreBackend does not implement IdempotentResponseStore.
+	ErrIdempotentResponsesUnsupported = errors.New("session store does not support idempotent responses")
 )
 
 // SessionStoreBackend implements methods for storing, retrieving and refreshing
@@ -17,7 +45,7 @@ type SessionStoreBackend interface {
 	GetGrant(accessToken Secret) (Grant, error)
 	// DeleteGrant removes an existing Grant from the session store.
 	DeleteGrant(accessToken Secret) error
-	// RefreshGrant refreshes an existing Grant returning the updated grant.
+	// RefreshGrant retrieves an existing Grant from the session store by its refresh token.
 	RefreshGrant(refreshToken Secret) (Grant, error)
 	// PutAuthorizationCode stores a new AuthorizationCode in the session store.
 	PutAuthorizationCode(authCode AuthorizationCode) error
@@ -27,31 +55,156 @@ type SessionStoreBackend interface {
 	DeleteAuthorizationCode(code Secret) error
 }
 
+// GrantInserter may be implemented by a SessionStoreBackend to store new grants atomically. InsertGrant
+// stores the grant only if neither its access token nor its refresh token is used by a stored grant,
+// otherwise it returns ErrTokenCollision. SessionStore.NewGrant checks for collisions before storing
+// grants in backends that do not implement it, which is not safe against concurrent requests.
+type GrantInserter interface {
+	InsertGrant(grant Grant) error
+}
+
+// AuthorizationCodeConsumer may be implemented by a SessionStoreBackend to use authorization codes
+// atomically. ConsumeAuthorizationCode removes the AuthorizationCode from the session store and returns it,
+// or returns an error if it does not exist, so that a code can only be consumed once even by concurrent
+// requests.
+type AuthorizationCodeConsumer interface {
+	ConsumeAuthorizationCode(code Secret) (AuthorizationCode, error)
+}
+
+// GrantRotator may be implemented by a SessionStoreBackend to rotate refresh tokens atomically. RotateGrant
+// stores the new grant and replaces the stored grant with the access token of old, updating it to old if
+// old.ReplacedBy is set and removing it otherwise. It returns ErrGrantRotated without making any changes if
+// the stored grant has been removed or rotated, or its Version is not the expected version.
+type GrantRotator interface {
+	RotateGrant(old, new Grant, expectedVersion int64) error
+}
+
+// GrantUpdater may be implemented by a SessionStoreBackend to update grants using optimistic concurrency.
+// UpdateGrant stores the grant only if the Version of the stored grant with the same access token is the
+// expected version, otherwise it returns ErrVersionConflict. SQL backends can implement it as an UPDATE
+// conditional on the version column.
+type GrantUpdater interface {
+	UpdateGrant(grant Grant, expectedVersion int64) error
+}
+
+// BackChannelRequestStore may be implemented by a SessionStoreBackend to store the requests of Client
+// Initiated Backchannel Authentication. Back-channel authentication requests fail with
+// ErrBackChannelRequestsUnsupported if the backend does not implement it.
+type BackChannelRequestStore interface {
+	// PutBackChannelRequest stores a BackChannelRequest in the session store, replacing any existing
+	// request with the same auth_req_id.
+	PutBackChannelRequest(req BackChannelRequest) error
+	// GetBackChannelRequest retrieves an existing BackChannelRequest from the session store.
+	GetBackChannelRequest(authReqID Secret) (BackChannelRequest, error)
+	// DeleteBackChannelRequest removes an existing BackChannelRequest from the session store.
+	DeleteBackChannelRequest(authReqID Secret) error
+}
+
+// BackChannelRequestUpdater may be implemented by a SessionStoreBackend to update back-channel
+// authentication requests atomically. UpdateBackChannelRequest stores the request only if the Status of the
+// stored request with the same auth_req_id is the expected status, otherwise it returns ErrStatusConflict,
+// so that recording a poll cannot undo a concurrent approval.
+type BackChannelRequestUpdater interface {
+	UpdateBackChannelRequest(req BackChannelRequest, expectedStatus BackChannelStatus) error
+}
+
+// DeviceAuthorizationStore may be implemented by a SessionStoreBackend to store the requests of the
+// Device Authorization Grant. Device authorization requests fail with ErrDeviceAuthorizationsUnsupported
+// if the backend does not implement it.
+type DeviceAuthorizationStore interface {
+	// PutDeviceAuthorization stores a DeviceAuthorization in the session store, replacing any existing
+	// request with the same device code.
+	PutDeviceAuthorization(d DeviceAuthorization) error
+	// GetDeviceAuthorization retrieves an existing DeviceAuthorization by its device code. It returns
+	// ErrorAccessDenied if there is none.
+	GetDeviceAuthorization(deviceCode Secret) (DeviceAuthorization, error)
+	// GetDeviceAuthorizationByUserCode retrieves an existing DeviceAuthorization by its user code. It
+	// returns ErrorAccessDenied if there is none.
+	GetDeviceAuthorizationByUserCode(userCode string) (DeviceAuthorization, error)
+	// DeleteDeviceAuthorization removes an existing DeviceAuthorization from the session store.
+	DeleteDeviceAuthorization(deviceCode Secret) error
+}
+
+// VerificationCodeStore may be implemented by a SessionStoreBackend to store the codes sent to resource
+// owners to reset their password or verify their email address. The account flows are disabled if the
+// backend does not implement it.
+type VerificationCodeStore interface {
+	// PutVerificationCode stores a VerificationCode in the session store.
+	PutVerificationCode(v VerificationCode) error
+	// GetVerificationCode retrieves an existing VerificationCode from the session store.
+	GetVerificationCode(code Secret) (VerificationCode, error)
+	// DeleteVerificationCode removes an existing VerificationCode from the session store.
+	DeleteVerificationCode(code Secret) error
+}
+
+// IdempotentResponseStore may be implemented by a SessionStoreBackend to store token responses for replay
+// to retries of requests with an idempotency key. The Idempotency-Key header is ignored if the backend does
+// not implement it.
+type IdempotentResponseStore interface {
+	// PutIdempotentResponse stores an IdempotentResponse in the session store, it may be discarded once
+	// expired.
+	PutIdempotentResponse(resp IdempotentResponse) error
+	// GetIdempotentResponse retrieves an existing IdempotentResponse from the session store.
+	GetIdempotentResponse(key string) (IdempotentResponse, error)
+}
+
+// DeviceAuthorizationUpdater may be implemented by a SessionStoreBackend to update device authorization
+// requests atomically. UpdateDeviceAuthorization stores the request only if the Status of the stored request
+// with the same device code is the expected status, otherwise it returns ErrStatusConflict, so that
+// recording a poll cannot undo a concurrent approval or denial.
+type DeviceAuthorizationUpdater interface {
+	UpdateDeviceAuthorization(d DeviceAuthorization, expectedStatus DeviceStatus) error
+}
+
 // SessionStore wraps the SessionStoreBackend interface and
 // provides methods for interacting with the session store.
 type SessionStore struct {
 	SessionStoreBackend
+	// TokenSource generates the tokens of new records. If nil, NewToken is used.
+	TokenSource TokenSource
+	// TokenExpiry is the lifetime of new grants that do not set their own. If zero, DefaultTokenExpiry is
+	// used. The Server sets it to its TokenExpiry for the SessionStore used by each request.
+	TokenExpiry time.Duration
+	// AuthorizationCodeExpiry is the lifetime of new authorization codes that do not set their own. If zero,
+	// DefaultAuthorizationCodeExpiry is used. The Server sets it to its AuthorizationCodeExpiry for the
+	// SessionStore used by each request.
+	AuthorizationCodeExpiry time.Duration
 }
 
 // NewSessionStore returns a new SessionStore with the provided backend.
 func NewSessionStore(backend SessionStoreBackend) *SessionStore {
-	return &SessionStore{backend}
+	return &SessionStore{SessionStoreBackend: backend}
+}
+
+// newToken generates a token using the SessionStore's TokenSource.
+func (s *SessionStore) newToken() (Secret, error) {
+	return newTokenFrom(s.TokenSource)
 }
 
 // NewAuthorizationCode creates a new authorization code and saves it in the session store returning the
 // new auth code and any error that occurs.
 func (s *SessionStore) NewAuthorizationCode(clientID, redirectURI string, scope []string) (AuthorizationCode, error) {
-	code, err := NewToken()
-	if err != nil {
-		return AuthorizationCode{}, err
-	}
-	authCode := AuthorizationCode{
-		Code:        Secret(code),
+	return s.NewAuthorizationCodeFor(AuthorizationCode{
 		ClientID:    clientID,
 		RedirectURI: redirectURI,
 		Scope:       scope,
-		CreatedAt:   timeNow(),
-		ExpiresIn:   DefaultAuthorizationCodeExpiry,
+	})
+}
+
+// NewAuthorizationCodeFor assigns a new code to the given AuthorizationCode and saves it in the session
+// store returning the new auth code and any error that occurs.
+func (s *SessionStore) NewAuthorizationCodeFor(authCode AuthorizationCode) (AuthorizationCode, error) {
+	code, err := s.newToken()
+	if err != nil {
+		return AuthorizationCode{}, err
+	}
+	authCode.Code = Secret(code)
+	authCode.CreatedAt = timeNow()
+	if authCode.ExpiresIn == 0 {
+		authCode.ExpiresIn = s.AuthorizationCodeExpiry
+	}
+	if authCode.ExpiresIn == 0 {
+		authCode.ExpiresIn = DefaultAuthorizationCodeExpiry
 	}
 	// Check whether there is an existing authcode with this access token
 	existing, err := s.GetAuthorizationCode(authCode.Code)
@@ -63,6 +216,415 @@ func (s *SessionStore) NewAuthorizationCode(clientID, redirectURI string, scope
 	return authCode, s.PutAuthorizationCode(authCode)
 }
 
+// NewGrant creates a new grant with the provided scope and saves it in the session store, returning the
+// stored grant and any error that occurs.
+func (s *SessionStore) NewGrant(scope []string) (Grant, error) {
+	return s.NewGrantFor(Grant{Scope: scope})
+}
+
+// NewGrantFor assigns new access and refresh tokens to the given Grant and saves it in the session store,
+// returning the stored grant and any error that occurs. The ExpiresIn and TokenType of the grant default to
+// the SessionStore's TokenExpiry and DefaultTokenType.
+func (s *SessionStore) NewGrantFor(grant Grant) (Grant, error) {
+	grant.CreatedAt = timeNow()
+	if grant.ExpiresIn == 0 {
+		grant.ExpiresIn = s.TokenExpiry
+	}
+	if grant.ExpiresIn == 0 {
+		grant.ExpiresIn = DefaultTokenExpiry
+	}
+	if grant.TokenType == "" {
+		grant.TokenType = DefaultTokenType
+	}
+	// Collisions are unlikely but would hand one grant's tokens to another, therefore, retry a few times
+	for i := 0; i < 5; i++ {
+		accessToken, refreshToken, err := newGrantTokens(s.TokenSource)
+		if err != nil {
+			return Grant{}, err
+		}
+		grant.AccessToken = accessToken
+		grant.RefreshToken = refreshToken
+		err = s.insertGrant(grant)
+		if err != ErrTokenCollision {
+			return grant, err
+		}
+	}
+	return grant, ErrorServerError
+}
+
+// insertGrant stores a new grant unless its tokens are used by a stored grant, atomically if the backend
+// implements GrantInserter.
+func (s *SessionStore) insertGrant(grant Grant) error {
+	if inserter, ok := s.SessionStoreBackend.(GrantInserter); ok {
+		return inserter.InsertGrant(grant)
+	}
+	if _, err := s.GetGrant(grant.AccessToken); err == nil {
+		return ErrTokenCollision
+	}
+	if grant.RefreshToken != "" {
+		if _, err := s.RefreshGrant(grant.RefreshToken); err == nil {
+			return ErrTokenCollision
+		}
+	}
+	return s.PutGrant(grant)
+}
+
+// newGrantTokens generates new access and refresh tokens using the source.
+func newGrantTokens(source TokenSource) (Secret, Secret, error) {
+	accessToken, err := newTokenFrom(source)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := newTokenFrom(source)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// NewBackChannelRequest assigns a new auth_req_id to the given BackChannelRequest and saves it in the session
+// store as pending, returning the stored request and any error that occurs.
+func (s *SessionStore) NewBackChannelRequest(req BackChannelRequest) (BackChannelRequest, error) {
+	authReqID, err := s.newToken()
+	if err != nil {
+		return BackChannelRequest{}, err
+	}
+	req.AuthReqID = authReqID
+	req.Status = BackChannelStatusPending
+	req.CreatedAt = timeNow()
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = DefaultBackChannelRequestExpiry
+	}
+	if req.Interval == 0 {
+		req.Interval = DefaultBackChannelPollingInterval
+	}
+	// Check whether there is an existing request with this auth_req_id
+	existing, err := s.GetBackChannelRequest(req.AuthReqID)
+	if err == nil && existing.AuthReqID.RawString() == req.AuthReqID.RawString() {
+		return req, ErrorServerError
+	}
+	return req, s.PutBackChannelRequest(req)
+}
+
+// PutBackChannelRequest stores the BackChannelRequest if the backend implements BackChannelRequestStore,
+// otherwise it returns ErrBackChannelRequestsUnsupported.
+func (s *SessionStore) PutBackChannelRequest(req BackChannelRequest) error {
+	store, ok := s.SessionStoreBackend.(BackChannelRequestStore)
+	if !ok {
+		return ErrBackChannelRequestsUnsupported
+	}
+	return store.PutBackChannelRequest(req)
+}
+
+// GetBackChannelRequest retrieves the BackChannelRequest if the backend implements BackChannelRequestStore,
+// otherwise it returns ErrBackChannelRequestsUnsupported.
+func (s *SessionStore) GetBackChannelRequest(authReqID Secret) (BackChannelRequest, error) {
+	store, ok := s.SessionStoreBackend.(BackChannelRequestStore)
+	if !ok {
+		return BackChannelRequest{}, ErrBackChannelRequestsUnsupported
+	}
+	return store.GetBackChannelRequest(authReqID)
+}
+
+// DeleteBackChannelRequest removes the BackChannelRequest if the backend implements
+// BackChannelRequestStore, otherwise it returns ErrBackChannelRequestsUnsupported.
+func (s *SessionStore) DeleteBackChannelRequest(authReqID Secret) error {
+	store, ok := s.SessionStoreBackend.(BackChannelRequestStore)
+	if !ok {
+		return ErrBackChannelRequestsUnsupported
+	}
+	return store.DeleteBackChannelRequest(authReqID)
+}
+
+// UpdateBackChannelRequest stores the changes to a BackChannelRequest if the stored request has the expected
+// status, otherwise it returns ErrStatusConflict. Updates are atomic if the backend implements
+// BackChannelRequestUpdater.
+func (s *SessionStore) UpdateBackChannelRequest(req BackChannelRequest, expectedStatus BackChannelStatus) error {
+	if updater, ok := s.SessionStoreBackend.(BackChannelRequestUpdater); ok {
+		return updater.UpdateBackChannelRequest(req, expectedStatus)
+	}
+	stored, err := s.GetBackChannelRequest(req.AuthReqID)
+	if err == ErrBackChannelRequestsUnsupported {
+		return err
+	}
+	if err != nil || stored.Status != expectedStatus {
+		return ErrStatusConflict
+	}
+	return s.PutBackChannelRequest(req)
+}
+
+// PutDeviceAuthorization stores the DeviceAuthorization if the backend implements DeviceAuthorizationStore,
+// otherwise it returns ErrDeviceAuthorizationsUnsupported.
+func (s *SessionStore) PutDeviceAuthorization(d DeviceAuthorization) error {
+	store, ok := s.SessionStoreBackend.(DeviceAuthorizationStore)
+	if !ok {
+		return ErrDeviceAuthorizationsUnsupported
+	}
+	return store.PutDeviceAuthorization(d)
+}
+
+// GetDeviceAuthorization retrieves the DeviceAuthorization by its device code if the backend implements
+// DeviceAuthorizationStore, otherwise it returns ErrDeviceAuthorizationsUnsupported.
+func (s *SessionStore) GetDeviceAuthorization(deviceCode Secret) (DeviceAuthorization, error) {
+	store, ok := s.SessionStoreBackend.(DeviceAuthorizationStore)
+	if !ok {
+		return DeviceAuthorization{}, ErrDeviceAuthorizationsUnsupported
+	}
+	return store.GetDeviceAuthorization(deviceCode)
+}
+
+// GetDeviceAuthorizationByUserCode retrieves the DeviceAuthorization by its user code if the backend
+// implements DeviceAuthorizationStore, otherwise it returns ErrDeviceAuthorizationsUnsupported.
+func (s *SessionStore) GetDeviceAuthorizationByUserCode(userCode string) (DeviceAuthorization, error) {
+	store, ok := s.SessionStoreBackend.(DeviceAuthorizationStore)
+	if !ok {
+		return DeviceAuthorization{}, ErrDeviceAuthorizationsUnsupported
+	}
+	return store.GetDeviceAuthorizationByUserCode(userCode)
+}
+
+// DeleteDeviceAuthorization removes the DeviceAuthorization if the backend implements
+// DeviceAuthorizationStore, otherwise it returns ErrDeviceAuthorizationsUnsupported.
+func (s *SessionStore) DeleteDeviceAuthorization(deviceCode Secret) error {
+	store, ok := s.SessionStoreBackend.(DeviceAuthorizationStore)
+	if !ok {
+		return ErrDeviceAuthorizationsUnsupported
+	}
+	return store.DeleteDeviceAuthorization(deviceCode)
+}
+
+// UpdateDeviceAuthorization stores the changes to a DeviceAuthorization if the stored request has the
+// expected status, otherwise it returns ErrStatusConflict. Updates are atomic if the backend implements
+// DeviceAuthorizationUpdater.
+func (s *SessionStore) UpdateDeviceAuthorization(d DeviceAuthorization, expectedStatus DeviceStatus) error {
+	if updater, ok := s.SessionStoreBackend.(DeviceAuthorizationUpdater); ok {
+		return updater.UpdateDeviceAuthorization(d, expectedStatus)
+	}
+	stored, err := s.GetDeviceAuthorization(d.DeviceCode)
+	if err == ErrDeviceAuthorizationsUnsupported {
+		return err
+	}
+	if err != nil || stored.Status != expectedStatus {
+		return ErrStatusConflict
+	}
+	return s.PutDeviceAuthorization(d)
+}
+
+// NewDeviceAuthorization assigns a new device code and user code to the given DeviceAuthorization and
+// saves it in the session store as pending, returning the stored request and any error that occurs.
+func (s *SessionStore) NewDeviceAuthorization(d DeviceAuthorization, format UserCodeFormat) (DeviceAuthorization, error) {
+	deviceCode, err := s.newToken()
+	if err != nil {
+		return DeviceAuthorization{}, err
+	}
+	d.DeviceCode = deviceCode
+	d.Status = DeviceStatusPending
+	d.CreatedAt = timeNow()
+	if d.ExpiresIn == 0 {
+		d.ExpiresIn = DefaultDeviceCodeExpiry
+	}
+	if d.Interval == 0 {
+		d.Interval = DefaultDevicePollingInterval
+	}
+	// Check whether there is an existing request with this device code
+	existing, err := s.GetDeviceAuthorization(d.DeviceCode)
+	if err == nil && existing.DeviceCode.RawString() == d.DeviceCode.RawString() {
+		return d, ErrorServerError
+	}
+	if err != nil && err != ErrorAccessDenied {
+		return d, err
+	}
+	// User codes are short so collisions are possible, therefore, retry a few times. Only a code that is
+	// not found or has expired is free, other errors mean the backend could not check.
+	for i := 0; i < 5; i++ {
+		d.UserCode, err = format.Generate()
+		if err != nil {
+			return d, err
+		}
+		existing, err := s.GetDeviceAuthorizationByUserCode(d.UserCode)
+		if err == ErrorAccessDenied || (err == nil && existing.IsExpired()) {
+			return d, s.PutDeviceAuthorization(d)
+		}
+		if err != nil {
+			return d, err
+		}
+	}
+	return d, ErrorServerError
+}
+
+// PutVerificationCode stores the VerificationCode if the backend implements VerificationCodeStore,
+// otherwise it returns ErrVerificationCodesUnsupported.
+func (s *SessionStore) PutVerificationCode(v VerificationCode) error {
+	store, ok := s.SessionStoreBackend.(VerificationCodeStore)
+	if !ok {
+		return ErrVerificationCodesUnsupported
+	}
+	return store.PutVerificationCode(v)
+}
+
+// GetVerificationCode retrieves the VerificationCode if the backend implements VerificationCodeStore,
+// otherwise it returns ErrVerificationCodesUnsupported.
+func (s *SessionStore) GetVerificationCode(code Secret) (VerificationCode, error) {
+	store, ok := s.SessionStoreBackend.(VerificationCodeStore)
+	if !ok {
+		return VerificationCode{}, ErrVerificationCodesUnsupported
+	}
+	return store.GetVerificationCode(code)
+}
+
+// DeleteVerificationCode removes the VerificationCode if the backend implements VerificationCodeStore,
+// otherwise it returns ErrVerificationCodesUnsupported.
+func (s *SessionStore) DeleteVerificationCode(code Secret) error {
+	store, ok := s.SessionStoreBackend.(VerificationCodeStore)
+	if !ok {
+		return ErrVerificationCodesUnsupported
+	}
+	return store.DeleteVerificationCode(code)
+}
+
+// PutIdempotentResponse stores the IdempotentResponse if the backend implements IdempotentResponseStore,
+// otherwise it returns ErrIdempotentResponsesUnsupported.
+func (s *SessionStore) PutIdempotentResponse(resp IdempotentResponse) error {
+	store, ok := s.SessionStoreBackend.(IdempotentResponseStore)
+	if !ok {
+		return ErrIdempotentResponsesUnsupported
+	}
+	return store.PutIdempotentResponse(resp)
+}
+
+// GetIdempotentResponse retrieves the IdempotentResponse if the backend implements IdempotentResponseStore,
+// otherwise it returns ErrIdempotentResponsesUnsupported.
+func (s *SessionStore) GetIdempotentResponse(key string) (IdempotentResponse, error) {
+	store, ok := s.SessionStoreBackend.(IdempotentResponseStore)
+	if !ok {
+		return IdempotentResponse{}, ErrIdempotentResponsesUnsupported
+	}
+	return store.GetIdempotentResponse(key)
+}
+
+// NewVerificationCode assigns a new code to the given VerificationCode and saves it in the session store,
+// returning the stored code and any error that occurs.
+func (s *SessionStore) NewVerificationCode(v VerificationCode) (VerificationCode, error) {
+	code, err := s.newToken()
+	if err != nil {
+		return VerificationCode{}, err
+	}
+	v.Code = code
+	v.CreatedAt = timeNow()
+	// Check whether there is an existing verification code with this code
+	existing, err := s.GetVerificationCode(v.Code)
+	if err == nil && existing.Code.RawString() == v.Code.RawString() {
+		return v, ErrorServerError
+	}
+	return v, s.PutVerificationCode(v)
+}
+
+// CheckVerificationCode retrieves a VerificationCode and checks that it was issued for the given purpose
+// and has not expired. It returns an error if the code is invalid.
+func (s *SessionStore) CheckVerificationCode(code Secret, purpose VerificationPurpose) (VerificationCode, error) {
+	v, err := s.GetVerificationCode(code)
+	if err != nil {
+		return v, err
+	}
+	if v.Purpose != purpose || v.IsExpired() {
+		return v, ErrorAccessDenied
+	}
+	return v, nil
+}
+
+// ConsumeAuthorizationCode removes an AuthorizationCode from the session store, returning it. It returns an
+// error if the code does not exist, such as when it has already been consumed. Consumption is atomic if the
+// backend implements AuthorizationCodeConsumer, otherwise the code is retrieved and then deleted, relying on
+// the backend's DeleteAuthorizationCode to fail for codes that have already been deleted.
+func (s *SessionStore) ConsumeAuthorizationCode(code Secret) (AuthorizationCode, error) {
+	if consumer, ok := s.SessionStoreBackend.(AuthorizationCodeConsumer); ok {
+		return consumer.ConsumeAuthorizationCode(code)
+	}
+	authCode, err := s.GetAuthorizationCode(code)
+	if err != nil {
+		return authCode, err
+	}
+	return authCode, s.DeleteAuthorizationCode(code)
+}
+
+// UpdateGrant stores the changes to a grant retrieved from the session store, incrementing its Version. It
+// returns ErrVersionConflict if the stored grant has been modified or removed since it was retrieved, in
+// which case the grant should be retrieved again before retrying. Updates are atomic if the backend
+// implements GrantUpdater.
+func (s *SessionStore) UpdateGrant(grant Grant) (Grant, error) {
+	expectedVersion := grant.Version
+	grant.Version++
+	return grant, s.updateGrant(grant, expectedVersion)
+}
+
+// updateGrant stores the grant if the stored grant has the expected version, atomically if the backend
+// implements GrantUpdater.
+func (s *SessionStore) updateGrant(grant Grant, expectedVersion int64) error {
+	if updater, ok := s.SessionStoreBackend.(GrantUpdater); ok {
+		return updater.UpdateGrant(grant, expectedVersion)
+	}
+	stored, err := s.GetGrant(grant.AccessToken)
+	if err != nil || stored.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+	return s.PutGrant(grant)
+}
+
+// ModifyGrant applies the modification to the stored grant with the access token and stores the result,
+// retrying with the latest grant if it is modified concurrently. It returns the updated grant.
+func (s *SessionStore) ModifyGrant(accessToken Secret, modify func(grant *Grant) error) (Grant, error) {
+	for i := 0; i < 5; i++ {
+		grant, err := s.GetGrant(accessToken)
+		if err != nil {
+			return Grant{}, err
+		}
+		err = modify(&grant)
+		if err != nil {
+			return Grant{}, err
+		}
+		grant, err = s.UpdateGrant(grant)
+		if err != ErrVersionConflict {
+			return grant, err
+		}
+	}
+	return Grant{}, ErrVersionConflict
+}
+
+// RotateGrant replaces a grant retrieved using its refresh token with the new grant issued by refreshing it.
+// If the grace period is zero or the new grant reuses the refresh token, the old grant is removed, otherwise
+// it is kept, recording its replacement, so that retries within the grace period can receive the new grant.
+// It returns the old grant as stored and ErrGrantRotated if the old grant was rotated or revoked
+// concurrently. Rotation is atomic if the backend implements GrantRotator.
+func (s *SessionStore) RotateGrant(old, new Grant, gracePeriod time.Duration) (Grant, error) {
+	expectedVersion := old.Version
+	if gracePeriod > 0 && new.RefreshToken != old.RefreshToken {
+		old.ReplacedBy = new.AccessToken
+		old.ReplacedAt = timeNow()
+		old.Version++
+	}
+	return old, s.rotateGrant(old, new, expectedVersion)
+}
+
+// rotateGrant replaces the old grant with the new grant, atomically if the backend implements GrantRotator.
+func (s *SessionStore) rotateGrant(old, new Grant, expectedVersion int64) error {
+	if rotator, ok := s.SessionStoreBackend.(GrantRotator); ok {
+		return rotator.RotateGrant(old, new, expectedVersion)
+	}
+	stored, err := s.GetGrant(old.AccessToken)
+	if err != nil || stored.ReplacedBy != "" || stored.Version != expectedVersion {
+		return ErrGrantRotated
+	}
+	if old.ReplacedBy != "" {
+		err = s.PutGrant(old)
+	} else {
+		err = s.DeleteGrant(old.AccessToken)
+	}
+	if err != nil {
+		return err
+	}
+	return s.PutGrant(new)
+}
+
 // CheckAuthorizationCode retrieves an AuthorizationCode and validates it against the given
 // code and redirect URI. It returns an error if the code is invalid or any other errors occur.
 func (s *SessionStore) CheckAuthorizationCode(code Secret, redirectURI string) (AuthorizationCode, error) {
@@ -88,6 +650,62 @@ func (s *SessionStore) CheckGrant(accessToken Secret) (Grant, error) {
 	if err != nil {
 		return grant, err
 	}
+	return grant, s.checkGrant(accessToken, grant)
+}
+
+// GrantResult is the result of checking one of the access tokens passed to CheckGrants. Err is nil if the
+// Grant is valid.
+type GrantResult struct {
+	Grant Grant
+	Err   error
+}
+
+// GrantBatchGetter may be implemented by a SessionStoreBackend to retrieve many grants in a single round
+// trip, such as using MGET or a query with an IN clause. GetGrants returns the stored grants keyed by their
+// access token, omitting access tokens that do not exist.
+type GrantBatchGetter interface {
+	GetGrants(accessTokens []Secret) (map[Secret]Grant, error)
+}
+
+// CheckGrants checks many access tokens as CheckGrant does, returning the result for each access token.
+// It allows gateways validating many concurrent requests to amortize the round trips to the backend, which
+// retrieves the grants in one request if it implements GrantBatchGetter. An error is returned if the grants
+// could not be retrieved.
+func (s *SessionStore) CheckGrants(accessTokens []Secret) (map[Secret]GrantResult, error) {
+	results := make(map[Secret]GrantResult, len(accessTokens))
+	getter, ok := s.SessionStoreBackend.(GrantBatchGetter)
+	if !ok {
+		for _, accessToken := range accessTokens {
+			grant, err := s.CheckGrant(accessToken)
+			results[accessToken] = GrantResult{grant, err}
+		}
+		return results, nil
+	}
+	grants, err := getter.GetGrants(accessTokens)
+	if err != nil {
+		return nil, err
+	}
+	for _, accessToken := range accessTokens {
+		grant, ok := grants[accessToken]
+		if !ok {
+			results[accessToken] = GrantResult{Err: ErrorAccessDenied}
+			continue
+		}
+		results[accessToken] = GrantResult{grant, s.checkGrant(accessToken, grant)}
+	}
+	return results, nil
+}
+
+// checkGrant checks that a grant retrieved from the session store is valid, deleting it if it has expired.
+func (s *SessionStore) checkGrant(accessToken Secret, grant Grant) error {
+	// Grants replaced by refreshing are revoked, they are only kept for the refresh token grace period
+	if grant.ReplacedBy != "" {
+		return ErrorAccessDenied
+	}
+	// Grants are not valid before their NotBefore time
+	if !grant.NotBefore.IsZero() && grant.NotBefore.After(timeNow()) {
+		return ErrorAccessDenied
+	}
 	if grant.IsExpired() {
 		// In the event that the grant has expired, ensure that it is deleted
 		// from the session store. In practice, SessionStoreBackend implementations
@@ -96,23 +714,51 @@ func (s *SessionStore) CheckGrant(accessToken Secret) (Grant, error) {
 		if err == nil {
 			err = ErrorAccessDenied
 		}
-		return grant, err
+		return err
 	}
-	return grant, nil
+	return nil
 }
 
 // MemSessionStoreBackend is an in-memory session store, implementing the SessionStore interface.
 type MemSessionStoreBackend struct {
-	mtx       *sync.Mutex
-	grants    map[string]Grant
-	authCodes map[string]AuthorizationCode
+	mtx                  *sync.Mutex
+	grants               map[string]Grant
+	authCodes            map[string]AuthorizationCode
+	backChannelRequests  map[string]BackChannelRequest
+	deviceAuthorizations map[string]DeviceAuthorization
+	userCodes            map[string]string
+	verificationCodes    map[string]VerificationCode
+	idempotentResponses  map[string]IdempotentResponse
+	name                 string
+	namespaces           *memNamespaces
+}
+
+// memNamespaces holds the namespaces of a MemSessionStoreBackend and the log to which changes are written if
+// it is persisted, shared by the backends of each namespace.
+type memNamespaces struct {
+	root     *MemSessionStoreBackend
+	backends map[string]*MemSessionStoreBackend
+	wal      *memWAL
 }
 
 func NewMemSessionStoreBackend() *MemSessionStoreBackend {
+	return newMemSessionStoreBackend(&sync.Mutex{}, nil)
+}
+
+// newMemSessionStoreBackend returns an empty backend using the mutex and namespaces, which are shared by
+// the backends of each namespace.
+func newMemSessionStoreBackend(mtx *sync.Mutex, namespaces *memNamespaces) *MemSessionStoreBackend {
 	return &MemSessionStoreBackend{
-		&sync.Mutex{},
+		mtx,
 		make(map[string]Grant),
 		make(map[string]AuthorizationCode),
+		make(map[string]BackChannelRequest),
+		make(map[string]DeviceAuthorization),
+		make(map[string]string),
+		make(map[string]VerificationCode),
+		make(map[string]IdempotentResponse),
+		"",
+		namespaces,
 	}
 }
 
@@ -120,8 +766,68 @@ func NewMemSessionStoreBackend() *MemSessionStoreBackend {
 func (m *MemSessionStoreBackend) PutGrant(grant Grant) error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
-	m.grants[grant.AccessToken.RawString()] = grant
-	return nil
+	return m.put(SessionRecord{Grant: &grant})
+}
+
+// InsertGrant stores a Grant in the session store unless its access or refresh token is already in use.
+func (m *MemSessionStoreBackend) InsertGrant(grant Grant) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.grants[grant.AccessToken.RawString()]; ok {
+		return ErrTokenCollision
+	}
+	if grant.RefreshToken != "" {
+		for _, existing := range m.grants {
+			if existing.RefreshToken.RawString() == grant.RefreshToken.RawString() {
+				return ErrTokenCollision
+			}
+		}
+	}
+	return m.put(SessionRecord{Grant: &grant})
+}
+
+// RotateGrant stores the new Grant, replacing or removing the old Grant, unless the old Grant has changed.
+func (m *MemSessionStoreBackend) RotateGrant(old, new Grant, expectedVersion int64) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	stored, ok := m.grants[old.AccessToken.RawString()]
+	if !ok || stored.ReplacedBy != "" || stored.Version != expectedVersion {
+		return ErrGrantRotated
+	}
+	var err error
+	if old.ReplacedBy != "" {
+		err = m.put(SessionRecord{Grant: &old})
+	} else {
+		err = m.remove(SessionRecord{Grant: &Grant{AccessToken: old.AccessToken}})
+	}
+	if err != nil {
+		return err
+	}
+	return m.put(SessionRecord{Grant: &new})
+}
+
+// GetGrants retrieves the Grants with the access tokens from the session store.
+func (m *MemSessionStoreBackend) GetGrants(accessTokens []Secret) (map[Secret]Grant, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	grants := make(map[Secret]Grant, len(accessTokens))
+	for _, accessToken := range accessTokens {
+		if grant, ok := m.grants[accessToken.RawString()]; ok {
+			grants[accessToken] = grant
+		}
+	}
+	return grants, nil
+}
+
+// UpdateGrant stores the Grant if the stored Grant has the expected version.
+func (m *MemSessionStoreBackend) UpdateGrant(grant Grant, expectedVersion int64) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	stored, ok := m.grants[grant.AccessToken.RawString()]
+	if !ok || stored.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+	return m.put(SessionRecord{Grant: &grant})
 }
 
 // GetGrant retrieves a Grant from the session store.
@@ -139,23 +845,31 @@ func (m *MemSessionStoreBackend) DeleteGrant(accessToken Secret) error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 	if _, ok := m.grants[accessToken.RawString()]; ok {
-		delete(m.grants, accessToken.RawString())
-		return nil
+		return m.remove(SessionRecord{Grant: &Grant{AccessToken: accessToken}})
 	}
 	return ErrorServerError
 }
 
-// RefreshGrant refreshes an existing Grant returning the updated grant.
+// RefreshGrant retrieves a Grant from the session store by its refresh token.
 func (m *MemSessionStoreBackend) RefreshGrant(refreshToken Secret) (Grant, error) {
-	return Grant{}, ErrorServerError
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if refreshToken == "" {
+		return Grant{}, ErrorAccessDenied
+	}
+	for _, grant := range m.grants {
+		if grant.RefreshToken.RawString() == refreshToken.RawString() {
+			return grant, nil
+		}
+	}
+	return Grant{}, ErrorAccessDenied
 }
 
 // PutAuthorizationCode stores a AuthorizationCode in the session store.
 func (m *MemSessionStoreBackend) PutAuthorizationCode(authCode AuthorizationCode) error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
-	m.authCodes[authCode.Code.RawString()] = authCode
-	return nil
+	return m.put(SessionRecord{AuthorizationCode: &authCode})
 }
 
 // GetAuthorizationCode retrieves an AuthorizationCode from the session store.
@@ -173,8 +887,349 @@ func (m *MemSessionStoreBackend) DeleteAuthorizationCode(code Secret) error {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
 	if _, ok := m.authCodes[code.RawString()]; ok {
-		delete(m.authCodes, code.RawString())
-		return nil
+		return m.remove(SessionRecord{AuthorizationCode: &AuthorizationCode{Code: code}})
+	}
+	return ErrorServerError
+}
+
+// ConsumeAuthorizationCode removes a AuthorizationCode from the session store and returns it.
+func (m *MemSessionStoreBackend) ConsumeAuthorizationCode(code Secret) (AuthorizationCode, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if authCode, ok := m.authCodes[code.RawString()]; ok {
+		return authCode, m.remove(SessionRecord{AuthorizationCode: &AuthorizationCode{Code: code}})
+	}
+	return AuthorizationCode{}, ErrorAccessDenied
+}
+
+// PutBackChannelRequest stores a BackChannelRequest in the session store.
+func (m *MemSessionStoreBackend) PutBackChannelRequest(req BackChannelRequest) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.put(SessionRecord{BackChannelRequest: &req})
+}
+
+// UpdateBackChannelRequest stores the BackChannelRequest if the stored request has the expected status.
+func (m *MemSessionStoreBackend) UpdateBackChannelRequest(req BackChannelRequest, expectedStatus BackChannelStatus) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	stored, ok := m.backChannelRequests[req.AuthReqID.RawString()]
+	if !ok || stored.Status != expectedStatus {
+		return ErrStatusConflict
+	}
+	return m.put(SessionRecord{BackChannelRequest: &req})
+}
+
+// GetBackChannelRequest retrieves a BackChannelRequest from the session store.
+func (m *MemSessionStoreBackend) GetBackChannelRequest(authReqID Secret) (BackChannelRequest, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if req, ok := m.backChannelRequests[authReqID.RawString()]; ok {
+		return req, nil
+	}
+	return BackChannelRequest{}, ErrorAccessDenied
+}
+
+// DeleteBackChannelRequest removes a BackChannelRequest from the session store.
+func (m *MemSessionStoreBackend) DeleteBackChannelRequest(authReqID Secret) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.backChannelRequests[authReqID.RawString()]; ok {
+		return m.remove(SessionRecord{BackChannelRequest: &BackChannelRequest{AuthReqID: authReqID}})
+	}
+	return ErrorServerError
+}
+
+// PutDeviceAuthorization stores a DeviceAuthorization in the session store.
+func (m *MemSessionStoreBackend) PutDeviceAuthorization(d DeviceAuthorization) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.put(SessionRecord{DeviceAuthorization: &d})
+}
+
+// UpdateDeviceAuthorization stores the DeviceAuthorization if the stored request has the expected status.
+func (m *MemSessionStoreBackend) UpdateDeviceAuthorization(d DeviceAuthorization, expectedStatus DeviceStatus) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	stored, ok := m.deviceAuthorizations[d.DeviceCode.RawString()]
+	if !ok || stored.Status != expectedStatus {
+		return ErrStatusConflict
+	}
+	return m.put(SessionRecord{DeviceAuthorization: &d})
+}
+
+// GetDeviceAuthorization retrieves a DeviceAuthorization from the session store.
+func (m *MemSessionStoreBackend) GetDeviceAuthorization(deviceCode Secret) (DeviceAuthorization, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if d, ok := m.deviceAuthorizations[deviceCode.RawString()]; ok {
+		return d, nil
+	}
+	return DeviceAuthorization{}, ErrorAccessDenied
+}
+
+// GetDeviceAuthorizationByUserCode retrieves a DeviceAuthorization from the session store.
+func (m *MemSessionStoreBackend) GetDeviceAuthorizationByUserCode(userCode string) (DeviceAuthorization, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if d, ok := m.deviceAuthorizations[m.userCodes[userCode]]; ok {
+		return d, nil
+	}
+	return DeviceAuthorization{}, ErrorAccessDenied
+}
+
+// DeleteDeviceAuthorization removes a DeviceAuthorization from the session store.
+func (m *MemSessionStoreBackend) DeleteDeviceAuthorization(deviceCode Secret) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.deviceAuthorizations[deviceCode.RawString()]; ok {
+		return m.remove(SessionRecord{DeviceAuthorization: &DeviceAuthorization{DeviceCode: deviceCode}})
+	}
+	return ErrorServerError
+}
+
+// PutVerificationCode stores a VerificationCode in the session store.
+func (m *MemSessionStoreBackend) PutVerificationCode(v VerificationCode) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.put(SessionRecord{VerificationCode: &v})
+}
+
+// GetVerificationCode retrieves a VerificationCode from the session store.
+func (m *MemSessionStoreBackend) GetVerificationCode(code Secret) (VerificationCode, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if v, ok := m.verificationCodes[code.RawString()]; ok {
+		return v, nil
+	}
+	return VerificationCode{}, ErrorAccessDenied
+}
+
+// DeleteVerificationCode removes a VerificationCode from the session store.
+func (m *MemSessionStoreBackend) DeleteVerificationCode(code Secret) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.verificationCodes[code.RawString()]; ok {
+		return m.remove(SessionRecord{VerificationCode: &VerificationCode{Code: code}})
 	}
 	return ErrorServerError
 }
+
+// PutIdempotentResponse stores an IdempotentResponse in the session store.
+func (m *MemSessionStoreBackend) PutIdempotentResponse(resp IdempotentResponse) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.put(SessionRecord{IdempotentResponse: &resp})
+}
+
+// GetIdempotentResponse retrieves an IdempotentResponse from the session store, removing it if it has
+// expired.
+func (m *MemSessionStoreBackend) GetIdempotentResponse(key string) (IdempotentResponse, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if resp, ok := m.idempotentResponses[key]; ok {
+		if !resp.IsExpired() {
+			return resp, nil
+		}
+		m.remove(SessionRecord{IdempotentResponse: &IdempotentResponse{Key: key}})
+	}
+	return IdempotentResponse{}, ErrorAccessDenied
+}
+
+// SweepExpired removes at most limit expired records.
+func (m *MemSessionStoreBackend) SweepExpired(ctx context.Context, limit int, onRemove func(Grant) error) (int, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	n := 0
+	for k, v := range m.grants {
+		if n >= limit {
+			return n, nil
+		}
+		if v.Sweepable() {
+			if onRemove != nil {
+				err := onRemove(v)
+				if err != nil {
+					return n, err
+				}
+			}
+			err := m.remove(SessionRecord{Grant: &Grant{AccessToken: Secret(k)}})
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	for k, v := range m.authCodes {
+		if n >= limit {
+			return n, nil
+		}
+		if v.IsExpired() {
+			err := m.remove(SessionRecord{AuthorizationCode: &AuthorizationCode{Code: Secret(k)}})
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	for k, v := range m.backChannelRequests {
+		if n >= limit {
+			return n, nil
+		}
+		if v.IsExpired() {
+			err := m.remove(SessionRecord{BackChannelRequest: &BackChannelRequest{AuthReqID: Secret(k)}})
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	for k, v := range m.deviceAuthorizations {
+		if n >= limit {
+			return n, nil
+		}
+		if v.IsExpired() {
+			err := m.remove(SessionRecord{DeviceAuthorization: &DeviceAuthorization{DeviceCode: Secret(k)}})
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	for k, v := range m.verificationCodes {
+		if n >= limit {
+			return n, nil
+		}
+		if v.IsExpired() {
+			err := m.remove(SessionRecord{VerificationCode: &VerificationCode{Code: Secret(k)}})
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	for k, v := range m.idempotentResponses {
+		if n >= limit {
+			return n, nil
+		}
+		if v.IsExpired() {
+			err := m.remove(SessionRecord{IdempotentResponse: &IdempotentResponse{Key: k}})
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Namespace returns the backend holding the records of the namespace, sharing the lock of this backend.
+func (m *MemSessionStoreBackend) Namespace(name string) (SessionStoreBackend, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.namespace(name, true), nil
+}
+
+// namespace returns the backend of the namespace, creating it if create is true. The lock must be held.
+func (m *MemSessionStoreBackend) namespace(name string, create bool) *MemSessionStoreBackend {
+	if m.namespaces == nil {
+		m.namespaces = &memNamespaces{root: m, backends: make(map[string]*MemSessionStoreBackend)}
+	}
+	if name == "" {
+		return m.namespaces.root
+	}
+	b, ok := m.namespaces.backends[name]
+	if !ok && create {
+		b = newMemSessionStoreBackend(m.mtx, m.namespaces)
+		b.name = name
+		m.namespaces.backends[name] = b
+	}
+	return b
+}
+
+// PurgeNamespace removes all records held in the namespace.
+func (m *MemSessionStoreBackend) PurgeNamespace(ctx context.Context, name string, onRemove func(Grant) error) (int, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	b := m.namespace(name, false)
+	if b == nil {
+		return 0, nil
+	}
+	n := 0
+	for _, record := range b.records() {
+		if record.Grant != nil && onRemove != nil {
+			err := onRemove(*record.Grant)
+			if err != nil {
+				return n, err
+			}
+		}
+		err := b.remove(record)
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// ExportRecords calls fn with a snapshot of the records held in memory, so that the backend is not locked
+// while they are exported.
+func (m *MemSessionStoreBackend) ExportRecords(ctx context.Context, fn func(SessionRecord) error) error {
+	m.mtx.Lock()
+	records := m.records()
+	m.mtx.Unlock()
+	for _, record := range records {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+		err = fn(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// records returns the records held in memory. The lock must be held.
+func (m *MemSessionStoreBackend) records() []SessionRecord {
+	records := make([]SessionRecord, 0, len(m.grants)+len(m.authCodes))
+	for _, v := range m.grants {
+		v := v
+		records = append(records, SessionRecord{Grant: &v})
+	}
+	for _, v := range m.authCodes {
+		v := v
+		records = append(records, SessionRecord{AuthorizationCode: &v})
+	}
+	for _, v := range m.backChannelRequests {
+		v := v
+		records = append(records, SessionRecord{BackChannelRequest: &v})
+	}
+	for _, v := range m.deviceAuthorizations {
+		v := v
+		records = append(records, SessionRecord{DeviceAuthorization: &v})
+	}
+	for _, v := range m.verificationCodes {
+		v := v
+		records = append(records, SessionRecord{VerificationCode: &v})
+	}
+	for _, v := range m.idempotentResponses {
+		v := v
+		records = append(records, SessionRecord{IdempotentResponse: &v})
+	}
+	return records
+}
+
+// Stats returns the number of records held in memory, including expired records.
+func (m *MemSessionStoreBackend) Stats() (SessionStoreStats, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return SessionStoreStats{
+		Grants:               int64(len(m.grants)),
+		AuthorizationCodes:   int64(len(m.authCodes)),
+		BackChannelRequests:  int64(len(m.backChannelRequests)),
+		DeviceAuthorizations: int64(len(m.deviceAuthorizations)),
+		VerificationCodes:    int64(len(m.verificationCodes)),
+		IdempotentResponses:  int64(len(m.idempotentResponses)),
+	}, nil
+}
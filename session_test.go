@@ -4,14 +4,27 @@ import (
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 )
 
+// baseSessionStoreBackend wraps a SessionStoreBackend hiding any optional interfaces it implements.
+type baseSessionStoreBackend struct {
+	SessionStoreBackend
+}
+
 func TestSessionStore(t *testing.T) {
 	// Test creating a new Grant and retrieving it from the session store.
 	ss := NewSessionStore(&MemSessionStoreBackend{
 		&sync.Mutex{},
 		make(map[string]Grant),
 		make(map[string]AuthorizationCode),
+		make(map[string]BackChannelRequest),
+		make(map[string]DeviceAuthorization),
+		make(map[string]string),
+		make(map[string]VerificationCode),
+		make(map[string]IdempotentResponse),
+		"",
+		nil,
 	})
 	grant := Grant{Scope: []string{"testscope"}}
 	err := ss.PutGrant(grant)
@@ -26,3 +39,208 @@ func TestSessionStore(t *testing.T) {
 		t.Errorf("Test failed, expected %v to equal %v", grant, grant2)
 	}
 }
+
+func TestSessionStoreNewGrant(t *testing.T) {
+	backends := map[string]SessionStoreBackend{
+		"atomic":   NewMemSessionStoreBackend(),
+		"fallback": struct{ SessionStoreBackend }{NewMemSessionStoreBackend()},
+	}
+	for name, backend := range backends {
+		ss := NewSessionStore(backend)
+		grant, err := ss.NewGrant([]string{"testscope"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if grant.AccessToken == "" || grant.RefreshToken == "" || grant.ExpiresIn != DefaultTokenExpiry || grant.TokenType != DefaultTokenType {
+			t.Errorf("Test failed, %s: unexpected grant %v", name, grant)
+		}
+		stored, err := ss.GetGrant(grant.AccessToken)
+		if err != nil || !reflect.DeepEqual(grant, stored) {
+			t.Errorf("Test failed, %s: expected %v to equal %v", name, grant, stored)
+		}
+
+		// Colliding tokens are regenerated
+		var mtx sync.Mutex
+		tokens := []Secret{grant.AccessToken, "refresh", "access", grant.RefreshToken, "access", "refresh"}
+		ss.TokenSource = TokenSourceFunc(func() (Secret, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			token := tokens[0]
+			tokens = tokens[1:]
+			return token, nil
+		})
+		grant, err = ss.NewGrant([]string{"testscope"})
+		if err != nil || grant.AccessToken != "access" || grant.RefreshToken != "refresh" {
+			t.Errorf("Test failed, %s: unexpected grant %v %v", name, grant, err)
+		}
+	}
+
+	// Concurrent requests generating the same tokens cannot both store a grant
+	ss := NewSessionStore(NewMemSessionStoreBackend())
+	ss.TokenSource = TokenSourceFunc(func() (Secret, error) { return "token", nil })
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	var stored int
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ss.NewGrant(nil); err == nil {
+				mtx.Lock()
+				stored++
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if stored != 1 {
+		t.Errorf("Test failed, expected one grant to be stored got %d", stored)
+	}
+}
+
+func TestConsumeAuthorizationCode(t *testing.T) {
+	backends := map[string]SessionStoreBackend{
+		"atomic":   NewMemSessionStoreBackend(),
+		"fallback": struct{ SessionStoreBackend }{NewMemSessionStoreBackend()},
+	}
+	for name, backend := range backends {
+		ss := NewSessionStore(backend)
+		authCode, err := ss.NewAuthorizationCode("testclientid", "https://testuri.com", []string{"testscope"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		consumed, err := ss.ConsumeAuthorizationCode(authCode.Code)
+		if err != nil || !reflect.DeepEqual(consumed, authCode) {
+			t.Errorf("Test failed, %s: expected %v got %v %v", name, authCode, consumed, err)
+		}
+		if _, err := ss.ConsumeAuthorizationCode(authCode.Code); err == nil {
+			t.Errorf("Test failed, %s: expected the code to be consumed only once", name)
+		}
+	}
+}
+
+func TestRotateGrant(t *testing.T) {
+	backends := map[string]SessionStoreBackend{
+		"atomic":   NewMemSessionStoreBackend(),
+		"fallback": struct{ SessionStoreBackend }{NewMemSessionStoreBackend()},
+	}
+	for name, backend := range backends {
+		ss := NewSessionStore(backend)
+		old := Grant{AccessToken: "access", RefreshToken: "refresh", CreatedAt: time.Now(), ExpiresIn: time.Hour}
+		if err := ss.PutGrant(old); err != nil {
+			t.Fatal(err)
+		}
+		// The old grant is kept for the grace period
+		first := Grant{AccessToken: "access2", RefreshToken: "refresh2", CreatedAt: time.Now(), ExpiresIn: time.Hour}
+		replaced, err := ss.RotateGrant(old, first, time.Minute)
+		if err != nil || replaced.ReplacedBy != "access2" {
+			t.Errorf("Test failed, %s: unexpected rotation %v %v", name, replaced, err)
+		}
+		if stored, err := ss.GetGrant("access"); err != nil || stored.ReplacedBy != "access2" {
+			t.Errorf("Test failed, %s: expected the old grant to be kept got %v %v", name, stored, err)
+		}
+		// A grant cannot be rotated twice
+		second := Grant{AccessToken: "access3", RefreshToken: "refresh3", CreatedAt: time.Now(), ExpiresIn: time.Hour}
+		if _, err := ss.RotateGrant(old, second, 0); err != ErrGrantRotated {
+			t.Errorf("Test failed, %s: expected %v got %v", name, ErrGrantRotated, err)
+		}
+		if _, err := ss.GetGrant("access3"); err == nil {
+			t.Errorf("Test failed, %s: expected the second grant not to be stored", name)
+		}
+		// Without a grace period the old grant is removed
+		if _, err := ss.RotateGrant(first, second, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ss.GetGrant("access2"); err == nil {
+			t.Errorf("Test failed, %s: expected the old grant to be removed", name)
+		}
+	}
+}
+
+func TestUpdateGrant(t *testing.T) {
+	backends := map[string]SessionStoreBackend{
+		"atomic":   NewMemSessionStoreBackend(),
+		"fallback": struct{ SessionStoreBackend }{NewMemSessionStoreBackend()},
+	}
+	for name, backend := range backends {
+		ss := NewSessionStore(backend)
+		grant := Grant{AccessToken: "access", RefreshToken: "refresh", Scope: []string{"read"}, CreatedAt: time.Now(), ExpiresIn: time.Hour}
+		if err := ss.PutGrant(grant); err != nil {
+			t.Fatal(err)
+		}
+		// A stale copy of the grant cannot overwrite a newer update
+		stale := grant
+		grant.Scope = []string{"read", "write"}
+		grant, err := ss.UpdateGrant(grant)
+		if err != nil || grant.Version != 1 {
+			t.Fatalf("Test failed, %s: unexpected update %v %v", name, grant, err)
+		}
+		stale.Scope = nil
+		if _, err := ss.UpdateGrant(stale); err != ErrVersionConflict {
+			t.Errorf("Test failed, %s: expected %v got %v", name, ErrVersionConflict, err)
+		}
+		// Nor can a refresh that retrieved the grant before it was updated rotate it
+		if _, err := ss.RotateGrant(stale, Grant{AccessToken: "access2"}, 0); err != ErrGrantRotated {
+			t.Errorf("Test failed, %s: expected %v got %v", name, ErrGrantRotated, err)
+		}
+	}
+
+	// Concurrent modifications are retried rather than lost
+	ss := NewSessionStore(NewMemSessionStoreBackend())
+	if err := ss.PutGrant(Grant{AccessToken: "access"}); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := ss.ModifyGrant("access", func(grant *Grant) error {
+				grant.Scope = append(grant.Scope, string(rune('a'+i)))
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	grant, err := ss.GetGrant("access")
+	if err != nil || len(grant.Scope) != 3 || grant.Version != 3 {
+		t.Errorf("Test failed, expected all modifications to be applied got %v %v", grant, err)
+	}
+}
+
+func TestCheckGrants(t *testing.T) {
+	backends := map[string]SessionStoreBackend{
+		"batch":    NewMemSessionStoreBackend(),
+		"fallback": struct{ SessionStoreBackend }{NewMemSessionStoreBackend()},
+	}
+	for name, backend := range backends {
+		ss := NewSessionStore(backend)
+		valid := Grant{AccessToken: "valid", CreatedAt: time.Now(), ExpiresIn: time.Hour}
+		expired := Grant{AccessToken: "expired", CreatedAt: time.Now().Add(-2 * time.Hour), ExpiresIn: time.Hour}
+		replaced := Grant{AccessToken: "replaced", CreatedAt: time.Now(), ExpiresIn: time.Hour, ReplacedBy: "valid"}
+		for _, grant := range []Grant{valid, expired, replaced} {
+			if err := ss.PutGrant(grant); err != nil {
+				t.Fatal(err)
+			}
+		}
+		results, err := ss.CheckGrants([]Secret{"valid", "expired", "replaced", "unknown"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 4 || results["valid"].Err != nil || !reflect.DeepEqual(results["valid"].Grant, valid) {
+			t.Errorf("Test failed, %s: unexpected results %v", name, results)
+		}
+		for _, token := range []Secret{"expired", "replaced", "unknown"} {
+			if results[token].Err == nil {
+				t.Errorf("Test failed, %s: expected %s to be invalid", name, token.RawString())
+			}
+		}
+		// Expired grants are deleted as by CheckGrant
+		if _, err := ss.GetGrant("expired"); err == nil {
+			t.Errorf("Test failed, %s: expected the expired grant to be deleted", name)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package goauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+)
+
+// Signer provides the keys used to sign ID tokens and JWT access tokens. KeyRotator is a Signer that
+// generates and rotates in-process keys, whereas StaticSigner uses keys managed outside the Server, such
+// as keys held in a cloud KMS or a PKCS #11 HSM.
+type Signer interface {
+	// SigningKey returns the key with which new tokens are signed.
+	SigningKey() (SigningKey, error)
+	// VerificationKeys returns the keys whose public keys are published by the JWKS endpoint.
+	VerificationKeys() ([]SigningKey, error)
+}
+
+// AlgorithmSigner is implemented by a Signer holding keys for several algorithms, allowing tokens to be
+// signed using the algorithm preferred by each client.
+type AlgorithmSigner interface {
+	Signer
+	// SigningKeyFor returns the key with which new tokens are signed using the algorithm. It returns
+	// ErrUnsupportedAlgorithm if the Signer has no key for the algorithm.
+	SigningKeyFor(algorithm string) (SigningKey, error)
+}
+
+// StaticSigner is a Signer using a fixed key. Keys for other algorithms can be listed as Alternates, and
+// previous keys can be listed so that they remain published while tokens they signed are still valid.
+type StaticSigner struct {
+	Key        SigningKey
+	Alternates []SigningKey
+	Previous   []SigningKey
+}
+
+// SigningKey returns the Key.
+func (s *StaticSigner) SigningKey() (SigningKey, error) {
+	return s.Key, nil
+}
+
+// SigningKeyFor returns the Key if it uses the algorithm, otherwise the first of the Alternates that does.
+func (s *StaticSigner) SigningKeyFor(algorithm string) (SigningKey, error) {
+	for _, key := range append([]SigningKey{s.Key}, s.Alternates...) {
+		if key.Algorithm == algorithm {
+			return key, nil
+		}
+	}
+	return SigningKey{}, ErrUnsupportedAlgorithm
+}
+
+// VerificationKeys returns the Key followed by the Alternates and the Previous keys.
+func (s *StaticSigner) VerificationKeys() ([]SigningKey, error) {
+	keys := append([]SigningKey{s.Key}, s.Alternates...)
+	return append(keys, s.Previous...), nil
+}
+
+// NewSigningKey returns a SigningKey using the signer, which may be an in-process private key or a key held
+// in a KMS or HSM, checking that the algorithm is supported for its public key.
+func NewSigningKey(id, algorithm string, signer crypto.Signer) (SigningKey, error) {
+	switch signer.Public().(type) {
+	case *rsa.PublicKey:
+		if algorithm != AlgorithmRS256 && algorithm != AlgorithmPS256 {
+			return SigningKey{}, ErrUnsupportedAlgorithm
+		}
+	case *ecdsa.PublicKey:
+		if algorithm != AlgorithmES256 {
+			return SigningKey{}, ErrUnsupportedAlgorithm
+		}
+	case ed25519.PublicKey:
+		if algorithm != AlgorithmEdDSA {
+			return SigningKey{}, ErrUnsupportedAlgorithm
+		}
+	default:
+		return SigningKey{}, ErrUnsupportedAlgorithm
+	}
+	return SigningKey{
+		ID:        id,
+		Algorithm: algorithm,
+		Signer:    signer,
+		CreatedAt: timeNow(),
+	}, nil
+}
+
+// remoteSigner is a crypto.Signer delegating to a signing function.
+type remoteSigner struct {
+	public crypto.PublicKey
+	sign   func(digest []byte) ([]byte, error)
+}
+
+// NewRemoteSigner returns a crypto.Signer for a key that never leaves a KMS or HSM, for use with
+// NewSigningKey. The sign function is passed the SHA-256 digest of the signing input and must return a
+// PKCS #1 v1.5 signature for RSA keys or an ASN.1 DER signature for ECDSA keys, as returned by the
+// AWS and GCP KMS signing APIs.
+func NewRemoteSigner(public crypto.PublicKey, sign func(digest []byte) ([]byte, error)) crypto.Signer {
+	return &remoteSigner{public, sign}
+}
+
+// Public satisfies the crypto.Signer interface.
+func (r *remoteSigner) Public() crypto.PublicKey {
+	return r.public
+}
+
+// Sign satisfies the crypto.Signer interface.
+func (r *remoteSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts.HashFunc() != crypto.SHA256 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return r.sign(digest)
+}
+
+// SignJWT returns the claims as a JWT in JWS compact serialization signed with the current key of the
+// Signer.
+func SignJWT(signer Signer, claims interface{}) (Secret, error) {
+	key, err := signer.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	return SignJWTWithKey(key, claims)
+}
+
+// SignJWTWithKey returns the claims as a JWT in JWS compact serialization signed with the key.
+func SignJWTWithKey(key SigningKey, claims interface{}) (Secret, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg": key.Algorithm,
+		"kid": key.ID,
+		"typ": "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sig, err := key.Sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return Secret(input + "." + base64.RawURLEncoding.EncodeToString(sig)), nil
+}
+
+// SigningAlgorithmClient is implemented by a Client that prefers tokens issued to it to be signed using
+// particular algorithms, such as AlgorithmPS256 or AlgorithmEdDSA.
+type SigningAlgorithmClient interface {
+	Client
+	// SigningAlgorithms returns the algorithms accepted by the client in order of preference.
+	SigningAlgorithms() []string
+}
+
+// SigningAlgorithms returns the algorithms for which the Server's Signer has a signing key.
+func (s *Server) SigningAlgorithms() ([]string, error) {
+	if s.Signer == nil {
+		return nil, ErrNoSigner
+	}
+	var algorithms []string
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmPS256, AlgorithmES256, AlgorithmEdDSA} {
+		_, err := s.signingKeyFor(algorithm)
+		if err == nil {
+			algorithms = append(algorithms, algorithm)
+		} else if err != ErrUnsupportedAlgorithm {
+			return nil, err
+		}
+	}
+	return algorithms, nil
+}
+
+// ValidateSigningAlgorithms checks that the Server can sign tokens using at least one of the algorithms,
+// for example when a client registers its preferred algorithms. It returns ErrUnsupportedAlgorithm if
+// none of them are supported. An empty list is valid, as tokens are then signed with the current key.
+func (s *Server) ValidateSigningAlgorithms(algorithms []string) error {
+	if len(algorithms) == 0 {
+		return nil
+	}
+	for _, algorithm := range algorithms {
+		_, err := s.signingKeyFor(algorithm)
+		if err != ErrUnsupportedAlgorithm {
+			return err
+		}
+	}
+	return ErrUnsupportedAlgorithm
+}
+
+// SignJWTForClient returns the claims as a JWT signed using the algorithm preferred by the client, for
+// example to sign the ID tokens of grants created by the client.
+func (s *Server) SignJWTForClient(client Client, claims interface{}) (Secret, error) {
+	key, err := s.signingKey(client)
+	if err != nil {
+		return "", err
+	}
+	return SignJWTWithKey(key, claims)
+}
+
+// signingKey returns the key with which tokens issued to the client are signed. Clients that do not
+// implement SigningAlgorithmClient receive tokens signed with the current key of the Signer, otherwise the
+// first of their preferred algorithms that the Signer supports is used.
+func (s *Server) signingKey(client Client) (SigningKey, error) {
+	if s.Signer == nil {
+		return SigningKey{}, ErrNoSigner
+	}
+	c, ok := client.(SigningAlgorithmClient)
+	if !ok || len(c.SigningAlgorithms()) == 0 {
+		return s.Signer.SigningKey()
+	}
+	for _, algorithm := range c.SigningAlgorithms() {
+		key, err := s.signingKeyFor(algorithm)
+		if err != ErrUnsupportedAlgorithm {
+			return key, err
+		}
+	}
+	return SigningKey{}, ErrUnsupportedAlgorithm
+}
+
+// signingKeyFor returns the Signer's key for the algorithm, using the current key if the Signer does not
+// implement AlgorithmSigner.
+func (s *Server) signingKeyFor(algorithm string) (SigningKey, error) {
+	if signer, ok := s.Signer.(AlgorithmSigner); ok {
+		return signer.SigningKeyFor(algorithm)
+	}
+	key, err := s.Signer.SigningKey()
+	if err != nil {
+		return SigningKey{}, err
+	}
+	if key.Algorithm != algorithm {
+		return SigningKey{}, ErrUnsupportedAlgorithm
+	}
+	return key, nil
+}
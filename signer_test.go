@@ -0,0 +1,120 @@
+package goauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	// The private key stands in for a key held in a KMS
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed int
+	remote := NewRemoteSigner(private.Public(), func(digest []byte) ([]byte, error) {
+		signed++
+		return private.Sign(rand.Reader, digest, crypto.SHA256)
+	})
+	if _, err := NewSigningKey("kms-key", AlgorithmRS256, remote); err != ErrUnsupportedAlgorithm {
+		t.Errorf("Test failed, expected %v got %v", ErrUnsupportedAlgorithm, err)
+	}
+	key, err := NewSigningKey("kms-key", AlgorithmES256, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := SignJWT(&StaticSigner{Key: key}, map[string]string{"sub": "testusername"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed != 1 {
+		t.Errorf("Test failed, expected the remote signer to be used once got %d", signed)
+	}
+
+	parts := strings.Split(token.RawString(), ".")
+	if len(parts) != 3 {
+		t.Fatalf("Test failed, malformed token %s", token.RawString())
+	}
+	var header map[string]string
+	data, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	json.Unmarshal(data, &header)
+	if header["alg"] != AlgorithmES256 || header["kid"] != "kms-key" {
+		t.Errorf("Test failed, unexpected header %v", header)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if len(sig) != 64 || !ecdsa.Verify(&private.PublicKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Error("Test failed, invalid signature")
+	}
+}
+
+type testSigningAlgorithmClient struct {
+	*testClient
+	algorithms []string
+}
+
+func (t testSigningAlgorithmClient) SigningAlgorithms() []string {
+	return t.algorithms
+}
+
+func TestSigningAlgorithmNegotiation(t *testing.T) {
+	es256, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eddsa, err := GenerateSigningKey(AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestHandler()
+	if _, err := server.SignJWTForClient(&testClient{}, nil); err != ErrNoSigner {
+		t.Errorf("Test failed, expected %v got %v", ErrNoSigner, err)
+	}
+	server.Signer = &StaticSigner{Key: es256, Alternates: []SigningKey{eddsa}}
+
+	algorithms, err := server.SigningAlgorithms()
+	if err != nil || strings.Join(algorithms, " ") != "ES256 EdDSA" {
+		t.Errorf("Test failed, unexpected algorithms %v %v", algorithms, err)
+	}
+	if err := server.ValidateSigningAlgorithms([]string{AlgorithmPS256, AlgorithmEdDSA}); err != nil {
+		t.Errorf("Test failed, expected the algorithms to be valid got %v", err)
+	}
+	if err := server.ValidateSigningAlgorithms([]string{AlgorithmRS256}); err != ErrUnsupportedAlgorithm {
+		t.Errorf("Test failed, expected %v got %v", ErrUnsupportedAlgorithm, err)
+	}
+
+	alg := func(client Client) string {
+		token, err := server.SignJWTForClient(client, map[string]string{"sub": "testusername"})
+		if err != nil {
+			return err.Error()
+		}
+		var header map[string]string
+		data, _ := base64.RawURLEncoding.DecodeString(strings.Split(token.RawString(), ".")[0])
+		json.Unmarshal(data, &header)
+		return header["alg"]
+	}
+	// Clients without preferences receive tokens signed with the current key
+	if got := alg(&testClient{}); got != AlgorithmES256 {
+		t.Errorf("Test failed, expected %s got %s", AlgorithmES256, got)
+	}
+	// The first supported preference is used
+	if got := alg(testSigningAlgorithmClient{&testClient{}, []string{AlgorithmPS256, AlgorithmEdDSA, AlgorithmES256}}); got != AlgorithmEdDSA {
+		t.Errorf("Test failed, expected %s got %s", AlgorithmEdDSA, got)
+	}
+	if got := alg(testSigningAlgorithmClient{&testClient{}, []string{AlgorithmRS256}}); got != ErrUnsupportedAlgorithm.Error() {
+		t.Errorf("Test failed, expected %v got %s", ErrUnsupportedAlgorithm, got)
+	}
+	// Alternate keys are published for verification
+	keys, err := server.Signer.VerificationKeys()
+	if err != nil || len(keys) != 2 || keys[1].ID != eddsa.ID {
+		t.Errorf("Test failed, unexpected verification keys %v %v", keys, err)
+	}
+}
@@ -0,0 +1,164 @@
+package goauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+)
+
+const (
+	// AlgorithmRS256 is RSASSA-PKCS1-v1_5 using SHA-256.
+	AlgorithmRS256 = "RS256"
+	// AlgorithmES256 is ECDSA using P-256 and SHA-256.
+	AlgorithmES256 = "ES256"
+	// AlgorithmPS256 is RSASSA-PSS using SHA-256.
+	AlgorithmPS256 = "PS256"
+	// AlgorithmEdDSA is EdDSA using Ed25519.
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	// ErrUnsupportedAlgorithm is returned for signing algorithms or keys that are not supported.
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	// DefaultSigningAlgorithm is the algorithm of keys generated by a KeyRotator that does not set one.
+	DefaultSigningAlgorithm = AlgorithmRS256
+)
+
+// SigningKey is a private key used to sign tokens. Its public key is published by the JWKS endpoint.
+type SigningKey struct {
+	// ID is the key ID, included in the kid header of signed tokens.
+	ID string
+	// Algorithm is the JWS algorithm used with the key.
+	Algorithm string
+	// Signer is the private key.
+	Signer crypto.Signer
+	// CreatedAt is the time the key was generated.
+	CreatedAt time.Time
+	// RetiredAt is the time the key was replaced by a new key. Retired keys are no longer used to sign
+	// tokens but remain published so that previously signed tokens can be verified. If zero, the key is
+	// in use.
+	RetiredAt time.Time
+}
+
+// GenerateSigningKey generates a new SigningKey for the algorithm.
+func GenerateSigningKey(algorithm string) (SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgorithmRS256, AlgorithmPS256:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return SigningKey{}, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+	id, err := NewToken()
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{
+		ID:        id.RawString(),
+		Algorithm: algorithm,
+		Signer:    signer,
+		CreatedAt: timeNow(),
+	}, nil
+}
+
+// IsRetired returns true if the key has been replaced and must no longer be used for signing.
+func (k SigningKey) IsRetired() bool {
+	return !k.RetiredAt.IsZero()
+}
+
+// Sign returns the JWS signature of the payload.
+func (k SigningKey) Sign(payload []byte) ([]byte, error) {
+	digest := sha256.Sum256(payload)
+	switch k.Algorithm {
+	case AlgorithmRS256:
+		return k.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case AlgorithmPS256:
+		return k.Signer.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+	case AlgorithmEdDSA:
+		// Ed25519 signs the payload itself rather than a digest
+		return k.Signer.Sign(rand.Reader, payload, crypto.Hash(0))
+	case AlgorithmES256:
+		der, err := k.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			return nil, err
+		}
+		// JWS uses the fixed length concatenation of r and s rather than ASN.1
+		var sig struct{ R, S *big.Int }
+		_, err = asn1.Unmarshal(der, &sig)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, 64)
+		sig.R.FillBytes(out[:32])
+		sig.S.FillBytes(out[32:])
+		return out, nil
+	}
+	return nil, ErrUnsupportedAlgorithm
+}
+
+// JWK returns the public key as a JSON Web Key.
+func (k SigningKey) JWK() (JWK, error) {
+	return NewJWK(k.ID, k.Algorithm, k.Signer.Public())
+}
+
+// signingKeyJSON is the serialized form of a SigningKey, with the private key in PKCS #8 form.
+type signingKeyJSON struct {
+	ID         string    `json:"id"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey []byte    `json:"private_key"`
+	CreatedAt  time.Time `json:"created_at"`
+	RetiredAt  time.Time `json:"retired_at"`
+}
+
+// MarshalJSON serializes the key including its private key, for use by KeyStore implementations. Only
+// in-process RSA, ECDSA and Ed25519 keys can be serialized.
+func (k SigningKey) MarshalJSON() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.Signer)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(signingKeyJSON{k.ID, k.Algorithm, der, k.CreatedAt, k.RetiredAt})
+}
+
+// UnmarshalJSON parses a key serialized by MarshalJSON.
+func (k *SigningKey) UnmarshalJSON(data []byte) error {
+	var j signingKeyJSON
+	err := json.Unmarshal(data, &j)
+	if err != nil {
+		return err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(j.PrivateKey)
+	if err != nil {
+		return err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return ErrUnsupportedAlgorithm
+	}
+	*k = SigningKey{
+		ID:        j.ID,
+		Algorithm: j.Algorithm,
+		Signer:    signer,
+		CreatedAt: j.CreatedAt,
+		RetiredAt: j.RetiredAt,
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package goauth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestSigningKey(t *testing.T) {
+	payload := []byte("testpayload")
+	digest := sha256.Sum256(payload)
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmPS256, AlgorithmES256, AlgorithmEdDSA} {
+		key, err := GenerateSigningKey(algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Keys survive serialization by a KeyStore
+		data, err := json.Marshal(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var parsed SigningKey
+		err = json.Unmarshal(data, &parsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := parsed.Sign(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch public := key.Signer.Public().(type) {
+		case *rsa.PublicKey:
+			if algorithm == AlgorithmPS256 {
+				err = rsa.VerifyPSS(public, crypto.SHA256, digest[:], sig, nil)
+			} else {
+				err = rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], sig)
+			}
+			if err != nil {
+				t.Errorf("Test failed, %s signature invalid: %v", algorithm, err)
+			}
+		case ed25519.PublicKey:
+			if !ed25519.Verify(public, payload, sig) {
+				t.Errorf("Test failed, %s signature invalid", algorithm)
+			}
+		case *ecdsa.PublicKey:
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			if len(sig) != 64 || !ecdsa.Verify(public, digest[:], r, s) {
+				t.Errorf("Test failed, %s signature invalid", algorithm)
+			}
+		}
+		jwk, err := key.JWK()
+		if err != nil || jwk.KeyID != key.ID || jwk.Algorithm != algorithm {
+			t.Errorf("Test failed, unexpected JWK %+v %v", jwk, err)
+		}
+		if _, err := jwk.PublicKey(); err != nil {
+			t.Errorf("Test failed, %s JWK public key: %v", algorithm, err)
+		}
+	}
+	if _, err := GenerateSigningKey("none"); err != ErrUnsupportedAlgorithm {
+		t.Errorf("Test failed, expected %v got %v", ErrUnsupportedAlgorithm, err)
+	}
+}
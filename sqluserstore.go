@@ -0,0 +1,186 @@
+package goauth
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQLUserStoreSchema creates a table compatible with SQLUserStore. It is written for SQLite and PostgreSQL
+// and may need adapting for other databases.
+const SQLUserStoreSchema = `CREATE TABLE IF NOT EXISTS users (
+	username VARCHAR(255) PRIMARY KEY,
+	email VARCHAR(255) UNIQUE,
+	email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+	password_hash VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL
+)`
+
+// DollarPlaceholder returns PostgreSQL style bind parameters for use as SQLUserStore.Placeholder.
+func DollarPlaceholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// SQLUserStore is a UserStore backed by a database/sql database using the table created by
+// SQLUserStoreSchema. The database driver must be imported by the application.
+type SQLUserStore struct {
+	DB *sql.DB
+	// Table is the name of the users table. If empty, "users" is used.
+	Table string
+	// Placeholder returns the bind parameter for the nth argument of a query, starting at 1. If nil, "?" is
+	// used as supported by MySQL and SQLite. Use DollarPlaceholder for PostgreSQL.
+	Placeholder func(n int) string
+	// Hasher overrides DefaultPasswordHasher if set.
+	Hasher PasswordHasher
+}
+
+// NewSQLUserStore returns a SQLUserStore using the default table and "?" bind parameters.
+func NewSQLUserStore(db *sql.DB) *SQLUserStore {
+	return &SQLUserStore{DB: db}
+}
+
+// hasher returns the PasswordHasher of the store.
+func (s *SQLUserStore) hasher() PasswordHasher {
+	if s.Hasher != nil {
+		return s.Hasher
+	}
+	return DefaultPasswordHasher
+}
+
+// query formats the query replacing %t with the table name and each ? with a bind parameter.
+func (s *SQLUserStore) query(q string) string {
+	table := s.Table
+	if table == "" {
+		table = "users"
+	}
+	q = strings.Replace(q, "%t", table, -1)
+	if s.Placeholder == nil {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			b.WriteString(s.Placeholder(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// CreateUser creates an account with the given password.
+func (s *SQLUserStore) CreateUser(user User, password Secret) error {
+	hash, err := s.hasher().Hash(password)
+	if err != nil {
+		return err
+	}
+	email := sql.NullString{String: user.Email, Valid: user.Email != ""}
+	var count int
+	err = s.DB.QueryRow(s.query("SELECT COUNT(*) FROM %t WHERE username = ? OR email = ?"), user.Username, email).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrUserExists
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = timeNow()
+	}
+	_, err = s.DB.Exec(
+		s.query("INSERT INTO %t (username, email, email_verified, password_hash, created_at) VALUES (?, ?, ?, ?, ?)"),
+		user.Username, email, user.EmailVerified, hash, user.CreatedAt.UTC(),
+	)
+	return err
+}
+
+// VerifyPassword returns true if the password is that of the account.
+func (s *SQLUserStore) VerifyPassword(username string, password Secret) (bool, error) {
+	var hash string
+	err := s.DB.QueryRow(s.query("SELECT password_hash FROM %t WHERE username = ?"), username).Scan(&hash)
+	if err == sql.ErrNoRows {
+		checkDummyPassword(s.hasher(), password)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return CheckPasswordHash(hash, password)
+}
+
+// ListUsers returns up to limit accounts ordered by username, skipping the first offset accounts.
+func (s *SQLUserStore) ListUsers(offset, limit int) ([]User, error) {
+	rows, err := s.DB.Query(s.query("SELECT username, email, email_verified, created_at FROM %t ORDER BY username LIMIT ? OFFSET ?"), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var users []User
+	for rows.Next() {
+		var u User
+		var email sql.NullString
+		var createdAt time.Time
+		err := rows.Scan(&u.Username, &email, &u.EmailVerified, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		u.Email = email.String
+		u.CreatedAt = createdAt
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// FindUser returns the username and email address of the account identified by the given username or
+// email address.
+func (s *SQLUserStore) FindUser(identifier string) (string, string, error) {
+	var username string
+	var email sql.NullString
+	err := s.DB.QueryRow(s.query("SELECT username, email FROM %t WHERE username = ?"), identifier).Scan(&username, &email)
+	if err == sql.ErrNoRows {
+		err = s.DB.QueryRow(s.query("SELECT username, email FROM %t WHERE LOWER(email) = LOWER(?)"), identifier).Scan(&username, &email)
+	}
+	if err == sql.ErrNoRows {
+		return "", "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return username, email.String, nil
+}
+
+// SetPassword replaces the password of the account.
+func (s *SQLUserStore) SetPassword(username string, password Secret) error {
+	hash, err := s.hasher().Hash(password)
+	if err != nil {
+		return err
+	}
+	return s.update(s.query("UPDATE %t SET password_hash = ? WHERE username = ?"), hash, username)
+}
+
+// SetEmailVerified marks the email address of the account as verified.
+func (s *SQLUserStore) SetEmailVerified(username, email string) error {
+	return s.update(s.query("UPDATE %t SET email_verified = ? WHERE username = ? AND email = ?"), true, username, email)
+}
+
+// update executes a query updating a single account, returning ErrUserNotFound if no account was updated.
+func (s *SQLUserStore) update(query string, args ...interface{}) error {
+	result, err := s.DB.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	if n > 1 {
+		return fmt.Errorf("goauth: updated %d users", n)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package goauth
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSQLDriver is a database/sql driver that understands the queries made by SQLUserStore and is
+// intended for use only in testing.
+type testSQLDriver struct {
+	mtx   sync.Mutex
+	users map[string]*testSQLUser
+}
+
+type testSQLUser struct {
+	username      string
+	email         interface{}
+	emailVerified bool
+	passwordHash  string
+	createdAt     time.Time
+}
+
+func (d *testSQLDriver) Open(name string) (driver.Conn, error) {
+	return &testSQLConn{d}, nil
+}
+
+type testSQLConn struct {
+	d *testSQLDriver
+}
+
+func (c *testSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return &testSQLStmt{c.d, query}, nil
+}
+
+func (c *testSQLConn) Close() error              { return nil }
+func (c *testSQLConn) Begin() (driver.Tx, error) { return nil, fmt.Errorf("not supported") }
+
+type testSQLStmt struct {
+	d     *testSQLDriver
+	query string
+}
+
+func (s *testSQLStmt) Close() error  { return nil }
+func (s *testSQLStmt) NumInput() int { return strings.Count(s.query, "$") }
+
+func (s *testSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.mtx.Lock()
+	defer s.d.mtx.Unlock()
+	switch {
+	case strings.HasPrefix(s.query, "INSERT INTO accounts"):
+		s.d.users[args[0].(string)] = &testSQLUser{args[0].(string), args[1], args[2].(bool), args[3].(string), args[4].(time.Time)}
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(s.query, "UPDATE accounts SET password_hash"):
+		if u, ok := s.d.users[args[1].(string)]; ok {
+			u.passwordHash = args[0].(string)
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(s.query, "UPDATE accounts SET email_verified"):
+		if u, ok := s.d.users[args[1].(string)]; ok && u.email == args[2] {
+			u.emailVerified = args[0].(bool)
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	}
+	return nil, fmt.Errorf("unexpected query %s", s.query)
+}
+
+func (s *testSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.mtx.Lock()
+	defer s.d.mtx.Unlock()
+	var sorted []*testSQLUser
+	for _, u := range s.d.users {
+		sorted = append(sorted, u)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].username < sorted[j].username })
+	rows := &testSQLRows{}
+	switch {
+	case strings.HasPrefix(s.query, "SELECT COUNT(*)"):
+		count := 0
+		for _, u := range sorted {
+			if u.username == args[0] || (args[1] != nil && u.email == args[1]) {
+				count++
+			}
+		}
+		rows.rows = [][]driver.Value{{int64(count)}}
+	case strings.HasPrefix(s.query, "SELECT password_hash"):
+		if u, ok := s.d.users[args[0].(string)]; ok {
+			rows.rows = [][]driver.Value{{u.passwordHash}}
+		}
+	case strings.HasPrefix(s.query, "SELECT username, email FROM accounts WHERE username"):
+		if u, ok := s.d.users[args[0].(string)]; ok {
+			rows.rows = [][]driver.Value{{u.username, u.email}}
+		}
+	case strings.HasPrefix(s.query, "SELECT username, email FROM accounts WHERE LOWER(email)"):
+		for _, u := range sorted {
+			if email, ok := u.email.(string); ok && strings.EqualFold(email, args[0].(string)) {
+				rows.rows = [][]driver.Value{{u.username, u.email}}
+			}
+		}
+	case strings.HasPrefix(s.query, "SELECT username, email, email_verified"):
+		limit, offset := int(args[0].(int64)), int(args[1].(int64))
+		for i, u := range sorted {
+			if i >= offset && i < offset+limit {
+				rows.rows = append(rows.rows, []driver.Value{u.username, u.email, u.emailVerified, u.createdAt})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected query %s", s.query)
+	}
+	return rows, nil
+}
+
+type testSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (r *testSQLRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{"", "", "", ""}
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *testSQLRows) Close() error { return nil }
+
+func (r *testSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func init() {
+	sql.Register("goauthtest", &testSQLDriver{users: make(map[string]*testSQLUser)})
+}
+
+func TestSQLUserStore(t *testing.T) {
+	db, err := sql.Open("goauthtest", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := NewSQLUserStore(db)
+	store.Table = "accounts"
+	store.Placeholder = DollarPlaceholder
+	store.Hasher = BcryptHasher{Cost: 4}
+	testUserStoreImplementation(t, store)
+}
@@ -0,0 +1,181 @@
+package goauth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ParamFlow carries the sealed parameters of an authorization request between the steps of the flow when
+// the Server has a StateCodec.
+const ParamFlow = "flow"
+
+var (
+	// DefaultStateMaxAge is the default lifetime of values encoded by a StateCodec.
+	DefaultStateMaxAge = 10 * time.Minute
+
+	// ErrInvalidState is returned when decoding a value that was not encoded by the StateCodec or that
+	// has been modified.
+	ErrInvalidState = errors.New("goauth: invalid state")
+	// ErrStateExpired is returned when decoding a value older than the MaxAge of the StateCodec.
+	ErrStateExpired = errors.New("goauth: state expired")
+)
+
+// StateCodec encodes values as opaque, URL safe strings that are signed using HMAC-SHA256, optionally
+// encrypted using AES-GCM and that expire. It allows data to be carried through the user agent, for
+// example in the state parameter or between the steps of an authorization flow, without server-side storage.
+type StateCodec struct {
+	// Key is the HMAC key used to sign values. It should be at least 32 random bytes.
+	Key []byte
+	// EncryptionKey is the AES key used to encrypt values, which must be 16, 24 or 32 bytes long. If nil,
+	// values are signed but their contents are visible to the user agent.
+	EncryptionKey []byte
+	// MaxAge is the lifetime of encoded values. If zero, DefaultStateMaxAge is used.
+	MaxAge time.Duration
+}
+
+// NewStateCodec returns a StateCodec signing values with the given key.
+func NewStateCodec(key []byte) *StateCodec {
+	return &StateCodec{Key: key}
+}
+
+// Encode returns the JSON encoding of v, sealed by the StateCodec.
+func (c *StateCodec) Encode(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	payload := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(payload, uint64(timeNow().Unix()))
+	payload = append(payload, data...)
+	if c.EncryptionKey != nil {
+		aead, err := c.aead()
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, aead.NonceSize())
+		_, err = io.ReadFull(rand.Reader, nonce)
+		if err != nil {
+			return "", err
+		}
+		payload = aead.Seal(nonce, nonce, payload, nil)
+	}
+	return base64.RawURLEncoding.EncodeToString(append(payload, c.sign(payload)...)), nil
+}
+
+// Decode verifies the sealed value and stores its contents in the value pointed to by v. It returns
+// ErrInvalidState if the value was not encoded by the StateCodec and ErrStateExpired if it has expired.
+func (c *StateCodec) Decode(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) < sha256.Size {
+		return ErrInvalidState
+	}
+	payload, mac := b[:len(b)-sha256.Size], b[len(b)-sha256.Size:]
+	if !hmac.Equal(mac, c.sign(payload)) {
+		return ErrInvalidState
+	}
+	if c.EncryptionKey != nil {
+		aead, err := c.aead()
+		if err != nil {
+			return err
+		}
+		if len(payload) < aead.NonceSize() {
+			return ErrInvalidState
+		}
+		payload, err = aead.Open(nil, payload[:aead.NonceSize()], payload[aead.NonceSize():], nil)
+		if err != nil {
+			return ErrInvalidState
+		}
+	}
+	if len(payload) < 8 {
+		return ErrInvalidState
+	}
+	maxAge := c.MaxAge
+	if maxAge == 0 {
+		maxAge = DefaultStateMaxAge
+	}
+	issuedAt := time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0)
+	if !issuedAt.Add(maxAge).After(timeNow()) {
+		return ErrStateExpired
+	}
+	return json.Unmarshal(payload[8:], v)
+}
+
+// sign returns the HMAC of the payload.
+func (c *StateCodec) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, c.Key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// aead returns the AES-GCM cipher using the EncryptionKey.
+func (c *StateCodec) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(c.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealFlow returns the action URL of the next step of the authorization request, carrying the parameters
+// along with the response type and client ID of the request. When the Server has a StateCodec they are
+// sealed in the flow parameter so that they cannot be modified between steps.
+func (s *Server) sealFlow(r *http.Request, params url.Values) (string, error) {
+	sealed := url.Values{
+		ParamResponseType: {r.FormValue(ParamResponseType)},
+		ParamClientID:     {r.FormValue(ParamClientID)},
+	}
+	for key, values := range params {
+		sealed[key] = values
+	}
+	if s.StateCodec == nil {
+		return sealed.Encode(), nil
+	}
+	flow, err := s.StateCodec.Encode(sealed)
+	if err != nil {
+		return "", err
+	}
+	return url.Values{ParamFlow: {flow}}.Encode(), nil
+}
+
+// restoreFlow replaces the parameters of the authorization request with those sealed in the flow
+// parameter, if present. It returns an error if the flow cannot be decoded.
+func (s *Server) restoreFlow(r *http.Request) error {
+	if s.StateCodec == nil {
+		return nil
+	}
+	err := r.ParseForm()
+	if err != nil {
+		return err
+	}
+	flow := r.Form.Get(ParamFlow)
+	if flow == "" {
+		return nil
+	}
+	var params url.Values
+	err = s.StateCodec.Decode(flow, &params)
+	if err != nil {
+		return err
+	}
+	// Only the sealed parameters and those submitted in the body, such as the credentials, are used
+	for key := range r.URL.Query() {
+		delete(r.Form, key)
+	}
+	for key, values := range r.PostForm {
+		r.Form[key] = values
+	}
+	for key, values := range params {
+		r.Form[key] = values
+	}
+	return nil
+}
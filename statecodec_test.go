@@ -0,0 +1,104 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateCodec(t *testing.T) {
+	type state struct {
+		ReturnTo string
+	}
+	for _, codec := range []*StateCodec{
+		NewStateCodec([]byte("testkey")),
+		{Key: []byte("testkey"), EncryptionKey: []byte("0123456789abcdef")},
+	} {
+		encoded, err := codec.Encode(state{"/home"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if codec.EncryptionKey != nil && strings.Contains(encoded, "home") {
+			t.Errorf("Test failed, expected the state to be encrypted got %s", encoded)
+		}
+		var decoded state
+		err = codec.Decode(encoded, &decoded)
+		if err != nil || decoded.ReturnTo != "/home" {
+			t.Errorf("Test failed, got %v %v", decoded, err)
+		}
+		// Modified values are rejected
+		// The final character may carry unused bits, so a character in the middle of the value is changed
+		i := len(encoded) / 2
+		c := byte('A')
+		if encoded[i] == c {
+			c = 'B'
+		}
+		tampered := encoded[:i] + string(c) + encoded[i+1:]
+		if err := codec.Decode(tampered, &decoded); err != ErrInvalidState {
+			t.Errorf("Test failed, expected ErrInvalidState got %v", err)
+		}
+		if err := NewStateCodec([]byte("otherkey")).Decode(encoded, &decoded); err != ErrInvalidState {
+			t.Errorf("Test failed, expected ErrInvalidState got %v", err)
+		}
+		// Expired values are rejected
+		timeNow = func() time.Time { return time.Now().Add(DefaultStateMaxAge) }
+		err = codec.Decode(encoded, &decoded)
+		timeNow = time.Now
+		if err != ErrStateExpired {
+			t.Errorf("Test failed, expected ErrStateExpired got %v", err)
+		}
+	}
+}
+
+func TestStateCodecAuthorizationFlow(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.StateCodec = NewStateCodec([]byte("testkey"))
+
+	r := httptest.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid&redirect_uri=https://testuri.com&scope=testscope&state=teststate", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	var challenge AuthorizationChallenge
+	err := json.NewDecoder(w.Body).Decode(&challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actionURL, err := url.Parse(challenge.ActionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	action := actionURL.Query()
+	if action.Get(ParamFlow) == "" || action.Get(ParamState) != "" {
+		t.Fatalf("Test failed, expected only a sealed flow got %s", challenge.ActionURL)
+	}
+
+	submit := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/authorize?"+query, strings.NewReader("username=testusername&password=testpassword"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	// The sealed parameters take precedence over those in the query
+	w = submit(actionURL.RawQuery + "&redirect_uri=https://attacker.com")
+	if w.Code != 302 {
+		t.Fatalf("Test failed, status %d", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Host != "testuri.com" || location.Query().Get(ParamCode) == "" || location.Query().Get(ParamState) != "teststate" {
+		t.Errorf("Test failed, got %s", location)
+	}
+
+	// A modified flow is rejected
+	if w := submit(ParamFlow + "=invalid"); w.Code != ErrorInvalidRequest.StatusCode {
+		t.Errorf("Test failed, expected status %d got %d", ErrorInvalidRequest.StatusCode, w.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package goauth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// StatsEndpoint is the conventional path at which StatsHandler is mounted.
+const StatsEndpoint = "/statsz"
+
+var (
+	// ErrStatsUnsupported is returned by Server.Stats if the SessionStoreBackend does not implement
+	// StatsReporter.
+	ErrStatsUnsupported = errors.New("session store does not report stats")
+)
+
+// SessionStoreStats describes the number of records held by a SessionStoreBackend, allowing operators to
+// alert on runaway token issuance.
+type SessionStoreStats struct {
+	Grants               int64 `json:"grants"`
+	AuthorizationCodes   int64 `json:"authorization_codes"`
+	BackChannelRequests  int64 `json:"back_channel_requests"`
+	DeviceAuthorizations int64 `json:"device_authorizations"`
+	VerificationCodes    int64 `json:"verification_codes"`
+	IdempotentResponses  int64 `json:"idempotent_responses"`
+	// ApproximateBytes is the approximate storage used by the records, if known.
+	ApproximateBytes int64 `json:"approximate_bytes,omitempty"`
+}
+
+// StatsReporter may be implemented by a SessionStoreBackend to report the number of records it holds.
+// Counts may include expired records which have not yet been removed.
+type StatsReporter interface {
+	Stats() (SessionStoreStats, error)
+}
+
+// Stats returns the SessionStoreStats of the Server's SessionStoreBackend, or ErrStatsUnsupported if it
+// does not implement StatsReporter.
+func (s *Server) Stats() (SessionStoreStats, error) {
+	if s.SessionStore != nil {
+		if reporter, ok := s.SessionStore.SessionStoreBackend.(StatsReporter); ok {
+			return reporter.Stats()
+		}
+	}
+	return SessionStoreStats{}, ErrStatsUnsupported
+}
+
+// StatsHandler returns a handler writing the SessionStoreStats as JSON. It responds with 501 Not
+// Implemented if the SessionStoreBackend does not report stats. It is not mounted by default as the
+// stats should not be public, use EnableStatsEndpoint or mount it on a separate mux.
+func (s *Server) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats, err := s.Stats()
+		if err == ErrStatsUnsupported {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		err = json.NewEncoder(w).Encode(stats)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// EnableStatsEndpoint mounts the StatsHandler at StatsEndpoint on the Server, protected by the handler
+// which should authenticate operators, such as a handler returned by Secure.
+func (s *Server) EnableStatsEndpoint(protect func(http.Handler) http.Handler) {
+	s.handle(StatsEndpoint, protect(s.StatsHandler()))
+}
@@ -0,0 +1,50 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatsHandler(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.EnableStatsEndpoint(func(h http.Handler) http.Handler { return h })
+	for i := 0; i < 2; i++ {
+		token, err := newToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = server.SessionStore.PutGrant(Grant{AccessToken: token})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := server.SessionStore.NewAuthorizationCode("testclient", "https://testuri.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", StatsEndpoint, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Test failed, expected status %d got %d", http.StatusOK, w.Code)
+	}
+	var stats SessionStoreStats
+	err = json.NewDecoder(w.Body).Decode(&stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Grants != 2 || stats.AuthorizationCodes != 1 {
+		t.Errorf("Test failed, unexpected stats %+v", stats)
+	}
+
+	// Backends that do not report stats are reported as unsupported
+	server.SessionStore = NewSessionStore(struct{ SessionStoreBackend }{NewMemSessionStoreBackend()})
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest("GET", StatsEndpoint, nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Test failed, expected status %d got %d", http.StatusNotImplemented, w.Code)
+	}
+}
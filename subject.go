@@ -0,0 +1,55 @@
+package goauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// SubjectType determines the subject identifiers of the resource owners included in tokens issued to a
+// client, as per https://openid.net/specs/openid-connect-core-1_0.html#SubjectIDTypes.
+type SubjectType string
+
+const (
+	// SubjectTypePublic provides the same subject identifier to all clients.
+	SubjectTypePublic SubjectType = "public"
+	// SubjectTypePairwise provides a different subject identifier to each sector, so that clients of
+	// different sectors cannot correlate resource owners.
+	SubjectTypePairwise SubjectType = "pairwise"
+)
+
+var (
+	// ErrNoPairwiseSubjectKey is returned when a pairwise subject identifier is required by a Server without
+	// a PairwiseSubjectKey.
+	ErrNoPairwiseSubjectKey = errors.New("the server has no pairwise subject key")
+)
+
+// PairwiseSubjectClient is implemented by a Client that receives pairwise subject identifiers. Clients
+// sharing a sector identifier, typically the host of their redirect URIs, receive the same identifiers.
+type PairwiseSubjectClient interface {
+	Client
+	SectorIdentifier() string
+}
+
+// PairwiseSubject returns the pairwise subject identifier of the resource owner for the sector, the
+// base64url encoded HMAC-SHA256 of the sector identifier and the username using the Server's
+// PairwiseSubjectKey. The identifier is stable for as long as the key is unchanged.
+func (s *Server) PairwiseSubject(sectorIdentifier, username string) (string, error) {
+	if len(s.PairwiseSubjectKey) == 0 {
+		return "", ErrNoPairwiseSubjectKey
+	}
+	mac := hmac.New(sha256.New, s.PairwiseSubjectKey)
+	mac.Write([]byte(sectorIdentifier))
+	mac.Write([]byte{0})
+	mac.Write([]byte(username))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// subject returns the subject identifier of the resource owner for the client.
+func (s *Server) subject(client Client, username string) (string, error) {
+	if c, ok := client.(PairwiseSubjectClient); ok {
+		return s.PairwiseSubject(c.SectorIdentifier(), username)
+	}
+	return username, nil
+}
@@ -0,0 +1,76 @@
+package goauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testPairwiseClient is a testClient receiving pairwise subject identifiers.
+type testPairwiseClient struct {
+	*testClient
+}
+
+func (t testPairwiseClient) SectorIdentifier() string {
+	return "testuri.com"
+}
+
+type testPairwiseAuthenticator struct {
+	*testAuthenticator
+}
+
+func (t testPairwiseAuthenticator) GetClientWithSecret(clientID string, clientSecret Secret) (Client, error) {
+	client, err := t.testAuthenticator.GetClientWithSecret(clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+	return testPairwiseClient{client.(*testClient)}, nil
+}
+
+func TestPairwiseSubject(t *testing.T) {
+	server := newTestHandler()
+	if _, err := server.PairwiseSubject("example.com", "testusername"); err != ErrNoPairwiseSubjectKey {
+		t.Errorf("Test failed, expected ErrNoPairwiseSubjectKey got %v", err)
+	}
+	server.PairwiseSubjectKey = []byte("testkey")
+	a, _ := server.PairwiseSubject("example.com", "testusername")
+	b, _ := server.PairwiseSubject("example.com", "testusername")
+	c, _ := server.PairwiseSubject("other.example.com", "testusername")
+	if a != b || a == c || a == "testusername" {
+		t.Errorf("Test failed, expected stable identifiers differing by sector got %s %s %s", a, b, c)
+	}
+
+	// JWT access tokens issued to pairwise clients identify the resource owner by the pairwise identifier
+	key, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.Signer = &StaticSigner{Key: key}
+	server.TokenFormats = map[string]TokenFormat{"https://api.example.com": TokenFormatJWT}
+	server.Authenticator = testPairwiseAuthenticator{server.Authenticator.(*testAuthenticator)}
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=password&username=testusername&password=testpassword&scope=testscope&resource=https%3A%2F%2Fapi.example.com"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	token, _ := resp["access_token"].(string)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Test failed, expected a JWT got %v", resp)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	json.Unmarshal(payload, &claims)
+	expected, _ := server.PairwiseSubject("testuri.com", "testusername")
+	if claims["sub"] != expected {
+		t.Errorf("Test failed, expected sub %s got %v", expected, claims["sub"])
+	}
+}
@@ -0,0 +1,67 @@
+package goauth
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// DefaultSweepBatchSize is the maximum number of records removed by each call to SweepExpired made by
+	// SessionStore.Sweep.
+	DefaultSweepBatchSize = 1000
+	// ErrSweepUnsupported is returned by SessionStore.Sweep if the SessionStoreBackend does not implement
+	// ExpirySweeper.
+	ErrSweepUnsupported = errors.New("session store does not support sweeping expired records")
+)
+
+// ExpirySweeper may be implemented by a SessionStoreBackend without native expiry, such as a SQL
+// database, to remove expired grants, authorization codes and other short lived records.
+type ExpirySweeper interface {
+	// SweepExpired removes at most limit expired records, returning the number removed. Grants are removed
+	// only if Sweepable returns true. If onRemove is not nil it is called with each grant before it is
+	// removed, and an error returned by it stops the sweep leaving the grant in place.
+	SweepExpired(ctx context.Context, limit int, onRemove func(Grant) error) (int, error)
+}
+
+// Sweepable returns true if the grant has expired and can no longer be refreshed, so that it may be
+// removed from the session store. Grants with a refresh token are kept until they are replaced or revoked.
+func (g *Grant) Sweepable() bool {
+	return g.IsExpired() && g.RefreshToken == ""
+}
+
+// SweepProgress reports the progress of SessionStore.Sweep.
+type SweepProgress struct {
+	// Batches is the number of batches swept.
+	Batches int
+	// Removed is the total number of records removed.
+	Removed int
+}
+
+// Sweep removes expired records from the backend in batches of DefaultSweepBatchSize until none remain
+// or the context is cancelled. The progress function, if not nil, is called after each batch. It is
+// intended to be run periodically, such as from cron or a Component.
+func (s *SessionStore) Sweep(ctx context.Context, progress func(SweepProgress)) (SweepProgress, error) {
+	var p SweepProgress
+	sweeper, ok := s.SessionStoreBackend.(ExpirySweeper)
+	if !ok {
+		return p, ErrSweepUnsupported
+	}
+	for {
+		err := ctx.Err()
+		if err != nil {
+			return p, err
+		}
+		n, err := sweeper.SweepExpired(ctx, DefaultSweepBatchSize, nil)
+		if err != nil {
+			return p, err
+		}
+		p.Batches++
+		p.Removed += n
+		if progress != nil {
+			progress(p)
+		}
+		if n < DefaultSweepBatchSize {
+			return p, nil
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package goauth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionStoreSweep(t *testing.T) {
+	store := NewSessionStore(NewMemSessionStoreBackend())
+	now := time.Now()
+	expired := now.Add(-2 * time.Hour)
+	grants := []Grant{
+		{AccessToken: "expired1", CreatedAt: expired, ExpiresIn: time.Hour},
+		{AccessToken: "expired2", CreatedAt: expired, ExpiresIn: time.Hour},
+		{AccessToken: "expired3", CreatedAt: expired, ExpiresIn: time.Hour},
+		// Grants that can still be refreshed are kept
+		{AccessToken: "refreshable", RefreshToken: "refresh", CreatedAt: expired, ExpiresIn: time.Hour},
+		{AccessToken: "active", CreatedAt: now, ExpiresIn: time.Hour},
+	}
+	for _, g := range grants {
+		err := store.PutGrant(g)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := store.PutAuthorizationCode(AuthorizationCode{Code: "code", CreatedAt: expired, ExpiresIn: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	DefaultSweepBatchSize = 2
+	defer func() { DefaultSweepBatchSize = 1000 }()
+	var reports []SweepProgress
+	p, err := store.Sweep(context.Background(), func(p SweepProgress) {
+		reports = append(reports, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Removed != 4 || p.Batches != 3 || len(reports) != 3 {
+		t.Errorf("Test failed, unexpected progress %+v with reports %v", p, reports)
+	}
+	for _, token := range []Secret{"refreshable", "active"} {
+		if _, err := store.GetGrant(token); err != nil {
+			t.Errorf("Test failed, expected grant %s to be kept", token.RawString())
+		}
+	}
+	if _, err := store.GetGrant("expired1"); err == nil {
+		t.Error("Test failed, expected expired grant to be removed")
+	}
+
+	// Backends without sweeping report it as unsupported
+	_, err = NewSessionStore(struct{ SessionStoreBackend }{NewMemSessionStoreBackend()}).Sweep(context.Background(), nil)
+	if err != ErrSweepUnsupported {
+		t.Errorf("Test failed, expected ErrSweepUnsupported got %v", err)
+	}
+}
@@ -1,10 +1,15 @@
 package goauth
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,12 +26,15 @@ const (
 )
 
 var (
-	// DefaultTokenExpiry is the default number of seconds
-	// that a token is
+	// DefaultTokenExpiry is the default lifetime of a token, used to initialize the TokenExpiry of each
+	// Server created by New.
 	DefaultTokenExpiry = time.Hour
 	// DefaultTokenType is the default token type that should be used when creating new tokens.
 	DefaultTokenType = TokenTypeBearer
-	// NewToken is a utility method for generating a new token that can be overriden in testing.
+	// NewToken generates tokens for SessionStores that do not set a TokenSource and is the initial
+	// TokenSource of each Server created by New. Tests should set a TokenSource, such as using
+	// Server.WithDeterministicTokens, rather than overriding NewToken, which affects every test in the
+	// process.
 	NewToken = newToken
 )
 
@@ -50,16 +58,146 @@ type Grant struct {
 	IDToken      Secret
 	Scope        []string
 	CreatedAt    time.Time
+	// RefreshScope is the scope of the refresh token if it is broader than Scope, such as when the access
+	// token was down-scoped on refresh. Later refreshes may request any of it.
+	RefreshScope []string
+	// Fingerprint is the context in which the grant was issued, it is only recorded when token
+	// binding is enabled.
+	Fingerprint RequestFingerprint
+	// ClientID is the ID of the client the grant was issued to.
+	ClientID string
+	// Username identifies the resource owner who authorized the grant. It is empty for grants issued to
+	// clients acting on their own behalf.
+	Username string
+	// Actor identifies the client acting on behalf of the resource owner of an impersonation grant.
+	Actor *Actor
+	// MayAct identifies the party authorized to act on behalf of the resource owner, such as by
+	// impersonation using this grant's access token as the actor token.
+	MayAct *Actor
+	// AuthorizationDetails are the fine-grained permissions granted in addition to the scope.
+	AuthorizationDetails []AuthorizationDetail
+	// Audience lists the resources at which the access token may be used, if the token request
+	// identified them.
+	Audience []string
+	// RefreshExpiresAt is the time at which the refresh token expires. If zero, it does not expire.
+	RefreshExpiresAt time.Time
+	// AuthTime is the time at which the resource owner authenticated to authorize the grant, if known.
+	// Refreshed grants keep the AuthTime of the grant they replace.
+	AuthTime time.Time
+	// Nonce is the nonce of the authorization request that the grant was issued for, included in its ID
+	// token. Refreshed grants do not keep it.
+	Nonce string
+	// IssuedAt is the time at which the server issued the grant and NotBefore the time before which it
+	// must not be accepted. If zero, NotBefore is not checked.
+	IssuedAt  time.Time
+	NotBefore time.Time
+	// Version is incremented each time the stored grant is updated using SessionStore.UpdateGrant or
+	// replaced by rotating its refresh token, so that concurrent modifications can be detected.
+	Version int64
+	// ReplacedBy is the access token of the grant issued when the refresh token of this grant was
+	// rotated, and ReplacedAt the time of the rotation. A replaced grant can no longer be used.
+	ReplacedBy Secret
+	ReplacedAt time.Time
+}
+
+// refreshTokenExpired returns true if the refresh token of the grant has expired.
+func (g *Grant) refreshTokenExpired() bool {
+	return !g.RefreshExpiresAt.IsZero() && !g.RefreshExpiresAt.After(timeNow())
+}
+
+// refreshScope returns the scope that may be requested when refreshing the grant.
+func (g *Grant) refreshScope() []string {
+	if g.RefreshScope != nil {
+		return g.RefreshScope
+	}
+	return g.Scope
+}
+
+// TokenPolicy defines the tokens issued to a client.
+type TokenPolicy struct {
+	// AccessTokenLifetime is the lifetime of the client's access tokens, overriding the ExpiresIn of the
+	// grants it creates. If zero, the ExpiresIn of the grant is used.
+	AccessTokenLifetime time.Duration
+	// NoRefreshTokens prevents refresh tokens being issued to the client, such as a single page application
+	// that cannot store them securely, even if its grants include one.
+	NoRefreshTokens bool
+	// RefreshTokenLifetime is the lifetime of the client's refresh tokens. Rotated refresh tokens receive
+	// a new lifetime while reused refresh tokens keep their original expiry, so combined with single use
+	// refresh tokens it allows short-lived, rotating refresh tokens. If zero, refresh tokens do not expire.
+	RefreshTokenLifetime time.Duration
+}
+
+// TokenPolicyProvider is implemented by a Client that defines its own TokenPolicy.
+type TokenPolicyProvider interface {
+	Client
+	TokenPolicy() TokenPolicy
+}
+
+// tokenPolicy returns the TokenPolicy of the client.
+func tokenPolicy(client Client) TokenPolicy {
+	if c, ok := client.(TokenPolicyProvider); ok {
+		return c.TokenPolicy()
+	}
+	return TokenPolicy{}
 }
 
 // IsExpired returns true if the grant has expired, else it returns false.
 func (g *Grant) IsExpired() bool {
-	if g.CreatedAt.Add(time.Duration(g.ExpiresIn) * time.Second).After(timeNow()) {
+	if g.ExpiresAt().After(timeNow()) {
 		return false
 	}
 	return true
 }
 
+// ExpiresAt returns the time at which the grant expires.
+func (g *Grant) ExpiresAt() time.Time {
+	return g.CreatedAt.Add(g.ExpiresIn)
+}
+
+// TTL returns the time remaining until the grant expires at the given time, or zero if it has expired.
+func (g *Grant) TTL(now time.Time) time.Duration {
+	ttl := g.ExpiresAt().Sub(now)
+	if ttl < 0 {
+		return 0
+	}
+	return ttl
+}
+
+// IssuedTo returns the ID of the client the grant was issued to.
+func (g *Grant) IssuedTo() string {
+	return g.ClientID
+}
+
+// issueGrant records the client, resource owner and time of issue on a new grant, applies the client's
+// TokenPolicy to its access and refresh tokens, issues its ID token, encrypting it if required by the client, binds it to the request and
+// formats its access token for the requested resources.
+func (s *Server) issueGrant(r *http.Request, clientID string, client Client, username string, grant *Grant) error {
+	grant.ClientID = clientID
+	grant.Username = username
+	policy := tokenPolicy(client)
+	if policy.AccessTokenLifetime > 0 {
+		grant.ExpiresIn = policy.AccessTokenLifetime
+	}
+	grant.IssuedAt = timeNow()
+	if grant.NotBefore.IsZero() {
+		grant.NotBefore = grant.IssuedAt
+	}
+	if policy.NoRefreshTokens {
+		grant.RefreshToken = ""
+		grant.RefreshExpiresAt = time.Time{}
+	} else if grant.RefreshToken != "" && grant.RefreshExpiresAt.IsZero() && policy.RefreshTokenLifetime > 0 {
+		grant.RefreshExpiresAt = grant.IssuedAt.Add(policy.RefreshTokenLifetime)
+	}
+	if err := s.issueIDToken(client, grant); err != nil {
+		return err
+	}
+	if err := encryptIDToken(client, grant); err != nil {
+		return err
+	}
+	s.bindGrant(r, grant)
+	return s.formatAccessToken(r, client, grant)
+}
+
 func (g *Grant) CheckScope(requiredScope []string) error {
 	// For each of the required scopes check that the grant has access
 	for _, check := range requiredScope {
@@ -80,22 +218,166 @@ func checkInScope(check string, scope []string) bool {
 	return false
 }
 
+// TokenResponseEncoding selects the media type of token responses.
+type TokenResponseEncoding int
+
+const (
+	// TokenEncodingJSON writes token responses as JSON, as required by RFC 6749.
+	TokenEncodingJSON TokenResponseEncoding = iota
+	// TokenEncodingNegotiate writes form encoded token responses to clients whose Accept header prefers
+	// application/x-www-form-urlencoded to application/json, and JSON to all other clients.
+	TokenEncodingNegotiate
+	// TokenEncodingForm always writes form encoded token responses, for legacy clients which do not send
+	// an Accept header.
+	TokenEncodingForm
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeForm = "application/x-www-form-urlencoded"
+)
+
+// TokenResponseOptions adjusts token responses to interoperate with client libraries that do not accept
+// every response permitted by RFC 6749. The zero value writes standard responses.
+type TokenResponseOptions struct {
+	// CapitalizeTokenType writes the token_type with an initial capital, such as "Bearer".
+	CapitalizeTokenType bool
+	// ExpiresInString writes expires_in as a string rather than a number.
+	ExpiresInString bool
+	// AlwaysIncludeScope writes the scope even if the grant has none.
+	AlwaysIncludeScope bool
+	// Encoding selects between JSON and form encoded responses.
+	Encoding TokenResponseEncoding
+}
+
+// tokenType returns the token type as written in responses.
+func (o TokenResponseOptions) tokenType(t TokenType) string {
+	if o.CapitalizeTokenType && t != "" {
+		return strings.ToUpper(string(t[:1])) + string(t[1:])
+	}
+	return string(t)
+}
+
+// contentType returns the media type of the token response to the request.
+func (o TokenResponseOptions) contentType(r *http.Request) string {
+	switch o.Encoding {
+	case TokenEncodingForm:
+		return contentTypeForm
+	case TokenEncodingNegotiate:
+		if r != nil && acceptQuality(r, contentTypeForm) > acceptQuality(r, contentTypeJSON) {
+			return contentTypeForm
+		}
+	}
+	return contentTypeJSON
+}
+
+// acceptQuality returns the quality the Accept header of the request gives the media type, only counting
+// exact matches so that wildcards fall back to JSON.
+func acceptQuality(r *http.Request, mediaType string) float64 {
+	for _, header := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(header, ",") {
+			params := strings.Split(part, ";")
+			if !strings.EqualFold(strings.TrimSpace(params[0]), mediaType) {
+				continue
+			}
+			q := 1.0
+			for _, param := range params[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) == 2 && kv[0] == "q" {
+					if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+						q = v
+					}
+				}
+			}
+			return q
+		}
+	}
+	return 0
+}
+
 // Write marshals the Grant into JSON, including only the required fields and writes it
 // to the provided io.Writer. It is used to return Grants in an http response.
 func (g *Grant) Write(w io.Writer) error {
+	return g.WriteWithOptions(w, TokenResponseOptions{})
+}
+
+// fields returns the fields of the token response for the Grant.
+func (g *Grant) fields(opts TokenResponseOptions) map[string]interface{} {
 	m := make(map[string]interface{})
-	m["access_token"] = g.AccessToken
-	m["token_type"] = g.TokenType
-	m["expires_in"] = g.ExpiresIn.Seconds()
+	m["access_token"] = g.AccessToken.RawString()
+	m["token_type"] = opts.tokenType(g.TokenType)
+	expiresIn := int64(g.ExpiresIn / time.Second)
+	if opts.ExpiresInString {
+		m["expires_in"] = strconv.FormatInt(expiresIn, 10)
+	} else {
+		m["expires_in"] = expiresIn
+	}
 	if g.RefreshToken != "" {
-		m["refresh_token"] = g.RefreshToken
+		m["refresh_token"] = g.RefreshToken.RawString()
 	}
-	if g.Scope != nil {
+	if g.Scope != nil || opts.AlwaysIncludeScope {
 		m["scope"] = strings.Join(g.Scope, " ")
 	}
 	if g.IDToken != "" {
-		m["id_token"] = g.IDToken
+		m["id_token"] = g.IDToken.RawString()
+	}
+	if g.AuthorizationDetails != nil {
+		m["authorization_details"] = g.AuthorizationDetails
+	}
+	return m
+}
+
+// WriteWithOptions marshals the Grant into JSON as Write does, applying the TokenResponseOptions. If the
+// options select TokenEncodingForm the Grant is form encoded instead.
+func (g *Grant) WriteWithOptions(w io.Writer, opts TokenResponseOptions) error {
+	if opts.Encoding == TokenEncodingForm {
+		return g.writeForm(w, opts)
 	}
 	enc := json.NewEncoder(w)
-	return enc.Encode(m)
+	return enc.Encode(g.fields(opts))
+}
+
+// writeForm writes the Grant as application/x-www-form-urlencoded.
+func (g *Grant) writeForm(w io.Writer, opts TokenResponseOptions) error {
+	v := url.Values{}
+	for key, value := range g.fields(opts) {
+		switch value := value.(type) {
+		case string, int64:
+			v.Set(key, fmt.Sprint(value))
+		default:
+			// Structured values are encoded as JSON
+			b, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			v.Set(key, string(b))
+		}
+	}
+	_, err := io.WriteString(w, v.Encode())
+	return err
+}
+
+// writeGrant writes the grant in a token response to the request using the Server's TokenResponseOptions,
+// setting the Content-Type of the response.
+func (s *Server) writeGrant(w http.ResponseWriter, r *http.Request, grant Grant) error {
+	contentType, body, err := s.encodeGrant(r, grant)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, err = w.Write(body)
+	return err
+}
+
+// encodeGrant returns the media type and body of the token response for the grant.
+func (s *Server) encodeGrant(r *http.Request, grant Grant) (string, []byte, error) {
+	var buf bytes.Buffer
+	var err error
+	contentType := s.TokenResponse.contentType(r)
+	if contentType == contentTypeForm {
+		err = grant.writeForm(&buf, s.TokenResponse)
+	} else {
+		err = json.NewEncoder(&buf).Encode(grant.fields(s.TokenResponse))
+	}
+	return contentType, buf.Bytes(), err
 }
@@ -1,7 +1,12 @@
 package goauth
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTokenHandler(t *testing.T) {
@@ -13,3 +18,143 @@ func TestTokenHandler(t *testing.T) {
 		t.Errorf("Test failed, got token with length %v", len(tok))
 	}
 }
+
+func TestGrantExpiry(t *testing.T) {
+	now := time.Now()
+	grant := Grant{ClientID: "testclientid", ExpiresIn: time.Minute, CreatedAt: now}
+	if !grant.ExpiresAt().Equal(now.Add(time.Minute)) {
+		t.Errorf("Test failed, unexpected expiry %v", grant.ExpiresAt())
+	}
+	if ttl := grant.TTL(now.Add(20 * time.Second)); ttl != 40*time.Second {
+		t.Errorf("Test failed, unexpected TTL %v", ttl)
+	}
+	if ttl := grant.TTL(now.Add(time.Hour)); ttl != 0 {
+		t.Errorf("Test failed, expected no TTL for an expired grant got %v", ttl)
+	}
+	if grant.IssuedTo() != "testclientid" {
+		t.Errorf("Test failed, unexpected client %s", grant.IssuedTo())
+	}
+}
+
+func TestGrantJSON(t *testing.T) {
+	grant := Grant{AccessToken: "testtoken", ExpiresIn: time.Hour, CreatedAt: time.Now().Add(-30 * time.Minute)}
+	if grant.IsExpired() {
+		t.Error("Test failed, expected the grant not to have expired")
+	}
+	data, err := json.Marshal(grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Grant
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ExpiresIn != time.Hour || decoded.AccessToken != "testtoken" {
+		t.Errorf("Test failed, unexpected grant %v", decoded)
+	}
+	// Grants stored by earlier versions, with ExpiresIn in nanoseconds, are decoded unchanged
+	err = json.Unmarshal([]byte(`{"AccessToken":"legacytoken","ExpiresIn":3600000000000}`), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ExpiresIn != time.Hour {
+		t.Errorf("Test failed, expected a legacy grant to expire after an hour got %v", decoded.ExpiresIn)
+	}
+	// Only the token response encodes ExpiresIn as seconds
+	var buf bytes.Buffer
+	err = grant.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"expires_in":3600`) {
+		t.Errorf("Test failed, expected expires_in to be an integer got %s", buf.String())
+	}
+}
+
+func TestGrantWriteWithOptions(t *testing.T) {
+	grant := Grant{AccessToken: "testtoken", TokenType: TokenTypeBearer, ExpiresIn: time.Hour}
+	var buf bytes.Buffer
+	err := grant.WriteWithOptions(&buf, TokenResponseOptions{
+		CapitalizeTokenType: true,
+		ExpiresInString:     true,
+		AlwaysIncludeScope:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m["token_type"] != "Bearer" || m["expires_in"] != "3600" || m["scope"] != "" {
+		t.Errorf("Test failed, unexpected response %s", buf.String())
+	}
+}
+
+func TestTokenResponseContentType(t *testing.T) {
+	cases := []struct {
+		Encoding TokenResponseEncoding
+		Accept   string
+		Expected string
+	}{
+		{TokenEncodingJSON, "application/x-www-form-urlencoded", "application/json"},
+		{TokenEncodingNegotiate, "", "application/json"},
+		{TokenEncodingNegotiate, "*/*", "application/json"},
+		{TokenEncodingNegotiate, "application/x-www-form-urlencoded", "application/x-www-form-urlencoded"},
+		{TokenEncodingNegotiate, "application/json;q=0.5, application/x-www-form-urlencoded", "application/x-www-form-urlencoded"},
+		{TokenEncodingNegotiate, "application/json, application/x-www-form-urlencoded", "application/json"},
+		{TokenEncodingForm, "application/json", "application/x-www-form-urlencoded"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", TokenEndpoint, nil)
+		if c.Accept != "" {
+			r.Header.Set("Accept", c.Accept)
+		}
+		s := &Server{TokenResponse: TokenResponseOptions{Encoding: c.Encoding}}
+		w := httptest.NewRecorder()
+		grant := Grant{AccessToken: "testtoken", TokenType: TokenTypeBearer, ExpiresIn: time.Hour, Scope: []string{"a", "b"}}
+		err := s.writeGrant(w, r, grant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != c.Expected {
+			t.Errorf("Test failed, expected %s for %q got %s", c.Expected, c.Accept, ct)
+		}
+		if c.Expected == "application/x-www-form-urlencoded" {
+			expected := "access_token=testtoken&expires_in=3600&scope=a+b&token_type=bearer"
+			if w.Body.String() != expected {
+				t.Errorf("Test failed, expected %s got %s", expected, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestTokenHandlerUnsupportedGrantType(t *testing.T) {
+	server := newTestHandler()
+	server.GrantTypeErrors = map[GrantType]Error{"urn:example:legacy": ErrorUnauthorizedClient}
+	cases := []struct {
+		Body     string
+		Status   int
+		Expected string
+	}{
+		{"", 400, "invalid_request"},
+		{"grant_type=urn:example:unknown", 400, "unsupported_grant_type"},
+		{"grant_type=urn:example:legacy", 401, "unauthorized_client"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(c.Body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		var e Error
+		err := json.Unmarshal(w.Body.Bytes(), &e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Code != c.Status || e.Code != c.Expected {
+			t.Errorf("Test failed, expected %d %s for %q got %d %s", c.Status, c.Expected, c.Body, w.Code, e.Code)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package goauth
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// parseTokenRequestBody returns an http.HandlerFunc that parses the application/json or multipart/form-data
+// body of a token request, if enabled by the Server's JSONTokenRequests or MultipartTokenRequests, into the
+// form of the request so that the handler reads its parameters as it would those of a form encoded body.
+func (s *Server) parseTokenRequestBody(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		var err error
+		switch {
+		case mediaType == "application/json" && s.JSONTokenRequests:
+			err = parseJSONForm(r)
+		case mediaType == "multipart/form-data" && s.MultipartTokenRequests:
+			err = r.ParseMultipartForm(s.maxRequestBodySize())
+		default:
+			handler(w, r)
+			return
+		}
+		if body, ok := r.Body.(*limitedBody); ok && body.exceeded {
+			s.ErrorHandler(w, ErrorRequestTooLarge.StatusCode, ErrorRequestTooLarge)
+			return
+		}
+		if err != nil || countFormValues(r.Form) > s.maxFormValues() {
+			s.ErrorHandler(w, ErrorInvalidRequest.StatusCode, ErrorInvalidRequest)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// parseJSONForm adds the members of the JSON object in the body of the request to its form. Strings and
+// arrays of strings are used as they are, any other value, such as the authorization_details array, is
+// used as its JSON encoding as it would be in a form encoded request.
+func parseJSONForm(r *http.Request) error {
+	var members map[string]json.RawMessage
+	err := json.NewDecoder(r.Body).Decode(&members)
+	if err != nil {
+		return err
+	}
+	values := make(url.Values, len(members))
+	for name, raw := range members {
+		raw = bytes.TrimSpace(raw)
+		var value string
+		var multiple []string
+		switch {
+		case bytes.Equal(raw, []byte("null")):
+		case json.Unmarshal(raw, &value) == nil:
+			values.Set(name, value)
+		case json.Unmarshal(raw, &multiple) == nil:
+			values[name] = multiple
+		default:
+			values.Set(name, string(raw))
+		}
+	}
+	if r.PostForm == nil {
+		r.PostForm = make(url.Values)
+	}
+	if r.Form == nil {
+		r.Form = make(url.Values)
+	}
+	for name, v := range values {
+		r.PostForm[name] = append(r.PostForm[name], v...)
+		// As with form encoded bodies, values from the body precede those from the query string
+		r.Form[name] = append(append([]string(nil), v...), r.Form[name]...)
+	}
+	return nil
+}
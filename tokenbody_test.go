@@ -0,0 +1,117 @@
+package goauth
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func multipartBody(t *testing.T, values map[string]string) (io.Reader, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, value := range values {
+		err := mw.WriteField(name, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := mw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &buf, mw.FormDataContentType()
+}
+
+func TestTokenRequestBody(t *testing.T) {
+	multipart, multipartType := multipartBody(t, map[string]string{"grant_type": "client_credentials", "scope": "testscope"})
+	cases := []struct {
+		JSON        bool
+		Multipart   bool
+		Body        io.Reader
+		ContentType string
+		Status      int
+	}{
+		{true, false, strings.NewReader(`{"grant_type":"client_credentials","scope":"testscope"}`), "application/json", http.StatusOK},
+		{true, false, strings.NewReader(`{"grant_type":"client_credentials","scope":null}`), "application/json; charset=utf-8", http.StatusOK},
+		// JSON bodies are not accepted unless enabled
+		{false, false, strings.NewReader(`{"grant_type":"client_credentials"}`), "application/json", http.StatusBadRequest},
+		{true, false, strings.NewReader(`{"grant_type":`), "application/json", http.StatusBadRequest},
+		{true, false, strings.NewReader(`["grant_type"]`), "application/json", http.StatusBadRequest},
+		{false, true, multipart, multipartType, http.StatusOK},
+		{false, false, strings.NewReader("--x--"), "multipart/form-data; boundary=x", http.StatusBadRequest},
+		{false, true, strings.NewReader("not multipart"), "multipart/form-data", http.StatusBadRequest},
+		// Form encoded bodies are still accepted when other bodies are enabled
+		{true, true, strings.NewReader("grant_type=client_credentials"), "application/x-www-form-urlencoded", http.StatusOK},
+	}
+	for i, c := range cases {
+		server := newTestHandler()
+		server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+		server.JSONTokenRequests = c.JSON
+		server.MultipartTokenRequests = c.Multipart
+		r := httptest.NewRequest("POST", TokenEndpoint, c.Body)
+		r.Header.Set("Content-Type", c.ContentType)
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != c.Status {
+			t.Errorf("Test failed, expected status %d for case %d got %d: %s", c.Status, i, w.Code, w.Body.Bytes())
+		}
+	}
+}
+
+func TestTokenRequestBodyLimits(t *testing.T) {
+	server := newTestHandler()
+	server.JSONTokenRequests = true
+	server.MaxRequestBodySize = 64
+	server.MaxFormValues = 3
+	cases := []struct {
+		Body   string
+		Status int
+	}{
+		{`{"grant_type":"` + strings.Repeat("x", 64) + `"}`, http.StatusRequestEntityTooLarge},
+		{`{"a":"1","b":["2","3"],"c":"4"}`, http.StatusBadRequest},
+	}
+	for i, c := range cases {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(c.Body))
+		r.Header.Set("Content-Type", "application/json")
+		r.ContentLength = -1
+		r.Body = io.NopCloser(r.Body)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != c.Status {
+			t.Errorf("Test failed, expected status %d for case %d got %d", c.Status, i, w.Code)
+		}
+	}
+}
+
+func TestParseJSONForm(t *testing.T) {
+	r := httptest.NewRequest("POST", TokenEndpoint+"?a=query", strings.NewReader(`{
+		"a": "body",
+		"resource": ["https://a.example.com", "https://b.example.com"],
+		"authorization_details": [{"type": "payment"}],
+		"n": 3,
+		"skipped": null
+	}`))
+	r.ParseForm()
+	err := parseJSONForm(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := url.Values{
+		"a":                     {"body"},
+		"resource":              {"https://a.example.com", "https://b.example.com"},
+		"authorization_details": {`[{"type": "payment"}]`},
+		"n":                     {"3"},
+	}
+	if r.PostForm.Encode() != expected.Encode() {
+		t.Errorf("Test failed, expected post form %v got %v", expected, r.PostForm)
+	}
+	if got := r.Form["a"]; len(got) != 2 || got[0] != "body" || got[1] != "query" {
+		t.Errorf("Test failed, expected both the query and body values of a got %v", got)
+	}
+}
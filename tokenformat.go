@@ -0,0 +1,174 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ParamResource is the parameter of token requests identifying the resources at which the access token
+// will be used as per https://tools.ietf.org/html/rfc8707.
+const ParamResource = "resource"
+
+// TokenFormat is the format of issued access tokens.
+type TokenFormat string
+
+const (
+	// TokenFormatOpaque issues random access tokens that resource servers verify by introspection or by
+	// sharing the session store.
+	TokenFormatOpaque TokenFormat = "opaque"
+	// TokenFormatJWT issues access tokens as JWTs signed by the Server's Signer, so that resource servers
+	// can verify them using the published keys. They are also stored in the session store so that Secure
+	// and introspection continue to accept them.
+	TokenFormatJWT TokenFormat = "jwt"
+)
+
+var (
+	// DefaultTokenFormat is the format of access tokens issued for resources not configured in the
+	// Server's TokenFormats.
+	DefaultTokenFormat = TokenFormatOpaque
+	// ErrNoSigner is returned when a JWT is issued by a Server without a Signer.
+	ErrNoSigner = errors.New("the server has no signer")
+)
+
+// accessTokenClaims are the claims of access tokens issued as JWTs.
+type accessTokenClaims struct {
+	ID       string      `json:"jti"`
+	Issuer   string      `json:"iss,omitempty"`
+	Subject  string      `json:"sub"`
+	Audience interface{} `json:"aud,omitempty"`
+	ClientID string      `json:"client_id"`
+	Actor    *Actor      `json:"act,omitempty"`
+	MayAct   *Actor      `json:"may_act,omitempty"`
+	// AuthorizationDetails are the fine-grained permissions of the token.
+	AuthorizationDetails []AuthorizationDetail `json:"authorization_details,omitempty"`
+	Scope                string                `json:"scope,omitempty"`
+	IssuedAt             int64                 `json:"iat"`
+	NotBefore            int64                 `json:"nbf"`
+	Expiry               int64                 `json:"exp"`
+	// Extra are the claims added by the Server's ClaimsMapper.
+	Extra map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON encodes the claims including the Extra claims. Extra claims cannot replace the claims set by
+// the Server.
+func (c accessTokenClaims) MarshalJSON() ([]byte, error) {
+	type claims accessTokenClaims
+	b, err := json.Marshal(claims(c))
+	if err != nil || len(c.Extra) == 0 {
+		return b, err
+	}
+	m := make(map[string]interface{}, len(c.Extra))
+	for name, value := range c.Extra {
+		m[name] = value
+	}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+// ClaimsRequest describes an access token being issued as a JWT.
+type ClaimsRequest struct {
+	ClientID string
+	Client   Client
+	// Subject is the sub claim of the token, the subject identifier of the resource owner for the client or,
+	// for grants issued to clients acting on their own behalf, the client ID.
+	Subject string
+	Scope   []string
+	// Grant is the grant of the access token.
+	Grant Grant
+}
+
+// ClaimsMapper adds claims, such as tenant IDs or roles, to the access tokens issued as JWTs. The
+// context is that of the token request.
+type ClaimsMapper interface {
+	MapClaims(ctx context.Context, req ClaimsRequest) (map[string]interface{}, error)
+}
+
+// ClaimsMapperFunc is an adapter allowing a function to be used as a ClaimsMapper.
+type ClaimsMapperFunc func(ctx context.Context, req ClaimsRequest) (map[string]interface{}, error)
+
+// MapClaims calls f(ctx, req).
+func (f ClaimsMapperFunc) MapClaims(ctx context.Context, req ClaimsRequest) (map[string]interface{}, error) {
+	return f(ctx, req)
+}
+
+// tokenFormat returns the format of the access token for the resources. A JWT is issued if any of the
+// resources requires one.
+func (s *Server) tokenFormat(resources []string) TokenFormat {
+	format := DefaultTokenFormat
+	for _, resource := range resources {
+		if f, ok := s.TokenFormats[resource]; ok {
+			if f == TokenFormatJWT {
+				return f
+			}
+			format = f
+		}
+	}
+	return format
+}
+
+// formatAccessToken records the resources of the token request on the grant and replaces its access token
+// with a JWT if required by the format configured for the resources.
+func (s *Server) formatAccessToken(r *http.Request, client Client, grant *Grant) error {
+	r.ParseForm()
+	resources := r.Form[ParamResource]
+	if len(resources) > 0 {
+		grant.Audience = resources
+	}
+	if s.tokenFormat(resources) != TokenFormatJWT {
+		return nil
+	}
+	if s.Signer == nil {
+		return ErrNoSigner
+	}
+	subject := grant.ClientID
+	if grant.Username != "" {
+		var err error
+		subject, err = s.subject(client, grant.Username)
+		if err != nil {
+			return err
+		}
+	}
+	claims := accessTokenClaims{
+		ID:                   newRequestID(),
+		Issuer:               s.Issuer,
+		Subject:              subject,
+		ClientID:             grant.ClientID,
+		Actor:                grant.Actor,
+		MayAct:               grant.MayAct,
+		AuthorizationDetails: grant.AuthorizationDetails,
+		Scope:                strings.Join(grant.Scope, " "),
+		IssuedAt:             grant.IssuedAt.Unix(),
+		NotBefore:            grant.NotBefore.Unix(),
+		Expiry:               grant.ExpiresAt().Unix(),
+	}
+	if len(resources) == 1 {
+		claims.Audience = resources[0]
+	} else if len(resources) > 1 {
+		claims.Audience = resources
+	}
+	if s.ClaimsMapper != nil {
+		extra, err := s.ClaimsMapper.MapClaims(r.Context(), ClaimsRequest{
+			ClientID: grant.ClientID,
+			Client:   client,
+			Subject:  subject,
+			Scope:    grant.Scope,
+			Grant:    *grant,
+		})
+		if err != nil {
+			return err
+		}
+		claims.Extra = extra
+	}
+	token, err := s.SignJWTForClient(client, claims)
+	if err != nil {
+		return err
+	}
+	grant.AccessToken = token
+	return nil
+}
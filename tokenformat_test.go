@@ -0,0 +1,89 @@
+package goauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTokenFormats(t *testing.T) {
+	key, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	server.Signer = &StaticSigner{Key: key}
+	server.TokenFormats = map[string]TokenFormat{"https://partner.example.com": TokenFormatJWT}
+
+	issue := func(body string) (map[string]interface{}, Grant) {
+		r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		var resp map[string]interface{}
+		err := json.NewDecoder(w.Body).Decode(&resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, _ := resp["access_token"].(string)
+		grant, err := server.SessionStore.GetGrant(Secret(token))
+		if err != nil {
+			t.Fatalf("Test failed, expected the access token to be stored got %v", resp)
+		}
+		return resp, grant
+	}
+
+	// Internal resources receive opaque tokens
+	resp, grant := issue("grant_type=client_credentials&resource=https%3A%2F%2Fapi.internal")
+	if strings.Count(resp["access_token"].(string), ".") != 0 {
+		t.Errorf("Test failed, expected an opaque token got %v", resp["access_token"])
+	}
+	if len(grant.Audience) != 1 || grant.Audience[0] != "https://api.internal" {
+		t.Errorf("Test failed, unexpected audience %v", grant.Audience)
+	}
+
+	// Partner resources receive JWTs
+	resp, grant = issue("grant_type=client_credentials&resource=https%3A%2F%2Fpartner.example.com")
+	parts := strings.Split(resp["access_token"].(string), ".")
+	if len(parts) != 3 {
+		t.Fatalf("Test failed, expected a JWT got %v", resp["access_token"])
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["aud"] != "https://partner.example.com" || claims["sub"] != "testclientid" || claims["client_id"] != "testclientid" {
+		t.Errorf("Test failed, unexpected claims %v", claims)
+	}
+	if int64(claims["exp"].(float64)) != grant.ExpiresAt().Unix() {
+		t.Errorf("Test failed, expected exp %d got %v", grant.ExpiresAt().Unix(), claims["exp"])
+	}
+
+	// The ClaimsMapper adds claims without replacing those set by the Server
+	server.ClaimsMapper = ClaimsMapperFunc(func(ctx context.Context, req ClaimsRequest) (map[string]interface{}, error) {
+		if req.Subject != "testclientid" || req.Client == nil {
+			t.Errorf("Test failed, unexpected request %+v", req)
+		}
+		return map[string]interface{}{"tenant": "acme", "sub": "other"}, nil
+	})
+	resp, _ = issue("grant_type=client_credentials&resource=https%3A%2F%2Fpartner.example.com")
+	payload, err = base64.RawURLEncoding.DecodeString(strings.Split(resp["access_token"].(string), ".")[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims = nil
+	json.Unmarshal(payload, &claims)
+	if claims["tenant"] != "acme" || claims["sub"] != "testclientid" {
+		t.Errorf("Test failed, unexpected claims %v", claims)
+	}
+}
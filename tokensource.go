@@ -0,0 +1,66 @@
+package goauth
+
+import (
+	"strconv"
+	"sync"
+)
+
+// TokenSource generates the tokens assigned to grants, authorization codes and other records of the
+// session store.
+type TokenSource interface {
+	Token() (Secret, error)
+}
+
+// TokenSourceFunc is a function implementing the TokenSource interface.
+type TokenSourceFunc func() (Secret, error)
+
+// Token calls f().
+func (f TokenSourceFunc) Token() (Secret, error) {
+	return f()
+}
+
+// newTokenFrom generates a token using the source, or NewToken if the source is nil.
+func newTokenFrom(source TokenSource) (Secret, error) {
+	if source == nil {
+		return NewToken()
+	}
+	return source.Token()
+}
+
+// TestTokenSource is a TokenSource generating predictable tokens for use in tests, the Prefix followed by a
+// sequence number starting at 1. It is safe for concurrent use, and as each Server or SessionStore can use
+// its own TestTokenSource, tests using them can run in parallel.
+type TestTokenSource struct {
+	Prefix string
+	mtx    sync.Mutex
+	n      int
+}
+
+// NewTestTokenSource returns a TestTokenSource generating tokens with the prefix.
+func NewTestTokenSource(prefix string) *TestTokenSource {
+	return &TestTokenSource{Prefix: prefix}
+}
+
+// Token returns the next token in the sequence.
+func (t *TestTokenSource) Token() (Secret, error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.n++
+	return Secret(t.Prefix + strconv.Itoa(t.n)), nil
+}
+
+// WithDeterministicTokens sets the Server's TokenSource to a TestTokenSource with the prefix, so that tests
+// can predict the tokens issued without overriding NewToken. It returns the Server and must not be used in
+// production.
+func (s *Server) WithDeterministicTokens(prefix string) *Server {
+	s.TokenSource = NewTestTokenSource(prefix)
+	return s
+}
+
+// tokenSource returns the TokenSource of the session store, or the Server's TokenSource if it is not set.
+func (s *Server) tokenSource(sessionStore *SessionStore) TokenSource {
+	if sessionStore != nil && sessionStore.TokenSource != nil {
+		return sessionStore.TokenSource
+	}
+	return s.TokenSource
+}
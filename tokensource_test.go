@@ -0,0 +1,40 @@
+package goauth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestWithDeterministicTokens(t *testing.T) {
+	server := newTestHandler().WithDeterministicTokens("token-")
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	client := server.Authenticator.(*testAuthenticator).client
+	grant, err := server.NewGrant(client, "testusername", []string{"testscope"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if grant.AccessToken != "token-1" || grant.RefreshToken != "token-2" {
+		t.Errorf("Test failed, unexpected tokens %s %s", grant.AccessToken.RawString(), grant.RefreshToken.RawString())
+	}
+	r, err := http.NewRequest("GET", "/authorize", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authCode, err := server.sessionStore(r).NewAuthorizationCode("testclientid", "https://testuri.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authCode.Code != "token-3" {
+		t.Errorf("Test failed, expected code token-3 got %s", authCode.Code.RawString())
+	}
+
+	// The SessionStore's TokenSource takes precedence
+	server.SessionStore.TokenSource = NewTestTokenSource("store-")
+	authCode, err = server.sessionStore(r).NewAuthorizationCode("testclientid", "https://testuri.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authCode.Code != "store-1" {
+		t.Errorf("Test failed, expected code store-1 got %s", authCode.Code.RawString())
+	}
+}
@@ -0,0 +1,464 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// SpanAuthorize is the name of the span recorded for requests to the authorize endpoint.
+	SpanAuthorize = "goauth.authorize"
+	// SpanToken is the name of the span recorded for requests to the token endpoint.
+	SpanToken = "goauth.token"
+	// SpanIntrospect is the name of the span recorded for requests to the introspection endpoint.
+	SpanIntrospect = "goauth.introspect"
+	// SpanBackChannelAuthorize is the name of the span recorded for requests to the backchannel
+	// authentication endpoint.
+	SpanBackChannelAuthorize = "goauth.bc_authorize"
+	// SpanDeviceAuthorization is the name of the span recorded for requests to the device authorization
+	// endpoint.
+	SpanDeviceAuthorization = "goauth.device_authorization"
+	// SpanSecure is the name of the span recorded for requests authenticated by Secure.
+	SpanSecure = "goauth.secure"
+
+	// AttributeGrantType is the span attribute holding the requested grant_type.
+	AttributeGrantType = "oauth.grant_type"
+	// AttributeResponseType is the span attribute holding the requested response_type.
+	AttributeResponseType = "oauth.response_type"
+	// AttributeTokenTypeHint is the span attribute holding the token_type_hint of an introspection request.
+	AttributeTokenTypeHint = "oauth.token_type_hint"
+	// AttributeScope is the span attribute holding the requested scope of a backchannel or device
+	// authorization request.
+	AttributeScope = "oauth.scope"
+	// AttributeClientID is the span attribute holding the client_id of the request.
+	AttributeClientID = "oauth.client_id"
+	// AttributeOutcome is the span attribute holding the outcome of the request, either
+	// OutcomeSuccess or OutcomeError.
+	AttributeOutcome = "oauth.outcome"
+
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// Tracer starts spans for the flows handled by the Server. It mirrors the subset of the OpenTelemetry
+// trace.Tracer API used by the package so that an OpenTelemetry tracer can be plugged in with a small
+// adapter, without the package depending on it directly.
+type Tracer interface {
+	// Start creates a span as a child of any span in ctx and returns a context containing it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation.
+type Span interface {
+	// SetAttribute records a key value pair on the span.
+	SetAttribute(key, value string)
+	// RecordError records that the operation failed with err.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+// ContextAuthenticator may be implemented by an Authenticator that needs the context of the request
+// it is serving, for example to pass the current span to a database driver. WithContext is called
+// before each call to the Authenticator.
+type ContextAuthenticator interface {
+	WithContext(ctx context.Context) Authenticator
+}
+
+// ContextSessionStoreBackend may be implemented by a SessionStoreBackend that needs the context of the
+// request it is serving. WithContext is called before each call to the SessionStoreBackend.
+type ContextSessionStoreBackend interface {
+	WithContext(ctx context.Context) SessionStoreBackend
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// traced returns a handler that runs handler within a span named name. If key is not empty the value of
+// the request parameter param is recorded as the attribute key along with the client_id of the request.
+// The request ID and outcome are always recorded, an authorization response redirecting with an error
+// counts as an error.
+func (s *Server) traced(name, key, param string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Tracer == nil {
+			handler(w, r)
+			return
+		}
+		ctx, span := s.Tracer.Start(r.Context(), name)
+		defer span.End()
+		span.SetAttribute(AttributeRequestID, RequestIDFromContext(ctx))
+		r = r.WithContext(ctx)
+		rec := &statusRecorder{ResponseWriter: w}
+		handler(rec, r)
+		if key != "" {
+			span.SetAttribute(key, r.FormValue(param))
+			clientID, _, ok := r.BasicAuth()
+			if !ok {
+				clientID = r.FormValue(ParamClientID)
+			}
+			span.SetAttribute(AttributeClientID, clientID)
+		}
+		outcome := OutcomeSuccess
+		if rec.status >= http.StatusBadRequest || redirectsWithError(rec) {
+			outcome = OutcomeError
+		}
+		span.SetAttribute(AttributeOutcome, outcome)
+	}
+}
+
+// redirectsWithError returns true if the response redirects the user agent with an error parameter.
+func redirectsWithError(rec *statusRecorder) bool {
+	if rec.status != http.StatusFound {
+		return false
+	}
+	u, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		return false
+	}
+	// Errors are returned in the query by the code flow and in the fragment by the implicit flow
+	if u.Query().Get(ParamError) != "" {
+		return true
+	}
+	fragment, _ := url.ParseQuery(u.Fragment)
+	return fragment.Get(ParamError) != ""
+}
+
+// endSpan records err on the span, if any, and ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// authenticator returns the Server's Authenticator bound to the context of the request. If the Server has
+// a Tracer each call made through it is recorded as a child span of the request.
+func (s *Server) authenticator(r *http.Request) Authenticator {
+	a := tracedAuthenticator{r.Context(), s.Tracer, s.Authenticator}
+	if s.Tracer == nil {
+		return a.withContext(r.Context())
+	}
+	return a
+}
+
+// sessionStore returns the Server's SessionStore bound to the context of the request. If the Server has
+// a Tracer each call made to its backend is recorded as a child span of the request.
+func (s *Server) sessionStore(r *http.Request) *SessionStore {
+	return s.bindSessionStore(r, s.SessionStore)
+}
+
+// bindSessionStore binds the given SessionStore to the context of the request.
+func (s *Server) bindSessionStore(r *http.Request, sessionStore *SessionStore) *SessionStore {
+	b := tracedSessionStoreBackend{r.Context(), s.Tracer, sessionStore.SessionStoreBackend}
+	bound := NewSessionStore(b)
+	if s.Tracer == nil {
+		bound = NewSessionStore(b.withContext(r.Context()))
+	}
+	bound.TokenSource = s.tokenSource(sessionStore)
+	bound.TokenExpiry = s.tokenExpiry()
+	bound.AuthorizationCodeExpiry = s.authorizationCodeExpiry()
+	return bound
+}
+
+// tracedAuthenticator records calls to an Authenticator as spans.
+type tracedAuthenticator struct {
+	ctx    context.Context
+	tracer Tracer
+	a      Authenticator
+}
+
+func (t tracedAuthenticator) withContext(ctx context.Context) Authenticator {
+	if ca, ok := t.a.(ContextAuthenticator); ok {
+		return ca.WithContext(ctx)
+	}
+	return t.a
+}
+
+func (t tracedAuthenticator) start(name string) (Authenticator, Span) {
+	ctx, span := t.tracer.Start(t.ctx, name)
+	return t.withContext(ctx), span
+}
+
+func (t tracedAuthenticator) GetClient(clientID string) (Client, error) {
+	a, span := t.start("Authenticator.GetClient")
+	span.SetAttribute(AttributeClientID, clientID)
+	client, err := a.GetClient(clientID)
+	endSpan(span, err)
+	return client, err
+}
+
+func (t tracedAuthenticator) GetClientWithSecret(clientID string, clientSecret Secret) (Client, error) {
+	a, span := t.start("Authenticator.GetClientWithSecret")
+	span.SetAttribute(AttributeClientID, clientID)
+	client, err := a.GetClientWithSecret(clientID, clientSecret)
+	endSpan(span, err)
+	return client, err
+}
+
+func (t tracedAuthenticator) AuthorizeResourceOwner(username string, password Secret, scope []string) (bool, error) {
+	a, span := t.start("Authenticator.AuthorizeResourceOwner")
+	ok, err := a.AuthorizeResourceOwner(username, password, scope)
+	endSpan(span, err)
+	return ok, err
+}
+
+// AuthorizeResourceOwnerRequest calls the most specific method implemented by the Authenticator to
+// authorize the resource owner.
+func (t tracedAuthenticator) AuthorizeResourceOwnerRequest(ctx context.Context, req ResourceOwnerRequest) (bool, error) {
+	ctx, span := t.tracer.Start(ctx, "Authenticator.AuthorizeResourceOwner")
+	span.SetAttribute(AttributeClientID, req.ClientID)
+	ok, err := authorizeResourceOwner(ctx, t.withContext(ctx), req)
+	endSpan(span, err)
+	return ok, err
+}
+
+// tracedSessionStoreBackend records calls to a SessionStoreBackend as spans.
+type tracedSessionStoreBackend struct {
+	ctx     context.Context
+	tracer  Tracer
+	backend SessionStoreBackend
+}
+
+func (t tracedSessionStoreBackend) withContext(ctx context.Context) SessionStoreBackend {
+	if cb, ok := t.backend.(ContextSessionStoreBackend); ok {
+		return cb.WithContext(ctx)
+	}
+	return t.backend
+}
+
+func (t tracedSessionStoreBackend) start(name string) (SessionStoreBackend, Span) {
+	ctx, span := t.tracer.Start(t.ctx, name)
+	return t.withContext(ctx), span
+}
+
+func (t tracedSessionStoreBackend) PutGrant(grant Grant) error {
+	b, span := t.start("SessionStore.PutGrant")
+	err := b.PutGrant(grant)
+	endSpan(span, err)
+	return err
+}
+
+// InsertGrant stores the grant atomically if the backend implements GrantInserter.
+func (t tracedSessionStoreBackend) InsertGrant(grant Grant) error {
+	b, span := t.start("SessionStore.InsertGrant")
+	err := NewSessionStore(b).insertGrant(grant)
+	endSpan(span, err)
+	return err
+}
+
+// RotateGrant rotates the grant atomically if the backend implements GrantRotator.
+func (t tracedSessionStoreBackend) RotateGrant(old, new Grant, expectedVersion int64) error {
+	b, span := t.start("SessionStore.RotateGrant")
+	err := NewSessionStore(b).rotateGrant(old, new, expectedVersion)
+	endSpan(span, err)
+	return err
+}
+
+// UpdateGrant updates the grant atomically if the backend implements GrantUpdater.
+func (t tracedSessionStoreBackend) UpdateGrant(grant Grant, expectedVersion int64) error {
+	b, span := t.start("SessionStore.UpdateGrant")
+	err := NewSessionStore(b).updateGrant(grant, expectedVersion)
+	endSpan(span, err)
+	return err
+}
+
+// GetGrants retrieves the grants in one request if the backend implements GrantBatchGetter.
+func (t tracedSessionStoreBackend) GetGrants(accessTokens []Secret) (map[Secret]Grant, error) {
+	b, span := t.start("SessionStore.GetGrants")
+	var grants map[Secret]Grant
+	var err error
+	if getter, ok := b.(GrantBatchGetter); ok {
+		grants, err = getter.GetGrants(accessTokens)
+	} else {
+		grants = make(map[Secret]Grant, len(accessTokens))
+		for _, accessToken := range accessTokens {
+			grant, err := b.GetGrant(accessToken)
+			if err == nil {
+				grants[accessToken] = grant
+			}
+		}
+	}
+	endSpan(span, err)
+	return grants, err
+}
+
+// RevokeSubject revokes the records of the subject, enumerating them if the backend does not implement
+// SubjectRevoker.
+func (t tracedSessionStoreBackend) RevokeSubject(subject string, issuedBefore time.Time) (int, error) {
+	b, span := t.start("SessionStore.RevokeSubject")
+	n, err := NewSessionStore(b).RevokeSubject(subject, issuedBefore)
+	endSpan(span, err)
+	return n, err
+}
+
+func (t tracedSessionStoreBackend) GetGrant(accessToken Secret) (Grant, error) {
+	b, span := t.start("SessionStore.GetGrant")
+	grant, err := b.GetGrant(accessToken)
+	endSpan(span, err)
+	return grant, err
+}
+
+func (t tracedSessionStoreBackend) DeleteGrant(accessToken Secret) error {
+	b, span := t.start("SessionStore.DeleteGrant")
+	err := b.DeleteGrant(accessToken)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) RefreshGrant(refreshToken Secret) (Grant, error) {
+	b, span := t.start("SessionStore.RefreshGrant")
+	grant, err := b.RefreshGrant(refreshToken)
+	endSpan(span, err)
+	return grant, err
+}
+
+func (t tracedSessionStoreBackend) PutAuthorizationCode(authCode AuthorizationCode) error {
+	b, span := t.start("SessionStore.PutAuthorizationCode")
+	err := b.PutAuthorizationCode(authCode)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) GetAuthorizationCode(code Secret) (AuthorizationCode, error) {
+	b, span := t.start("SessionStore.GetAuthorizationCode")
+	authCode, err := b.GetAuthorizationCode(code)
+	endSpan(span, err)
+	return authCode, err
+}
+
+// ConsumeAuthorizationCode consumes the code atomically if the backend implements
+// AuthorizationCodeConsumer.
+func (t tracedSessionStoreBackend) ConsumeAuthorizationCode(code Secret) (AuthorizationCode, error) {
+	b, span := t.start("SessionStore.ConsumeAuthorizationCode")
+	authCode, err := NewSessionStore(b).ConsumeAuthorizationCode(code)
+	endSpan(span, err)
+	return authCode, err
+}
+
+func (t tracedSessionStoreBackend) DeleteAuthorizationCode(code Secret) error {
+	b, span := t.start("SessionStore.DeleteAuthorizationCode")
+	err := b.DeleteAuthorizationCode(code)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) PutBackChannelRequest(req BackChannelRequest) error {
+	b, span := t.start("SessionStore.PutBackChannelRequest")
+	err := NewSessionStore(b).PutBackChannelRequest(req)
+	endSpan(span, err)
+	return err
+}
+
+// UpdateBackChannelRequest updates the request atomically if the backend implements
+// BackChannelRequestUpdater.
+func (t tracedSessionStoreBackend) UpdateBackChannelRequest(req BackChannelRequest, expectedStatus BackChannelStatus) error {
+	b, span := t.start("SessionStore.UpdateBackChannelRequest")
+	err := NewSessionStore(b).UpdateBackChannelRequest(req, expectedStatus)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) GetBackChannelRequest(authReqID Secret) (BackChannelRequest, error) {
+	b, span := t.start("SessionStore.GetBackChannelRequest")
+	req, err := NewSessionStore(b).GetBackChannelRequest(authReqID)
+	endSpan(span, err)
+	return req, err
+}
+
+func (t tracedSessionStoreBackend) DeleteBackChannelRequest(authReqID Secret) error {
+	b, span := t.start("SessionStore.DeleteBackChannelRequest")
+	err := NewSessionStore(b).DeleteBackChannelRequest(authReqID)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) PutDeviceAuthorization(d DeviceAuthorization) error {
+	b, span := t.start("SessionStore.PutDeviceAuthorization")
+	err := NewSessionStore(b).PutDeviceAuthorization(d)
+	endSpan(span, err)
+	return err
+}
+
+// UpdateDeviceAuthorization updates the request atomically if the backend implements
+// DeviceAuthorizationUpdater.
+func (t tracedSessionStoreBackend) UpdateDeviceAuthorization(d DeviceAuthorization, expectedStatus DeviceStatus) error {
+	b, span := t.start("SessionStore.UpdateDeviceAuthorization")
+	err := NewSessionStore(b).UpdateDeviceAuthorization(d, expectedStatus)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) GetDeviceAuthorization(deviceCode Secret) (DeviceAuthorization, error) {
+	b, span := t.start("SessionStore.GetDeviceAuthorization")
+	d, err := NewSessionStore(b).GetDeviceAuthorization(deviceCode)
+	endSpan(span, err)
+	return d, err
+}
+
+func (t tracedSessionStoreBackend) GetDeviceAuthorizationByUserCode(userCode string) (DeviceAuthorization, error) {
+	b, span := t.start("SessionStore.GetDeviceAuthorizationByUserCode")
+	d, err := NewSessionStore(b).GetDeviceAuthorizationByUserCode(userCode)
+	endSpan(span, err)
+	return d, err
+}
+
+func (t tracedSessionStoreBackend) DeleteDeviceAuthorization(deviceCode Secret) error {
+	b, span := t.start("SessionStore.DeleteDeviceAuthorization")
+	err := NewSessionStore(b).DeleteDeviceAuthorization(deviceCode)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) PutVerificationCode(v VerificationCode) error {
+	b, span := t.start("SessionStore.PutVerificationCode")
+	err := NewSessionStore(b).PutVerificationCode(v)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) GetVerificationCode(code Secret) (VerificationCode, error) {
+	b, span := t.start("SessionStore.GetVerificationCode")
+	v, err := NewSessionStore(b).GetVerificationCode(code)
+	endSpan(span, err)
+	return v, err
+}
+
+func (t tracedSessionStoreBackend) DeleteVerificationCode(code Secret) error {
+	b, span := t.start("SessionStore.DeleteVerificationCode")
+	err := NewSessionStore(b).DeleteVerificationCode(code)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) PutIdempotentResponse(resp IdempotentResponse) error {
+	b, span := t.start("SessionStore.PutIdempotentResponse")
+	err := NewSessionStore(b).PutIdempotentResponse(resp)
+	endSpan(span, err)
+	return err
+}
+
+func (t tracedSessionStoreBackend) GetIdempotentResponse(key string) (IdempotentResponse, error) {
+	b, span := t.start("SessionStore.GetIdempotentResponse")
+	resp, err := NewSessionStore(b).GetIdempotentResponse(key)
+	endSpan(span, err)
+	return resp, err
+}
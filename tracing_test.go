@@ -0,0 +1,164 @@
+package goauth
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testSpan implements the Span interface and is intended for use only in testing.
+type testSpan struct {
+	name       string
+	parent     *testSpan
+	attributes map[string]string
+	err        error
+	ended      bool
+}
+
+func (t *testSpan) SetAttribute(key, value string) { t.attributes[key] = value }
+func (t *testSpan) RecordError(err error)          { t.err = err }
+func (t *testSpan) End()                           { t.ended = true }
+
+// testTracer implements the Tracer interface and is intended for use only in testing.
+type testTracer struct {
+	mtx   sync.Mutex
+	spans []*testSpan
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{name: name, parent: parent, attributes: make(map[string]string)}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func TestTracing(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	tracer := &testTracer{}
+	server.Tracer = tracer
+
+	r := httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials&scope=testscope"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "testclientsecret")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatalf("Test failed, status %v", w.Code)
+	}
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("Test failed, expected 3 spans got %d", len(tracer.spans))
+	}
+	root := tracer.spans[0]
+	if root.name != SpanToken || !root.ended {
+		t.Errorf("Test failed, unexpected root span %+v", root)
+	}
+	expected := map[string]string{
+		AttributeGrantType: "client_credentials",
+		AttributeClientID:  "testclientid",
+		AttributeOutcome:   OutcomeSuccess,
+	}
+	for k, v := range expected {
+		if root.attributes[k] != v {
+			t.Errorf("Test failed, expected attribute %s to be %s got %s", k, v, root.attributes[k])
+		}
+	}
+	for i, name := range []string{"Authenticator.GetClientWithSecret", "SessionStore.InsertGrant"} {
+		span := tracer.spans[i+1]
+		if span.name != name || span.parent != root || !span.ended {
+			t.Errorf("Test failed, unexpected child span %+v", span)
+		}
+	}
+
+	// Failed requests are recorded as errors
+	tracer.spans = nil
+	r = httptest.NewRequest("POST", TokenEndpoint, strings.NewReader("grant_type=client_credentials"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("testclientid", "wrongsecret")
+	server.ServeHTTP(httptest.NewRecorder(), r)
+	if tracer.spans[0].attributes[AttributeOutcome] != OutcomeError {
+		t.Errorf("Test failed, expected an error outcome")
+	}
+	if tracer.spans[1].err == nil {
+		t.Errorf("Test failed, expected the client lookup to record an error")
+	}
+}
+
+func TestTracingIntrospection(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	tracer := &testTracer{}
+	server.Tracer = tracer
+
+	introspect := func(secret string) *testSpan {
+		tracer.spans = nil
+		r := httptest.NewRequest("POST", IntrospectionEndpoint, strings.NewReader("token=unknown&token_type_hint=access_token"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", secret)
+		server.ServeHTTP(httptest.NewRecorder(), r)
+		if len(tracer.spans) == 0 {
+			t.Fatal("Test failed, expected a span")
+		}
+		return tracer.spans[0]
+	}
+
+	root := introspect("testclientsecret")
+	expected := map[string]string{
+		AttributeTokenTypeHint: "access_token",
+		AttributeClientID:      "testclientid",
+		AttributeOutcome:       OutcomeSuccess,
+	}
+	if root.name != SpanIntrospect || !root.ended {
+		t.Errorf("Test failed, unexpected root span %+v", root)
+	}
+	for k, v := range expected {
+		if root.attributes[k] != v {
+			t.Errorf("Test failed, expected attribute %s to be %s got %s", k, v, root.attributes[k])
+		}
+	}
+	// Requests from unauthenticated clients are recorded as errors
+	if root = introspect("wrongsecret"); root.attributes[AttributeOutcome] != OutcomeError {
+		t.Errorf("Test failed, expected an error outcome got %+v", root)
+	}
+}
+
+func TestTracingDeviceAndBackChannel(t *testing.T) {
+	server := newTestHandler()
+	server.SessionStore = NewSessionStore(NewMemSessionStoreBackend())
+	tracer := &testTracer{}
+	server.Tracer = tracer
+
+	request := func(endpoint string) *testSpan {
+		tracer.spans = nil
+		r := httptest.NewRequest("POST", endpoint, strings.NewReader("scope=testscope&login_hint=testusername"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth("testclientid", "testclientsecret")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if len(tracer.spans) == 0 {
+			t.Fatalf("Test failed, expected a span for %s", endpoint)
+		}
+		if id := tracer.spans[0].attributes[AttributeRequestID]; id == "" || id != w.Header().Get(RequestIDHeader) {
+			t.Errorf("Test failed, expected the request ID %q got %q", w.Header().Get(RequestIDHeader), id)
+		}
+		return tracer.spans[0]
+	}
+
+	root := request(DeviceAuthorizationEndpoint)
+	if root.name != SpanDeviceAuthorization || !root.ended || root.attributes[AttributeScope] != "testscope" ||
+		root.attributes[AttributeClientID] != "testclientid" || root.attributes[AttributeOutcome] != OutcomeSuccess {
+		t.Errorf("Test failed, unexpected span %+v", root)
+	}
+	// Backchannel authentication is not configured, so the request fails
+	root = request(BackChannelAuthorizeEndpoint)
+	if root.name != SpanBackChannelAuthorize || root.attributes[AttributeClientID] != "testclientid" || root.attributes[AttributeOutcome] != OutcomeError {
+		t.Errorf("Test failed, unexpected span %+v", root)
+	}
+}
@@ -13,10 +13,28 @@ const (
 	ParamState            = "state"
 	ParamError            = "error"
 	ParamErrorDescription = "error_description"
+	ParamErrorURI         = "error_uri"
 	ParamCode             = "code"
 	ParamAccessToken      = "access_token"
 	ParamExpiresIn        = "expires_in"
 	ParamTokenType        = "token_type"
+	ParamRefreshToken     = "refresh_token"
+
+	ParamLoginHint               = "login_hint"
+	ParamBindingMessage          = "binding_message"
+	ParamAuthReqID               = "auth_req_id"
+	ParamClientNotificationToken = "client_notification_token"
+	ParamRequestedExpiry         = "requested_expiry"
+	ParamPrompt                  = "prompt"
+	ParamMaxAge                  = "max_age"
+	ParamIDTokenHint             = "id_token_hint"
+	ParamNonce                   = "nonce"
+	ParamDeviceCode              = "device_code"
+	ParamUserCode                = "user_code"
+	ParamVerificationURI         = "verification_uri"
+	ParamVerificationURIComplete = "verification_uri_complete"
+	// ParamIssuer identifies the Server in authorization responses as per RFC 9207.
+	ParamIssuer = "iss"
 )
 
 type ResponseType string
@@ -39,6 +57,11 @@ const (
 	GrantTypeClientCredentials = "client_credentials"
 	// GrantTypeRefreshToken is the grant type used for refresh token requests.
 	GrantTypeRefreshToken = "refresh_token"
+	// GrantTypeCIBA is the grant type used to poll for the result of a Client Initiated Backchannel
+	// Authentication request.
+	GrantTypeCIBA = "urn:openid:params:grant-type:ciba"
+	// GrantTypeDeviceCode is the grant type used to poll for the result of a Device Authorization Grant.
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
 )
 
 // Secret is a string which is masked when serialized.
@@ -68,4 +91,7 @@ const (
 	StrategyClientCredentials                Strategy = "client_credentials"
 	StrategyResourceOwnerPasswordCredentials Strategy = "resource_owner_password_credentials"
 	StrategyImplicit                         Strategy = "implicit"
+	StrategyCIBA                             Strategy = "ciba"
+	StrategyDeviceCode                       Strategy = "device_code"
+	StrategyRefreshToken                     Strategy = "refresh_token"
 )
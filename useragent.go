@@ -0,0 +1,86 @@
+package goauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// EmbeddedBrowserPolicy defines how the authorization endpoint treats requests made from
+// embedded browsers (webviews) rather than the system browser.
+type EmbeddedBrowserPolicy int
+
+const (
+	// EmbeddedBrowserAllow performs no detection of embedded browsers.
+	EmbeddedBrowserAllow EmbeddedBrowserPolicy = iota
+	// EmbeddedBrowserWarn allows the request to continue but marks it so that the authorization UI
+	// can warn the resource owner. See IsEmbeddedBrowserRequest.
+	EmbeddedBrowserWarn
+	// EmbeddedBrowserReject rejects the request with a disallowed_useragent error.
+	EmbeddedBrowserReject
+)
+
+// EmbeddedBrowserDetector returns true if the request was made from an embedded browser.
+type EmbeddedBrowserDetector func(r *http.Request) bool
+
+var (
+	// DefaultEmbeddedBrowserDetector is the detector used when the Server does not define one.
+	DefaultEmbeddedBrowserDetector EmbeddedBrowserDetector = detectEmbeddedBrowser
+
+	// embeddedBrowserMarkers are user agent fragments identifying common in-app browsers and webviews.
+	embeddedBrowserMarkers = []string{
+		"; wv)",          // Android WebView
+		"FBAN/",          // Facebook for iOS
+		"FBAV/",          // Facebook for Android
+		"Instagram",      // Instagram
+		"Line/",          // LINE
+		"MicroMessenger", // WeChat
+		"Twitter",        // Twitter
+		"GSA/",           // Google Search App
+	}
+)
+
+// detectEmbeddedBrowser identifies embedded browsers from the request's user agent. iOS webviews are
+// identified by the absence of the Safari token which is present in all iOS system browsers.
+func detectEmbeddedBrowser(r *http.Request) bool {
+	ua := r.UserAgent()
+	for _, marker := range embeddedBrowserMarkers {
+		if strings.Contains(ua, marker) {
+			return true
+		}
+	}
+	isIOS := strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod")
+	if isIOS && strings.Contains(ua, "AppleWebKit") && !strings.Contains(ua, "Safari") {
+		return true
+	}
+	return false
+}
+
+type embeddedBrowserKey struct{}
+
+// IsEmbeddedBrowserRequest returns true if the request was identified as coming from an embedded browser
+// under the EmbeddedBrowserWarn policy. It can be used by an AuthorizationHandler to display a warning.
+func IsEmbeddedBrowserRequest(r *http.Request) bool {
+	embedded, _ := r.Context().Value(embeddedBrowserKey{}).(bool)
+	return embedded
+}
+
+// checkEmbeddedBrowser applies the server's EmbeddedBrowserPolicy to the request. It returns the request
+// that should be used to continue processing or false if the request has been rejected.
+func (s *Server) checkEmbeddedBrowser(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	if s.EmbeddedBrowserPolicy == EmbeddedBrowserAllow {
+		return r, true
+	}
+	detect := s.EmbeddedBrowserDetector
+	if detect == nil {
+		detect = DefaultEmbeddedBrowserDetector
+	}
+	if !detect(r) {
+		return r, true
+	}
+	if s.EmbeddedBrowserPolicy == EmbeddedBrowserReject {
+		s.ErrorHandler(w, ErrorDisallowedUserAgent.StatusCode, ErrorDisallowedUserAgent)
+		return r, false
+	}
+	return r.WithContext(context.WithValue(r.Context(), embeddedBrowserKey{}, true)), true
+}
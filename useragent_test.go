@@ -0,0 +1,55 @@
+package goauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDetectEmbeddedBrowser(t *testing.T) {
+	for ua, expected := range map[string]bool{
+		"Mozilla/5.0 (Linux; Android 10; SM-G973F Build/QP1A.190711.020; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/83.0.4103.106 Mobile Safari/537.36": true,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 13_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148":                                                    true,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 13_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/275.0.0.52.119;]":                  true,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 13_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.1.1 Mobile/15E148 Safari/604.1":                        false,
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/83.0.4103.116 Safari/537.36":                                                        false,
+	} {
+		r, err := http.NewRequest("GET", "/authorize", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("User-Agent", ua)
+		if detectEmbeddedBrowser(r) != expected {
+			t.Errorf("Test failed, expected %v for %s", expected, ua)
+		}
+	}
+}
+
+func TestEmbeddedBrowserPolicy(t *testing.T) {
+	server := newTestHandler()
+	server.EmbeddedBrowserDetector = func(r *http.Request) bool {
+		return true
+	}
+
+	server.EmbeddedBrowserPolicy = EmbeddedBrowserReject
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/authorize?response_type=code&client_id=testclientid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ServeHTTP(w, r)
+	if w.Code != 403 {
+		t.Errorf("Test failed, status %v", w.Code)
+	}
+
+	server.EmbeddedBrowserPolicy = EmbeddedBrowserWarn
+	var warned bool
+	server.authorizeHandlers.AddHandler(ResponseTypeCode, func(w http.ResponseWriter, r *http.Request) {
+		warned = IsEmbeddedBrowserRequest(r)
+	})
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if !warned {
+		t.Error("Test failed, expected the request to be marked as an embedded browser")
+	}
+}
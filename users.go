@@ -0,0 +1,217 @@
+package goauth
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUserNotFound is returned by UserStore implementations when no account matches.
+	ErrUserNotFound = errors.New("goauth: user not found")
+	// ErrUserExists is returned by CreateUser when the username or email address is already in use.
+	ErrUserExists = errors.New("goauth: user already exists")
+)
+
+// User is a resource owner account managed by a UserStore.
+type User struct {
+	Username      string
+	Email         string
+	EmailVerified bool
+	CreatedAt     time.Time
+}
+
+// UserStore manages the accounts of resource owners for deployments using the Server as their identity
+// provider. It is required by the password reset and email verification flows and can be used to
+// authorize resource owners with UserStoreAuthenticator.
+type UserStore interface {
+	// CreateUser creates an account with the given password. It returns ErrUserExists if the username or
+	// email address is already in use.
+	CreateUser(user User, password Secret) error
+	// VerifyPassword returns true if the password is that of the account. It returns false if the account
+	// does not exist.
+	VerifyPassword(username string, password Secret) (bool, error)
+	// ListUsers returns up to limit accounts ordered by username, skipping the first offset accounts.
+	ListUsers(offset, limit int) ([]User, error)
+	// FindUser returns the username and email address of the account identified by the given username or
+	// email address. It returns an error if no account matches.
+	FindUser(identifier string) (username, email string, err error)
+	// SetPassword replaces the password of the account.
+	SetPassword(username string, password Secret) error
+	// SetEmailVerified marks the email address of the account as verified, provided that it is still the
+	// given email address.
+	SetEmailVerified(username, email string) error
+}
+
+// UserStoreAuthenticator implements the AuthorizeResourceOwner method of the Authenticator interface by
+// verifying the resource owner's password against a UserStore. It is intended to be embedded in an
+// Authenticator implementation.
+type UserStoreAuthenticator struct {
+	UserStore UserStore
+}
+
+// AuthorizeResourceOwner checks the resource owner's password using the UserStore.
+func (u UserStoreAuthenticator) AuthorizeResourceOwner(username string, password Secret, scope []string) (bool, error) {
+	ok, err := u.UserStore.VerifyPassword(username, password)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, ErrorAccessDenied
+	}
+	return true, nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// checkDummyPassword performs the same work as verifying a password so that failed attempts for unknown
+// accounts take as long as those for existing accounts.
+func checkDummyPassword(hasher PasswordHasher, password Secret) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = hasher.Hash("dummy password")
+	})
+	CheckPasswordHash(dummyHash, password)
+}
+
+// memUser is an account stored by MemUserStore.
+type memUser struct {
+	User
+	PasswordHash string
+}
+
+// MemUserStore is an in-memory UserStore. Like MemSessionStoreBackend it is not intended for production use.
+type MemUserStore struct {
+	// Hasher overrides DefaultPasswordHasher if set.
+	Hasher PasswordHasher
+	mtx    sync.Mutex
+	users  map[string]*memUser
+}
+
+// NewMemUserStore returns an empty MemUserStore.
+func NewMemUserStore() *MemUserStore {
+	return &MemUserStore{users: make(map[string]*memUser)}
+}
+
+// hasher returns the PasswordHasher of the store.
+func (m *MemUserStore) hasher() PasswordHasher {
+	if m.Hasher != nil {
+		return m.Hasher
+	}
+	return DefaultPasswordHasher
+}
+
+// find returns the account with the given username or email address. It must be called with the mutex held.
+func (m *MemUserStore) find(identifier string) (*memUser, bool) {
+	if u, ok := m.users[identifier]; ok {
+		return u, true
+	}
+	for _, u := range m.users {
+		if u.Email != "" && strings.EqualFold(u.Email, identifier) {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// CreateUser creates an account with the given password.
+func (m *MemUserStore) CreateUser(user User, password Secret) error {
+	hash, err := m.hasher().Hash(password)
+	if err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.find(user.Username); ok {
+		return ErrUserExists
+	}
+	if _, ok := m.find(user.Email); ok && user.Email != "" {
+		return ErrUserExists
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = timeNow()
+	}
+	m.users[user.Username] = &memUser{user, hash}
+	return nil
+}
+
+// VerifyPassword returns true if the password is that of the account.
+func (m *MemUserStore) VerifyPassword(username string, password Secret) (bool, error) {
+	m.mtx.Lock()
+	u, ok := m.users[username]
+	var hash string
+	if ok {
+		hash = u.PasswordHash
+	}
+	m.mtx.Unlock()
+	if !ok {
+		checkDummyPassword(m.hasher(), password)
+		return false, nil
+	}
+	return CheckPasswordHash(hash, password)
+}
+
+// ListUsers returns up to limit accounts ordered by username, skipping the first offset accounts.
+func (m *MemUserStore) ListUsers(offset, limit int) ([]User, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	users := make([]User, 0, len(m.users))
+	for _, u := range m.users {
+		users = append(users, u.User)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	if offset >= len(users) {
+		return nil, nil
+	}
+	users = users[offset:]
+	if limit < len(users) {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+// FindUser returns the username and email address of the account identified by the given username or
+// email address.
+func (m *MemUserStore) FindUser(identifier string) (string, string, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	u, ok := m.find(identifier)
+	if !ok {
+		return "", "", ErrUserNotFound
+	}
+	return u.Username, u.Email, nil
+}
+
+// SetPassword replaces the password of the account.
+func (m *MemUserStore) SetPassword(username string, password Secret) error {
+	hash, err := m.hasher().Hash(password)
+	if err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	u, ok := m.users[username]
+	if !ok {
+		return ErrUserNotFound
+	}
+	u.PasswordHash = hash
+	return nil
+}
+
+// SetEmailVerified marks the email address of the account as verified.
+func (m *MemUserStore) SetEmailVerified(username, email string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	u, ok := m.users[username]
+	if !ok || u.Email != email {
+		return ErrUserNotFound
+	}
+	u.EmailVerified = true
+	return nil
+}
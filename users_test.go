@@ -0,0 +1,104 @@
+package goauth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	for _, hasher := range []PasswordHasher{
+		BcryptHasher{Cost: 4},
+		Argon2Hasher{Time: 1, Memory: 1024, Threads: 1},
+	} {
+		hash, err := hasher.Hash("testpassword")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ok, err := CheckPasswordHash(hash, "testpassword")
+		if err != nil || !ok {
+			t.Errorf("Test failed, expected %s to match: %v", hash, err)
+		}
+		ok, err = CheckPasswordHash(hash, "wrongpassword")
+		if err != nil || ok {
+			t.Errorf("Test failed, expected %s not to match: %v", hash, err)
+		}
+	}
+	if _, err := CheckPasswordHash("plaintext", "plaintext"); err == nil {
+		t.Error("Test failed, expected an error for an unsupported hash")
+	}
+}
+
+func TestMemUserStore(t *testing.T) {
+	store := NewMemUserStore()
+	store.Hasher = BcryptHasher{Cost: 4}
+	testUserStoreImplementation(t, store)
+}
+
+// testUserStoreImplementation checks the behaviour expected of all UserStore implementations.
+func testUserStoreImplementation(t *testing.T, store UserStore) {
+	err := store.CreateUser(User{Username: "bob", Email: "bob@example.com"}, "bobpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.CreateUser(User{Username: "alice"}, "alicepassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.CreateUser(User{Username: "carol", Email: "bob@example.com"}, "x") != ErrUserExists {
+		t.Error("Test failed, expected duplicate email addresses to be rejected")
+	}
+
+	authenticator := UserStoreAuthenticator{store}
+	if ok, err := authenticator.AuthorizeResourceOwner("bob", "bobpassword", nil); !ok || err != nil {
+		t.Errorf("Test failed, expected bob to be authorized: %v", err)
+	}
+	if ok, _ := authenticator.AuthorizeResourceOwner("bob", "alicepassword", nil); ok {
+		t.Error("Test failed, expected the wrong password to be rejected")
+	}
+	if ok, _ := authenticator.AuthorizeResourceOwner("dave", "bobpassword", nil); ok {
+		t.Error("Test failed, expected an unknown user to be rejected")
+	}
+
+	username, email, err := store.FindUser("BOB@example.com")
+	if err != nil || username != "bob" || email != "bob@example.com" {
+		t.Errorf("Test failed, expected to find bob by email got %s %s %v", username, email, err)
+	}
+	if _, _, err := store.FindUser("dave"); err != ErrUserNotFound {
+		t.Errorf("Test failed, expected ErrUserNotFound got %v", err)
+	}
+
+	err = store.SetPassword("bob", "newpassword")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := store.VerifyPassword("bob", "newpassword"); !ok {
+		t.Error("Test failed, expected the new password to be accepted")
+	}
+	if store.SetEmailVerified("bob", "other@example.com") == nil {
+		t.Error("Test failed, expected a stale email address not to be verified")
+	}
+	err = store.SetEmailVerified("bob", "bob@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	users, err := store.ListUsers(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, u := range users {
+		names = append(names, u.Username)
+		if u.Username == "bob" && !u.EmailVerified {
+			t.Error("Test failed, expected bob's email address to be verified")
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"alice", "bob"}) {
+		t.Errorf("Test failed, unexpected users %s", strings.Join(names, ","))
+	}
+	users, err = store.ListUsers(1, 10)
+	if err != nil || len(users) != 1 || users[0].Username != "bob" {
+		t.Errorf("Test failed, expected the offset to be applied got %v %v", users, err)
+	}
+}
@@ -0,0 +1,288 @@
+package goauth
+
+import (
+	"context"
+
+	v1 "github.com/scritchley/goauth"
+)
+
+// FromV1 adapts a version 1 Authenticator. Its clients are adapted using FromV1Client.
+func FromV1(a v1.Authenticator) Authenticator {
+	if t, ok := a.(*toV1Authenticator); ok {
+		return t.a
+	}
+	return fromV1Authenticator{a}
+}
+
+// fromV1Authenticator is a version 1 Authenticator adapted to Authenticator.
+type fromV1Authenticator struct {
+	a v1.Authenticator
+}
+
+// withContext returns the Authenticator bound to the context if it is a ContextAuthenticator.
+func (f fromV1Authenticator) withContext(ctx context.Context) v1.Authenticator {
+	if ca, ok := f.a.(v1.ContextAuthenticator); ok {
+		return ca.WithContext(ctx)
+	}
+	return f.a
+}
+
+func (f fromV1Authenticator) GetClient(ctx context.Context, req ClientRequest) (Client, error) {
+	var client v1.Client
+	var err error
+	if req.Authenticate {
+		client, err = f.withContext(ctx).GetClientWithSecret(req.ClientID, req.Secret)
+	} else {
+		client, err = f.withContext(ctx).GetClient(req.ClientID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return FromV1Client(client), nil
+}
+
+func (f fromV1Authenticator) AuthorizeResourceOwner(ctx context.Context, req ResourceOwnerRequest) (bool, error) {
+	a := f.withContext(ctx)
+	if ra, ok := a.(v1.ResourceOwnerAuthenticator); ok {
+		return ra.AuthorizeResourceOwnerRequest(ctx, v1.ResourceOwnerRequest{
+			Credentials: req.Credentials,
+			ClientID:    req.ClientID,
+			Client:      ToV1Client(ctx, req.Client),
+			RemoteAddr:  req.RemoteAddr,
+			Scope:       req.Scope,
+		})
+	}
+	if ca, ok := a.(v1.CredentialsAuthenticator); ok {
+		return ca.AuthorizeCredentials(req.Credentials, req.Scope)
+	}
+	return a.AuthorizeResourceOwner(req.Credentials.Username, req.Credentials.Password, req.Scope)
+}
+
+// FromV1Client adapts a version 1 Client. The capabilities of the client, such as TypedClient, are
+// available through the capability interfaces of this package.
+func FromV1Client(c v1.Client) Client {
+	if c == nil {
+		return nil
+	}
+	if t, ok := c.(*toV1Client); ok {
+		return t.c
+	}
+	return &fromV1Client{c}
+}
+
+// fromV1Client is a version 1 Client adapted to Client.
+type fromV1Client struct {
+	c v1.Client
+}
+
+func (f *fromV1Client) AllowStrategy(ctx context.Context, s v1.Strategy) (bool, error) {
+	return f.c.AllowStrategy(s), nil
+}
+
+func (f *fromV1Client) AllowRedirectURI(ctx context.Context, uri string) (bool, error) {
+	return f.c.AllowRedirectURI(uri), nil
+}
+
+func (f *fromV1Client) AuthorizeScope(ctx context.Context, req ScopeRequest) ([]string, error) {
+	return f.c.AuthorizeScope(req.Scope)
+}
+
+func (f *fromV1Client) AuthorizeResourceOwner(ctx context.Context, username string) (bool, error) {
+	return f.c.AuthorizeResourceOwner(username)
+}
+
+func (f *fromV1Client) CreateGrant(ctx context.Context, req GrantRequest) (v1.Grant, error) {
+	return f.c.CreateGrant(req.Scope)
+}
+
+func (f *fromV1Client) ClientType() v1.ClientType {
+	if typed, ok := f.c.(v1.TypedClient); ok {
+		return typed.ClientType()
+	}
+	return v1.ClientTypeConfidential
+}
+
+func (f *fromV1Client) Trusted() bool {
+	trusted, ok := f.c.(v1.TrustedClient)
+	return ok && trusted.Trusted()
+}
+
+func (f *fromV1Client) RefreshTokenPolicy() v1.RefreshTokenPolicy {
+	if c, ok := f.c.(v1.RefreshTokenPolicyClient); ok {
+		return c.RefreshTokenPolicy()
+	}
+	return v1.DefaultRefreshTokenPolicy
+}
+
+func (f *fromV1Client) DefaultScope() []string {
+	if c, ok := f.c.(v1.DefaultScopeClient); ok {
+		return c.DefaultScope()
+	}
+	return nil
+}
+
+func (f *fromV1Client) RequirePKCE() bool {
+	c, ok := f.c.(v1.PKCERequirer)
+	return ok && c.RequirePKCE()
+}
+
+func (f *fromV1Client) TokenPolicy() v1.TokenPolicy {
+	if c, ok := f.c.(v1.TokenPolicyProvider); ok {
+		return c.TokenPolicy()
+	}
+	return v1.TokenPolicy{}
+}
+
+func (f *fromV1Client) Metadata() v1.ClientMetadata {
+	if c, ok := f.c.(v1.MetadataProvider); ok {
+		return c.Metadata()
+	}
+	return v1.ClientMetadata{}
+}
+
+// ToV1 adapts an Authenticator for use by the Server. The Server binds it to the context of each request
+// it serves.
+func ToV1(a Authenticator) v1.Authenticator {
+	if f, ok := a.(fromV1Authenticator); ok {
+		return f.a
+	}
+	return &toV1Authenticator{context.Background(), a}
+}
+
+// toV1Authenticator is an Authenticator adapted to the version 1 Authenticator.
+type toV1Authenticator struct {
+	ctx context.Context
+	a   Authenticator
+}
+
+// WithContext satisfies the ContextAuthenticator interface.
+func (t *toV1Authenticator) WithContext(ctx context.Context) v1.Authenticator {
+	return &toV1Authenticator{ctx, t.a}
+}
+
+func (t *toV1Authenticator) GetClient(clientID string) (v1.Client, error) {
+	client, err := t.a.GetClient(t.ctx, ClientRequest{ClientID: clientID})
+	if err != nil {
+		return nil, err
+	}
+	return ToV1Client(t.ctx, client), nil
+}
+
+func (t *toV1Authenticator) GetClientWithSecret(clientID string, clientSecret v1.Secret) (v1.Client, error) {
+	client, err := t.a.GetClient(t.ctx, ClientRequest{ClientID: clientID, Authenticate: true, Secret: clientSecret})
+	if err != nil {
+		return nil, err
+	}
+	return ToV1Client(t.ctx, client), nil
+}
+
+func (t *toV1Authenticator) AuthorizeResourceOwner(username string, password v1.Secret, scope []string) (bool, error) {
+	return t.a.AuthorizeResourceOwner(t.ctx, ResourceOwnerRequest{
+		Credentials: v1.Credentials{Username: username, Password: password},
+		Scope:       scope,
+	})
+}
+
+// AuthorizeResourceOwnerRequest satisfies the ResourceOwnerAuthenticator interface.
+func (t *toV1Authenticator) AuthorizeResourceOwnerRequest(ctx context.Context, req v1.ResourceOwnerRequest) (bool, error) {
+	return t.a.AuthorizeResourceOwner(ctx, ResourceOwnerRequest{
+		Credentials: req.Credentials,
+		ClientID:    req.ClientID,
+		Client:      FromV1Client(req.Client),
+		RemoteAddr:  req.RemoteAddr,
+		Scope:       req.Scope,
+	})
+}
+
+// ToV1Client adapts a Client to the version 1 Client, bound to the context. The version 1 interface cannot
+// return errors from AllowStrategy and AllowRedirectURI, so an error denies the strategy or redirect URI.
+// The capability interfaces implemented by the client are exposed as their version 1 equivalents.
+func ToV1Client(ctx context.Context, c Client) v1.Client {
+	if c == nil {
+		return nil
+	}
+	if f, ok := c.(*fromV1Client); ok {
+		return f.c
+	}
+	return &toV1Client{ctx, c}
+}
+
+// toV1Client is a Client adapted to the version 1 Client.
+type toV1Client struct {
+	ctx context.Context
+	c   Client
+}
+
+func (t *toV1Client) AllowStrategy(s v1.Strategy) bool {
+	allowed, err := t.c.AllowStrategy(t.ctx, s)
+	return err == nil && allowed
+}
+
+func (t *toV1Client) AllowRedirectURI(uri string) bool {
+	allowed, err := t.c.AllowRedirectURI(t.ctx, uri)
+	return err == nil && allowed
+}
+
+func (t *toV1Client) AuthorizeScope(scope []string) ([]string, error) {
+	return t.c.AuthorizeScope(t.ctx, ScopeRequest{Scope: scope})
+}
+
+func (t *toV1Client) AuthorizeResourceOwner(username string) (bool, error) {
+	return t.c.AuthorizeResourceOwner(t.ctx, username)
+}
+
+func (t *toV1Client) CreateGrant(scope []string) (v1.Grant, error) {
+	return t.c.CreateGrant(t.ctx, GrantRequest{Scope: scope})
+}
+
+// ClientType satisfies the version 1 TypedClient interface.
+func (t *toV1Client) ClientType() v1.ClientType {
+	if typed, ok := t.c.(TypedClient); ok {
+		return typed.ClientType()
+	}
+	return v1.ClientTypeConfidential
+}
+
+// Trusted satisfies the version 1 TrustedClient interface.
+func (t *toV1Client) Trusted() bool {
+	trusted, ok := t.c.(TrustedClient)
+	return ok && trusted.Trusted()
+}
+
+// RefreshTokenPolicy satisfies the version 1 RefreshTokenPolicyClient interface.
+func (t *toV1Client) RefreshTokenPolicy() v1.RefreshTokenPolicy {
+	if c, ok := t.c.(RefreshTokenPolicyClient); ok {
+		return c.RefreshTokenPolicy()
+	}
+	return v1.DefaultRefreshTokenPolicy
+}
+
+// DefaultScope satisfies the version 1 DefaultScopeClient interface.
+func (t *toV1Client) DefaultScope() []string {
+	if c, ok := t.c.(DefaultScopeClient); ok {
+		return c.DefaultScope()
+	}
+	return nil
+}
+
+// RequirePKCE satisfies the version 1 PKCERequirer interface.
+func (t *toV1Client) RequirePKCE() bool {
+	c, ok := t.c.(PKCERequirer)
+	return ok && c.RequirePKCE()
+}
+
+// TokenPolicy satisfies the version 1 TokenPolicyProvider interface.
+func (t *toV1Client) TokenPolicy() v1.TokenPolicy {
+	if c, ok := t.c.(TokenPolicyProvider); ok {
+		return c.TokenPolicy()
+	}
+	return v1.TokenPolicy{}
+}
+
+// Metadata satisfies the version 1 MetadataProvider interface.
+func (t *toV1Client) Metadata() v1.ClientMetadata {
+	if c, ok := t.c.(MetadataProvider); ok {
+		return c.Metadata()
+	}
+	return v1.ClientMetadata{}
+}
@@ -0,0 +1,126 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "github.com/scritchley/goauth"
+)
+
+type testKey struct{}
+
+// testClient implements Client and TypedClient, recording the context of each call.
+type testClient struct {
+	clientType v1.ClientType
+	ctx        context.Context
+}
+
+func (t *testClient) AllowStrategy(ctx context.Context, s v1.Strategy) (bool, error) {
+	t.ctx = ctx
+	return s == v1.StrategyClientCredentials, nil
+}
+
+func (t *testClient) AllowRedirectURI(ctx context.Context, uri string) (bool, error) {
+	return false, errors.New("lookup failed")
+}
+
+func (t *testClient) AuthorizeScope(ctx context.Context, req ScopeRequest) ([]string, error) {
+	return req.Scope, nil
+}
+
+func (t *testClient) AuthorizeResourceOwner(ctx context.Context, username string) (bool, error) {
+	return false, nil
+}
+
+func (t *testClient) CreateGrant(ctx context.Context, req GrantRequest) (v1.Grant, error) {
+	return v1.Grant{
+		AccessToken: "access",
+		TokenType:   v1.TokenTypeBearer,
+		ExpiresIn:   time.Hour,
+		Scope:       req.Scope,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+func (t *testClient) ClientType() v1.ClientType {
+	return t.clientType
+}
+
+// testAuthenticator implements Authenticator with a single client.
+type testAuthenticator struct {
+	client *testClient
+	req    ClientRequest
+}
+
+func (t *testAuthenticator) GetClient(ctx context.Context, req ClientRequest) (Client, error) {
+	t.req = req
+	if req.ClientID != "client" || (req.Authenticate && req.Secret != "secret") {
+		return nil, v1.ErrorUnauthorizedClient
+	}
+	return t.client, nil
+}
+
+func (t *testAuthenticator) AuthorizeResourceOwner(ctx context.Context, req ResourceOwnerRequest) (bool, error) {
+	return false, nil
+}
+
+func TestNew(t *testing.T) {
+	auth := &testAuthenticator{client: &testClient{}}
+	server := New(auth)
+	server.SessionStore = v1.NewSessionStore(v1.NewMemSessionStoreBackend())
+
+	r := httptest.NewRequest("POST", v1.TokenEndpoint, strings.NewReader("grant_type=client_credentials&scope=read"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("client", "secret")
+	r = r.WithContext(context.WithValue(r.Context(), testKey{}, "value"))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	resp := make(map[string]interface{})
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp["scope"] != "read" {
+		t.Fatalf("Test failed, got %d %v", w.Code, resp)
+	}
+	if !auth.req.Authenticate || auth.req.Secret != "secret" {
+		t.Errorf("Test failed, expected an authenticated client request got %+v", auth.req)
+	}
+	if auth.client.ctx == nil || auth.client.ctx.Value(testKey{}) != "value" {
+		t.Error("Test failed, expected the client to receive the request context")
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	ctx := context.Background()
+	client := &testClient{clientType: v1.ClientTypePublic}
+	auth := &testAuthenticator{client: client}
+
+	// Adapting in both directions returns the original implementation
+	if FromV1(ToV1(auth)) != Authenticator(auth) {
+		t.Error("Test failed, expected the original authenticator")
+	}
+	if FromV1Client(ToV1Client(ctx, client)) != Client(client) {
+		t.Error("Test failed, expected the original client")
+	}
+
+	// Capabilities are exposed as their version 1 equivalents and errors deny access
+	adapted := ToV1Client(ctx, client)
+	if typed, ok := adapted.(v1.TypedClient); !ok || typed.ClientType() != v1.ClientTypePublic {
+		t.Error("Test failed, expected a public client")
+	}
+	if adapted.AllowRedirectURI("https://example.com") {
+		t.Error("Test failed, expected the redirect URI to be denied")
+	}
+
+	// Version 1 implementations are adapted through the version 2 interfaces
+	v1Auth := ToV1(auth)
+	adaptedAuth := fromV1Authenticator{v1Auth}
+	c, err := adaptedAuth.GetClient(ctx, ClientRequest{ClientID: "client", Authenticate: true, Secret: "wrong"})
+	if err == nil {
+		t.Errorf("Test failed, expected an error got %v", c)
+	}
+}
@@ -0,0 +1,7 @@
+module github.com/scritchley/goauth/v2
+
+go 1.16
+
+require github.com/scritchley/goauth v0.0.0-00010101000000-000000000000
+
+replace github.com/scritchley/goauth => ../
@@ -0,0 +1,119 @@
+// Package goauth is version 2 of the goauth handler contract. Its Client and Authenticator interfaces
+// receive the request context and take option structs, so that fields can be added to requests without
+// breaking existing implementations, while optional behaviour is declared by implementing capability
+// interfaces. The Server itself is shared with version 1, and implementations of either version can be
+// adapted to the other using FromV1 and ToV1.
+package goauth
+
+import (
+	"context"
+
+	v1 "github.com/scritchley/goauth"
+)
+
+// Client is a client registered with the authorization server.
+type Client interface {
+	// AllowStrategy returns true if the client may authenticate using the Strategy.
+	AllowStrategy(ctx context.Context, s v1.Strategy) (bool, error)
+	// AllowRedirectURI returns true if the client may use the redirect URI.
+	AllowRedirectURI(ctx context.Context, uri string) (bool, error)
+	// AuthorizeScope returns the scope of the ScopeRequest approved for the client, which may be all,
+	// part or none of the requested scope, or an error if the scope is invalid.
+	AuthorizeScope(ctx context.Context, req ScopeRequest) ([]string, error)
+	// AuthorizeResourceOwner returns true if the client may act on behalf of the resource owner.
+	AuthorizeResourceOwner(ctx context.Context, username string) (bool, error)
+	// CreateGrant creates a new grant for the GrantRequest.
+	//
+	// Deprecated: Grants are created by the Server and CreateGrant is no longer called. Use the Server's
+	// GrantDecorator to customise them.
+	CreateGrant(ctx context.Context, req GrantRequest) (v1.Grant, error)
+}
+
+// ScopeRequest is a request to authorize the scope of a Client.
+type ScopeRequest struct {
+	// Scope is the requested scope.
+	Scope []string
+}
+
+// GrantRequest is a request to create a grant for a Client.
+type GrantRequest struct {
+	// Scope is the approved scope of the grant.
+	Scope []string
+}
+
+// Authenticator looks up clients and authenticates resource owners.
+type Authenticator interface {
+	// GetClient returns the Client of the ClientRequest. It returns an error if the client is not found or,
+	// if the request is authenticated, its secret is incorrect.
+	GetClient(ctx context.Context, req ClientRequest) (Client, error)
+	// AuthorizeResourceOwner checks the credentials of the resource owner and the requested scope.
+	AuthorizeResourceOwner(ctx context.Context, req ResourceOwnerRequest) (bool, error)
+}
+
+// ClientRequest is a request to look up a Client.
+type ClientRequest struct {
+	// ClientID identifies the client.
+	ClientID string
+	// Authenticate is true if the client must be authenticated using the Secret, such as a confidential
+	// client at the token endpoint.
+	Authenticate bool
+	Secret       v1.Secret
+}
+
+// ResourceOwnerRequest is a request to authenticate a resource owner using their credentials.
+type ResourceOwnerRequest struct {
+	// Credentials are those submitted by the resource owner.
+	Credentials v1.Credentials
+	// ClientID and Client identify the client making the request.
+	ClientID string
+	Client   Client
+	// RemoteAddr is the network address of the user agent.
+	RemoteAddr string
+	// Scope is the scope approved for the client.
+	Scope []string
+}
+
+// TypedClient is implemented by a Client that declares its ClientType. Clients are otherwise treated as
+// confidential.
+type TypedClient interface {
+	ClientType() v1.ClientType
+}
+
+// TrustedClient is implemented by a Client that may be trusted not to require the consent of the resource
+// owner.
+type TrustedClient interface {
+	Trusted() bool
+}
+
+// RefreshTokenPolicyClient is implemented by a Client that defines its own RefreshTokenPolicy. Clients are
+// otherwise subject to DefaultRefreshTokenPolicy.
+type RefreshTokenPolicyClient interface {
+	RefreshTokenPolicy() v1.RefreshTokenPolicy
+}
+
+// DefaultScopeClient is implemented by a Client declaring the scope it is granted when a request omits the
+// scope parameter.
+type DefaultScopeClient interface {
+	DefaultScope() []string
+}
+
+// PKCERequirer is implemented by a Client that declares whether it must use PKCE with the Authorization Code
+// Grant. Public clients must always use PKCE.
+type PKCERequirer interface {
+	RequirePKCE() bool
+}
+
+// TokenPolicyProvider is implemented by a Client that defines its own TokenPolicy.
+type TokenPolicyProvider interface {
+	TokenPolicy() v1.TokenPolicy
+}
+
+// MetadataProvider is implemented by a Client that describes itself to resource owners.
+type MetadataProvider interface {
+	Metadata() v1.ClientMetadata
+}
+
+// New creates a Server using the Authenticator.
+func New(a Authenticator) *v1.Server {
+	return v1.New(ToV1(a))
+}
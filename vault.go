@@ -0,0 +1,298 @@
+package goauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrVaultNotFound is returned when a secret does not exist in Vault.
+	ErrVaultNotFound = errors.New("vault: secret not found")
+)
+
+// VaultClient is a minimal client for the HashiCorp Vault HTTP API, reading and writing secrets in a KV
+// version 2 secrets engine. Add it to the Server using AddComponent to renew its token before it expires.
+type VaultClient struct {
+	// Address is the URL of the Vault server, such as https://vault.example.com:8200.
+	Address string
+	// Mount is the path of the KV version 2 secrets engine. If empty, "secret" is used.
+	Mount string
+	// HTTPClient is used for requests to Vault. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// RenewIncrement is the TTL requested when renewing the token. If zero, the token's own TTL is kept.
+	RenewIncrement time.Duration
+	// OnError is called when the token cannot be renewed.
+	OnError func(err error)
+	mtx     sync.RWMutex
+	token   string
+}
+
+// NewVaultClient returns a VaultClient authenticating with the token.
+func NewVaultClient(address, token string) *VaultClient {
+	return &VaultClient{
+		Address: address,
+		token:   token,
+	}
+}
+
+// SetToken replaces the token used to authenticate with Vault.
+func (v *VaultClient) SetToken(token string) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.token = token
+}
+
+func (v *VaultClient) mount() string {
+	if v.Mount != "" {
+		return strings.Trim(v.Mount, "/")
+	}
+	return "secret"
+}
+
+// do makes a request to the Vault API decoding the response into out if it is not nil.
+func (v *VaultClient) do(method, path string, body interface{}, out interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	r, err := http.NewRequest(method, strings.TrimRight(v.Address, "/")+"/v1/"+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	v.mtx.RLock()
+	r.Header.Set("X-Vault-Token", v.token)
+	v.mtx.RUnlock()
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	client := v.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrVaultNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("vault: %s %s returned status %d: %s", method, path, resp.StatusCode, strings.Join(e.Errors, ", "))
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Read returns the data of the latest version of the secret at the path.
+func (v *VaultClient) Read(path string) (map[string]string, error) {
+	var resp struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	err := v.do("GET", v.mount()+"/data/"+path, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data.Data, nil
+}
+
+// Write stores data as a new version of the secret at the path.
+func (v *VaultClient) Write(path string, data map[string]string) error {
+	return v.do("POST", v.mount()+"/data/"+path, map[string]interface{}{"data": data}, nil)
+}
+
+// Delete removes all versions of the secret at the path.
+func (v *VaultClient) Delete(path string) error {
+	err := v.do("DELETE", v.mount()+"/metadata/"+path, nil, nil)
+	if err == ErrVaultNotFound {
+		return nil
+	}
+	return err
+}
+
+// List returns the names of the secrets under the path.
+func (v *VaultClient) List(path string) ([]string, error) {
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := v.do("GET", v.mount()+"/metadata/"+path+"?list=true", nil, &resp)
+	if err == ErrVaultNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data.Keys, nil
+}
+
+// RenewToken renews the token returning its new TTL.
+func (v *VaultClient) RenewToken() (time.Duration, error) {
+	body := map[string]interface{}{}
+	if v.RenewIncrement > 0 {
+		body["increment"] = int64(v.RenewIncrement / time.Second)
+	}
+	var resp struct {
+		Auth struct {
+			LeaseDuration int64 `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	err := v.do("POST", "auth/token/renew-self", body, &resp)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(resp.Auth.LeaseDuration) * time.Second, nil
+}
+
+// Run satisfies the Component interface, renewing the token when half of its TTL has elapsed. Tokens
+// without a TTL are not renewed again. Failed renewals are retried after a minute.
+func (v *VaultClient) Run(ctx context.Context) error {
+	for {
+		wait := time.Minute
+		ttl, err := v.RenewToken()
+		if err != nil {
+			if v.OnError != nil {
+				v.OnError(err)
+			}
+		} else if ttl == 0 {
+			<-ctx.Done()
+			return nil
+		} else if ttl/2 > wait {
+			wait = ttl / 2
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// VaultKeyStore is a KeyStore that stores each SigningKey as a secret in Vault, so that private keys are
+// not held in application configuration or on disk.
+type VaultKeyStore struct {
+	Client *VaultClient
+	// Path is the path under which keys are stored. If empty, "goauth/keys" is used.
+	Path string
+}
+
+// NewVaultKeyStore returns a VaultKeyStore storing keys under the default path.
+func NewVaultKeyStore(client *VaultClient) *VaultKeyStore {
+	return &VaultKeyStore{Client: client}
+}
+
+func (v *VaultKeyStore) path(id string) string {
+	path := v.Path
+	if path == "" {
+		path = "goauth/keys"
+	}
+	if id == "" {
+		return strings.Trim(path, "/")
+	}
+	return strings.Trim(path, "/") + "/" + url.PathEscape(id)
+}
+
+// Keys returns all stored keys.
+func (v *VaultKeyStore) Keys() ([]SigningKey, error) {
+	ids, err := v.Client.List(v.path(""))
+	if err != nil {
+		return nil, err
+	}
+	var keys []SigningKey
+	for _, id := range ids {
+		if strings.HasSuffix(id, "/") {
+			continue
+		}
+		data, err := v.Client.Read(v.path(id))
+		if err == ErrVaultNotFound {
+			// The key was deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var key SigningKey
+		err = json.Unmarshal([]byte(data["key"]), &key)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// PutKey stores the key.
+func (v *VaultKeyStore) PutKey(key SigningKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return v.Client.Write(v.path(key.ID), map[string]string{"key": string(data)})
+}
+
+// DeleteKey removes the key with the given ID.
+func (v *VaultKeyStore) DeleteKey(id string) error {
+	return v.Client.Delete(v.path(id))
+}
+
+// VaultClientSecretResolver is a ClientSecretResolver reading the secrets of each client from Vault.
+type VaultClientSecretResolver struct {
+	Client *VaultClient
+	// Path is the path under which the secrets of each client are stored. If empty, "goauth/clients" is
+	// used.
+	Path string
+}
+
+// NewVaultClientSecretResolver returns a VaultClientSecretResolver reading secrets from the default path.
+func NewVaultClientSecretResolver(client *VaultClient) *VaultClientSecretResolver {
+	return &VaultClientSecretResolver{Client: client}
+}
+
+func (v *VaultClientSecretResolver) path(clientID string) string {
+	path := v.Path
+	if path == "" {
+		path = "goauth/clients"
+	}
+	return strings.Trim(path, "/") + "/" + url.PathEscape(clientID)
+}
+
+// ClientSecrets returns the secrets of the client. It returns ErrVaultNotFound if the client has none.
+func (v *VaultClientSecretResolver) ClientSecrets(clientID string) ([]ClientSecret, error) {
+	data, err := v.Client.Read(v.path(clientID))
+	if err != nil {
+		return nil, err
+	}
+	var secrets []ClientSecret
+	err = json.Unmarshal([]byte(data["secrets"]), &secrets)
+	return secrets, err
+}
+
+// PutClientSecrets replaces the secrets of the client, such as after RotateClientSecret.
+func (v *VaultClientSecretResolver) PutClientSecrets(clientID string, secrets []ClientSecret) error {
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	return v.Client.Write(v.path(clientID), map[string]string{"secrets": string(data)})
+}
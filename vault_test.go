@@ -0,0 +1,117 @@
+package goauth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testVault emulates the parts of the Vault API used by VaultClient and is intended for use only in
+// testing.
+type testVault struct {
+	mtx     sync.Mutex
+	secrets map[string]map[string]string
+	renewed int
+}
+
+func (t *testVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if r.Header.Get("X-Vault-Token") != "testtoken" {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "auth/token/renew-self":
+		t.renewed++
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"lease_duration": 3600}})
+	case strings.HasPrefix(path, "secret/data/") && r.Method == "GET":
+		data, ok := t.secrets[strings.TrimPrefix(path, "secret/data/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+	case strings.HasPrefix(path, "secret/data/") && r.Method == "POST":
+		var body struct {
+			Data map[string]string `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		t.secrets[strings.TrimPrefix(path, "secret/data/")] = body.Data
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(path, "secret/metadata/") && r.URL.Query().Get("list") == "true":
+		prefix := strings.TrimPrefix(path, "secret/metadata/") + "/"
+		var keys []string
+		for k := range t.secrets {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, strings.TrimPrefix(k, prefix))
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+	case strings.HasPrefix(path, "secret/metadata/") && r.Method == "DELETE":
+		delete(t.secrets, strings.TrimPrefix(path, "secret/metadata/"))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestVault(t *testing.T) {
+	vault := &testVault{secrets: make(map[string]map[string]string)}
+	ts := httptest.NewServer(vault)
+	defer ts.Close()
+	client := NewVaultClient(ts.URL, "testtoken")
+
+	// Signing keys can be rotated using the VaultKeyStore
+	rotator := NewKeyRotator(NewVaultKeyStore(client))
+	rotator.Algorithm = AlgorithmES256
+	rotator.Retain = 1
+	for i := 0; i < 3; i++ {
+		timeNow = func() time.Time { return time.Now().Add(time.Duration(i) * time.Hour) }
+		if _, err := rotator.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	timeNow = time.Now
+	keys, err := rotator.VerificationKeys()
+	if err != nil || len(keys) != 2 || keys[0].IsRetired() || !keys[1].IsRetired() {
+		t.Errorf("Test failed, unexpected keys %v %v", keys, err)
+	}
+
+	// Client secrets are resolved from Vault
+	DefaultPasswordHasher = BcryptHasher{Cost: 4}
+	defer func() { DefaultPasswordHasher = Argon2Hasher{} }()
+	resolver := NewVaultClientSecretResolver(client)
+	secret, secrets, err := RotateClientSecret(nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resolver.PutClientSecrets("testclientid", secrets); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := ResolveClientSecret(resolver, "testclientid", secret); !ok || err != nil {
+		t.Errorf("Test failed, expected the secret to be valid got %v", err)
+	}
+	if _, err := ResolveClientSecret(resolver, "unknown", secret); err != ErrVaultNotFound {
+		t.Errorf("Test failed, expected %v got %v", ErrVaultNotFound, err)
+	}
+
+	// The token is renewed
+	if ttl, err := client.RenewToken(); err != nil || ttl != time.Hour || vault.renewed != 1 {
+		t.Errorf("Test failed, got %v %v", ttl, err)
+	}
+	client.SetToken("invalid")
+	if _, err := client.RenewToken(); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Test failed, expected permission denied got %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultVerifierKeyRefreshInterval is the interval at which a VerifierKeyCache that does not set
+	// RefreshInterval revalidates its documents.
+	DefaultVerifierKeyRefreshInterval = 5 * time.Minute
+	// DefaultVerifierKeyMinRefreshInterval is the minimum interval between refreshes of a VerifierKeyCache
+	// caused by tokens signed with unknown keys, limiting the requests made for forged key IDs.
+	DefaultVerifierKeyMinRefreshInterval = 30 * time.Second
+	// ErrVerifierKeyNotFound is returned by VerifierKeyCache.Key if no key has the requested ID.
+	ErrVerifierKeyNotFound = errors.New("verification key not found")
+)
+
+// cachedDocument is a JSON document fetched by a VerifierKeyCache along with its ETag.
+type cachedDocument struct {
+	body    []byte
+	etag    string
+	fetched time.Time
+}
+
+// VerifierKeyCache caches the JWKS and discovery documents of an authorization server for resource
+// servers verifying its tokens. Documents are revalidated using If-None-Match so that unchanged documents
+// are not transferred again. Add it to a Server using AddComponent, or call Run, to refresh the documents
+// in the background so that verification never waits for the authorization server.
+type VerifierKeyCache struct {
+	// JWKSURL is the URL of the JWKS endpoint. If empty, the jwks_uri of the discovery document is used.
+	JWKSURL string
+	// DiscoveryURL is the URL of the discovery document, such as
+	// https://auth.example.com/.well-known/openid-configuration. It is optional if JWKSURL is set.
+	DiscoveryURL string
+	// Client is used to make requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// RefreshInterval overrides DefaultVerifierKeyRefreshInterval if greater than zero.
+	RefreshInterval time.Duration
+	// MinRefreshInterval overrides DefaultVerifierKeyMinRefreshInterval if greater than zero.
+	MinRefreshInterval time.Duration
+	// OnError is called when a background refresh fails. The previously cached documents remain in use.
+	OnError   func(err error)
+	mtx       sync.RWMutex
+	refresh   sync.Mutex
+	jwks      cachedDocument
+	discovery cachedDocument
+	keys      JWKSet
+	metadata  map[string]interface{}
+}
+
+// NewVerifierKeyCache returns a VerifierKeyCache for the JWKS endpoint at the URL.
+func NewVerifierKeyCache(jwksURL string) *VerifierKeyCache {
+	return &VerifierKeyCache{JWKSURL: jwksURL}
+}
+
+func (c *VerifierKeyCache) refreshInterval() time.Duration {
+	if c.RefreshInterval > 0 {
+		return c.RefreshInterval
+	}
+	return DefaultVerifierKeyRefreshInterval
+}
+
+func (c *VerifierKeyCache) minRefreshInterval() time.Duration {
+	if c.MinRefreshInterval > 0 {
+		return c.MinRefreshInterval
+	}
+	return DefaultVerifierKeyMinRefreshInterval
+}
+
+// fetch makes a conditional request for the document at the URL, returning the cached document if it
+// has not been modified.
+func (c *VerifierKeyCache) fetch(ctx context.Context, url string, cached cachedDocument) (cachedDocument, error) {
+	r, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return cached, err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Accept", "application/json")
+	if cached.etag != "" {
+		r.Header.Set("If-None-Match", cached.etag)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return cached, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached.body != nil {
+		cached.fetched = timeNow()
+		return cached, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return cached, fmt.Errorf("GET %s returned status %d", url, resp.StatusCode)
+	}
+	var body json.RawMessage
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return cached, err
+	}
+	return cachedDocument{
+		body:    body,
+		etag:    resp.Header.Get("ETag"),
+		fetched: timeNow(),
+	}, nil
+}
+
+// Refresh revalidates the cached documents.
+func (c *VerifierKeyCache) Refresh(ctx context.Context) error {
+	c.refresh.Lock()
+	defer c.refresh.Unlock()
+	c.mtx.RLock()
+	jwks, discovery := c.jwks, c.discovery
+	c.mtx.RUnlock()
+	jwksURL := c.JWKSURL
+	var metadata map[string]interface{}
+	if c.DiscoveryURL != "" {
+		doc, err := c.fetch(ctx, c.DiscoveryURL, discovery)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(doc.body, &metadata)
+		if err != nil {
+			return err
+		}
+		discovery = doc
+		if jwksURL == "" {
+			jwksURL, _ = metadata["jwks_uri"].(string)
+		}
+	}
+	if jwksURL == "" {
+		return errors.New("no JWKS URL is configured or published in the discovery document")
+	}
+	doc, err := c.fetch(ctx, jwksURL, jwks)
+	if err != nil {
+		return err
+	}
+	var keys JWKSet
+	err = json.Unmarshal(doc.body, &keys)
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.jwks, c.keys = doc, keys
+	if metadata != nil {
+		c.discovery, c.metadata = discovery, metadata
+	}
+	return nil
+}
+
+// Keys returns the cached keys, fetching them if they have not yet been fetched.
+func (c *VerifierKeyCache) Keys(ctx context.Context) ([]JWK, error) {
+	c.mtx.RLock()
+	fetched := !c.jwks.fetched.IsZero()
+	keys := c.keys.Keys
+	c.mtx.RUnlock()
+	if fetched {
+		return keys, nil
+	}
+	err := c.Refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.keys.Keys, nil
+}
+
+// Key returns the key with the ID. If no cached key has the ID the keys are refreshed, at most once each
+// MinRefreshInterval, so that keys added by rotation are found without waiting for the next refresh.
+func (c *VerifierKeyCache) Key(ctx context.Context, keyID string) (JWK, error) {
+	keys, err := c.Keys(ctx)
+	if err != nil {
+		return JWK{}, err
+	}
+	if key, ok := findJWK(keys, keyID); ok {
+		return key, nil
+	}
+	c.mtx.RLock()
+	fetched := c.jwks.fetched
+	c.mtx.RUnlock()
+	if timeNow().Sub(fetched) < c.minRefreshInterval() {
+		return JWK{}, ErrVerifierKeyNotFound
+	}
+	err = c.Refresh(ctx)
+	if err != nil {
+		return JWK{}, err
+	}
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	if key, ok := findJWK(c.keys.Keys, keyID); ok {
+		return key, nil
+	}
+	return JWK{}, ErrVerifierKeyNotFound
+}
+
+// findJWK returns the key with the ID.
+func findJWK(keys []JWK, keyID string) (JWK, bool) {
+	for _, key := range keys {
+		if key.KeyID == keyID {
+			return key, true
+		}
+	}
+	return JWK{}, false
+}
+
+// Discovery returns the cached discovery document, fetching it if it has not yet been fetched.
+func (c *VerifierKeyCache) Discovery(ctx context.Context) (map[string]interface{}, error) {
+	c.mtx.RLock()
+	metadata := c.metadata
+	c.mtx.RUnlock()
+	if metadata != nil {
+		return metadata, nil
+	}
+	if c.DiscoveryURL == "" {
+		return nil, errors.New("no discovery URL is configured")
+	}
+	err := c.Refresh(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.metadata, nil
+}
+
+// Run satisfies the Component interface, refreshing the documents each RefreshInterval. Failed refreshes
+// are reported to OnError and retried after the MinRefreshInterval.
+func (c *VerifierKeyCache) Run(ctx context.Context) error {
+	for {
+		wait := c.refreshInterval()
+		err := c.Refresh(ctx)
+		if err != nil && ctx.Err() == nil {
+			if c.OnError != nil {
+				c.OnError(err)
+			}
+			wait = c.minRefreshInterval()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
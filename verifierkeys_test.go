@@ -0,0 +1,113 @@
+package goauth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestVerifierKeyCache(t *testing.T) {
+	key, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := key.JWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := JWKSet{Keys: []JWK{jwk}}
+	var requests, notModified int
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var doc interface{}
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			doc = map[string]interface{}{"issuer": ts.URL, "jwks_uri": ts.URL + JWKSEndpoint}
+		case JWKSEndpoint:
+			doc = set
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + r.URL.Path + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		json.NewEncoder(w).Encode(doc)
+	}))
+	defer ts.Close()
+
+	cache := &VerifierKeyCache{DiscoveryURL: ts.URL + "/.well-known/openid-configuration"}
+	ctx := context.Background()
+	got, err := cache.Key(ctx, key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, jwk) {
+		t.Errorf("Test failed, expected %v got %v", jwk, got)
+	}
+	metadata, err := cache.Discovery(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata["issuer"] != ts.URL || requests != 2 {
+		t.Errorf("Test failed, unexpected discovery %v after %d requests", metadata, requests)
+	}
+	public, err := got.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(public, key.Signer.Public()) {
+		t.Error("Test failed, expected the public key of the signing key")
+	}
+
+	// Unknown keys do not cause a refresh within the minimum refresh interval
+	_, err = cache.Key(ctx, "unknown")
+	if err != ErrVerifierKeyNotFound || requests != 2 {
+		t.Errorf("Test failed, expected ErrVerifierKeyNotFound without a request got %v after %d requests", err, requests)
+	}
+
+	// Refreshes revalidate the cached documents
+	err = cache.Refresh(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notModified != 2 {
+		t.Errorf("Test failed, expected 2 not modified responses got %d", notModified)
+	}
+	got, err = cache.Key(ctx, key.ID)
+	if err != nil || got.KeyID != key.ID {
+		t.Errorf("Test failed, expected the cached key after revalidation got %v %v", got, err)
+	}
+
+	// Keys added by rotation are fetched once the minimum refresh interval has elapsed
+	rotated, err := GenerateSigningKey(AlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedJWK, err := rotated.JWK()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set = JWKSet{Keys: []JWK{rotatedJWK, jwk}}
+	now := time.Now()
+	timeNow = func() time.Time { return now.Add(time.Minute) }
+	defer func() { timeNow = time.Now }()
+	ts.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	})
+	cache.DiscoveryURL = ""
+	cache.JWKSURL = ts.URL + JWKSEndpoint
+	got, err = cache.Key(ctx, rotated.ID)
+	if err != nil || got.KeyID != rotated.ID {
+		t.Errorf("Test failed, expected the rotated key got %v %v", got, err)
+	}
+}
@@ -0,0 +1,215 @@
+package goauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader carries the signature of a webhook request in the form t=<unix time>,v1=<hex>,
+	// where v1 is the HMAC-SHA256 of the time, a period and the request body keyed with the webhook secret.
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// WebhookEventHeader carries the EventType of a webhook request.
+	WebhookEventHeader = "X-Webhook-Event"
+)
+
+var (
+	// DefaultWebhookMaxRetries is the number of times delivery of an event is retried by a
+	// WebhookNotifier that does not set MaxRetries.
+	DefaultWebhookMaxRetries = 3
+	// DefaultWebhookBackoff is the delay before the first retry by a WebhookNotifier that does not set
+	// Backoff. The delay doubles with each retry.
+	DefaultWebhookBackoff = time.Second
+	// ErrInvalidWebhookSignature is returned by VerifyWebhookSignature if the signature does not match.
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+)
+
+// WebhookNotifier is an EventSink that POSTs each Event as JSON to a set of URLs. Requests are signed
+// using the WebhookSignatureHeader so that receivers can verify that they were sent by the Server.
+// Delivery is retried on network errors, 5xx and 429 responses.
+type WebhookNotifier struct {
+	// URLs receive every published event.
+	URLs []string
+	// Secret is the key used to sign requests.
+	Secret []byte
+	// Events restricts the events delivered to the listed types. If empty, all events are delivered.
+	Events []EventType
+	// Client is used to make requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// MaxRetries overrides DefaultWebhookMaxRetries if greater than zero.
+	MaxRetries int
+	// Backoff overrides DefaultWebhookBackoff if greater than zero.
+	Backoff time.Duration
+	// OnError is called when an event could not be delivered to a URL after all retries.
+	OnError func(url string, e Event, err error)
+	wg      sync.WaitGroup
+}
+
+// NewWebhookNotifier returns a WebhookNotifier signing requests with the secret and delivering events
+// to the urls.
+func NewWebhookNotifier(secret []byte, urls ...string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URLs:   urls,
+		Secret: secret,
+	}
+}
+
+// Publish satisfies the EventSink interface. Events are delivered in the background so that requests
+// are not delayed by slow receivers, use Wait to wait for pending deliveries.
+func (n *WebhookNotifier) Publish(ctx context.Context, e Event) error {
+	if !n.accepts(e.Type) {
+		return nil
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.Deliver(context.Background(), e)
+	}()
+	return nil
+}
+
+// Wait blocks until all events published so far have been delivered or have failed.
+func (n *WebhookNotifier) Wait() {
+	n.wg.Wait()
+}
+
+// Deliver sends the event to each of the URLs, retrying failed requests, and returns the last error
+// that occurred.
+func (n *WebhookNotifier) Deliver(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	var lastErr error
+	for _, url := range n.URLs {
+		err := n.deliver(ctx, url, e, body)
+		if err != nil {
+			lastErr = err
+			if n.OnError != nil {
+				n.OnError(url, e, err)
+			}
+		}
+	}
+	return lastErr
+}
+
+// deliver sends the body to the url, retrying with exponential backoff.
+func (n *WebhookNotifier) deliver(ctx context.Context, url string, e Event, body []byte) error {
+	retries := n.MaxRetries
+	if retries <= 0 {
+		retries = DefaultWebhookMaxRetries
+	}
+	backoff := n.Backoff
+	if backoff <= 0 {
+		backoff = DefaultWebhookBackoff
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = n.send(ctx, url, e, body)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff << uint(attempt)):
+		}
+	}
+}
+
+// send makes a single request, returning whether it should be retried if it failed.
+func (n *WebhookNotifier) send(ctx context.Context, url string, e Event, body []byte) (bool, error) {
+	r, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(WebhookEventHeader, string(e.Type))
+	r.Header.Set(WebhookSignatureHeader, SignWebhook(n.Secret, timeNow(), body))
+	client := n.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("webhook %s returned status %d", url, resp.StatusCode)
+	}
+	return false, nil
+}
+
+// accepts returns true if events of the type should be delivered.
+func (n *WebhookNotifier) accepts(t EventType) bool {
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, e := range n.Events {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// SignWebhook returns the value of the WebhookSignatureHeader for a request body sent at time t.
+func SignWebhook(secret []byte, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(webhookMAC(secret, ts, body))
+}
+
+// VerifyWebhookSignature checks the WebhookSignatureHeader of a request received from a WebhookNotifier.
+// Signatures created more than tolerance ago are rejected to prevent replay, a tolerance of zero disables
+// the check.
+func VerifyWebhookSignature(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			sig = kv[1]
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	mac, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, webhookMAC(secret, ts, body)) {
+		return ErrInvalidWebhookSignature
+	}
+	if tolerance > 0 && timeNow().Sub(time.Unix(unix, 0)) > tolerance {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// webhookMAC returns the HMAC-SHA256 of the timestamp and body.
+func webhookMAC(secret []byte, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
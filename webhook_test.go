@@ -0,0 +1,79 @@
+package goauth
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	secret := []byte("testsecret")
+	var attempts int32
+	received := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := VerifyWebhookSignature(secret, r.Header.Get(WebhookSignatureHeader), body, time.Minute); err != nil {
+			t.Errorf("Test failed, %v", err)
+		}
+		// Fail the first attempt to check that delivery is retried
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received <- r.Header.Get(WebhookEventHeader)
+	}))
+	defer ts.Close()
+
+	n := NewWebhookNotifier(secret, ts.URL)
+	n.Backoff = time.Millisecond
+	n.Events = []EventType{EventTokenIssued}
+	n.Publish(context.Background(), Event{Type: EventTokenRevoked})
+	n.Publish(context.Background(), Event{Type: EventTokenIssued})
+	n.Wait()
+	select {
+	case eventType := <-received:
+		if eventType != string(EventTokenIssued) {
+			t.Errorf("Test failed, expected %s got %s", EventTokenIssued, eventType)
+		}
+	default:
+		t.Fatal("Test failed, expected the event to be delivered")
+	}
+	if attempts != 2 {
+		t.Errorf("Test failed, expected 2 attempts got %d", attempts)
+	}
+
+	// Client errors are not retried
+	failed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer failed.Close()
+	var errored int
+	n = NewWebhookNotifier(secret, failed.URL)
+	n.OnError = func(url string, e Event, err error) { errored++ }
+	if err := n.Deliver(context.Background(), Event{Type: EventTokenIssued}); err == nil || errored != 1 {
+		t.Errorf("Test failed, expected an error got %v", err)
+	}
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	secret := []byte("testsecret")
+	body := []byte(`{"type":"token.issued"}`)
+	header := SignWebhook(secret, time.Now(), body)
+	if err := VerifyWebhookSignature(secret, header, body, time.Minute); err != nil {
+		t.Errorf("Test failed, %v", err)
+	}
+	if err := VerifyWebhookSignature([]byte("othersecret"), header, body, time.Minute); err != ErrInvalidWebhookSignature {
+		t.Errorf("Test failed, expected %v got %v", ErrInvalidWebhookSignature, err)
+	}
+	if err := VerifyWebhookSignature(secret, header, []byte(`{}`), time.Minute); err != ErrInvalidWebhookSignature {
+		t.Errorf("Test failed, expected %v got %v", ErrInvalidWebhookSignature, err)
+	}
+	old := SignWebhook(secret, time.Now().Add(-time.Hour), body)
+	if err := VerifyWebhookSignature(secret, old, body, time.Minute); err != ErrInvalidWebhookSignature {
+		t.Errorf("Test failed, expected %v got %v", ErrInvalidWebhookSignature, err)
+	}
+}